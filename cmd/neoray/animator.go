@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+)
+
+// Animator owns every animated value of the editor. Values are stepped once
+// per tick with the delta time, and the frames between the ticks interpolate
+// them with the frame time. Render on demand asks the animator whether it
+// needs to render additional frames.
+type Animator struct {
+	editor *EditorContext
+	tweens []*Tween
+}
+
+func NewAnimator(editor *EditorContext) *Animator {
+	return &Animator{editor: editor}
+}
+
+// Tween is an animated value. X and Y can be used separately, for example
+// the grids use X for the opacity and Y for the offset.
+type Tween struct {
+	editor *EditorContext
+	anim   common.Animation
+	value  common.Vector2[float32]
+	// Called after every step, tweens mark their own damage
+	onStep func()
+}
+
+// Creates a tween at the value. onStep is called every tick while the tween
+// is animating, it may be nil.
+func (animator *Animator) NewTween(value common.Vector2[float32], onStep func()) *Tween {
+	tween := &Tween{
+		editor: animator.editor,
+		value:  value,
+		onStep: onStep,
+	}
+	animator.tweens = append(animator.tweens, tween)
+	return tween
+}
+
+// Tweens of the destroyed objects must be removed
+func (animator *Animator) Remove(tween *Tween) {
+	for i, t := range animator.tweens {
+		if t == tween {
+			animator.tweens = append(animator.tweens[:i], animator.tweens[i+1:]...)
+			return
+		}
+	}
+}
+
+func (animator *Animator) Update(delta float32) {
+	EndBenchmark := bench.Begin()
+	for _, tween := range animator.tweens {
+		if !tween.anim.IsFinished() {
+			tween.value = tween.anim.Step(delta)
+			if tween.onStep != nil {
+				tween.onStep()
+			}
+		}
+	}
+	EndBenchmark("Animator.Update")
+}
+
+// Returns true if one of the tweens is animating
+func (animator *Animator) IsAnimating() bool {
+	for _, tween := range animator.tweens {
+		if !tween.anim.IsFinished() {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts animating the value. The value is set to the target immediately if
+// the lifetime is zero.
+func (tween *Tween) Animate(from, to common.Vector2[float32], lifeTime float32, easing common.Easing) {
+	tween.anim = common.NewEasedAnimation(from, to, lifeTime, easing)
+	tween.value = tween.anim.Step(0)
+}
+
+// Animates from the current value, interrupted animations continue smoothly
+func (tween *Tween) AnimateTo(to common.Vector2[float32], lifeTime float32, easing common.Easing) {
+	tween.Animate(tween.value, to, lifeTime, easing)
+}
+
+// Stops the animation and sets the value
+func (tween *Tween) Set(value common.Vector2[float32]) {
+	tween.anim = common.Animation{}
+	tween.value = value
+}
+
+func (tween *Tween) IsFinished() bool {
+	return tween.anim.IsFinished()
+}
+
+// Returns the current value, interpolated between the ticks
+func (tween *Tween) Value() common.Vector2[float32] {
+	if tween.editor.frameTime > 0 && !tween.anim.IsFinished() {
+		return tween.anim.Peek(tween.editor.frameTime)
+	}
+	return tween.value
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+)
+
+func TestAnimator(t *testing.T) {
+	animator := NewAnimator(new(EditorContext))
+	steps := 0
+	tween := animator.NewTween(common.Vec2[float32](0, 0), func() { steps++ })
+	if animator.IsAnimating() {
+		t.Fatal("New tween is animating")
+	}
+	tween.AnimateTo(common.Vec2[float32](1, 0), 1, common.EaseLinear)
+	animator.Update(0.5)
+	if got := tween.Value().X; got != 0.5 {
+		t.Errorf("Value after half of the lifetime = %v, want 0.5", got)
+	}
+	// Interrupted animation continues from the current value
+	tween.AnimateTo(common.Vec2[float32](0, 0), 1, common.EaseOutCubic)
+	if got := tween.Value().X; got != 0.5 {
+		t.Errorf("Value after restarting = %v, want 0.5", got)
+	}
+	animator.Update(2)
+	if got := tween.Value().X; got != 0 {
+		t.Errorf("Value after the lifetime = %v, want 0", got)
+	}
+	if animator.IsAnimating() {
+		t.Error("Finished tween is animating")
+	}
+	if steps != 2 {
+		t.Errorf("onStep called %d times, want 2", steps)
+	}
+	// Zero lifetime sets the value immediately
+	tween.AnimateTo(common.Vec2[float32](1, 0), 0, common.EaseLinear)
+	if got := tween.Value().X; got != 1 || !tween.IsFinished() {
+		t.Errorf("Value with zero lifetime = %v, want 1", got)
+	}
+	tween.AnimateTo(common.Vec2[float32](0, 0), 1, common.EaseLinear)
+	animator.Remove(tween)
+	if animator.IsAnimating() {
+		t.Error("Removed tween is animating")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"os"
@@ -25,26 +26,87 @@ Webpage %s
 
 Options:
 
---file <name>
-	Filename to open
---line <number>
-	Cursor goes to line <number>
+--file <name>, <name>...
+	Files to open, arguments without a dash are files too
+--open-mode tabs|vsplit|hsplit|buffers
+	Opens multiple files in tabs, splits or only as buffers
+	(default)
+--wait
+	Waits until the files are written or closed, implies --nofork.
+	Use with --singleinstance to edit in the running Neoray
+--cwd <dir>
+	Working directory of neovim, with --singleinstance only the
+	window opening the files uses it
+--session <file>
+	Loads the session saved with :NeoraySessionSave
+--line <number>, +<number>
+	Cursor goes to line <number>, + alone goes to the last line
 --column <number>
 	Cursor goes to column <number>
 --singleinstance, -si
 	Only accepts one instance of neoray and sends all flags to it
+--workspace
+	Scopes --singleinstance to the project root, which is found
+	by searching .git upwards from the file or working directory
+--root <dir>
+	Same as --workspace but uses <dir> as the project root
+--ipc-address <address>
+	Address of the --singleinstance server instead of localhost,
+	NEORAY_IPC_TOKEN must be set to listen on the network
+--ipc-cert <file>, --ipc-key <file>
+	Encrypts the --singleinstance connection with TLS, clients
+	need only the certificate
 --verbose
 	Prints verbose debug output to a file
+--cmd <command>
+	Executes <command> before loading any vimrc, after Neoray
+	defined its commands
+-u <vimrc>
+	Uses <vimrc> instead of the default init file
+-c <command>, +<command>
+	Executes <command> after the files are loaded and the cursor
+	is moved, in the given order. Works with --server too
 --nvim <path>
 	Relative or absolute path to nvim executable
+--env <name>=<value>, --env <name>
+	Sets or removes (without value) an environment variable of
+	nvim, can be given multiple times
 --server <address>
 	Connect to existing neovim instance
+--channel stdio
+	Attach to the neovim rpc channel given on stdin and stdout
+	by the program started Neoray, instead of starting neovim
 --multigrid
-	Enables multigrid support (experimental)
+	Enables multigrid support (experimental), same as --ext multigrid
+--ext <features>
+	Comma separated ui features neovim sends to Neoray instead of
+	drawing: multigrid, messages, popupmenu, tabline, cmdline. A
+	feature starting with - is disabled
+--double-buffer
+	Renders to a back buffer and swaps, use this if the window
+	flickers or tears. Transparency may not work in fullscreen
+--headless-frames <n>
+	Keeps the window hidden, renders <n> frames and writes them
+	as PNG files, then quits. Used for render tests
+--headless-dir <dir>
+	Directory of the frames written by --headless-frames
+--trace <file>
+	Writes the timeline of the update, event handling, draw and
+	render phases to <file>, open it in chrome://tracing
+--cpuprofile <file>
+	Writes pprof cpu profile to <file>
 --list-fonts <file>
 	Lists all fonts and writes them to <file>
 --nofork
 	Do not detach process from terminal
+--register-shell
+	Adds Neoray to the context menu of the explorer and
+	associates text files with Neoray (Windows only)
+--unregister-shell
+	Removes the changes made by --register-shell
+--install-desktop
+	Installs desktop entry and icons, Neoray is listed in
+	the open with menus of text files (Linux only)
 --version, -v
 	Prints only the version and quits
 --help, -h
@@ -54,30 +116,116 @@ All other flags forwards to neovim
 `
 
 type ParsedArgs struct {
-	file       string
+	files      []string
+	openMode   string
+	cwd        string
+	wait       bool
+	session    string
 	line       int
 	column     int
+	cmdsBefore []string // --cmd
+	vimrc      string   // -u
+	cmds       []string // -c and +{command}
 	singleInst bool
+	workspace  bool
+	root       string
+	ipcAddress string
+	ipcCert    string
+	ipcKey     string
 	execPath   string
+	env        []string // --env flags in order
 	address    string
-	multiGrid  bool
+	channel    string
+	ext        map[string]bool // --ext features without ext_ prefix
+	doubleBuf  bool
 	nofork     bool
-	others     []string
+	// Headless mode
+	headlessFrames int
+	headlessDir    string
+	// Profiling
+	traceFile   string
+	profileFile string
+	others      []string
+}
+
+// Ui features can be externalized with --ext, names are the ui options without
+// ext_ prefix. Neoray draws the multigrid windows, the messages, the cmdline
+// and the tabline, the popupmenu is only useful with plugins drawing it with
+// vim.ui_attach, neovim externalizes a feature only if all uis support it.
+var extFeatures = []string{"multigrid", "messages", "popupmenu", "tabline", "cmdline"}
+
+func isExtFeature(name string) bool {
+	for _, feature := range extFeatures {
+		if name == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses comma separated feature names, a name starting with - disables the
+// feature
+func parseExtFeatures(ext map[string]bool, list string) error {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		enable := !strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if !isExtFeature(name) {
+			return fmt.Errorf("unknown ui feature %q, valid ones are %s", name, strings.Join(extFeatures, ", "))
+		}
+		ext[name] = enable
+	}
+	return nil
+}
+
+// Neovim flags followed by a value, -S is followed by a value only if it
+// doesn't start with a dash.
+var nvimValueFlags = map[string]bool{
+	"-i":            true,
+	"-q":            true,
+	"-s":            true,
+	"-S":            true,
+	"-t":            true,
+	"-w":            true,
+	"-W":            true,
+	"--listen":      true,
+	"--startuptime": true,
 }
 
 // Last boolean value specifies if we should quit after parsing
 func ParseArgs(args []string) (ParsedArgs, error, bool) {
 	// Init defaults
 	options := ParsedArgs{
-		file:       "",
+		files:      []string{},
+		openMode:   "buffers",
+		cwd:        "",
+		wait:       false,
+		session:    "",
 		line:       -1,
 		column:     -1,
+		cmdsBefore: []string{},
+		vimrc:      "",
+		cmds:       []string{},
 		singleInst: false,
+		workspace:  false,
+		root:       "",
+		ipcAddress: "",
+		ipcCert:    "",
+		ipcKey:     "",
 		execPath:   "nvim",
+		env:        []string{},
 		address:    "",
-		multiGrid:  false,
+		channel:    "",
+		ext:        map[string]bool{},
+		doubleBuf:  false,
 		nofork:     false,
-		others:     []string{},
+		// Headless mode
+		headlessFrames: 0,
+		headlessDir:    ".",
+		// Profiling
+		traceFile:   "",
+		profileFile: "",
+		others:      []string{},
 	}
 	var err error
 	for i := 0; i < len(args); i++ {
@@ -86,7 +234,37 @@ func ParseArgs(args []string) (ParsedArgs, error, bool) {
 			if i+1 >= len(args) {
 				return options, errors.New("specify filename after --file"), false
 			}
-			options.file = args[i+1]
+			options.files = append(options.files, args[i+1])
+			i++
+		case "--open-mode":
+			if i+1 >= len(args) {
+				return options, errors.New("specify tabs, vsplit, hsplit or buffers after --open-mode"), false
+			}
+			switch args[i+1] {
+			case "tabs", "vsplit", "hsplit", "buffers":
+				options.openMode = args[i+1]
+			default:
+				return options, errors.New("invalid open mode"), false
+			}
+			i++
+		case "--wait":
+			options.wait = true
+			// Program started Neoray waits for the process
+			options.nofork = true
+		case "--cwd":
+			if i+1 >= len(args) {
+				return options, errors.New("specify directory after --cwd"), false
+			}
+			cwd, err := filepath.Abs(ExpandHome(args[i+1]))
+			if err == nil {
+				options.cwd = cwd
+			}
+			i++
+		case "--session":
+			if i+1 >= len(args) {
+				return options, errors.New("specify session file after --session"), false
+			}
+			options.session = args[i+1]
 			i++
 		case "--line":
 			if i+1 >= len(args) {
@@ -106,8 +284,53 @@ func ParseArgs(args []string) (ParsedArgs, error, bool) {
 				return options, errors.New("invalid column number"), false
 			}
 			i++
+		case "--cmd":
+			if i+1 >= len(args) {
+				return options, errors.New("specify command after --cmd"), false
+			}
+			options.cmdsBefore = append(options.cmdsBefore, args[i+1])
+			i++
+		case "-u":
+			if i+1 >= len(args) {
+				return options, errors.New("specify vimrc after -u"), false
+			}
+			options.vimrc = args[i+1]
+			i++
+		case "-c":
+			if i+1 >= len(args) {
+				return options, errors.New("specify command after -c"), false
+			}
+			options.cmds = append(options.cmds, args[i+1])
+			i++
 		case "--singleinstance", "-si":
 			options.singleInst = true
+		case "--workspace":
+			options.workspace = true
+		case "--root":
+			if i+1 >= len(args) {
+				return options, errors.New("specify project root after --root"), false
+			}
+			options.workspace = true
+			options.root = args[i+1]
+			i++
+		case "--ipc-address":
+			if i+1 >= len(args) {
+				return options, errors.New("specify address after --ipc-address"), false
+			}
+			options.ipcAddress = args[i+1]
+			i++
+		case "--ipc-cert":
+			if i+1 >= len(args) {
+				return options, errors.New("specify certificate file after --ipc-cert"), false
+			}
+			options.ipcCert = args[i+1]
+			i++
+		case "--ipc-key":
+			if i+1 >= len(args) {
+				return options, errors.New("specify key file after --ipc-key"), false
+			}
+			options.ipcKey = args[i+1]
+			i++
 		case "--verbose":
 			logger.InitFile("Neoray_verbose.log")
 		case "--nvim":
@@ -119,14 +342,71 @@ func ParseArgs(args []string) (ParsedArgs, error, bool) {
 				options.execPath = nvimPath
 			}
 			i++
+		case "--env":
+			if i+1 >= len(args) || args[i+1] == "" || args[i+1][0] == '=' {
+				return options, errors.New("specify variable name after --env"), false
+			}
+			options.env = append(options.env, args[i+1])
+			i++
 		case "--server":
 			if i+1 >= len(args) {
 				return options, errors.New("specify server address after --server"), false
 			}
 			options.address = args[i+1]
 			i++
+		case "--channel":
+			if i+1 >= len(args) {
+				return options, errors.New("specify channel after --channel"), false
+			}
+			if args[i+1] != "stdio" {
+				return options, errors.New("only stdio channel is supported"), false
+			}
+			options.channel = args[i+1]
+			// The program started Neoray talks with our stdin and stdout
+			options.nofork = true
+			i++
 		case "--multigrid":
-			options.multiGrid = true
+			options.ext["multigrid"] = true
+		case "--ext":
+			if i+1 >= len(args) {
+				return options, errors.New("specify features after --ext"), false
+			}
+			err = parseExtFeatures(options.ext, args[i+1])
+			if err != nil {
+				return options, err, false
+			}
+			i++
+		case "--double-buffer":
+			options.doubleBuf = true
+		case "--headless-frames":
+			if i+1 >= len(args) {
+				return options, errors.New("specify frame count after --headless-frames"), false
+			}
+			options.headlessFrames, err = strconv.Atoi(args[i+1])
+			if err != nil || options.headlessFrames <= 0 {
+				return options, errors.New("invalid frame count"), false
+			}
+			// Tests wait for the process
+			options.nofork = true
+			i++
+		case "--headless-dir":
+			if i+1 >= len(args) {
+				return options, errors.New("specify directory after --headless-dir"), false
+			}
+			options.headlessDir = args[i+1]
+			i++
+		case "--trace":
+			if i+1 >= len(args) {
+				return options, errors.New("specify file name after --trace"), false
+			}
+			options.traceFile = args[i+1]
+			i++
+		case "--cpuprofile":
+			if i+1 >= len(args) {
+				return options, errors.New("specify file name after --cpuprofile"), false
+			}
+			options.profileFile = args[i+1]
+			i++
 		case "--list-fonts":
 			if i+1 >= len(args) {
 				return options, errors.New("specify file name after --list-fonts"), false
@@ -136,6 +416,24 @@ func ParseArgs(args []string) (ParsedArgs, error, bool) {
 			return options, nil, true
 		case "--nofork":
 			options.nofork = true
+		case "--register-shell":
+			err := RegisterShell()
+			if err == nil {
+				PrintMessage("Shell integration", "Neoray is registered to the shell.")
+			}
+			return options, err, true
+		case "--unregister-shell":
+			err := UnregisterShell()
+			if err == nil {
+				PrintMessage("Shell integration", "Neoray is unregistered from the shell.")
+			}
+			return options, err, true
+		case "--install-desktop":
+			err := InstallDesktop()
+			if err == nil {
+				PrintMessage("Desktop integration", "Neoray desktop entry is installed.")
+			}
+			return options, err, true
 		case "--version", "-v":
 			PrintVersion()
 			return options, nil, true
@@ -143,7 +441,35 @@ func ParseArgs(args []string) (ParsedArgs, error, bool) {
 			PrintHelp()
 			return options, nil, true
 		default:
+			if strings.HasPrefix(args[i], "+") {
+				// +{number}, + or +{command}
+				if line, err := strconv.Atoi(args[i][1:]); err == nil {
+					options.line = line
+				} else if args[i] == "+" {
+					options.cmds = append(options.cmds, "$")
+				} else {
+					options.cmds = append(options.cmds, args[i][1:])
+				}
+				break
+			}
+			if args[i] == "--" {
+				// Rest of the arguments are files
+				options.files = append(options.files, args[i+1:]...)
+				i = len(args)
+				break
+			}
+			if !strings.HasPrefix(args[i], "-") {
+				options.files = append(options.files, args[i])
+				break
+			}
 			options.others = append(options.others, args[i])
+			// Values of the neovim flags are not files
+			if nvimValueFlags[args[i]] && i+1 < len(args) {
+				if args[i] != "-S" || !strings.HasPrefix(args[i+1], "-") {
+					options.others = append(options.others, args[i+1])
+					i++
+				}
+			}
 		}
 	}
 	return options, nil, options.Fork()
@@ -164,6 +490,11 @@ func PrintHelp() {
 	dialog.Message(msg).Title("Help").Info()
 }
 
+func PrintMessage(title, msg string) {
+	fmt.Println(msg)
+	dialog.Message("%s", msg).Title(title).Info()
+}
+
 func ListFonts(fileName string) {
 	fontList := fontfinder.List()
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
@@ -185,6 +516,21 @@ func ListFonts(fileName string) {
 	logger.Log(logger.TRACE, "Font list written to", fileName)
 }
 
+// Returns the arguments of the embedded neovim. Neovim runs --cmd commands and
+// the vimrc after the ui attached, so Neoray's commands are always defined
+// before them. -c commands are not given to neovim, Neoray runs them itself
+// after the startup, see ProcessAfter.
+func (options ParsedArgs) NvimArgs() []string {
+	args := []string{"--embed"}
+	if options.vimrc != "" {
+		args = append(args, "-u", options.vimrc)
+	}
+	for _, cmd := range options.cmdsBefore {
+		args = append(args, "--cmd", cmd)
+	}
+	return append(args, options.others...)
+}
+
 // detach from terminal.
 func (options ParsedArgs) Fork() bool {
 	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
@@ -210,19 +556,188 @@ func (options ParsedArgs) Fork() bool {
 	return false
 }
 
+// Returns the environment of the neovim started by Neoray. Neoray's own
+// variables and VIMRUNTIME, which is usually left by another neovim version and
+// breaks the runtime files, are removed. COLORTERM and NVIM_GUI are set for
+// plugins detecting the ui. Overrides are the --env flags, NAME=VALUE sets and
+// NAME removes a variable.
+func ChildEnv(environ, overrides []string) []string {
+	vars := make(map[string]string)
+	order := []string{}
+	set := func(name, value string) {
+		if _, ok := vars[name]; !ok {
+			order = append(order, name)
+		}
+		vars[name] = value
+	}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		set(name, value)
+	}
+	delete(vars, strings.ToUpper(NAME)+"_NOFORK")
+	delete(vars, strings.ToUpper(NAME)+"_IPC_TOKEN")
+	delete(vars, "VIMRUNTIME")
+	if _, ok := vars["COLORTERM"]; !ok {
+		set("COLORTERM", "truecolor")
+	}
+	set("NVIM_GUI", strings.ToLower(NAME))
+	for _, kv := range overrides {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok {
+			set(name, value)
+		} else {
+			delete(vars, name)
+		}
+	}
+	env := make([]string, 0, len(vars))
+	for _, name := range order {
+		if value, ok := vars[name]; ok {
+			env = append(env, name+"="+value)
+			// Names may be added again after removed
+			delete(vars, name)
+		}
+	}
+	return env
+}
+
+// Offers to run neovim in the terminal with the same arguments when the window
+// can't be created, like when there is no display. Only possible when Neoray
+// is not detached from the terminal. Quits after neovim exits if the user
+// accepts, otherwise returns.
+func (options ParsedArgs) FailoverToTerminal(reason ...any) {
+	if options.channel != "" || !options.nofork && (runtime.GOOS == "linux" || runtime.GOOS == "darwin") {
+		return
+	}
+	for _, file := range []*os.File{os.Stdin, os.Stdout} {
+		info, err := file.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, append([]any{"Neoray can't create its window:"}, reason...)...)
+	fmt.Fprint(os.Stderr, "Start nvim in this terminal instead? [Y/n] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "" && answer != "y" && answer != "yes" {
+		return
+	}
+	args := []string{}
+	if options.address != "" {
+		// Terminal ui of the neovim can connect too
+		args = append(args, "--remote-ui", "--server", options.address)
+	}
+	if options.vimrc != "" {
+		args = append(args, "-u", options.vimrc)
+	}
+	for _, cmd := range options.cmdsBefore {
+		args = append(args, "--cmd", cmd)
+	}
+	if options.line != -1 {
+		args = append(args, fmt.Sprintf("+%d", options.line))
+	}
+	switch options.openMode {
+	case "tabs":
+		args = append(args, "-p")
+	case "vsplit":
+		args = append(args, "-O")
+	case "hsplit":
+		args = append(args, "-o")
+	}
+	args = append(args, options.others...)
+	if len(options.files) > 0 {
+		args = append(args, "--")
+		args = append(args, options.files...)
+	}
+	for _, cmd := range options.cmds {
+		args = append(args, "-c", cmd)
+	}
+	cmd := exec.Command(options.execPath, args...)
+	cmd.Dir = options.cwd
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else {
+			logger.Log(logger.ERROR, "Failed to start neovim:", err)
+			code = 1
+		}
+	}
+	logger.Shutdown()
+	os.Exit(code)
+}
+
+// Replaces the leading ~/ with the home directory, desktop shortcuts and
+// options are not expanded by a shell.
+func ExpandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// Returns the single instance connection settings. Token is read from the
+// environment, arguments are visible to other users in the process list.
+func (options ParsedArgs) IpcConfig() IpcConfig {
+	return IpcConfig{
+		address:  options.ipcAddress,
+		token:    os.Getenv(strings.ToUpper(NAME) + "_IPC_TOKEN"),
+		certFile: options.ipcCert,
+		keyFile:  options.ipcKey,
+	}
+}
+
+// Returns the project root if single instance is scoped to workspaces,
+// otherwise empty string.
+func (options ParsedArgs) ProjectRoot() string {
+	if !options.workspace {
+		return ""
+	}
+	if options.root != "" {
+		root, err := filepath.Abs(options.root)
+		if err == nil {
+			return root
+		}
+		return options.root
+	}
+	if len(options.files) > 0 {
+		return FindProjectRoot(filepath.Dir(options.files[0]))
+	}
+	return FindProjectRoot(".")
+}
+
 // Call this before starting neovim.
 func (options ParsedArgs) ProcessBefore() bool {
 	if options.singleInst {
 		// First we will check only once because sending and
 		// waiting http requests will make neoray opens slower.
-		client, err := CreateClient()
+		client, err := CreateClient(options.ProjectRoot(), options.IpcConfig())
 		if err != nil {
 			logger.Log(logger.DEBUG, "No instance found or ipc client creation failed:", err)
 			return false
 		}
 		defer client.Close()
-		if options.file != "" {
-			fullPath, err := filepath.Abs(options.file)
+		if options.wait && !client.Supports(IPC_MSG_TYPE_WAIT_FILE) {
+			logger.Log(logger.WARN, "Running Neoray doesn't support --wait, starting a new one")
+			return false
+		}
+		// Sent first, files are opened in the same window
+		if options.cwd != "" {
+			if !client.Supports(IPC_MSG_TYPE_SET_CWD) {
+				logger.Log(logger.WARN, "Running Neoray doesn't support --cwd, ignored")
+			} else if !client.Call(IPC_MSG_TYPE_SET_CWD, options.cwd) {
+				return false
+			}
+		}
+		for _, file := range options.files {
+			fullPath, err := filepath.Abs(file)
 			if err == nil {
 				if !client.Call(IPC_MSG_TYPE_OPEN_FILE, fullPath) {
 					return false
@@ -239,6 +754,22 @@ func (options ParsedArgs) ProcessBefore() bool {
 				return false
 			}
 		}
+		if options.wait {
+			for _, file := range options.files {
+				fullPath, err := filepath.Abs(file)
+				if err != nil {
+					continue
+				}
+				logger.Log(logger.TRACE, "Waiting for", fullPath)
+				if !client.Call(IPC_MSG_TYPE_WAIT_FILE, fullPath) {
+					// Files are already sent, starting a new instance
+					// opens them again
+					logger.Log(logger.ERROR, "Neoray closed before the file is done:", fullPath)
+					logger.Shutdown()
+					os.Exit(1)
+				}
+			}
+		}
 		return true
 	}
 	return false
@@ -247,7 +778,7 @@ func (options ParsedArgs) ProcessBefore() bool {
 // Call this after connected neovim as ui.
 func (options ParsedArgs) ProcessAfter() {
 	if options.singleInst {
-		server, err := CreateServer()
+		server, err := CreateServer(options.ProjectRoot(), options.IpcConfig())
 		if err != nil {
 			logger.Log(logger.ERROR, "Failed to create ipc server:", err)
 		} else {
@@ -255,13 +786,33 @@ func (options ParsedArgs) ProcessAfter() {
 			logger.Log(logger.TRACE, "Ipc server created")
 		}
 	}
-	if options.file != "" {
-		Editor.nvim.EditFile(options.file)
-	}
-	if options.line != -1 {
-		Editor.nvim.MoveCursor(options.line, 0)
-	}
-	if options.column != -1 {
-		Editor.nvim.MoveCursor(0, options.column)
+	if Editor.nvim.attached && (options.vimrc != "" || len(options.cmdsBefore) > 0) {
+		logger.Log(logger.WARN, "-u and --cmd are ignored, neovim is already started")
 	}
+	// Requests are sent one by one from the same goroutine, otherwise they
+	// may reach neovim in any order. User commands run last.
+	go func() {
+		proc := Editor.nvim
+		if options.session != "" {
+			escaped, ok := proc.EscapeFileName(options.session)
+			if ok {
+				proc.Command("source %s", escaped)
+			}
+		}
+		if len(options.files) > 0 {
+			proc.OpenFiles(options.files, options.openMode)
+		}
+		if options.line != -1 {
+			proc.handle.Call("cursor", nil, options.line, 0)
+		}
+		if options.column != -1 {
+			proc.handle.Call("cursor", nil, 0, options.column)
+		}
+		if options.cwd != "" {
+			proc.ChangeDir(options.cwd, false)
+		}
+		for _, cmd := range options.cmds {
+			proc.Command("%s", cmd)
+		}
+	}()
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChildEnv(t *testing.T) {
+	environ := []string{
+		"HOME=/home/user",
+		"VIMRUNTIME=/usr/share/nvim/runtime",
+		"NEORAY_NOFORK=true",
+		"LANG=en_US.UTF-8",
+		"EMPTY=",
+	}
+	overrides := []string{
+		"LANG=C",
+		"HOME",
+		"FOO=a=b",
+		"NVIM_GUI",
+	}
+	want := []string{
+		"LANG=C",
+		"EMPTY=",
+		"COLORTERM=truecolor",
+		"FOO=a=b",
+	}
+	got := ChildEnv(environ, overrides)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChildEnv() = %v, want %v", got, want)
+	}
+	// User's COLORTERM is kept
+	got = ChildEnv([]string{"COLORTERM=24bit"}, nil)
+	want = []string{"COLORTERM=24bit", "NVIM_GUI=neoray"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChildEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestParseArgs_startupCommands(t *testing.T) {
+	args := []string{"--nofork", "--cmd", "let a = 1", "-u", "NONE", "+10", "-c", "echo 1", "+", "+/foo", "-n", "file.txt"}
+	options, err, quit := ParseArgs(args)
+	if err != nil || quit {
+		t.Fatalf("ParseArgs() failed: %v %v", err, quit)
+	}
+	if options.line != 10 {
+		t.Errorf("line = %d, want 10", options.line)
+	}
+	wantCmds := []string{"echo 1", "$", "/foo"}
+	if !reflect.DeepEqual(options.cmds, wantCmds) {
+		t.Errorf("cmds = %q, want %q", options.cmds, wantCmds)
+	}
+	wantArgs := []string{"--embed", "-u", "NONE", "--cmd", "let a = 1", "-n"}
+	if got := options.NvimArgs(); !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("NvimArgs() = %q, want %q", got, wantArgs)
+	}
+	if _, err, _ := ParseArgs([]string{"-c"}); err == nil {
+		t.Error("-c without command must fail")
+	}
+}
+
+func TestParseArgs_files(t *testing.T) {
+	args := []string{"--nofork", "a.go", "--file", "b.go", "-S", "s.vim", "-S", "-n", "--open-mode", "tabs", "c.go", "--", "-d.go"}
+	options, err, _ := ParseArgs(args)
+	if err != nil {
+		t.Fatalf("ParseArgs() failed: %v", err)
+	}
+	wantFiles := []string{"a.go", "b.go", "c.go", "-d.go"}
+	if !reflect.DeepEqual(options.files, wantFiles) {
+		t.Errorf("files = %q, want %q", options.files, wantFiles)
+	}
+	wantOthers := []string{"-S", "s.vim", "-S", "-n"}
+	if !reflect.DeepEqual(options.others, wantOthers) {
+		t.Errorf("others = %q, want %q", options.others, wantOthers)
+	}
+	if options.openMode != "tabs" {
+		t.Errorf("openMode = %q, want tabs", options.openMode)
+	}
+	if _, err, _ := ParseArgs([]string{"--open-mode", "windows"}); err == nil {
+		t.Error("Invalid open mode must fail")
+	}
+}
+
+func TestParseArgs_ext(t *testing.T) {
+	options, err, _ := ParseArgs([]string{"--nofork", "--multigrid", "--ext", "messages, cmdline", "--ext", "-multigrid"})
+	if err != nil {
+		t.Fatalf("ParseArgs() failed: %v", err)
+	}
+	want := map[string]bool{"multigrid": false, "messages": true, "cmdline": true}
+	if !reflect.DeepEqual(options.ext, want) {
+		t.Errorf("ext = %v, want %v", options.ext, want)
+	}
+	if _, err, _ := ParseArgs([]string{"--ext", "wildmenu"}); err == nil {
+		t.Error("Unknown feature must fail")
+	}
+}
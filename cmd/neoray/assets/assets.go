@@ -15,6 +15,8 @@ var (
 	NeovimIconData32x32 []byte
 	//go:embed icons/neovim-48.png
 	NeovimIconData48x48 []byte
+	//go:embed icons/neovim-256.png
+	NeovimIconData256x256 []byte
 
     // Fonts
     // The regular one is completely packed with nerd fonts.
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/sqweek/dialog"
+)
+
+// Autosaved sessions older than this multiple of the interval belong to
+// crashed instances even if the process id is reused.
+const AUTOSAVE_STALE_FACTOR = 3
+
+// Lightweight session, unlike the sessions created with :mksession this only
+// contains the listed buffers, working directory and the window state.
+type AutosaveSession struct {
+	Pid     int      `json:"pid"`
+	Cwd     string   `json:"cwd"`
+	Current string   `json:"current"`
+	Buffers []string `json:"buffers"`
+	Window  string   `json:"window"` // arguments of NeorayRestoreWindow
+}
+
+// Autosave periodically saves the session of this instance to the cache
+// directory and removes it when Neoray closes normally. A session file left
+// from an instance which is not running means it crashed, and the user is
+// asked to restore it on the next launch.
+type Autosave struct {
+	dir      string
+	lastSave time.Time
+	checked  bool
+	closed   bool
+	busy     sync.Mutex // locked while collecting the session from neovim
+	mutex    sync.Mutex // locked while writing or removing the file
+}
+
+func NewAutosave() *Autosave {
+	autosave := new(Autosave)
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to find cache directory, autosave disabled:", err)
+		return autosave
+	}
+	autosave.dir = filepath.Join(dir, "neoray", "autosave")
+	autosave.lastSave = time.Now()
+	return autosave
+}
+
+func (autosave *Autosave) path(pid int) string {
+	return filepath.Join(autosave.dir, fmt.Sprintf("session-%d.json", pid))
+}
+
+func (autosave *Autosave) interval() time.Duration {
+	return time.Duration(Editor.options.sessionAutosave) * time.Second
+}
+
+// Returns true if a process with the pid is running
+func isProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess fails on windows if the process doesn't exist
+		return true
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+func (autosave *Autosave) Update() {
+	if autosave.dir == "" || Editor.state < EditorWindowShown || Editor.options.sessionAutosave <= 0 || Editor.headless.IsEnabled() {
+		return
+	}
+	if !autosave.checked {
+		autosave.checked = true
+		autosave.offerRestore()
+	}
+	if time.Since(autosave.lastSave) >= autosave.interval() {
+		autosave.lastSave = time.Now()
+		// Window state must be taken in the main thread
+		window := windowSessionState()
+		go autosave.save(window)
+	}
+}
+
+func (autosave *Autosave) save(window string) {
+	// Skip if the last one is not finished, neovim may be blocked
+	if !autosave.busy.TryLock() {
+		return
+	}
+	defer autosave.busy.Unlock()
+	session := AutosaveSession{
+		Pid:     os.Getpid(),
+		Cwd:     Editor.nvim.WorkingDirectory(),
+		Current: Editor.nvim.CurrentBufferName(),
+		Buffers: Editor.nvim.ListedBuffers(),
+		Window:  window,
+	}
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	if autosave.closed {
+		return
+	}
+	data, err := json.Marshal(session)
+	if err == nil {
+		err = os.MkdirAll(autosave.dir, 0755)
+	}
+	if err == nil {
+		// Write to a temporary file first, crash may happen while writing
+		path := autosave.path(session.Pid)
+		err = os.WriteFile(path+".tmp", data, 0644)
+		if err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to autosave session:", err)
+		return
+	}
+	logger.Log(logger.DEBUG, "Session autosaved")
+}
+
+// Finds the sessions of the crashed instances, asks the user to restore the
+// latest one and removes all of them.
+func (autosave *Autosave) offerRestore() {
+	entries, err := os.ReadDir(autosave.dir)
+	if err != nil {
+		return
+	}
+	type crashed struct {
+		path    string
+		modTime time.Time
+	}
+	sessions := []crashed{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "session-") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		var pid int
+		_, err = fmt.Sscanf(entry.Name(), "session-%d.json", &pid)
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		stale := time.Since(info.ModTime()) > AUTOSAVE_STALE_FACTOR*autosave.interval()
+		if stale || !isProcessAlive(pid) {
+			sessions = append(sessions, crashed{path: filepath.Join(autosave.dir, entry.Name()), modTime: info.ModTime()})
+		}
+	}
+	if len(sessions) == 0 {
+		return
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].modTime.After(sessions[j].modTime)
+	})
+	data, err := os.ReadFile(sessions[0].path)
+	for _, s := range sessions {
+		os.Remove(s.path)
+	}
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to read autosaved session:", err)
+		return
+	}
+	var session AutosaveSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		logger.Log(logger.WARN, "Autosaved session is corrupted:", err)
+		return
+	}
+	logger.Log(logger.TRACE, "Found autosaved session of a crashed instance")
+	if !dialog.Message("Neoray didn't close properly last time.\nRestore previous session?").Title("Restore Session").YesNo() {
+		Editor.window.Raise()
+		return
+	}
+	Editor.window.Raise()
+	restoreWindowSession(strings.Fields(session.Window))
+	Editor.nvim.RestoreBuffers(session.Cwd, session.Current, session.Buffers)
+}
+
+// Removes the session of this instance, call when closing normally.
+func (autosave *Autosave) Remove() {
+	if autosave.dir == "" {
+		return
+	}
+	autosave.mutex.Lock()
+	defer autosave.mutex.Unlock()
+	autosave.closed = true
+	os.Remove(autosave.path(os.Getpid()))
+}
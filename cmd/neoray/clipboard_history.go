@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Maximum number of visible entries in the picker
+const CLIPBOARD_HISTORY_MAX_ITEMS = 12
+
+// ClipboardHistory keeps the last texts copied, cut and pasted with Neoray,
+// newest first. It is disabled unless the ClipboardHistory option sets the
+// number of the entries. The picker pastes an older entry, it is also
+// available to neovim with NeorayClipboardHistory().
+type ClipboardHistory struct {
+	pos        common.Vector2[int]
+	hidden     bool
+	rows, cols int
+	entries    []string
+	selected   int // index of the selected entry
+	renderer   *GridRenderer
+}
+
+func NewClipboardHistory() *ClipboardHistory {
+	history := new(ClipboardHistory)
+	history.hidden = true
+	history.rows = 1
+	history.cols = 1
+	var err error
+	history.renderer, err = NewGridRenderer(Editor, history.rows, history.cols, nil, DEFAULT_FONT_SIZE, history.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create clipboard history renderer")
+	}
+	return history
+}
+
+// Sets the system clipboard and adds the text to the history
+func SetClipboard(text string) {
+	glfw.SetClipboardString(text)
+	Editor.clipboardHistory.Add(text)
+}
+
+// Moves the text to the top if it is already in the history
+func (history *ClipboardHistory) Add(text string) {
+	if text == "" || Editor.options.clipboardHistory <= 0 {
+		return
+	}
+	for i, entry := range history.entries {
+		if entry == text {
+			history.entries = append(history.entries[:i], history.entries[i+1:]...)
+			break
+		}
+	}
+	history.entries = append([]string{text}, history.entries...)
+	history.Trim()
+}
+
+// Removes the oldest entries exceeding the ClipboardHistory option
+func (history *ClipboardHistory) Trim() {
+	limit := common.Max(Editor.options.clipboardHistory, 0)
+	if len(history.entries) > limit {
+		history.entries = history.entries[:limit]
+	}
+	// Picker shows the entries without checking
+	if len(history.entries) < history.rows {
+		history.Hide()
+	}
+}
+
+// Returns a copy of the entries, newest first
+func (history *ClipboardHistory) Entries() []string {
+	return append([]string{}, history.entries...)
+}
+
+// Pastes the entry and moves it to the top, returns false if the index is
+// out of range.
+func (history *ClipboardHistory) Paste(index int) bool {
+	if index < 0 || index >= len(history.entries) {
+		return false
+	}
+	text := history.entries[index]
+	SetClipboard(text)
+	PasteText(text)
+	return true
+}
+
+// Entries are shown in a single line, the first line with the number of the
+// others
+func clipboardEntryLabel(text string, width int) string {
+	lines := strings.Split(strings.TrimRight(text, "\r\n"), "\n")
+	suffix := ""
+	if len(lines) > 1 {
+		suffix = fmt.Sprintf(" (+%d lines)", len(lines)-1)
+	}
+	label := previewPasteLine(strings.TrimLeft(lines[0], " \t"), common.Max(width-len(suffix), 1))
+	return label + suffix
+}
+
+func (history *ClipboardHistory) SetFontKit(kit *fontkit.FontKit) {
+	history.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (history *ClipboardHistory) SetFontSize(size float64) {
+	history.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (history *ClipboardHistory) IsVisible() bool {
+	return !history.hidden
+}
+
+func (history *ClipboardHistory) Show() {
+	if Editor.options.clipboardHistory <= 0 {
+		Editor.nvim.EchoError("Clipboard history is disabled, set the %s option", OPTION_CLIPBOARD_HISTORY)
+		return
+	}
+	if len(history.entries) == 0 {
+		Editor.nvim.EchoError("Clipboard history is empty")
+		return
+	}
+	history.hidden = false
+	history.selected = 0
+	// Width is the most of the window but not too wide
+	cellSize := history.renderer.CellSize()
+	windowCols := Editor.ScreenSize().Width() / cellSize.Width()
+	history.cols = common.Clamp(windowCols-4, common.Min(20, windowCols), 80)
+	history.rows = common.Min(len(history.entries), CLIPBOARD_HISTORY_MAX_ITEMS)
+	history.renderer.Resize(history.rows, history.cols)
+	history.pos = common.Vector2[int]{
+		X: common.Max((Editor.ScreenSize().Width()-history.cols*cellSize.Width())/2, 0),
+		Y: Editor.ScreenSize().Height() / 8,
+	}
+	history.renderer.SetPos(history.pos)
+	Editor.MarkDraw()
+}
+
+func (history *ClipboardHistory) Hide() {
+	if !history.hidden {
+		history.hidden = true
+		Editor.MarkRender()
+	}
+}
+
+func (history *ClipboardHistory) choose(index int) {
+	history.Hide()
+	history.Paste(index)
+}
+
+func (history *ClipboardHistory) moveSelection(v int) {
+	if history.rows == 0 {
+		return
+	}
+	history.selected = (history.selected + v + history.rows) % history.rows
+	Editor.MarkDraw()
+}
+
+// Call this function instead of sending keys to neovim when it is visible.
+func (history *ClipboardHistory) KeyInput(keycode string) {
+	switch keycode {
+	case "<ESC>", "<C-c>", "q":
+		history.Hide()
+	case "<CR>", "<kEnter>":
+		history.choose(history.selected)
+	case "<Up>", "k", "<C-p>", "<S-Tab>":
+		history.moveSelection(-1)
+	case "<Down>", "j", "<C-n>", "<Tab>":
+		history.moveSelection(1)
+	default:
+		// Numbers paste the entry directly
+		if len(keycode) == 1 && keycode[0] >= '1' && keycode[0] <= '9' {
+			index := int(keycode[0] - '1')
+			if index < history.rows {
+				history.choose(index)
+			}
+		}
+	}
+}
+
+func (history *ClipboardHistory) Draw() {
+	if history.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	normal := WidgetAttribute("Pmenu")
+	selected := WidgetAttribute("PmenuSel")
+	selected.bold = true
+	for i := 0; i < history.rows; i++ {
+		attrib := normal
+		if i == history.selected {
+			attrib = selected
+		}
+		number := " "
+		if i < 9 {
+			number = fmt.Sprint(i + 1)
+		}
+		text := fmt.Sprintf(" %s %s", number, clipboardEntryLabel(history.entries[i], history.cols-4))
+		history.renderer.DrawText(i, 0, []rune(text), attrib)
+	}
+	EndBenchmark("ClipboardHistory.Draw")
+}
+
+func (history *ClipboardHistory) Render() {
+	if history.hidden {
+		return
+	}
+	history.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns true if the position is on the picker and the index of the entry
+// under the position.
+func (history *ClipboardHistory) IsIntersecting(pos common.Vector2[int]) (bool, int) {
+	row, _, ok := history.renderer.CellAt(pos)
+	if !ok {
+		return false, -1
+	}
+	return true, row
+}
+
+// Call this function when mouse moved.
+func (history *ClipboardHistory) MouseMove(pos common.Vector2[int]) {
+	if history.hidden {
+		return
+	}
+	ok, index := history.IsIntersecting(pos)
+	if ok && index != history.selected {
+		history.selected = index
+		Editor.MarkDraw()
+	}
+}
+
+// Call this function when mouse clicked. Returns true if the click is
+// handled and shouldn't be sent to neovim.
+func (history *ClipboardHistory) MouseClick(pos common.Vector2[int]) bool {
+	if history.hidden {
+		return false
+	}
+	ok, index := history.IsIntersecting(pos)
+	if !ok {
+		history.Hide()
+	} else {
+		history.choose(index)
+	}
+	return true
+}
+
+func (history *ClipboardHistory) Destroy() {
+	history.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Clipboard history destroyed")
+}
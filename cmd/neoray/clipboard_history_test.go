@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClipboardHistory(t *testing.T) {
+	options := Editor.options
+	defer func() { Editor.options = options }()
+	history := &ClipboardHistory{hidden: true}
+	Editor.options.clipboardHistory = 0
+	history.Add("disabled")
+	if len(history.entries) != 0 {
+		t.Fatalf("Disabled history added an entry: %q", history.entries)
+	}
+	Editor.options.clipboardHistory = 3
+	for _, text := range []string{"a", "b", "", "c", "a", "d"} {
+		history.Add(text)
+	}
+	if want := []string{"d", "a", "c"}; !reflect.DeepEqual(history.Entries(), want) {
+		t.Errorf("Entries = %q, want %q", history.Entries(), want)
+	}
+	Editor.options.clipboardHistory = 1
+	history.Trim()
+	if want := []string{"d"}; !reflect.DeepEqual(history.Entries(), want) {
+		t.Errorf("Entries after trim = %q, want %q", history.Entries(), want)
+	}
+}
+
+func Test_clipboardEntryLabel(t *testing.T) {
+	if got, want := clipboardEntryLabel("\tfunc main() {\n}\n", 40), "func main() { (+1 lines)"; got != want {
+		t.Errorf("clipboardEntryLabel = %q, want %q", got, want)
+	}
+}
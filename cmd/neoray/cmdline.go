@@ -0,0 +1,230 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+type CmdlineLevel struct {
+	content []MessageCell
+	pos     int // Byte position of the cursor in the content
+	firstc  string
+	prompt  string
+	indent  int
+	// Shown at the cursor while waiting for the character after ctrl-v or
+	// ctrl-k, inserted before the cursor if shift is true
+	special string
+	shift   bool
+}
+
+// Returns the cells of the line with the prompt and the column of the cursor
+func (level *CmdlineLevel) layout() ([]MessageCell, int) {
+	cells := textCells(level.firstc+level.prompt+strings.Repeat(" ", level.indent), 0)
+	content := messageText(level.content)
+	pos := common.Clamp(level.pos, 0, len(content))
+	cursor := len(cells) + utf8.RuneCountInString(content[:pos])
+	cells = append(cells, level.content...)
+	if level.special != "" {
+		special := textCells(level.special, 0)
+		if level.shift || cursor >= len(cells) {
+			cells = append(cells[:cursor], append(special, cells[cursor:]...)...)
+		} else {
+			cells[cursor] = special[0]
+		}
+	}
+	return cells, cursor
+}
+
+// Cmdline is drawn at the bottom of the window when ext_cmdline is enabled,
+// neovim enables it with ext_messages too. Only the innermost level is shown,
+// like ctrl-r = in the cmdline, and the lines of a block, like a :function
+// typed in the cmdline, are shown above it.
+type Cmdline struct {
+	pos      common.Vector2[int]
+	levels   []CmdlineLevel
+	block    [][]MessageCell
+	rows     int // Zero when nothing is drawn
+	cols     int
+	renderer *GridRenderer
+}
+
+func NewCmdline() *Cmdline {
+	cmdline := new(Cmdline)
+	var err error
+	cmdline.renderer, err = NewGridRenderer(Editor, 1, 1, nil, DEFAULT_FONT_SIZE, cmdline.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create cmdline renderer")
+	}
+	return cmdline
+}
+
+func (cmdline *Cmdline) SetFontKit(kit *fontkit.FontKit) {
+	cmdline.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (cmdline *Cmdline) SetFontSize(size float64) {
+	cmdline.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (cmdline *Cmdline) IsVisible() bool {
+	return len(cmdline.levels) > 0
+}
+
+// Returns the number of the rows drawn last time, the messages are drawn
+// above them.
+func (cmdline *Cmdline) Rows() int {
+	return cmdline.rows
+}
+
+// Returns the level, nil if the level is not shown. Levels start from one.
+func (cmdline *Cmdline) level(level int) *CmdlineLevel {
+	if level < 1 || level > len(cmdline.levels) {
+		return nil
+	}
+	return &cmdline.levels[level-1]
+}
+
+// Call this when neovim sends cmdline_show. The cursor of the grid is hidden
+// while the cmdline is visible.
+func (cmdline *Cmdline) Show(level int, line CmdlineLevel) {
+	if level < 1 || level > len(cmdline.levels)+1 {
+		logger.Log(logger.DEBUG, "Cmdline level", level, "skipped a level")
+		level = len(cmdline.levels) + 1
+	}
+	cmdline.levels = append(cmdline.levels[:level-1], line)
+	Editor.cursor.Hide()
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends cmdline_pos
+func (cmdline *Cmdline) SetCursor(level, pos int) {
+	if line := cmdline.level(level); line != nil {
+		line.pos = pos
+		Editor.MarkDraw()
+	}
+}
+
+// Call this when neovim sends cmdline_special_char
+func (cmdline *Cmdline) SetSpecialChar(level int, char string, shift bool) {
+	if line := cmdline.level(level); line != nil {
+		line.special = char
+		line.shift = shift
+		Editor.MarkDraw()
+	}
+}
+
+// Call this when neovim sends cmdline_hide, the outer levels stay visible
+func (cmdline *Cmdline) Hide(level int) {
+	if cmdline.level(level) == nil {
+		return
+	}
+	cmdline.levels = cmdline.levels[:level-1]
+	if !cmdline.IsVisible() {
+		Editor.cursor.Show()
+	}
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends cmdline_block_show
+func (cmdline *Cmdline) ShowBlock(lines [][]MessageCell) {
+	cmdline.block = lines
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends cmdline_block_append
+func (cmdline *Cmdline) AppendBlock(line []MessageCell) {
+	cmdline.block = append(cmdline.block, line)
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends cmdline_block_hide
+func (cmdline *Cmdline) HideBlock() {
+	cmdline.block = nil
+	Editor.MarkDraw()
+}
+
+// Removes everything, call this when ext_cmdline is disabled
+func (cmdline *Cmdline) Reset() {
+	if cmdline.IsVisible() {
+		Editor.cursor.Show()
+	}
+	cmdline.levels = nil
+	cmdline.block = nil
+	cmdline.rows = 0
+	Editor.MarkRender()
+}
+
+func (cmdline *Cmdline) Draw() {
+	if !cmdline.IsVisible() || !Editor.nvim.HasExt("cmdline") {
+		cmdline.rows = 0
+		return
+	}
+	EndBenchmark := bench.Begin()
+	cellSize := cmdline.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	cols := common.Max((windowSize.Width()-Editor.minimap.Width())/cellSize.Width(), 1)
+	screenRows := common.Max(windowSize.Height()/cellSize.Height(), 1)
+	lines := [][]MessageCell{}
+	for _, line := range cmdline.block {
+		lines = append(lines, wrapMessageCells(line, cols)...)
+	}
+	cells, cursor := cmdline.levels[len(cmdline.levels)-1].layout()
+	// The cursor may be after the last character
+	cursorRow := len(lines) + cursor/cols
+	cursorCol := cursor % cols
+	lines = append(lines, wrapMessageCells(cells, cols)...)
+	for cursorRow >= len(lines) {
+		lines = append(lines, []MessageCell{})
+	}
+	// The block is cut from the top if it doesn't fit
+	if len(lines) > screenRows {
+		cursorRow -= len(lines) - screenRows
+		lines = lines[len(lines)-screenRows:]
+	}
+	cmdline.rows = len(lines)
+	if cmdline.rows != cmdline.renderer.rows || cols != cmdline.cols {
+		cmdline.cols = cols
+		cmdline.renderer.Resize(cmdline.rows, cols)
+	}
+	cmdline.pos = common.Vector2[int]{
+		X: 0,
+		Y: common.Max(windowSize.Height()-cmdline.rows*cellSize.Height(), 0),
+	}
+	cmdline.renderer.SetPos(cmdline.pos)
+	for row, line := range lines {
+		drawMessageCells(cmdline.renderer, row, line)
+	}
+	// Cursor is drawn as a reversed cell
+	if cursorRow >= 0 {
+		cell := MessageCell{}
+		if cursorCol < len(lines[cursorRow]) {
+			cell = lines[cursorRow][cursorCol]
+		}
+		attrib := messageAttribute(cell.attribID)
+		attrib.foreground, attrib.background = attrib.background, attrib.foreground
+		if cell.char == ' ' {
+			cell.char = 0
+		}
+		cmdline.renderer.DrawCell(cursorRow, cursorCol, cell.char, attrib)
+	}
+	EndBenchmark("Cmdline.Draw")
+}
+
+func (cmdline *Cmdline) Render() {
+	if cmdline.rows == 0 {
+		return
+	}
+	cmdline.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+func (cmdline *Cmdline) Destroy() {
+	cmdline.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Cmdline destroyed")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/hismailbulut/Neoray/pkg/icc"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Loads the color profile given with the ColorProfile option and applies it
+// to the shader. Empty option disables color management and "auto" uses the
+// profile of the monitor.
+func ApplyColorProfile() {
+	path := Editor.options.colorProfile
+	if path == "auto" {
+		path = Editor.window.ColorProfilePath()
+		if path == "" {
+			logger.Log(logger.WARN, "Color profile of the monitor is not found")
+		}
+	}
+	if path == "" {
+		Editor.window.Renderer().DisableColorTransform()
+		Editor.MarkForceDraw()
+		return
+	}
+	profile, err := icc.Load(ExpandHome(path))
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to load color profile:", err)
+		return
+	}
+	matrix, ok := profile.FromSRGB()
+	if !ok {
+		logger.Log(logger.WARN, "Color profile", path, "has invalid primaries")
+		return
+	}
+	var matrix32 [3][3]float32
+	for i := range matrix {
+		for j := range matrix[i] {
+			matrix32[i][j] = float32(matrix[i][j])
+		}
+	}
+	gamma := [3]float32{float32(profile.Gamma[0]), float32(profile.Gamma[1]), float32(profile.Gamma[2])}
+	Editor.window.Renderer().SetColorTransform(matrix32, gamma)
+	logger.Log(logger.DEBUG, "Color profile", path, "loaded, gamma:", gamma)
+	Editor.MarkForceDraw()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+type ConfirmButton struct {
+	label    string
+	key      string // sent to neovim when clicked
+	col, row int    // position of the first cell of the label
+}
+
+// ConfirmDialog shows the prompts of confirm() and the swap file messages
+// as a dialog in the center of the window. Neovim sends these with
+// ext_messages, the buttons are parsed from the last line of the message.
+// The user can click a button or type the key as always.
+type ConfirmDialog struct {
+	pos        common.Vector2[int]
+	hidden     bool
+	rows, cols int
+	cells      [][]rune
+	buttons    []ConfirmButton
+	hlButton   int // Highlighted button index, -1 if none
+	renderer   *GridRenderer
+}
+
+func NewConfirmDialog() *ConfirmDialog {
+	dialog := new(ConfirmDialog)
+	dialog.hidden = true
+	dialog.hlButton = -1
+	dialog.rows = 1
+	dialog.cols = 1
+	var err error
+	dialog.renderer, err = NewGridRenderer(Editor, dialog.rows, dialog.cols, nil, DEFAULT_FONT_SIZE, dialog.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create confirm dialog renderer")
+	}
+	return dialog
+}
+
+// Parses buttons from the choices line, which looks like
+// "[Y]es, (N)o, (C)ancel: ". Returns nil if the line is not a choices line.
+func parseConfirmButtons(line string) []ConfirmButton {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(line, ":")
+	buttons := []ConfirmButton{}
+	for _, label := range strings.Split(line, ", ") {
+		label = strings.TrimSpace(label)
+		// Hotkey is the character between brackets or parentheses
+		start := strings.IndexAny(label, "[(")
+		if start == -1 || start+2 >= len(label) || !strings.ContainsRune("])", rune(label[start+2])) {
+			return nil
+		}
+		buttons = append(buttons, ConfirmButton{
+			label: label,
+			key:   label[start+1 : start+2],
+		})
+	}
+	if len(buttons) == 0 {
+		return nil
+	}
+	return buttons
+}
+
+func (dialog *ConfirmDialog) SetFontKit(kit *fontkit.FontKit) {
+	dialog.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (dialog *ConfirmDialog) SetFontSize(size float64) {
+	dialog.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (dialog *ConfirmDialog) IsVisible() bool {
+	return !dialog.hidden
+}
+
+// Shows the dialog with the message. The last line of the message must
+// contain the choices, otherwise the dialog is not shown and returns false.
+func (dialog *ConfirmDialog) Show(message string) bool {
+	lines := strings.Split(strings.TrimRight(message, "\n "), "\n")
+	buttons := parseConfirmButtons(lines[len(lines)-1])
+	if buttons == nil {
+		return false
+	}
+	lines = lines[:len(lines)-1]
+	// Long lines are wrapped at the window width
+	cellSize := dialog.renderer.CellSize()
+	maxWidth := common.Max(Editor.ScreenSize().Width()/cellSize.Width()-4, 10)
+	wrapped := []string{}
+	for _, line := range lines {
+		runes := []rune(line)
+		for len(runes) > maxWidth {
+			wrapped = append(wrapped, string(runes[:maxWidth]))
+			runes = runes[maxWidth:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+	// Buttons are placed to the bottom line, wrapped if there is no space
+	buttonRow := len(wrapped) + 1
+	col := 1
+	width := 0
+	for _, line := range wrapped {
+		width = common.Max(width, len([]rune(line)))
+	}
+	for i := range buttons {
+		labelWidth := len([]rune(buttons[i].label))
+		if col > 1 && col+labelWidth > maxWidth+1 {
+			buttonRow++
+			col = 1
+		}
+		buttons[i].row = buttonRow
+		buttons[i].col = col
+		col += labelWidth + 2
+		width = common.Max(width, col-3)
+	}
+	// Create cells, one cell padding around the dialog for the border
+	dialog.rows = buttonRow + 2
+	dialog.cols = width + 2
+	dialog.cells = make([][]rune, dialog.rows)
+	for i := range dialog.cells {
+		dialog.cells[i] = make([]rune, dialog.cols)
+	}
+	setText := func(row, col int, text string) {
+		for i, c := range []rune(text) {
+			if c == ' ' {
+				c = 0
+			}
+			dialog.cells[row][col+i] = c
+		}
+	}
+	for i, line := range wrapped {
+		setText(i+1, 1, line)
+	}
+	for _, button := range buttons {
+		setText(button.row, button.col, button.label)
+	}
+	dialog.buttons = buttons
+	dialog.hlButton = -1
+	dialog.hidden = false
+	dialog.renderer.Resize(dialog.rows, dialog.cols)
+	dialog.center()
+	// Move the mouse to the first button
+	WarpMouse(dialog.renderer.CellCenter(buttons[0].row, buttons[0].col))
+	Editor.MarkDraw()
+	return true
+}
+
+func (dialog *ConfirmDialog) center() {
+	cellSize := dialog.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	dialog.pos = common.Vector2[int]{
+		X: common.Max((windowSize.Width()-dialog.cols*cellSize.Width())/2, 0),
+		Y: common.Max((windowSize.Height()-dialog.rows*cellSize.Height())/2, 0),
+	}
+	dialog.renderer.SetPos(dialog.pos)
+}
+
+func (dialog *ConfirmDialog) Hide() {
+	if !dialog.hidden {
+		dialog.hidden = true
+		Editor.MarkRender()
+	}
+}
+
+func (dialog *ConfirmDialog) Draw() {
+	if dialog.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	// Window may be resized
+	dialog.center()
+	normal := WidgetAttribute("Pmenu")
+	highlighted := WidgetAttribute("PmenuSel")
+	highlighted.bold = true
+	// Borders are drawn to the padding
+	for row := 1; row < dialog.rows-1; row++ {
+		for col := 1; col < dialog.cols-1; col++ {
+			attrib := normal
+			if dialog.buttonAt(row, col) != -1 {
+				attrib.bold = true
+				if dialog.buttonAt(row, col) == dialog.hlButton {
+					attrib = highlighted
+				}
+			}
+			dialog.renderer.DrawCell(row, col, dialog.cells[row][col], attrib)
+		}
+	}
+	dialog.renderer.DrawBorder(normal)
+	EndBenchmark("ConfirmDialog.Draw")
+}
+
+func (dialog *ConfirmDialog) Render() {
+	if dialog.hidden {
+		return
+	}
+	dialog.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns index of the button at the cell, -1 if there is no button
+func (dialog *ConfirmDialog) buttonAt(row, col int) int {
+	for i, button := range dialog.buttons {
+		if row == button.row && col >= button.col && col < button.col+len([]rune(button.label)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns true if the position is on the dialog and index of the button under
+// the position, -1 if there is no button.
+func (dialog *ConfirmDialog) IsIntersecting(pos common.Vector2[int]) (bool, int) {
+	row, col, ok := dialog.renderer.CellAt(pos)
+	if !ok {
+		return false, -1
+	}
+	return true, dialog.buttonAt(row, col)
+}
+
+// Call this function when mouse moved.
+func (dialog *ConfirmDialog) MouseMove(pos common.Vector2[int]) {
+	if dialog.hidden {
+		return
+	}
+	_, index := dialog.IsIntersecting(pos)
+	if dialog.hlButton != index {
+		dialog.hlButton = index
+		Editor.MarkDraw()
+	}
+}
+
+// Call this function when mouse clicked. Returns true if the dialog is
+// visible, the click shouldn't be sent to neovim because neovim is waiting
+// for the answer.
+func (dialog *ConfirmDialog) MouseClick(pos common.Vector2[int]) bool {
+	if dialog.hidden {
+		return false
+	}
+	_, index := dialog.IsIntersecting(pos)
+	if index != -1 {
+		Editor.nvim.Input(dialog.buttons[index].key)
+		dialog.Hide()
+	}
+	return true
+}
+
+func (dialog *ConfirmDialog) Destroy() {
+	dialog.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Confirm dialog destroyed")
+}
@@ -4,59 +4,134 @@ import (
 	"github.com/hismailbulut/Neoray/pkg/bench"
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/logger"
-	"github.com/hismailbulut/Neoray/pkg/opengl"
-	"github.com/hismailbulut/Neoray/pkg/window"
+	"github.com/hismailbulut/Neoray/pkg/render"
 )
 
+// Seconds of fading the cursor when neovim is busy
+const CURSOR_FADE_TIME = 0.15
+
 type Cursor struct {
-	row, col int              // Position of the cursor in the grid
-	grid     int              // Id of the grid where the cursor is
-	mode     Mode             // Current mode and style information (normal, visual etc.)
-	anim     common.Animation // Cursor animation
+	editor   *EditorContext
+	row, col int    // Position of the cursor in the grid
+	grid     int    // Id of the grid where the cursor is
+	mode     Mode   // Current mode and style information (normal, visual etc.)
+	anim     *Tween // Position of the cursor in the screen
 	hidden   bool
+	// Cursor fades out while neovim is busy, instead of staying at a stale
+	// position. X of the fade is the opacity.
+	busy bool
+	fade *Tween
+	// Spinner drawn in the cell of the cursor while busy if the BusySpinner
+	// option is enabled, fades in as the cursor fades out. Rectangle is zero
+	// when not drawn.
+	spinner     render.VertexBuffer
+	spinnerRect common.Rectangle[float32]
+	spinTime    float32
+	spinFrame   int
 	// TODO: We can make a cursor renderer with different features
-	buffer *opengl.VertexBuffer
+	buffer render.VertexBuffer
+	// Last drawn rectangle, relative to the animated position. Used for moving
+	// the cursor between ticks.
+	shape common.Rectangle[float32]
+	// Last drawn rectangle in the screen, for damaging only the cursor
+	rect common.Rectangle[float32]
 	// blinking variables
 	bHidden  bool
 	time     float32
 	nextTime float32
 }
 
-func NewCursor(window *window.Window) *Cursor {
+func NewCursor(editor *EditorContext) *Cursor {
 	cursor := new(Cursor)
-	cursor.buffer = window.GL().CreateVertexBuffer(1)
+	cursor.editor = editor
+	cursor.buffer = editor.window.Renderer().CreateVertexBuffer(1)
+	cursor.spinner = editor.window.Renderer().CreateVertexBuffer(1)
+	cursor.anim = editor.animator.NewTween(common.Vector2[float32]{}, func() {
+		if !cursor.hidden {
+			// Additional draw call to cursor for animation, cursor reports
+			// the damaged area itself
+			editor.MarkPartialDraw()
+		}
+	})
+	cursor.fade = editor.animator.NewTween(common.Vec2[float32](1, 0), cursor.markDamage)
 	return cursor
 }
 
 func (cursor *Cursor) Update(delta float32) {
 	cursor.time += delta
-	if cursor.anim.IsFinished() {
+	if cursor.busy {
+		if cursor.editor.options.busySpinner {
+			cursor.spinTime += delta
+			frame := int(cursor.spinTime/BUSY_SPINNER_STEP) % len(busySpinner)
+			if frame != cursor.spinFrame {
+				cursor.spinFrame = frame
+				cursor.editor.MarkPartialDraw()
+			}
+		}
+	} else if cursor.anim.IsFinished() {
 		// Blink if animation finished (cursor is not moving)
 		cursor.updateBlinking()
-	} else if !cursor.hidden {
-		// Additional draw call to cursor for animation
-		// TODO We don't need to draw whole screen, just cursor enough
-		MarkDraw()
 	}
 }
 
 func (cursor *Cursor) Show() {
 	if cursor.hidden {
 		cursor.hidden = false
-		MarkRender()
+		cursor.editor.MarkRender()
 	}
 }
 
 func (cursor *Cursor) Hide() {
 	if !cursor.hidden {
 		cursor.hidden = true
-		MarkRender()
+		cursor.editor.MarkRender()
+	}
+}
+
+// Call this when neovim sends busy_start and busy_stop
+func (cursor *Cursor) SetBusy(busy bool) {
+	if busy != cursor.busy {
+		target := float32(1)
+		if busy {
+			target = 0
+		}
+		cursor.fade.AnimateTo(common.Vec2(target, 0), CURSOR_FADE_TIME, common.EaseLinear)
+		cursor.spinTime = 0
+		cursor.spinFrame = 0
+		// Spinner is drawn or removed
+		cursor.editor.MarkPartialDraw()
+	}
+	cursor.busy = busy
+	if busy {
+		// Doesn't blink while busy, it fades out
+		cursor.blinkShow()
+	} else {
+		cursor.resetBlinking()
+	}
+}
+
+// Renders the area of the cursor and the spinner again
+func (cursor *Cursor) markDamage() {
+	// Rounded outwards
+	cursor.editor.MarkDamage(common.Rectangle[float32]{
+		X: cursor.rect.X - 1,
+		Y: cursor.rect.Y - 1,
+		W: cursor.rect.W + 2,
+		H: cursor.rect.H + 2,
+	}.ToInt())
+	if cursor.spinnerRect.W > 0 {
+		cursor.editor.MarkDamage(common.Rectangle[float32]{
+			X: cursor.spinnerRect.X - 1,
+			Y: cursor.spinnerRect.Y - 1,
+			W: cursor.spinnerRect.W + 2,
+			H: cursor.spinnerRect.H + 2,
+		}.ToInt())
 	}
 }
 
 // Returns the grid where the cursor is
 func (cursor *Cursor) Grid() *Grid {
-	return Editor.gridManager.Grid(cursor.grid)
+	return cursor.editor.gridManager.Grid(cursor.grid)
 }
 
 func (cursor *Cursor) resetBlinking() {
@@ -93,14 +168,14 @@ func (cursor *Cursor) updateBlinking() {
 func (cursor *Cursor) blinkShow() {
 	if cursor.bHidden {
 		cursor.bHidden = false
-		MarkRender()
+		cursor.markDamage()
 	}
 }
 
 func (cursor *Cursor) blinkHide() {
 	if !cursor.bHidden {
 		cursor.bHidden = true
-		MarkRender()
+		cursor.markDamage()
 	}
 }
 
@@ -116,7 +191,7 @@ func (cursor *Cursor) SetPosition(id, row, col int) {
 			X: float32(currentGrid.PixelPos().X + (cursor.col * currentGrid.CellSize().Width())),
 			Y: float32(currentGrid.PixelPos().Y + (cursor.row * currentGrid.CellSize().Height())),
 		}
-		targetGrid := Editor.gridManager.Grid(id)
+		targetGrid := cursor.editor.gridManager.Grid(id)
 		if targetGrid == nil {
 			return
 		}
@@ -124,13 +199,13 @@ func (cursor *Cursor) SetPosition(id, row, col int) {
 			X: float32(targetGrid.PixelPos().X + (col * targetGrid.CellSize().Width())),
 			Y: float32(targetGrid.PixelPos().Y + (row * targetGrid.CellSize().Height())),
 		}
-		cursor.anim = common.NewAnimation(current, target, Editor.options.cursorAnimTime)
+		cursor.anim.Animate(current, target, cursor.editor.options.cursorAnimTime, common.EaseOutCubic)
 	}()
 	cursor.grid = id
 	cursor.row = row
 	cursor.col = col
 	cursor.resetBlinking()
-	MarkDraw()
+	cursor.editor.MarkPartialDraw()
 }
 
 func (cursor *Cursor) IsInArea(grid, x, y, w, h int) bool {
@@ -168,10 +243,10 @@ func (cursor *Cursor) modeRectangle(info ModeInfo, position, cellSize common.Vec
 
 func (cursor *Cursor) AttributeColors(id int) (common.Color, common.Color) {
 	// When attr_id is 0 we are using cursor foreground for default background and background for default foreground
-	fg := Editor.gridManager.background
-	bg := Editor.gridManager.foreground
+	fg := cursor.editor.gridManager.background
+	bg := cursor.editor.gridManager.foreground
 	if id != 0 {
-		attrib, ok := Editor.gridManager.attributes[id]
+		attrib, ok := cursor.editor.gridManager.attributes[id]
 		if ok {
 			if attrib.foreground.A > 0 {
 				fg = attrib.foreground
@@ -184,7 +259,7 @@ func (cursor *Cursor) AttributeColors(id int) (common.Color, common.Color) {
 	return fg, bg
 }
 
-func (cursor *Cursor) Draw(delta float32) {
+func (cursor *Cursor) Draw() {
 	if cursor.hidden || cursor.bHidden {
 		return
 	}
@@ -196,14 +271,22 @@ func (cursor *Cursor) Draw(delta float32) {
 	// Current grid where the cursor is
 	grid := cursor.Grid()
 	if grid != nil {
-		pos := cursor.anim.Step(delta).ToInt()
+		pos := cursor.anim.Value().ToInt()
 		rect, blockShaped := cursor.modeRectangle(modeInfo, pos, grid.CellSize())
+		cursor.shape = rect
+		cursor.shape.X -= float32(pos.X)
+		cursor.shape.Y -= float32(pos.Y)
+		// Both previous and current areas are changed
+		cursor.markDamage()
+		cursor.rect = rect
+		cursor.drawSpinner(grid, pos, cursorBg)
+		cursor.markDamage()
 		cell := grid.SafeCellAt(cursor.row, cursor.col)
 		// Only draw character to the cursor if animation is finished and cell
 		// has a printable character and cursor shape is block
 		if cursor.anim.IsFinished() && cell.char != 0 && blockShaped {
 			// We need to draw cell character to the cursor foreground
-			cellAttrib := cell.Attribute()
+			cellAttrib := cell.Attribute(cursor.editor.gridManager)
 			// Draw undercurl to cursor if cell has
 			if cellAttrib.undercurl {
 				cursor.buffer.SetIndexSp(0, cursorFg)
@@ -213,11 +296,11 @@ func (cursor *Cursor) Draw(delta float32) {
 			if charPos.W > grid.CellSize().Width() {
 				charPos.W /= 2
 			}
-			cursor.buffer.SetIndexTex1(0, grid.renderer.atlas.Normalize(charPos))
+			cursor.buffer.SetIndexTex1(0, grid.renderer.atlas.Normalize(charPos), charPos.Layer)
 			cursor.buffer.SetIndexFg(0, cursorFg)
 		} else {
 			// No cell drawing needed. Clear foreground.
-			cursor.buffer.SetIndexTex1(0, common.ZeroRectangleF32)
+			cursor.buffer.SetIndexTex1(0, common.ZeroRectangleF32, 0)
 			cursor.buffer.SetIndexFg(0, common.ZeroColor)
 			cursor.buffer.SetIndexSp(0, common.ZeroColor)
 		}
@@ -227,23 +310,82 @@ func (cursor *Cursor) Draw(delta float32) {
 	}
 }
 
+// Draws the current frame of the spinner to the cell at the position, with the
+// color of the cursor
+func (cursor *Cursor) drawSpinner(grid *Grid, pos common.Vector2[int], color common.Color) {
+	if !cursor.busy || !cursor.editor.options.busySpinner {
+		cursor.spinnerRect = common.ZeroRectangleF32
+		return
+	}
+	cellSize := grid.CellSize()
+	cursor.spinnerRect = common.Rectangle[float32]{
+		X: float32(pos.X),
+		Y: float32(pos.Y),
+		W: float32(cellSize.Width()),
+		H: float32(cellSize.Height()),
+	}
+	charPos := grid.renderer.atlas.GetCharPos(busySpinner[cursor.spinFrame], false, false, false, false, cellSize)
+	if charPos.W > cellSize.Width() {
+		charPos.W /= 2
+	}
+	cursor.spinner.SetIndexTex1(0, grid.renderer.atlas.Normalize(charPos), charPos.Layer)
+	cursor.spinner.SetIndexFg(0, color)
+	// Only the glyph is blended over the cell
+	cursor.spinner.SetIndexBg(0, common.ZeroColor)
+	cursor.spinner.SetIndexPos(0, cursor.spinnerRect)
+}
+
 func (cursor *Cursor) Render() {
-	if cursor.hidden || cursor.bHidden {
+	opacity := cursor.fade.Value().X
+	if cursor.hidden {
 		return
 	}
 	grid := cursor.Grid()
-	if grid != nil {
-		// Because we are drawing grid's characters, we need it's atlas
-		grid.renderer.atlas.BindTexture()
+	if grid == nil {
+		return
+	}
+	// Because we are drawing grid's characters, we need it's atlas
+	grid.renderer.atlas.BindTexture()
+	if cursor.spinnerRect.W > 0 && opacity < 1 {
+		cursor.spinner.Bind()
+		cursor.spinner.Update()
+		cursor.spinner.SetOpacity(1 - opacity)
+		cursor.editor.window.Renderer().SetBlending(true)
+		cursor.spinner.Render()
+		cursor.spinner.SetOpacity(1)
+		cursor.editor.window.Renderer().SetBlending(false)
+	}
+	if !cursor.bHidden && opacity > 0 {
+		if cursor.editor.frameTime > 0 && !cursor.anim.IsFinished() {
+			// Interpolate between ticks
+			pos := cursor.anim.Value().ToInt()
+			rect := cursor.shape
+			rect.X += float32(pos.X)
+			rect.Y += float32(pos.Y)
+			cursor.buffer.SetIndexPos(0, rect)
+		}
 		cursor.buffer.Bind()
 		cursor.buffer.Update()
 		// TODO Do we need to update projection?
 		// cursor.buffer.SetProjection(Editor.window.Viewport().ToF32())
+		fading := opacity < 1
+		if fading {
+			cursor.buffer.SetOpacity(opacity)
+			cursor.editor.window.Renderer().SetBlending(true)
+		}
 		cursor.buffer.Render()
+		if fading {
+			// Every buffer uses the same shader, restore the opacity for others
+			cursor.buffer.SetOpacity(1)
+			cursor.editor.window.Renderer().SetBlending(false)
+		}
 	}
 }
 
 func (cursor *Cursor) Destroy() {
+	cursor.editor.animator.Remove(cursor.anim)
+	cursor.editor.animator.Remove(cursor.fade)
 	cursor.buffer.Destroy()
+	cursor.spinner.Destroy()
 	logger.Log(logger.DEBUG, "Cursor destroyed")
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hismailbulut/Neoray/cmd/neoray/assets"
+)
+
+// Mime types listed in the desktop entry, Neoray is shown in the "Open with"
+// menus of these files
+var desktopMimeTypes = []string{
+	"text/plain",
+	"text/markdown",
+	"text/x-csrc",
+	"text/x-chdr",
+	"text/x-c++src",
+	"text/x-c++hdr",
+	"text/x-go",
+	"text/x-python",
+	"text/x-rust",
+	"text/x-lua",
+	"text/x-shellscript",
+	"text/x-makefile",
+	"application/json",
+	"application/x-yaml",
+	"application/xml",
+}
+
+const desktopEntryTemplate = `[Desktop Entry]
+Type=Application
+Name=Neoray
+GenericName=Text Editor
+Comment=Simple and lightweight GUI client for Neovim
+Exec=%s %%F
+Icon=neoray
+Terminal=false
+Categories=Utility;TextEditor;Development;
+Keywords=Text;Editor;Neovim;Vim;
+MimeType=%s;
+StartupWMClass=Neoray
+`
+
+func xdgDataHome() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+func writeFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Installs the desktop entry and icons for the current user. Default
+// applications are left to the user, the entry only lists the mime types.
+// Desktop databases are updated if the tools are available.
+func InstallDesktop() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	dataHome, err := xdgDataHome()
+	if err != nil {
+		return err
+	}
+	// Icons
+	icons := map[int][]byte{
+		16:  assets.NeovimIconData16x16,
+		32:  assets.NeovimIconData32x32,
+		48:  assets.NeovimIconData48x48,
+		256: assets.NeovimIconData256x256,
+	}
+	for size, data := range icons {
+		path := filepath.Join(dataHome, "icons", "hicolor", fmt.Sprintf("%dx%d", size, size), "apps", "neoray.png")
+		if err := writeFile(path, data); err != nil {
+			return err
+		}
+	}
+	// Desktop entry, spaces in the path must be quoted
+	if strings.ContainsAny(exe, " \t") {
+		exe = `"` + exe + `"`
+	}
+	entry := fmt.Sprintf(desktopEntryTemplate, exe, strings.Join(desktopMimeTypes, ";"))
+	applications := filepath.Join(dataHome, "applications")
+	if err := writeFile(filepath.Join(applications, "neoray.desktop"), []byte(entry)); err != nil {
+		return err
+	}
+	// These are optional
+	runIfExists := func(name string, args ...string) {
+		if _, err := exec.LookPath(name); err == nil {
+			if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s failed: %s %s\n", name, err, out)
+			}
+		}
+	}
+	runIfExists("update-desktop-database", applications)
+	runIfExists("gtk-update-icon-cache", "-f", "-t", filepath.Join(dataHome, "icons", "hicolor"))
+	return nil
+}
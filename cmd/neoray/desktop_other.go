@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func InstallDesktop() error {
+	return errors.New("desktop installation is only supported on Linux")
+}
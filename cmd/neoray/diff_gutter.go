@@ -0,0 +1,209 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/hismailbulut/Neoray/pkg/render"
+	"github.com/hismailbulut/Neoray/pkg/window"
+	"github.com/neovim/go-client/nvim"
+)
+
+// Signs are fetched at most once in this duration
+const DIFF_GUTTER_FETCH_INTERVAL = 100 * time.Millisecond
+
+// A sign of a diff plugin, row is relative to the window
+type gutterSign struct {
+	win        nvim.Window
+	sRow, sCol int // screen position of the window
+	row        int
+	color      uint32
+}
+
+// Adjacent signs with the same color are drawn as one strip
+type gutterStrip struct {
+	gutterSign
+	rows int
+}
+
+// Sorts the signs and merges the adjacent ones with the same color. Only the
+// first sign of a row is used.
+func mergeGutterSigns(signs []gutterSign) []gutterStrip {
+	sort.SliceStable(signs, func(i, j int) bool {
+		if signs[i].win != signs[j].win {
+			return signs[i].win < signs[j].win
+		}
+		return signs[i].row < signs[j].row
+	})
+	strips := []gutterStrip{}
+	for _, sign := range signs {
+		if len(strips) > 0 {
+			last := &strips[len(strips)-1]
+			if last.win == sign.win {
+				end := last.row + last.rows
+				if sign.row < end {
+					continue
+				}
+				if sign.row == end && sign.color == last.color {
+					last.rows++
+					continue
+				}
+			}
+		}
+		strips = append(strips, gutterStrip{gutterSign: sign, rows: 1})
+	}
+	return strips
+}
+
+// DiffGutter draws the signs of the diff plugins, like gitsigns, as thin
+// colored strips at the left edge of the windows. The sign column can be
+// disabled then. Signs are recognized by their highlight group names and
+// fetched from neovim in the background after every flush.
+type DiffGutter struct {
+	buffer    render.VertexBuffer
+	strips    []gutterStrip
+	fetching  bool
+	dirty     bool
+	lastFetch time.Time
+}
+
+func NewDiffGutter(window *window.Window) *DiffGutter {
+	gutter := new(DiffGutter)
+	gutter.buffer = window.Renderer().CreateVertexBuffer(1)
+	return gutter
+}
+
+func (gutter *DiffGutter) IsEnabled() bool {
+	return Editor.options.diffGutter
+}
+
+// Call this after every flush, signs will be fetched in the next update
+func (gutter *DiffGutter) MarkDirty() {
+	gutter.dirty = true
+}
+
+func (gutter *DiffGutter) Update() {
+	if !gutter.IsEnabled() || Editor.state < EditorWindowShown {
+		return
+	}
+	if gutter.dirty && !gutter.fetching && time.Since(gutter.lastFetch) >= DIFF_GUTTER_FETCH_INTERVAL {
+		gutter.dirty = false
+		gutter.fetching = true
+		gutter.lastFetch = time.Now()
+		go gutter.fetch()
+	}
+}
+
+func (gutter *DiffGutter) fetch() {
+	var result [][]int
+	err := Editor.nvim.handle.ExecLua("return require('neoray').diff_signs()", &result)
+	if err != nil {
+		logger.Log(logger.ERROR, "Diff gutter failed to get signs:", err)
+	}
+	signs := make([]gutterSign, 0, len(result))
+	for _, sign := range result {
+		if len(sign) != 5 {
+			continue
+		}
+		signs = append(signs, gutterSign{
+			win:   nvim.Window(sign[0]),
+			sRow:  sign[1],
+			sCol:  sign[2],
+			row:   sign[3],
+			color: uint32(sign[4]),
+		})
+	}
+	strips := mergeGutterSigns(signs)
+	Editor.dispatch.Dispatch(func() {
+		gutter.fetching = false
+		if err == nil && gutter.IsEnabled() {
+			gutter.strips = strips
+			Editor.MarkDraw()
+		}
+	})
+}
+
+// Returns the grid of the window when multigrid is enabled
+func windowGrid(win nvim.Window) *Grid {
+	if !Editor.nvim.HasExt("multigrid") {
+		return nil
+	}
+	for _, grid := range Editor.gridManager.sortedGrids {
+		if grid.id != 1 && grid.window == win && !grid.hidden {
+			return grid
+		}
+	}
+	return nil
+}
+
+// Strips are a fifth of a cell wide and placed at the left of the first
+// column, on the separator, if the window is not at the left edge.
+func (gutter *DiffGutter) stripRect(strip gutterStrip) (common.Rectangle[int], bool) {
+	row, col := strip.row, 0
+	grid := windowGrid(strip.win)
+	if grid == nil {
+		grid = Editor.gridManager.Grid(1)
+		if grid == nil {
+			return common.Rectangle[int]{}, false
+		}
+		row += strip.sRow
+		col = strip.sCol
+	}
+	rect := grid.CellsRect(row, col, strip.rows, 1)
+	rect.W = common.Max(rect.W/5, 2)
+	if strip.sCol > 0 {
+		rect.X -= rect.W
+	}
+	return rect, true
+}
+
+// Grids may be moved or resized, strips are built in every draw
+func (gutter *DiffGutter) Draw() {
+	if !gutter.IsEnabled() || len(gutter.strips) == 0 {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("DiffGutter.Draw")
+	gutter.buffer.Resize(len(gutter.strips))
+	for i, strip := range gutter.strips {
+		rect, ok := gutter.stripRect(strip)
+		if !ok {
+			// Invisible
+			rect = common.Rectangle[int]{}
+		}
+		gutter.buffer.SetIndexPos(i, rect.ToF32())
+		gutter.buffer.SetIndexBg(i, common.ColorFromUint(strip.color))
+	}
+}
+
+func (gutter *DiffGutter) Render() {
+	if !gutter.IsEnabled() || len(gutter.strips) == 0 {
+		return
+	}
+	defaultGrid := Editor.gridManager.Grid(1)
+	if defaultGrid == nil {
+		return
+	}
+	// We only draw backgrounds but the shader needs an atlas
+	defaultGrid.renderer.atlas.BindTexture()
+	gutter.buffer.Bind()
+	gutter.buffer.Update()
+	gutter.buffer.SetProjection(Editor.ProjectionRect())
+	gutter.buffer.Render()
+}
+
+// Call this when the option changed
+func (gutter *DiffGutter) SetEnabled(enabled bool) {
+	Editor.options.diffGutter = enabled
+	gutter.strips = nil
+	gutter.MarkDirty()
+	Editor.MarkDraw()
+}
+
+func (gutter *DiffGutter) Destroy() {
+	gutter.buffer.Destroy()
+	logger.Log(logger.DEBUG, "Diff gutter destroyed")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_mergeGutterSigns(t *testing.T) {
+	const add, change = 0x00ff00, 0x0000ff
+	signs := []gutterSign{
+		{win: 1001, row: 5, color: add},
+		{win: 1000, row: 2, color: add},
+		{win: 1000, row: 0, color: add},
+		{win: 1000, row: 1, color: add},
+		{win: 1000, row: 1, color: change},
+		{win: 1000, row: 3, color: change},
+		{win: 1001, row: 6, color: add},
+	}
+	want := []gutterStrip{
+		{gutterSign: gutterSign{win: 1000, row: 0, color: add}, rows: 3},
+		{gutterSign: gutterSign{win: 1000, row: 3, color: change}, rows: 1},
+		{gutterSign: gutterSign{win: 1001, row: 5, color: add}, rows: 2},
+	}
+	if got := mergeGutterSigns(signs); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeGutterSigns = %+v, want %+v", got, want)
+	}
+}
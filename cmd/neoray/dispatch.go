@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+)
+
+// DispatchQueue runs functions in the main thread. The window, the renderer
+// and the editor state can only be used from the main thread, goroutines like
+// the rpc handlers and the ipc server schedule their work with this. Zero
+// value is ready to use.
+type DispatchQueue struct {
+	mutex sync.Mutex
+	queue []func()
+	// Functions waiting for the first flush, they need the default grid
+	flushQueue []func()
+}
+
+// Schedules the function to run in the next tick, can be called from any
+// goroutine
+func (dispatch *DispatchQueue) Dispatch(fn func()) {
+	dispatch.mutex.Lock()
+	defer dispatch.mutex.Unlock()
+	dispatch.queue = append(dispatch.queue, fn)
+}
+
+// Same with Dispatch but the function waits for the first flush, because it
+// depends on the default grid. These run after the others in the tick.
+func (dispatch *DispatchQueue) DispatchAfterFlush(fn func()) {
+	dispatch.mutex.Lock()
+	defer dispatch.mutex.Unlock()
+	dispatch.flushQueue = append(dispatch.flushQueue, fn)
+}
+
+// Dispatches the function and blocks until it returns. Must not be called
+// from the main thread, it never returns then.
+func (dispatch *DispatchQueue) Wait(fn func()) {
+	done := make(chan bool)
+	dispatch.Dispatch(func() {
+		defer close(done)
+		fn()
+	})
+	<-done
+}
+
+// Runs the dispatched functions, call from the main thread. Functions
+// dispatched while running are run in the next tick.
+func (dispatch *DispatchQueue) Run(flushed bool) {
+	dispatch.mutex.Lock()
+	queue := dispatch.queue
+	dispatch.queue = nil
+	if flushed {
+		queue = append(queue, dispatch.flushQueue...)
+		dispatch.flushQueue = nil
+	}
+	dispatch.mutex.Unlock()
+	if len(queue) == 0 {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	for _, fn := range queue {
+		fn()
+	}
+	EndBenchmark("DispatchQueue.Run")
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestDispatchQueue(t *testing.T) {
+	var dispatch DispatchQueue
+	order := ""
+	dispatch.DispatchAfterFlush(func() { order += "c" })
+	dispatch.Dispatch(func() { order += "a" })
+	dispatch.Dispatch(func() {
+		order += "b"
+		// Dispatched while running, runs in the next tick
+		dispatch.Dispatch(func() { order += "d" })
+	})
+	dispatch.Run(false)
+	if order != "ab" {
+		t.Errorf("Order before the flush = %q, want \"ab\"", order)
+	}
+	dispatch.Run(true)
+	if order != "abdc" {
+		t.Errorf("Order after the flush = %q, want \"abdc\"", order)
+	}
+	// Wait blocks until the main thread runs the function
+	result := make(chan int)
+	go func() {
+		value := 0
+		dispatch.Wait(func() { value = 42 })
+		result <- value
+	}()
+	for {
+		dispatch.Run(true)
+		select {
+		case value := <-result:
+			if value != 42 {
+				t.Errorf("Value after Wait = %d, want 42", value)
+			}
+			return
+		default:
+		}
+	}
+}
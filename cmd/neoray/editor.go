@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/png"
+	"math"
+	"os"
 	"time"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
@@ -18,28 +21,78 @@ import (
 
 type Options struct {
 	// custom options
-	cursorAnimTime      float32
-	transparency        float32
-	targetTPS           int
-	contextMenuEnabled  bool
-	boxDrawingEnabled   bool
-	imageViewerEnabled  bool
-	keyToggleFullscreen string
-	keyIncreaseFontSize string
-	keyDecreaseFontSize string
+	cursorAnimTime     float32
+	busySpinner        bool // spinner in the cell of the cursor while neovim is busy
+	transparency       float32
+	floatTransparency  float32
+	floatAnimTime      float32
+	switchAnimTime     float32
+	messageAnimTime    float32
+	targetTPS          int
+	contextMenuEnabled bool
+	boxDrawingEnabled  bool
+	imageViewerEnabled bool
+	underlineThickness float64
+	underlineOffset    float64
+	minContrast        float32
+	checkUpdates       bool
+	sessionAutosave    int
+	minimapEnabled     bool
+	keybinds           Keybinds // g:neoray_keybinds and Key options
+	lockGridSize       bool
+	mouseWarp          bool
+	keyRepeatDelay     int // milliseconds, zero means system
+	keyRepeatRate      int // per second, zero means system
+	keyRepeatArrows    bool
+	superKey           bool
+	digraphHelper      bool
+	imeAutoSwitch      bool
+	glyphWarmUp        string // rendered in background with ASCII
+	renderRate         int    // frames per second while animating, zero means targetTPS
+	colorProfile       string // icc file path, "auto" for the monitor profile
+	pasteProtection    int    // pasting more lines asks the user, zero disables
+	clipboardHistory   int    // number of the clipboard entries kept, zero disables
+	terminalClipboard  bool   // programs in :terminal can set the clipboard with OSC 52
+	diffGutter         bool   // signs of the diff plugins are drawn as strips
+	terminalImages     bool   // kitty and sixel images of the programs in :terminal are drawn
 }
 
 func DefaultOptions() Options {
 	return Options{
-		cursorAnimTime:      0.1,
-		transparency:        1,
-		targetTPS:           60,
-		contextMenuEnabled:  true,
-		boxDrawingEnabled:   true,
-		imageViewerEnabled:  true,
-		keyToggleFullscreen: "<F11>",
-		keyIncreaseFontSize: "<C-kPlus>",
-		keyDecreaseFontSize: "<C-kMinus>",
+		cursorAnimTime:     0.1,
+		busySpinner:        false,
+		transparency:       1,
+		floatTransparency:  -1,
+		floatAnimTime:      0.1,
+		switchAnimTime:     0,
+		messageAnimTime:    0.1,
+		targetTPS:          60,
+		contextMenuEnabled: true,
+		boxDrawingEnabled:  true,
+		imageViewerEnabled: true,
+		underlineThickness: -1,
+		underlineOffset:    -1,
+		minContrast:        1,
+		checkUpdates:       false,
+		sessionAutosave:    60,
+		minimapEnabled:     false,
+		keybinds:           DefaultKeybinds(),
+		lockGridSize:       false,
+		mouseWarp:          false,
+		keyRepeatDelay:     0,
+		keyRepeatRate:      0,
+		keyRepeatArrows:    true,
+		superKey:           false,
+		digraphHelper:      false,
+		imeAutoSwitch:      false,
+		glyphWarmUp:        "",
+		renderRate:         0,
+		colorProfile:       "",
+		pasteProtection:    100,
+		clipboardHistory:   0,
+		terminalClipboard:  true,
+		diffGutter:         false,
+		terminalImages:     true,
 	}
 }
 
@@ -75,7 +128,10 @@ func (state EditorState) String() string {
 	panic("unknown editor state")
 }
 
-var Editor struct {
+// EditorContext is the state of an editor window. Modules take the editor
+// they belong to when they are created and use it instead of the global
+// Editor, which is the editor of the main window.
+type EditorContext struct {
 	state EditorState
 	// Parsed startup arguments
 	parsedArgs ParsedArgs
@@ -85,6 +141,9 @@ var Editor struct {
 	options Options
 	// Main window of this program.
 	window *window.Window
+	// Animator owns the animated values, like the cursor position and the
+	// fading of the grids.
+	animator *Animator
 	// Grid manager holds information about neovim grids and how they will be rendered
 	// We also use its underlying rendering structure when rendering cursor and context menu
 	gridManager *GridManager
@@ -92,35 +151,109 @@ var Editor struct {
 	cursor *Cursor
 	// ContextMenu is the only context menu in this program for right click menu.
 	contextMenu *ContextMenu
+	// ConfirmDialog shows confirm prompts of neovim when ext_messages is enabled.
+	confirmDialog *ConfirmDialog
+	// Messages and Cmdline are drawn when ext_messages is enabled.
+	messages *Messages
+	cmdline  *Cmdline
+	// PasteGuard confirms pasting large texts
+	pasteGuard *PasteGuard
+	// ClipboardHistory keeps the last copied texts and pastes them
+	clipboardHistory *ClipboardHistory
+	// QuickOpen is the fuzzy file finder overlay.
+	quickOpen *QuickOpen
+	// UnicodeInput inserts characters by codepoint or name.
+	unicodeInput *UnicodeInput
+	// Settings panel
+	settings *Settings
+	// Keycast shows pressed keys
+	keycast *Keycast
+	// Tabline is drawn when the tabline is externalized
+	tabline *Tabline
+	// Tooltip of the element under the mouse
+	tooltip *Tooltip
+	// Widgets above in z-order
+	widgets *WidgetLayer
+	// Recorder captures the screen
+	recorder *Recorder
+	// Headless mode for render tests
+	headless *Headless
+	// Performance counters published to neovim
+	stats *Stats
+	// Window title, set by neovim or g:neoray_title
+	title *Title
+	// Updater checks new versions if user wants
+	updater *Updater
+	// Hyperlink under the mouse in the terminal buffers
+	terminalLinks *TerminalLinks
+	// Minimap shows the miniature of the current buffer
+	minimap *Minimap
+	// Colored strips of the diff signs at the left edge of the windows
+	diffGutter *DiffGutter
+	// Kitty and sixel images of the terminal buffers
+	terminalImages *TerminalImages
+	// Autosave saves the session periodically for crash recovery
+	autosave *Autosave
 	// ImageViewer
 	imageViewer *ImageViewer
 	// UIOptions is a struct, holds some user ui uiOptions like guifont.
 	uiOptions UIOptions
+	// Multiplier of the DPI, g:neoray_scale_factor
+	scaleFactor float64
 	// Neovim child process
 	nvim *NvimProcess
+	// Functions scheduled to the main thread by the other goroutines
+	dispatch DispatchQueue
 	// MainLoop ticker
 	ticker *time.Ticker
+	// Renders additional frames between ticks while something is animating,
+	// nil when the render rate is not higher than the tick rate
+	frameTicker *time.Ticker
+	// Seconds passed since the last tick when rendering an additional frame,
+	// animations are interpolated with it. Zero while ticking.
+	frameTime float32
 	// Stops mainloop
 	quitChan chan bool
+	// Drawing and rendering stops while minimized, events are still processed
+	minimized bool
+	focused   bool
+	// Ticks per second when the window is not focused, g:neoray_unfocused_tps
+	// zero means same with the TargetTPS
+	unfocusedTPS int
 	// Draw calls
 	cDraw      bool
 	cForceDraw bool
 	cRender    bool
+	// Damaged area of the screen since the last render. Only this area is
+	// rendered when the window is transparent, unless fullDamage is set.
+	damage     common.Rectangle[int]
+	fullDamage bool
+	// Scissor of the damaged area while rendering a partial frame, empty
+	// otherwise
+	frameScissor common.Rectangle[int]
 }
 
+// Editor of the main window. Modules taking the editor as a parameter must
+// not use this, the others are moved one by one.
+var Editor = new(EditorContext)
+
 func InitEditor() {
 	var err error
 
 	Editor.options = DefaultOptions()
+	Editor.scaleFactor = 1
+	Editor.focused = true
 
 	err = glfw.Init()
 	if err != nil {
+		Editor.parsedArgs.FailoverToTerminal(err)
 		logger.Log(logger.FATAL, "Failed to initialize GLFW3:", err)
 	}
 	logger.Log(logger.TRACE, "GLFW3 Version:", glfw.GetVersionString())
 
-	Editor.window, err = window.New(NAME, 800, 600, bench.IsDebugBuild())
+	Editor.window, err = window.New(NAME, 800, 600, bench.IsDebugBuild(), Editor.parsedArgs.doubleBuf)
 	if err != nil {
+		Editor.parsedArgs.FailoverToTerminal(err)
 		logger.Log(logger.FATAL, err)
 	}
 	// Event handler function runs when we call window.PollEvents
@@ -130,31 +263,93 @@ func InitEditor() {
 	// Set window icons
 	LoadDefaultIcons()
 	// Update opengl viewport
-	Editor.window.GL().SetViewport(Editor.window.Viewport())
+	Editor.window.Renderer().SetViewport(Editor.window.Viewport())
 	// Print some opengl info
-	info := Editor.window.GL().Info()
+	info := Editor.window.Renderer().Info()
 	logger.Log(logger.TRACE, "Opengl Version:", info.Version)
 	logger.Log(logger.TRACE, "Vendor:", info.Vendor)
 	logger.Log(logger.TRACE, "Renderer:", info.Renderer)
 	logger.Log(logger.TRACE, "GLSL:", info.ShadingLanguageVersion)
 	logger.Log(logger.TRACE, "Max Texture Size:", info.MaxTextureSize)
+	logger.Log(logger.TRACE, "Max Array Texture Layers:", info.MaxArrayTextureLayers)
 	// Set default font
 	fontkit.SetDefaultFontData(assets.Regular, assets.Bold, assets.Italic, assets.BoldItalic)
+	// Initialize animator
+	Editor.animator = NewAnimator(Editor)
 	// Initialize gridManager
-	Editor.gridManager = NewGridManager()
+	Editor.gridManager = NewGridManager(Editor)
 	// Initialize cursor
-	Editor.cursor = NewCursor(Editor.window)
+	Editor.cursor = NewCursor(Editor)
+	// Initialize minimap
+	Editor.minimap = NewMinimap(Editor.window)
+	// Initialize diffGutter
+	Editor.diffGutter = NewDiffGutter(Editor.window)
+	// Initialize terminalImages
+	Editor.terminalImages = NewTerminalImages(Editor.window)
+	// Initialize terminalLinks
+	Editor.terminalLinks = new(TerminalLinks)
 	// Initialize contextMenu
 	Editor.contextMenu = NewContextMenu()
+	// Initialize confirmDialog
+	Editor.confirmDialog = NewConfirmDialog()
+	// Initialize messages
+	Editor.messages = NewMessages()
+	// Initialize cmdline
+	Editor.cmdline = NewCmdline()
+	// Initialize pasteGuard
+	Editor.pasteGuard = NewPasteGuard()
+	// Initialize clipboardHistory
+	Editor.clipboardHistory = NewClipboardHistory()
+	// Initialize quickOpen
+	Editor.quickOpen = NewQuickOpen()
+	// Initialize unicodeInput
+	Editor.unicodeInput = NewUnicodeInput()
+	// Initialize settings
+	Editor.settings = NewSettings()
+	// Initialize keycast
+	Editor.keycast = NewKeycast()
+	// Initialize tabline
+	Editor.tabline = NewTabline()
+	// Initialize tooltip
+	Editor.tooltip = NewTooltip()
+	// Initialize widgets, from the bottom to the top
+	Editor.widgets = new(WidgetLayer)
+	Editor.widgets.Add(
+		Editor.tabline,
+		// Messages are placed above the cmdline, it must be drawn first
+		Editor.cmdline,
+		Editor.messages,
+		Editor.contextMenu,
+		Editor.confirmDialog,
+		Editor.clipboardHistory,
+		Editor.pasteGuard,
+		Editor.quickOpen,
+		Editor.unicodeInput,
+		Editor.settings,
+		Editor.keycast,
+		Editor.tooltip,
+	)
+	// Initialize recorder
+	Editor.recorder = NewRecorder()
+	// Initialize stats
+	Editor.stats = NewStats()
+	// Initialize title
+	Editor.title = new(Title)
+	// Initialize headless mode
+	Editor.headless = NewHeadless(Editor.parsedArgs.headlessFrames, Editor.parsedArgs.headlessDir)
+	// Initialize updater
+	Editor.updater = NewUpdater()
+	// Initialize autosave
+	Editor.autosave = NewAutosave()
 	// Initialize imageViewer
 	Editor.imageViewer = NewImageViewer(Editor.window)
 	// TODO Move this to gridManager
 	Editor.uiOptions = CreateUIOptions()
 	// Start neovim
-	Editor.nvim = CreateNvimProcess()
+	Editor.nvim = CreateNvimProcess(Editor)
 	// Calculate temporary start size and start the ui connection
 	// The size will be updated according to user preferences
-	cellSize := DefaultCellSize()
+	cellSize := Editor.DefaultCellSize()
 	cols := Editor.window.Size().Width() / cellSize.Width()
 	rows := Editor.window.Size().Height() / cellSize.Height()
 	logger.Log(logger.DEBUG, "Calculated startup size of the neovim is", rows, cols)
@@ -166,35 +361,75 @@ func InitEditor() {
 }
 
 func LoadDefaultIcons() {
-	icons := [3]image.Image{}
+	icons := make([]image.Image, 0, 3)
 	icon48, err := png.Decode(bytes.NewReader(assets.NeovimIconData48x48))
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to decode 48x48 icon:", err)
 	} else {
-		icons[0] = icon48
+		icons = append(icons, icon48)
 	}
 
 	icon32, err := png.Decode(bytes.NewReader(assets.NeovimIconData32x32))
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to decode 32x32 icon:", err)
 	} else {
-		icons[1] = icon32
+		icons = append(icons, icon32)
 	}
 
 	icon16, err := png.Decode(bytes.NewReader(assets.NeovimIconData16x16))
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to decode 16x16 icon:", err)
 	} else {
-		icons[2] = icon16
+		icons = append(icons, icon16)
 	}
 	Editor.window.SetIcon(icons)
 }
 
+// Loads the icons from png files, g:neoray_window_icon. Icons can be given in
+// multiple sizes and the system chooses the best one. Icons are not changed if
+// none of them can be loaded.
+func LoadIcons(files []string) {
+	icons := make([]image.Image, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var icon image.Image
+			icon, err = png.Decode(bytes.NewReader(data))
+			if err == nil {
+				icons = append(icons, icon)
+				continue
+			}
+		}
+		logger.Log(logger.ERROR, "Failed to load icon", file, "error:", err)
+	}
+	if len(icons) > 0 {
+		Editor.window.SetIcon(icons)
+	}
+}
+
+// Returns the DPI multiplied with the scale factor, all font sizes must be
+// set with this
+func (editor *EditorContext) ScaledDPI() float64 {
+	return editor.window.DPI() * editor.scaleFactor
+}
+
+// Sets the scale factor and reloads the fonts. Factor is clamped between
+// SCALE_FACTOR_MIN and SCALE_FACTOR_MAX.
+func SetScaleFactor(factor float64) {
+	factor = common.Clamp(factor, SCALE_FACTOR_MIN, SCALE_FACTOR_MAX)
+	if factor == Editor.scaleFactor {
+		return
+	}
+	logger.Log(logger.DEBUG, "Scale factor is", factor)
+	Editor.scaleFactor = factor
+	ResetFontSize()
+}
+
 // A helper function, if default grid is not set by neovim yet we use this for cell size
-func DefaultCellSize() common.Vector2[int] {
+func (editor *EditorContext) DefaultCellSize() common.Vector2[int] {
 	face, _ := fontkit.Default().DefaultFont().CreateFace(fontkit.FaceParams{
 		Size:            DEFAULT_FONT_SIZE,
-		DPI:             Editor.window.DPI(),
+		DPI:             editor.ScaledDPI(),
 		UseBoxDrawing:   false,
 		UseBlockDrawing: false,
 	})
@@ -208,13 +443,122 @@ func ResizeWindowInCellFormat(rows, cols int) {
 		size.X = cols * defaultGrid.CellSize().Width()
 		size.Y = rows * defaultGrid.CellSize().Height()
 	} else {
-		cellSize := DefaultCellSize()
+		cellSize := Editor.DefaultCellSize()
 		size.X = cols * cellSize.Width()
 		size.Y = rows * cellSize.Height()
 	}
+	size.X += Editor.minimap.Width()
+	size.Y += Editor.tabline.Height()
 	Editor.window.Resize(size)
 }
 
+// Returns the size of the area everything is laid out in, this is the size of
+// the default grid and the minimap. The screen is centered in the window when
+// the window size is not a multiple of the cell size, and scaled to fit the
+// window when the grid size is locked.
+func (editor *EditorContext) ScreenSize() common.Vector2[int] {
+	defaultGrid := editor.gridManager.Grid(1)
+	if defaultGrid == nil {
+		return editor.window.Size()
+	}
+	size := defaultGrid.Size()
+	size.X += editor.minimap.Width()
+	return size
+}
+
+// Returns the rectangle of the screen visible in the window, all buffers must
+// use this as projection. The remaining space is filled with the background.
+// The tabline is above the screen, at negative positions.
+func (editor *EditorContext) ProjectionRect() common.Rectangle[float32] {
+	viewport := editor.window.Viewport().ToF32()
+	screen := editor.ScreenSize()
+	top := float32(editor.tabline.Height())
+	screenW, screenH := float32(screen.Width()), float32(screen.Height())+top
+	if screenW <= 0 || screenH <= 0 {
+		return viewport
+	}
+	scale := float32(1)
+	if editor.options.lockGridSize {
+		scale = common.Min(viewport.W/screenW, viewport.H/screenH)
+	}
+	// The screen may be larger than the window until neovim resizes the
+	// grid, keep it at top left then. Offset is rounded to keep glyphs sharp.
+	offsetX := float32(math.Floor(float64(common.Max(viewport.W-screenW*scale, 0) / 2)))
+	offsetY := float32(math.Floor(float64(common.Max(viewport.H-screenH*scale, 0) / 2)))
+	return common.Rectangle[float32]{
+		X: -offsetX / scale,
+		Y: -offsetY/scale - top,
+		W: viewport.W / scale,
+		H: viewport.H / scale,
+	}
+}
+
+// Converts a position in the window to the screen, mouse positions must be
+// converted with this.
+func (editor *EditorContext) WindowToScreen(x, y float64) common.Vector2[int] {
+	viewport := editor.window.Viewport().ToF32()
+	rect := editor.ProjectionRect()
+	return common.Vector2[int]{
+		X: int(math.Floor(float64(rect.X) + x*float64(rect.W/viewport.W))),
+		Y: int(math.Floor(float64(rect.Y) + y*float64(rect.H/viewport.H))),
+	}
+}
+
+// Converts a position in the screen to the window, reverse of WindowToScreen.
+func (editor *EditorContext) ScreenToWindow(pos common.Vector2[int]) common.Vector2[int] {
+	viewport := editor.window.Viewport().ToF32()
+	rect := editor.ProjectionRect()
+	return common.Vector2[int]{
+		X: int((float32(pos.X) - rect.X) * viewport.W / rect.W),
+		Y: int((float32(pos.Y) - rect.Y) * viewport.H / rect.H),
+	}
+}
+
+// Returns the rectangle of the cell in the window, in the same coordinates with
+// the mouse position. Grid 0 is the default grid like nvim_input_mouse, the
+// row and the column are screen cells then.
+func (editor *EditorContext) CellToWindow(id, row, col int) (common.Rectangle[int], error) {
+	if id == 0 {
+		id = 1
+	}
+	grid := editor.gridManager.Grid(id)
+	if grid == nil || grid.hidden {
+		return common.Rectangle[int]{}, fmt.Errorf("grid %d is not visible", id)
+	}
+	if !grid.IsInBounds(row, col) {
+		return common.Rectangle[int]{}, fmt.Errorf("cell %d,%d is outside of the grid %d", row, col, id)
+	}
+	rect := grid.CellsRect(row, col, 1, 1)
+	topLeft := editor.ScreenToWindow(common.Vector2[int]{X: rect.X, Y: rect.Y})
+	bottomRight := editor.ScreenToWindow(common.Vector2[int]{X: rect.X + rect.W, Y: rect.Y + rect.H})
+	return common.Rectangle[int]{
+		X: topLeft.X,
+		Y: topLeft.Y,
+		W: bottomRight.X - topLeft.X,
+		H: bottomRight.Y - topLeft.Y,
+	}, nil
+}
+
+// Returns the grid, row and column at the position in the window, reverse of
+// CellToWindow. Grid is always 1 if multigrid is off.
+func (editor *EditorContext) WindowToCell(x, y int) (int, int, int, error) {
+	id, row, col := editor.gridManager.CellAt(editor.WindowToScreen(float64(x), float64(y)))
+	if id == -1 {
+		return -1, -1, -1, fmt.Errorf("position %d,%d is not on a grid", x, y)
+	}
+	return id, row, col, nil
+}
+
+// Moves the mouse pointer to the position in the screen if MouseWarp option
+// is enabled. Dialogs and popup menus call this when they open.
+func WarpMouse(pos common.Vector2[int]) {
+	if !Editor.options.mouseWarp || !Editor.focused {
+		return
+	}
+	Editor.window.SetMousePos(Editor.ScreenToWindow(pos))
+	inputCache.mousePos = pos
+}
+
 // This is for making sure the state changing valid
 func SetEditorState(state EditorState) {
 	// assert(state-1 == Editor.state, "Editor state can only incremented by 1")
@@ -223,23 +567,59 @@ func SetEditorState(state EditorState) {
 }
 
 func ResetTicker() {
+	tps := Editor.options.targetTPS
+	if !Editor.focused && Editor.unfocusedTPS > 0 {
+		tps = common.Min(Editor.unfocusedTPS, tps)
+	}
 	if Editor.ticker == nil {
-		Editor.ticker = time.NewTicker(time.Second / time.Duration(Editor.options.targetTPS))
+		Editor.ticker = time.NewTicker(time.Second / time.Duration(tps))
 	} else {
-		Editor.ticker.Reset(time.Second / time.Duration(Editor.options.targetTPS))
+		Editor.ticker.Reset(time.Second / time.Duration(tps))
 	}
+	// Rendering faster than ticking is only useful when focused
+	rate := Editor.options.renderRate
+	if rate > tps && Editor.focused {
+		if Editor.frameTicker == nil {
+			Editor.frameTicker = time.NewTicker(time.Second / time.Duration(rate))
+		} else {
+			Editor.frameTicker.Reset(time.Second / time.Duration(rate))
+		}
+	} else if Editor.frameTicker != nil {
+		Editor.frameTicker.Stop()
+		Editor.frameTicker = nil
+	}
+}
+
+// Returns true if something is moving on the screen and can be interpolated
+func (editor *EditorContext) IsAnimating() bool {
+	return editor.animator.IsAnimating()
+}
+
+func (editor *EditorContext) MarkDraw() {
+	editor.cDraw = true
+	editor.fullDamage = true
 }
 
-func MarkDraw() {
-	Editor.cDraw = true
+// Draws without damaging the whole screen, everything changed in the draw
+// must be reported with MarkDamage.
+func (editor *EditorContext) MarkPartialDraw() {
+	editor.cDraw = true
 }
 
-func MarkForceDraw() {
-	Editor.cForceDraw = true
+func (editor *EditorContext) MarkForceDraw() {
+	editor.cForceDraw = true
+	editor.fullDamage = true
 }
 
-func MarkRender() {
-	Editor.cRender = true
+func (editor *EditorContext) MarkRender() {
+	editor.cRender = true
+	editor.fullDamage = true
+}
+
+// Renders only the rectangle of the screen if nothing else is damaged
+func (editor *EditorContext) MarkDamage(rect common.Rectangle[int]) {
+	editor.cRender = true
+	editor.damage = editor.damage.Union(rect)
 }
 
 func MainLoop() {
@@ -274,6 +654,13 @@ func MainLoop() {
 			Editor.window.PollEvents()
 			// then update
 			UpdateHandler(float32(delta))
+		case frame := <-frameChan():
+			// Additional frame between ticks, only animations are moving
+			if Editor.state >= EditorWindowShown && !Editor.minimized && Editor.IsAnimating() {
+				Editor.frameTime = float32(frame.Sub(lastTick).Seconds())
+				RenderFrame()
+				Editor.frameTime = 0
+			}
 		case <-Editor.quitChan:
 			run = false
 		}
@@ -282,40 +669,57 @@ func MainLoop() {
 	logger.Log(logger.TRACE, "Program finished. Total execution time:", time.Since(programBegin))
 }
 
+// Receiving from a nil channel blocks forever, so the select in the MainLoop
+// ignores the frame ticker when it is disabled.
+func frameChan() <-chan time.Time {
+	if Editor.frameTicker == nil {
+		return nil
+	}
+	return Editor.frameTicker.C
+}
+
 func UpdateHandler(delta float32) {
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("UpdateHandler")
 	// Update required stuff
+	Editor.dispatch.Run(Editor.state >= EditorFirstFlush)
 	Editor.nvim.Update()
 	Editor.gridManager.Update()
+	Editor.animator.Update(delta)
 	Editor.cursor.Update(delta)
+	Editor.minimap.Update()
+	Editor.diffGutter.Update()
+	Editor.terminalImages.Update()
 	Editor.imageViewer.Update()
-	if Editor.server != nil {
-		Editor.server.Update()
-	}
-	// Draw calls
-	if Editor.state >= EditorWindowShown {
+	Editor.quickOpen.Update()
+	Editor.unicodeInput.Update()
+	Editor.settings.Update()
+	Editor.keycast.Update(delta)
+	Editor.tabline.Update()
+	Editor.tooltip.Update(delta)
+	UpdateKeyRepeat(delta)
+	Editor.recorder.Update(delta)
+	Editor.headless.Update()
+	Editor.stats.Update(delta)
+	Editor.title.Update(delta)
+	Editor.updater.Update()
+	Editor.autosave.Update()
+	// Draw calls, nobody can see the window when it is minimized
+	if Editor.state >= EditorWindowShown && !Editor.minimized {
 		if Editor.cDraw || Editor.cForceDraw {
 			EndBenchmark := bench.Begin()
 			Editor.gridManager.Draw(Editor.cForceDraw)
-			Editor.cursor.Draw(delta)
-			Editor.contextMenu.Draw()
+			Editor.terminalImages.Draw()
+			Editor.cursor.Draw()
+			Editor.minimap.Draw()
+			Editor.diffGutter.Draw()
+			Editor.widgets.Draw()
 			Editor.imageViewer.Draw()
 			EndBenchmark("UpdateHandler.Draw")
 		}
 		// Render calls
 		if Editor.cDraw || Editor.cForceDraw || Editor.cRender {
-			EndBenchmark := bench.Begin()
-			// Clear background
-			bg := Editor.gridManager.background
-			bg.A = Editor.options.transparency
-			Editor.window.GL().ClearScreen(bg)
-			// Render in order
-			Editor.gridManager.Render()
-			Editor.cursor.Render()
-			Editor.contextMenu.Render()
-			Editor.imageViewer.Render()
-			// Flush to make changes visible
-			Editor.window.GL().Flush()
-			EndBenchmark("UpdateHandler.Render")
+			RenderFrame()
 		}
 		// Clear calls
 		Editor.cDraw = false
@@ -324,6 +728,90 @@ func UpdateHandler(delta float32) {
 	}
 }
 
+// Renders everything to the screen. Doesn't draw anything, can be called
+// between ticks with Editor.frameTime for interpolating animations.
+func RenderFrame() {
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("RenderFrame")
+	// The window is single buffered and the compositor may show it while we
+	// are rendering. Clearing the whole transparent window every frame causes
+	// flickering on some compositors, only the damaged area is rendered then.
+	// Back buffer is undefined after swapping, double buffered windows are
+	// always rendered fully.
+	partial := Editor.options.transparency < 1 && !Editor.fullDamage && Editor.frameTime == 0 &&
+		!Editor.window.IsDoubleBuffered()
+	if partial {
+		if Editor.damage.W <= 0 || Editor.damage.H <= 0 {
+			return
+		}
+		Editor.frameScissor = Editor.ScreenToScissor(Editor.damage, 1)
+		Editor.window.Renderer().SetScissor(Editor.frameScissor)
+		defer func() {
+			Editor.frameScissor = common.ZeroRectangleINT
+			Editor.window.Renderer().DisableScissor()
+		}()
+	}
+	if Editor.frameTime == 0 {
+		Editor.damage = common.ZeroRectangleINT
+		Editor.fullDamage = false
+	}
+	// Clear background
+	bg := Editor.gridManager.background
+	bg.A = Editor.options.transparency
+	Editor.window.Renderer().ClearScreen(bg)
+	// Render in order
+	Editor.gridManager.Render()
+	Editor.terminalImages.Render()
+	Editor.cursor.Render()
+	Editor.minimap.Render()
+	Editor.diffGutter.Render()
+	Editor.widgets.Render()
+	Editor.imageViewer.Render()
+	// Pixels are read from the back buffer when double buffered, capture
+	// before presenting
+	Editor.recorder.Capture()
+	Editor.headless.Capture()
+	// Make changes visible
+	Editor.window.Present()
+	Editor.stats.FrameRendered()
+}
+
+// Converts the rectangle of the screen to the opengl scissor. Margin pixels
+// are added to every side, damaged areas use it for rounding errors of scaling.
+func (editor *EditorContext) ScreenToScissor(rect common.Rectangle[int], margin int) common.Rectangle[int] {
+	viewport := editor.window.Viewport()
+	topLeft := editor.ScreenToWindow(common.Vec2(rect.X, rect.Y))
+	bottomRight := editor.ScreenToWindow(common.Vec2(rect.X+rect.W, rect.Y+rect.H))
+	left := common.Max(topLeft.X-margin, 0)
+	top := common.Max(topLeft.Y-margin, 0)
+	right := common.Min(bottomRight.X+margin, viewport.W)
+	bottom := common.Min(bottomRight.Y+margin, viewport.H)
+	return common.Rectangle[int]{
+		X: left,
+		Y: viewport.H - bottom,
+		W: common.Max(right-left, 0),
+		H: common.Max(bottom-top, 0),
+	}
+}
+
+// Limits rendering to the rectangle of the screen until UnclipRender. Partial
+// frames are still limited to the damaged area.
+func (editor *EditorContext) ClipRender(rect common.Rectangle[int]) {
+	scissor := editor.ScreenToScissor(rect, 0)
+	if editor.frameScissor.W > 0 && editor.frameScissor.H > 0 {
+		scissor = scissor.Intersect(editor.frameScissor)
+	}
+	editor.window.Renderer().SetScissor(scissor)
+}
+
+func (editor *EditorContext) UnclipRender() {
+	if editor.frameScissor.W > 0 && editor.frameScissor.H > 0 {
+		editor.window.Renderer().SetScissor(editor.frameScissor)
+	} else {
+		editor.window.Renderer().DisableScissor()
+	}
+}
+
 func EventHandler(event window.WindowEvent) {
 	switch event.Type {
 	case window.WindowEventRefresh:
@@ -337,12 +825,20 @@ func EventHandler(event window.WindowEvent) {
 				Type:   window.WindowEventResize,
 				Params: []any{size.Width(), size.Height()},
 			})
+			// Contents of the single buffered window may be lost, everything
+			// must be rendered again.
+			Editor.MarkRender()
 			// Only update if tick received
 			select {
 			case <-Editor.ticker.C:
 				// TODO: calculate delta
 				UpdateHandler(0)
 			default:
+				// Render the last frame, otherwise the window stays empty until
+				// the next tick
+				if Editor.state >= EditorWindowShown && !Editor.minimized {
+					RenderFrame()
+				}
 			}
 		}
 	case window.WindowEventResize:
@@ -355,20 +851,21 @@ func EventHandler(event window.WindowEvent) {
 				break
 			}
 			// Update viewport
-			Editor.window.GL().SetViewport(Editor.window.Viewport())
+			Editor.window.Renderer().SetViewport(Editor.window.Viewport())
 			// Mark render because viewport changed
-			MarkRender()
+			Editor.MarkRender()
+			// Locked grid is scaled to the window instead
+			if Editor.options.lockGridSize {
+				break
+			}
 			// Update grid size
 			defaultGrid := Editor.gridManager.Grid(1)
 			if defaultGrid == nil {
 				break
 			}
 			cellSize := defaultGrid.CellSize()
-			rows := height / cellSize.Height()
-			cols := width / cellSize.Width()
-			if rows == defaultGrid.rows && cols == defaultGrid.cols {
-				break
-			}
+			rows := (height - Editor.tabline.Height()) / cellSize.Height()
+			cols := (width - Editor.minimap.Width()) / cellSize.Width()
 			// Try to resize the neovim
 			Editor.nvim.TryResizeUI(rows, cols)
 		}
@@ -409,13 +906,39 @@ func EventHandler(event window.WindowEvent) {
 			files := event.Params[0].([]string)
 			DropHandler(files)
 		}
+	case window.WindowEventTextDrop:
+		{
+			text := event.Params[0].(string)
+			xpos := event.Params[1].(float64)
+			ypos := event.Params[2].(float64)
+			TextDropHandler(text, xpos, ypos)
+		}
 	case window.WindowEventScaleChanged:
 		{
-			Editor.gridManager.ResetFontSize()
+			logger.Log(logger.DEBUG, "Content scale changed, DPI is", Editor.window.DPI())
+			ResetFontSizeKeepCells()
+		}
+	case window.WindowEventMinimize:
+		{
+			Editor.minimized = event.Params[0].(bool)
+			logger.Log(logger.DEBUG, "Window minimized:", Editor.minimized)
+			if !Editor.minimized {
+				// Skipped frames may be left in the buffers
+				Editor.MarkForceDraw()
+			}
+		}
+	case window.WindowEventFocus:
+		{
+			Editor.focused = event.Params[0].(bool)
+			// Ticker is created when the loop starts
+			if Editor.ticker != nil {
+				ResetTicker()
+			}
+			Editor.nvim.SetFocus(Editor.focused)
 		}
 	case window.WindowEventClose:
 		{
-			if Editor.nvim.connectedViaTcp {
+			if Editor.nvim.attached {
 				// Neoray is not responsible for closing neovim.
 				Editor.nvim.Disconnect()
 				// Stop loop
@@ -431,13 +954,21 @@ func EventHandler(event window.WindowEvent) {
 
 func ShutdownEditor() {
 	Editor.ticker.Stop()
+	if Editor.frameTicker != nil {
+		Editor.frameTicker.Stop()
+	}
 	if Editor.server != nil {
 		Editor.server.Close()
 	}
+	Editor.autosave.Remove()
+	Editor.recorder.Close()
 	Editor.nvim.Close()
 	Editor.imageViewer.Destroy()
-	Editor.contextMenu.Destroy()
+	Editor.widgets.Destroy()
 	Editor.cursor.Destroy()
+	Editor.minimap.Destroy()
+	Editor.diffGutter.Destroy()
+	Editor.terminalImages.Destroy()
 	Editor.gridManager.Destroy()
 	Editor.window.Destroy()
 	glfw.Terminate()
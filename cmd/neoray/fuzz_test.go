@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neovim/go-client/msgpack"
+)
+
+// Redraw events and ipc messages come from other processes, malformed ones
+// must not crash Neoray. Run with go test -fuzz FuzzRedraw or FuzzIpcCall.
+// Malformed redraw events are skipped, but the panics of the grids while
+// handling them are bugs and fail the test.
+
+func FuzzRedraw(f *testing.F) {
+	// Golden event streams are good seeds
+	files, _ := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var events [][]interface{}
+		if json.Unmarshal(data, &events) != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if msgpack.NewEncoder(&buf).Encode(events) == nil {
+			f.Add(buf.Bytes())
+		}
+	}
+	// Window and the default font kit are shared with the golden tests
+	defer setupGoldenEditor(f)()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var events [][]interface{}
+		if msgpack.NewDecoder(bytes.NewReader(data)).Decode(&events) != nil {
+			return
+		}
+		// Every input starts without grids, failures must be reproducible
+		Editor.gridManager.Destroy()
+		Editor.gridManager = NewGridManager(Editor)
+		redrawBugHook = func(name string, err any) {
+			t.Errorf("Redraw event %s panicked: %v", name, err)
+		}
+		defer func() {
+			redrawBugHook = nil
+		}()
+		Editor.nvim = &NvimProcess{editor: Editor, eventChan: make(chan []interface{}, len(events))}
+		for _, event := range events {
+			Editor.nvim.eventChan <- event
+		}
+		Editor.gridManager.Update()
+		Editor.gridManager.Draw(true)
+	})
+}
+
+func FuzzIpcCall(f *testing.F) {
+	for _, call := range []IpcFuncCall{
+		{MsgType: IPC_MSG_TYPE_OK},
+		{MsgType: IPC_MSG_TYPE_CLOSE_CONN, MacAddress: 1},
+		{MsgType: IPC_MSG_TYPE_OPEN_FILE, Root: "/home", Args: []interface{}{"file.txt"}},
+		{MsgType: IPC_MSG_TYPE_GOTO_LINE, Args: []interface{}{12}},
+		{MsgType: IPC_MSG_TYPE_GOTO_COLUMN, Args: []interface{}{"3"}},
+	} {
+		data, err := json.Marshal(call)
+		if err == nil {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		call, err := decodeIpcCall(data)
+		if err != nil {
+			// Must be printable even if invalid
+			_ = call.MsgType.String()
+			return
+		}
+		// Validated calls must be usable without checking
+		switch call.MsgType {
+		case IPC_MSG_TYPE_OPEN_FILE:
+			_ = call.Args[0].(string)
+		case IPC_MSG_TYPE_GOTO_LINE, IPC_MSG_TYPE_GOTO_COLUMN:
+			_ = int(call.Args[0].(float64))
+		}
+	})
+}
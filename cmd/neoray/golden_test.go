@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hismailbulut/Neoray/cmd/neoray/assets"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/window"
+)
+
+// Golden tests feed the redraw events in testdata/golden/*.json to the grid
+// manager, render them and compare the result with the png file with the same
+// name. Run with -update to write the images again after an intended change,
+// every case must have its image committed. A different result is written
+// next to the golden image as name.actual.png.
+
+var updateGolden = flag.Bool("update", false, "update golden images")
+
+const (
+	// Maximum difference of a color channel before the pixel counts as different
+	GOLDEN_CHANNEL_TOLERANCE = 16
+	// Maximum ratio of the different pixels
+	GOLDEN_PIXEL_TOLERANCE = 0.01
+)
+
+var (
+	goldenOnce sync.Once
+	goldenErr  error
+)
+
+// Initializes only the parts of the editor needed for rendering grids. The
+// window and the default font kit are created once and shared by the golden
+// tests and the fuzz tests, the default font kit can't be created again.
+// TestMain destroys the window.
+func setupGoldenEditor(t testing.TB) func() {
+	goldenOnce.Do(func() {
+		win, err := window.New("golden", 800, 600, false, false)
+		if err != nil {
+			goldenErr = err
+			return
+		}
+		Editor.window = win
+		Editor.options = DefaultOptions()
+		// Animations make the result depend on time
+		Editor.options.floatAnimTime = 0
+		Editor.options.switchAnimTime = 0
+		Editor.options.messageAnimTime = 0
+		// Same glyphs on every monitor
+		Editor.scaleFactor = 96 / win.DPI()
+		Editor.state = EditorInitialized
+		Editor.uiOptions = CreateUIOptions()
+		Editor.window.Renderer().SetViewport(Editor.window.Viewport())
+		fontkit.SetDefaultFontData(assets.Regular, assets.Bold, assets.Italic, assets.BoldItalic)
+		Editor.animator = NewAnimator(Editor)
+	})
+	if goldenErr != nil {
+		t.Skip("Failed to create window:", goldenErr)
+	}
+	// Every test starts without grids
+	Editor.gridManager = NewGridManager(Editor)
+	Editor.cursor = NewCursor(Editor)
+	Editor.minimap = NewMinimap(Editor.window)
+	Editor.tabline = NewTabline()
+	return func() {
+		Editor.tabline.Destroy()
+		Editor.minimap.Destroy()
+		Editor.cursor.Destroy()
+		Editor.gridManager.Destroy()
+	}
+}
+
+// Feeds the events and returns the rendered default grid
+func renderGoldenEvents(t *testing.T, events [][]interface{}) *image.RGBA {
+	Editor.nvim = &NvimProcess{editor: Editor, eventChan: make(chan []interface{}, len(events))}
+	for _, event := range events {
+		Editor.nvim.eventChan <- event
+	}
+	Editor.gridManager.Update()
+	defaultGrid := Editor.gridManager.Grid(1)
+	if defaultGrid == nil {
+		t.Fatal("Events didn't create the default grid")
+	}
+	bg := Editor.gridManager.background
+	bg.A = 1
+	Editor.window.Renderer().ClearScreen(bg)
+	Editor.gridManager.Draw(true)
+	Editor.gridManager.Render()
+	Editor.window.Renderer().Flush()
+	screen := Editor.window.Renderer().ReadPixels(Editor.window.Viewport())
+	// Only the grid is compared, window size depends on the system and the
+	// grid is centered in the window
+	size := defaultGrid.Size()
+	rect := Editor.ProjectionRect()
+	img := image.NewRGBA(image.Rect(0, 0, size.Width(), size.Height()))
+	draw.Draw(img, img.Bounds(), screen, image.Pt(int(-rect.X), int(-rect.Y)), draw.Src)
+	return img
+}
+
+// Returns the ratio of the different pixels
+func compareImages(a, b *image.RGBA) float64 {
+	if a.Bounds() != b.Bounds() {
+		return 1
+	}
+	different := 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if common.Abs(int(a.Pix[i+c])-int(b.Pix[i+c])) > GOLDEN_CHANNEL_TOLERANCE {
+				different++
+				break
+			}
+		}
+	}
+	return float64(different) / float64(len(a.Pix)/4)
+}
+
+func readPNG(file string) (*image.RGBA, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(decoded.Bounds())
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	return img, nil
+}
+
+func writePNG(file string, img image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var events [][]interface{}
+			err = json.Unmarshal(data, &events)
+			if err != nil {
+				t.Fatal("Failed to parse events:", err)
+			}
+			defer setupGoldenEditor(t)()
+			img := renderGoldenEvents(t, events)
+			goldenFile := strings.TrimSuffix(file, ".json") + ".png"
+			if *updateGolden {
+				err = writePNG(goldenFile, img)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			actualFile := strings.TrimSuffix(file, ".json") + ".actual.png"
+			golden, err := readPNG(goldenFile)
+			if os.IsNotExist(err) {
+				writePNG(actualFile, img)
+				t.Fatalf("Golden image %s doesn't exist, result is written to %s. Run with -update to create it.", goldenFile, actualFile)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			diff := compareImages(img, golden)
+			if diff > GOLDEN_PIXEL_TOLERANCE {
+				err = writePNG(actualFile, img)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Errorf("Rendered image differs from the golden image by %.2f%%, result is written to %s", diff*100, actualFile)
+			} else {
+				// Result of a previous failure
+				os.Remove(actualFile)
+			}
+		})
+	}
+}
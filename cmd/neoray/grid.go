@@ -7,7 +7,6 @@ import (
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/fontkit"
 	"github.com/hismailbulut/Neoray/pkg/logger"
-	"github.com/hismailbulut/Neoray/pkg/window"
 	"github.com/neovim/go-client/nvim"
 )
 
@@ -31,12 +30,35 @@ func (gridType GridType) String() string {
 	panic("unknown grid type")
 }
 
-// Because of the struct packing, this order of elements is important
-// Current size of the Cell is 16 bytes in 64 bit systems
+// Default backgrounds have this alpha value, the shader replaces it with the
+// background alpha of the grid. This makes floating windows can have
+// different transparency than the normal grids.
+const DEFAULT_BACKGROUND_ALPHA = -1
+
+// Grids bigger than these are rejected, a 8k monitor with a tiny font is far
+// below them. A corrupted resize event could allocate gigabytes otherwise.
+// Rows and columns are checked before the cells, so their product can't
+// overflow.
+const (
+	MAX_GRID_ROWS  = 1 << 14
+	MAX_GRID_COLS  = 1 << 14
+	MAX_GRID_CELLS = 1 << 20
+)
+
+// Printable ASCII characters are rendered in background when the font of the
+// default grid changes, with the characters of the GlyphWarmUp option
+func glyphWarmUpText(glyphWarmUp string) string {
+	text := make([]rune, 0, '~'-'!'+1)
+	for char := '!'; char <= '~'; char++ {
+		text = append(text, char)
+	}
+	return string(text) + glyphWarmUp
+}
+
+// Cells are stored as runs in GridRow, this is a single cell of them
 type Cell struct {
-	needsDraw bool
-	char      rune
-	attribID  int
+	char     rune
+	attribID int
 }
 
 func (cell Cell) String() string {
@@ -48,44 +70,54 @@ func (cell Cell) String() string {
 	)
 }
 
-func (cell *Cell) Attribute() HighlightAttribute {
+// Manager holds the highlight attributes and the default colors
+func (cell *Cell) Attribute(manager *GridManager) HighlightAttribute {
 	if cell.attribID == 0 {
 		// Default attribute
-		background := Editor.gridManager.background
-		background.A = Editor.options.transparency
+		background := manager.background
+		background.A = DEFAULT_BACKGROUND_ALPHA
 		return HighlightAttribute{
-			foreground: Editor.gridManager.foreground,
+			foreground: manager.foreground,
 			background: background,
-			special:    Editor.gridManager.special,
+			special:    manager.special,
 		}
 	} else {
-		attrib, ok := Editor.gridManager.attributes[cell.attribID]
+		attrib, ok := manager.attributes[cell.attribID]
 		if !ok {
 			logger.LogF(logger.ERROR, "Attribute id %d not found!", cell.attribID)
 			return attrib
 		}
 		// Zero alpha means color is not set and we use default color
 		if attrib.foreground.A <= 0 {
-			attrib.foreground = Editor.gridManager.foreground
+			attrib.foreground = manager.foreground
 		}
 		if attrib.background.A <= 0 {
-			attrib.background = Editor.gridManager.background
+			attrib.background = manager.background
 			// Default backgrounds are transparent
-			attrib.background.A = Editor.options.transparency
+			attrib.background.A = DEFAULT_BACKGROUND_ALPHA
+		}
+		// Blend is set by neovim for the windows have winblend or pumblend.
+		// Neovim blends the colors itself without multigrid.
+		if attrib.blend > 0 && manager.editor.nvim.HasExt("multigrid") {
+			attrib.background.A = 1 - float32(common.Clamp(attrib.blend, 0, 100))/100
 		}
 		if attrib.special.A <= 0 {
-			attrib.special = Editor.gridManager.special
+			attrib.special = manager.special
 		}
 		// Reverse foreground an background colors if reverse attribute set
 		if attrib.reverse {
 			attrib.foreground, attrib.background = attrib.background, attrib.foreground
 			attrib.reverse = false
+			if attrib.foreground.A < 0 {
+				attrib.foreground.A = 1
+			}
 		}
 		return attrib
 	}
 }
 
 type Grid struct {
+	editor     *EditorContext
 	id         int         // id is the same id used in the grids hashmap
 	number     int         // number specifies the create order of the grid, which starts from zero and counts
 	sRow, sCol int         // top left corner of the grid
@@ -94,7 +126,13 @@ type Grid struct {
 	hidden     bool
 	typ        GridType
 	renderer   *GridRenderer
-	cells      [][]Cell
+	cells      []GridRow
+	// Floating windows fade in and slide when opened and closed. X of the
+	// animation is opacity and Y is the vertical offset in pixels.
+	anim *Tween
+	// For detecting wholesale content changes like tab or buffer switch
+	damage  int  // number of cells changed since last flush
+	resized bool // grid resized since last flush
 }
 
 // For debugging purposes.
@@ -111,23 +149,30 @@ func (grid *Grid) String() string {
 	)
 }
 
-func NewGrid(window *window.Window, id, number int, rows, cols int, kit *fontkit.FontKit, fontSize float64, position common.Vector2[int]) (*Grid, error) {
+func NewGrid(editor *EditorContext, id, number int, rows, cols int, kit *fontkit.FontKit, fontSize float64, position common.Vector2[int]) (*Grid, error) {
 	grid := new(Grid)
+	grid.editor = editor
 	grid.id = id
 	grid.number = number
 	grid.rows = rows
 	grid.cols = cols
+	grid.anim = editor.animator.NewTween(common.Vec2[float32](1, 0), editor.MarkRender)
 	// Create cells
-	grid.cells = make([][]Cell, rows)
+	grid.cells = make([]GridRow, rows)
 	for i := range grid.cells {
-		grid.cells[i] = make([]Cell, cols)
+		grid.cells[i] = NewGridRow(cols)
 	}
 	// Create renderer
 	var err error
-	grid.renderer, err = NewGridRenderer(window, rows, cols, kit, fontSize, position)
+	grid.renderer, err = NewGridRenderer(editor, rows, cols, kit, fontSize, position)
 	if err != nil {
 		return nil, err
 	}
+	grid.renderer.SetWideFontKit(editor.uiOptions.guifontwideKit)
+	grid.renderer.SetLineSpace(editor.uiOptions.linespace)
+	if id == 1 {
+		grid.renderer.SetWarmUp(glyphWarmUpText(editor.options.glyphWarmUp))
+	}
 	logger.Log(logger.DEBUG, "Grid created:", grid)
 	return grid, nil
 }
@@ -151,6 +196,18 @@ func (grid *Grid) SetBoxDrawing(useBoxDrawing, useBlockDrawing bool) {
 	grid.renderer.SetBoxDrawing(useBoxDrawing, useBlockDrawing)
 }
 
+func (grid *Grid) SetUnderline(thickness, offset float64) {
+	grid.renderer.SetUnderline(thickness, offset)
+}
+
+func (grid *Grid) SetWideFontKit(kit *fontkit.FontKit) {
+	grid.renderer.SetWideFontKit(kit)
+}
+
+func (grid *Grid) SetLineSpace(lineSpace int) {
+	grid.renderer.SetLineSpace(lineSpace)
+}
+
 func (grid *Grid) Size() common.Vector2[int] {
 	return common.Vector2[int]{
 		X: grid.cols * grid.CellSize().Width(),
@@ -160,7 +217,7 @@ func (grid *Grid) Size() common.Vector2[int] {
 
 // This function returns a copy of the cell. Does not check bounds.
 func (grid *Grid) CellAt(row, col int) Cell {
-	return grid.cells[row][col]
+	return grid.cells[row].At(col)
 }
 
 // Safe alternative to CellAt. Returns empty cell if out of bounds.
@@ -168,18 +225,22 @@ func (grid *Grid) SafeCellAt(row, col int) Cell {
 	if !grid.IsInBounds(row, col) {
 		return Cell{}
 	}
-	return grid.cells[row][col]
+	return grid.cells[row].At(col)
 }
 
 func (grid *Grid) IsInBounds(row, col int) bool {
 	return row >= 0 && row < grid.rows && col >= 0 && col < grid.cols
 }
 
-// Sets the cell in grid, doesn't checks for bounds
-func (grid *Grid) SetCell(row, col int, char rune, attribID int) {
-	grid.cells[row][col].char = char
-	grid.cells[row][col].attribID = attribID
-	grid.cells[row][col].needsDraw = true
+// Sets count cells starting from the column, doesn't checks for bounds
+func (grid *Grid) SetCells(row, col, count int, char rune, attribID int) {
+	grid.damage += grid.cells[row].Set(col, count, char, attribID)
+}
+
+// Sets the cells starting from the column to the runs, doesn't checks for
+// bounds
+func (grid *Grid) SetRuns(row, col int, runs []CellRun) {
+	grid.damage += grid.cells[row].SetRuns(col, runs)
 }
 
 func (grid *Grid) PixelPos() common.Vector2[int] {
@@ -194,7 +255,7 @@ func (grid *Grid) Scroll(top, bot, rows, left, right int) {
 	// dst and src are row numbers
 	// left and right are column numbers
 	copyRow := func(dst, src, left, right int) {
-		copy(grid.cells[dst][left:right], grid.cells[src][left:right])
+		grid.cells[dst].Copy(&grid.cells[src], left, right)
 		grid.renderer.CopyRow(dst, src, left, right)
 	}
 	if rows > 0 { // Scroll down, move up
@@ -206,7 +267,19 @@ func (grid *Grid) Scroll(top, bot, rows, left, right int) {
 			copyRow(y-rows, y, left, right)
 		}
 	}
-	MarkRender()
+	grid.editor.MarkDamage(grid.CellsRect(top, left, bot-top, right-left))
+}
+
+// Returns the rectangle of the cells in the screen
+func (grid *Grid) CellsRect(row, col, rows, cols int) common.Rectangle[int] {
+	pos := grid.PixelPos()
+	cellSize := grid.CellSize()
+	return common.Rectangle[int]{
+		X: pos.X + col*cellSize.Width(),
+		Y: pos.Y + row*cellSize.Height(),
+		W: cols * cellSize.Width(),
+		H: rows * cellSize.Height(),
+	}
 }
 
 // Don't use this function directly. Use gridManager's resize function.
@@ -215,35 +288,50 @@ func (grid *Grid) Resize(rows, cols int) {
 	if rows == grid.rows && cols == grid.cols {
 		return
 	}
-	// TODO: We can reduce allocations by making cells 1 dimensional array
 	// NOTE: Resizing should not clear the cells
 	EndBenchmark := bench.Begin()
 	// Resize rows
-	if cap(grid.cells) > rows {
+	if len(grid.cells) > rows {
 		grid.cells = grid.cells[:rows]
 	} else {
-		remaining := rows - len(grid.cells)
-		grid.cells = append(grid.cells, make([][]Cell, remaining)...)
+		for len(grid.cells) < rows {
+			grid.cells = append(grid.cells, NewGridRow(grid.cols))
+		}
 	}
 	// Resize cols
 	for i := 0; i < rows; i++ {
-		if cap(grid.cells[i]) > cols {
-			grid.cells[i] = grid.cells[i][:cols]
-		} else {
-			remaining := cols - len(grid.cells[i])
-			grid.cells[i] = append(grid.cells[i], make([]Cell, remaining)...)
-		}
+		grid.cells[i].Resize(cols)
 	}
 	EndBenchmark("Grid.ResizeCells")
 	// Resize renderer
 	grid.renderer.Resize(rows, cols)
 	grid.rows = rows
 	grid.cols = cols
+	grid.resized = true
 	// Resizing renderer also clears it's buffer, because of this we must redraw every cell
-	MarkForceDraw()
+	grid.editor.MarkForceDraw()
 }
 
 func (grid *Grid) SetPos(win nvim.Window, sRow, sCol int, rows, cols int, typ GridType, position common.Vector2[int]) {
+	if typ == GridTypeFloat {
+		// Only animate when the window appears, not when it moves
+		if grid.hidden || grid.typ != GridTypeFloat {
+			grid.Animate(true)
+		}
+	} else if typ == GridTypeMessage && grid.editor.options.messageAnimTime > 0 && position.Y != grid.PixelPos().Y {
+		// Slide the message grid from the old position, or from the bottom
+		// of the window if it wasn't visible
+		from := float32(grid.PixelPos().Y - position.Y)
+		if grid.hidden || grid.typ != GridTypeMessage {
+			from = float32(grid.editor.ScreenSize().Height() - position.Y)
+		} else if !grid.anim.IsFinished() {
+			from += grid.anim.Value().Y
+		}
+		grid.anim.Animate(common.Vec2(1, from), common.Vec2[float32](1, 0), grid.editor.options.messageAnimTime, common.EaseOutCubic)
+		grid.editor.MarkRender()
+	} else if typ != GridTypeMessage {
+		grid.anim.Set(common.Vec2[float32](1, 0))
+	}
 	grid.window = win
 	grid.typ = typ
 	grid.hidden = false
@@ -256,7 +344,7 @@ func (grid *Grid) SetPos(win nvim.Window, sRow, sCol int, rows, cols int, typ Gr
 	}
 	grid.renderer.SetPos(position)
 	logger.Log(logger.DEBUG, "Grid moved:", grid)
-	MarkForceDraw()
+	grid.editor.MarkForceDraw()
 }
 
 func (grid *Grid) Draw(force bool) {
@@ -264,14 +352,39 @@ func (grid *Grid) Draw(force bool) {
 		return
 	}
 	EndBenchmark := bench.Begin()
+	drawn := false
 	for row := 0; row < grid.rows; row++ {
-		for col := 0; col < grid.cols; col++ {
-			cell := grid.CellAt(row, col)
-			if cell.needsDraw || force {
-				grid.renderer.DrawCell(row, col, cell.char, cell.Attribute())
-				grid.cells[row][col].needsDraw = false
+		cells := &grid.cells[row]
+		begin, end := cells.Dirty()
+		if force {
+			begin, end = 0, grid.cols
+		}
+		if begin >= end {
+			continue
+		}
+		drawn = true
+		// Glyphs may overflow to the neighbour cells
+		grid.editor.MarkDamage(grid.CellsRect(row, begin-1, 1, end-begin+2))
+		// Attribute is same for all cells of a run
+		col := 0
+		for _, run := range cells.runs {
+			runEnd := col + int(run.count)
+			if runEnd > begin {
+				cell := run.Cell()
+				attrib := cell.Attribute(grid.editor.gridManager)
+				for c := common.Max(col, begin); c < common.Min(runEnd, end); c++ {
+					grid.renderer.DrawCell(row, c, cell.char, attrib)
+				}
 			}
+			if runEnd >= end {
+				break
+			}
+			col = runEnd
 		}
+		cells.ClearDirty()
+	}
+	if drawn {
+		grid.checkBlended()
 	}
 	if force {
 		EndBenchmark("Grid.ForceDraw")
@@ -280,14 +393,81 @@ func (grid *Grid) Draw(force bool) {
 	}
 }
 
+// Updates whether the grid has cells with blend, every run is checked because
+// scrolling moves the rows without drawing them
+func (grid *Grid) checkBlended() {
+	blended := false
+	if grid.editor.nvim.HasExt("multigrid") {
+		attribs := grid.editor.gridManager.attributes
+	rows:
+		for row := range grid.cells {
+			for _, run := range grid.cells[row].runs {
+				if attrib, ok := attribs[run.Cell().attribID]; ok && attrib.blend > 0 {
+					blended = true
+					break rows
+				}
+			}
+		}
+	}
+	grid.renderer.blending = blended
+}
+
+// Starts the open or close animation of the grid. Animation starts from the
+// current state, so interrupted animations continues smoothly.
+func (grid *Grid) Animate(open bool) {
+	// Slides half of the cell height
+	closed := common.Vec2(0, -float32(grid.CellSize().Height())/2)
+	opened := common.Vec2[float32](1, 0)
+	if open {
+		if grid.anim.IsFinished() {
+			grid.anim.Set(closed)
+		}
+		grid.anim.AnimateTo(opened, grid.editor.options.floatAnimTime, common.EaseOutCubic)
+	} else {
+		grid.anim.AnimateTo(closed, grid.editor.options.floatAnimTime, common.EaseOutCubic)
+	}
+	grid.editor.MarkRender()
+}
+
+// Fades in the new content of the grid if most of the cells changed since the
+// last flush. Resizing also changes every cell, we don't animate it.
+func (grid *Grid) Flush() {
+	if grid.editor.options.switchAnimTime > 0 && grid.editor.state >= EditorFirstFlush &&
+		grid.typ == GridTypeNormal && !grid.hidden && !grid.resized &&
+		grid.damage > grid.rows*grid.cols/2 {
+		grid.anim.Animate(common.Vec2[float32](0, 0), common.Vec2[float32](1, 0), grid.editor.options.switchAnimTime, common.EaseLinear)
+		grid.editor.MarkRender()
+	}
+	grid.damage = 0
+	grid.resized = false
+}
+
+// Returns true if the grid is visible or playing it's close animation
+func (grid *Grid) IsRendering() bool {
+	return !grid.hidden || !grid.anim.IsFinished()
+}
+
 func (grid *Grid) Render() {
-	if grid.hidden {
+	if !grid.IsRendering() {
 		return
 	}
-	grid.renderer.Render()
+	state := grid.anim.Value()
+	// Sliding grids and overflowing glyphs must not bleed to the other grids
+	grid.editor.ClipRender(grid.CellsRect(0, 0, grid.rows, grid.cols))
+	grid.renderer.Render(grid.BackgroundAlpha(), state.X, common.Vec2(0, state.Y))
+	grid.editor.UnclipRender()
+}
+
+// Alpha value of the default background color of this grid
+func (grid *Grid) BackgroundAlpha() float32 {
+	if grid.typ == GridTypeFloat && grid.editor.options.floatTransparency >= 0 {
+		return grid.editor.options.floatTransparency
+	}
+	return grid.editor.options.transparency
 }
 
 func (grid *Grid) Destroy() {
 	logger.Log(logger.DEBUG, "Grid destroyed:", grid)
+	grid.editor.animator.Remove(grid.anim)
 	grid.renderer.Destroy()
 }
@@ -2,94 +2,243 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"unicode"
 
+	"github.com/hismailbulut/Neoray/pkg/bench"
 	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
 	"github.com/neovim/go-client/nvim"
 )
 
+// Names of the unknown or malformed events already logged, newer neovim
+// versions may send them for every redraw and logging once is enough.
+var loggedBadEvents = map[string]bool{}
+
+// Called when a redraw event panics outside of this file, which is a bug in
+// the grids rather than a malformed event. Fuzz tests fail with this.
+var redrawBugHook func(name string, err any)
+
+// Returns the file of the function that panicked, call from the deferred
+// function recovering it
+func panicFile() string {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers, this and the deferred function
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.File
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func logBadEventOnce(name string, message ...any) {
+	if loggedBadEvents[name] {
+		return
+	}
+	loggedBadEvents[name] = true
+	logger.Log(logger.WARN, message...)
+}
+
 func (manager *GridManager) HandleEvents() {
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("GridManager.HandleEvents")
 	// We must only take last cursor event at same redraw event batch, see issue #6
 	var lastGridCursorGoto []interface{}
-	for len(Editor.nvim.eventChan) > 0 {
-		event := <-Editor.nvim.eventChan
-		switch event[0] {
-		// Global events
-		case "set_title":
-			title := event[1].([]interface{})[0].(string)
-			Editor.window.SetTitle(title)
-		case "set_icon":
-		case "mode_info_set":
-			manager.mode_info_set(event[1:])
-		case "option_set":
-			manager.option_set(event[1:])
-		case "mode_change":
-			manager.mode_change(event[1:])
-		case "mouse_on":
-		case "mouse_off":
-		case "busy_start":
-			Editor.cursor.Hide()
-		case "busy_stop":
-			Editor.cursor.Show()
-		case "suspend":
-		case "update_menu":
-		case "bell":
-		case "visual_bell":
-		case "flush":
-			if Editor.state < EditorFirstFlush {
-				SetEditorState(EditorFirstFlush)
-			}
-			MarkDraw()
-		// Grid Events (line-based)
-		case "grid_resize":
-			manager.grid_resize(event[1:])
-		case "default_colors_set":
-			manager.default_colors_set(event[1:])
-		case "hl_attr_define":
-			manager.hl_attr_define(event[1:])
-		case "hl_group_set":
-		case "grid_line":
-			manager.grid_line(event[1:])
-		case "grid_clear":
-			manager.grid_clear(event[1:])
-		case "grid_destroy":
-			manager.grid_destroy(event[1:])
-		case "grid_cursor_goto":
+	for len(manager.editor.nvim.eventChan) > 0 {
+		event := <-manager.editor.nvim.eventChan
+		if len(event) == 0 {
+			continue
+		}
+		name, ok := event[0].(string)
+		if !ok {
+			logBadEventOnce("", "Redraw event has no name:", event)
+			continue
+		}
+		if name == "neoray_attach" {
+			manager.editor.nvim.pendingAttach--
+			manager.resetGrids = manager.editor.nvim.pendingAttach == 0
+			lastGridCursorGoto = nil
+			continue
+		}
+		if manager.editor.nvim.pendingAttach > 0 {
+			continue
+		}
+		if manager.resetGrids {
+			manager.resetGrids = false
+			manager.ResetGrids()
+		}
+		if name == "grid_cursor_goto" {
 			lastGridCursorGoto = event
-		case "grid_scroll":
-			manager.grid_scroll(event[1:])
-		// Multgrid specific events
-		case "win_pos":
-			manager.win_pos(event[1:])
-		case "win_float_pos":
-			manager.win_float_pos(event[1:])
-		case "win_external_pos":
-			manager.win_external_pos(event[1:])
-		case "win_hide":
-			manager.win_hide(event[1:])
-		case "win_close":
-			manager.win_close(event[1:])
-		case "msg_set_pos":
-			manager.msg_set_pos(event[1:])
-		case "win_viewport":
-			manager.win_viewport(event[1:])
+			continue
 		}
+		manager.handleEvent(name, event)
 	}
 	if lastGridCursorGoto != nil {
-		manager.grid_cursor_goto(lastGridCursorGoto[1:])
+		manager.handleEvent("grid_cursor_goto", lastGridCursorGoto)
+	}
+}
+
+// Events may have more fields than we know in newer versions of neovim, the
+// extra ones are ignored. Missing fields or unexpected types panics while
+// converting, we recover and skip the rest of the event. Panics of the grids
+// are recovered too but logged as bugs.
+func (manager *GridManager) handleEvent(name string, event []interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			if filepath.Base(panicFile()) != "grid_events.go" {
+				logger.Log(logger.ERROR, "Redraw event", name, "panicked:", err, "\n"+string(debug.Stack()))
+				if redrawBugHook != nil {
+					redrawBugHook(name, err)
+				}
+				return
+			}
+			logBadEventOnce(name, "Skipped malformed redraw event", name+":", err)
+		}
+	}()
+	switch name {
+	// Global events
+	case "set_title":
+		title := event[1].([]interface{})[0].(string)
+		manager.editor.title.SetNvimTitle(title)
+	case "set_icon":
+	case "mode_info_set":
+		manager.mode_info_set(event[1:])
+	case "option_set":
+		manager.option_set(event[1:])
+	case "mode_change":
+		manager.mode_change(event[1:])
+	case "mouse_on":
+	case "mouse_off":
+	case "busy_start":
+		manager.editor.cursor.SetBusy(true)
+	case "busy_stop":
+		manager.editor.cursor.SetBusy(false)
+	case "suspend":
+	case "update_menu":
+	case "bell":
+	case "visual_bell":
+	case "flush":
+		manager.Flush()
+		manager.editor.nvim.Flushed()
+		manager.editor.minimap.MarkDirty()
+		manager.editor.diffGutter.MarkDirty()
+		manager.editor.terminalImages.MarkDirty()
+		if manager.editor.state < EditorFirstFlush {
+			SetEditorState(EditorFirstFlush)
+		}
+		// Grids report their changed cells
+		manager.editor.MarkPartialDraw()
+	// Grid Events (line-based)
+	case "grid_resize":
+		manager.grid_resize(event[1:])
+	case "default_colors_set":
+		manager.default_colors_set(event[1:])
+	case "hl_attr_define":
+		manager.hl_attr_define(event[1:])
+	case "hl_group_set":
+		manager.hl_group_set(event[1:])
+	case "grid_line":
+		manager.grid_line(event[1:])
+	case "grid_clear":
+		manager.grid_clear(event[1:])
+	case "grid_destroy":
+		manager.grid_destroy(event[1:])
+	case "grid_cursor_goto":
+		manager.grid_cursor_goto(event[1:])
+	case "grid_scroll":
+		manager.grid_scroll(event[1:])
+	// Multgrid specific events
+	case "win_pos":
+		manager.win_pos(event[1:])
+	case "win_float_pos":
+		manager.win_float_pos(event[1:])
+	case "win_external_pos":
+		manager.win_external_pos(event[1:])
+	case "win_hide":
+		manager.win_hide(event[1:])
+	case "win_close":
+		manager.win_close(event[1:])
+	case "msg_set_pos":
+		manager.msg_set_pos(event[1:])
+	case "win_viewport":
+		manager.win_viewport(event[1:])
+	// Message events, only sent when ext_messages is enabled
+	case "msg_show":
+		manager.msg_show(event[1:])
+	case "msg_clear":
+		manager.editor.confirmDialog.Hide()
+		manager.editor.messages.Clear()
+	case "msg_showmode", "msg_showcmd", "msg_ruler":
+		manager.msg_status(name, event[1:])
+	case "msg_history_show":
+		manager.msg_history_show(event[1:])
+	case "msg_history_clear":
+		// The history is only shown until the next message
+	// Cmdline events, sent when ext_cmdline or ext_messages is enabled
+	case "cmdline_show":
+		manager.cmdline_show(event[1:])
+	case "cmdline_pos":
+		manager.cmdline_pos(event[1:])
+	case "cmdline_special_char":
+		manager.cmdline_special_char(event[1:])
+	case "cmdline_hide":
+		manager.cmdline_hide(event[1:])
+	case "cmdline_block_show":
+		manager.cmdline_block_show(event[1:])
+	case "cmdline_block_append":
+		manager.cmdline_block_append(event[1:])
+	case "cmdline_block_hide":
+		manager.editor.cmdline.HideBlock()
+	// Tabline events, only sent when ext_tabline is enabled
+	case "tabline_update":
+		manager.tabline_update(event[1:])
+	default:
+		logBadEventOnce(name, "Unknown redraw event:", name)
 	}
 }
 
 func to_int(v interface{}) int {
+	i, ok := to_int_ok(v)
+	if !ok {
+		panic(fmt.Errorf("to_int: unexpected type %T", v))
+	}
+	return i
+}
+
+// Same as to_int but doesn't panic, ok is false if the value is not a number
+func to_int_ok(v interface{}) (int, bool) {
 	switch v := v.(type) {
 	case int64:
-		return int(v)
+		return int(v), true
 	case uint64:
-		return int(v)
+		return int(v), true
 	case float64:
-		return int(v)
+		return int(v), true
 	default:
-		panic(fmt.Errorf("to_int: unexpected type %T", v))
+		return 0, false
+	}
+}
+
+func to_float64(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		panic(fmt.Errorf("to_float64: unexpected type %T", v))
 	}
 }
 
@@ -107,7 +256,7 @@ func to_uint32(v interface{}) uint32 {
 }
 
 func (manager *GridManager) option_set(args []interface{}) {
-	options := &Editor.uiOptions
+	options := &manager.editor.uiOptions
 	for _, arg := range args {
 		arg := arg.([]interface{})
 		opt := arg[0].(string)
@@ -116,7 +265,7 @@ func (manager *GridManager) option_set(args []interface{}) {
 		case "arabicshape":
 			options.arabicshape = val.(bool)
 		case "ambiwidth":
-			options.ambiwidth = val.(string)
+			options.setAmbiwidth(val.(string))
 		case "emoji":
 			options.emoji = val.(bool)
 		case "guifont":
@@ -124,15 +273,15 @@ func (manager *GridManager) option_set(args []interface{}) {
 		case "guifontset":
 			options.guifontset = val.(string)
 		case "guifontwide":
-			options.guifontwide = val.(string)
+			options.setGuiFontWide(val.(string))
 		case "linespace":
-			options.linespace = to_int(val)
+			options.setLinespace(to_int(val))
 		case "pumblend":
-			options.pumblend = to_int(val)
+			options.setPumblend(to_int(val))
 		case "showtabline":
-			options.showtabline = to_int(val)
+			options.setShowtabline(to_int(val))
 		case "termguicolors":
-			options.termguicolors = val.(bool)
+			options.setTermguicolors(val.(bool))
 		}
 	}
 }
@@ -140,8 +289,8 @@ func (manager *GridManager) option_set(args []interface{}) {
 func (manager *GridManager) mode_info_set(args []interface{}) {
 	for _, arg := range args {
 		arg := arg.([]interface{})
-		Editor.cursor.mode.cursor_style_enabled = arg[0].(bool)
-		Editor.cursor.mode.Clear()
+		manager.editor.cursor.mode.cursor_style_enabled = arg[0].(bool)
+		manager.editor.cursor.mode.Clear()
 		for _, infos := range arg[1].([]interface{}) {
 			infoMap := infos.(map[string]interface{})
 			info := ModeInfo{}
@@ -167,7 +316,7 @@ func (manager *GridManager) mode_info_set(args []interface{}) {
 					info.name = v.(string)
 				}
 			}
-			Editor.cursor.mode.Add(info)
+			manager.editor.cursor.mode.Add(info)
 		}
 	}
 }
@@ -175,8 +324,9 @@ func (manager *GridManager) mode_info_set(args []interface{}) {
 func (manager *GridManager) mode_change(args []interface{}) {
 	for _, arg := range args {
 		arg := arg.([]interface{})
-		Editor.cursor.mode.current_mode_name = arg[0].(string)
-		Editor.cursor.mode.current_mode = to_int(arg[1])
+		manager.editor.cursor.mode.current_mode_name = arg[0].(string)
+		manager.editor.cursor.mode.current_mode = to_int(arg[1])
+		switchIMEMode(arg[0].(string))
 	}
 }
 
@@ -186,6 +336,10 @@ func (manager *GridManager) grid_resize(args []interface{}) {
 		grid_id := to_int(arg[0])
 		cols := to_int(arg[1])
 		rows := to_int(arg[2])
+		if rows < 0 || cols < 0 || rows > MAX_GRID_ROWS || cols > MAX_GRID_COLS || rows*cols > MAX_GRID_CELLS {
+			logBadEventOnce("grid_resize", "Invalid grid size", rows, cols)
+			continue
+		}
 		manager.ResizeGrid(grid_id, rows, cols)
 	}
 }
@@ -202,7 +356,7 @@ func (manager *GridManager) default_colors_set(args []interface{}) {
 		// NOTE: Unlike the corresponding |ui-grid-old| events, the screen is not
 		// always cleared after sending this event. The UI must repaint the
 		// screen with changed background color itself.
-		MarkForceDraw()
+		manager.editor.MarkForceDraw()
 	}
 }
 
@@ -248,12 +402,21 @@ func (manager *GridManager) hl_attr_define(args []interface{}) {
 			case "underdash":
 				// hl_attr.underdash = true
 			case "blend":
-				// hl_attr.blend = int(val.Convert(t_uint).Uint())
+				hl_attr.blend = to_int(v)
 			}
 		}
 		manager.attributes[hl_id] = hl_attr
-		MarkForceDraw()
+		manager.editor.MarkForceDraw()
+	}
+}
+
+// Widgets use the builtin groups for drawing themselves
+func (manager *GridManager) hl_group_set(args []interface{}) {
+	for _, arg := range args {
+		arg := arg.([]interface{})
+		manager.groups[arg[0].(string)] = to_int(arg[1])
 	}
+	manager.editor.MarkForceDraw()
 }
 
 func (manager *GridManager) grid_line(args []interface{}) {
@@ -262,8 +425,10 @@ func (manager *GridManager) grid_line(args []interface{}) {
 		grid_id := to_int(arg[0])
 		row := to_int(arg[1])
 		col := to_int(arg[2])
-		// cells is an array of arrays each with 1 to 3 elements
+		// cells is an array of arrays each with 1 to 3 elements, they are
+		// set together
 		cells := arg[3].([]interface{})
+		runs := manager.lineRuns[:0]
 		hl_id := 0 // if hl_id is not present, we will use the last one
 		for _, cell := range cells {
 			// cell is a slice, may have 1 to 3 elements
@@ -283,13 +448,15 @@ func (manager *GridManager) grid_line(args []interface{}) {
 			if len(cell) >= 2 {
 				hl_id = to_int(cell[1])
 			}
-			// third one is repeat count -optional
+			// third one is repeat count -optional, newer versions may send more
 			repeat := 1
-			if len(cell) == 3 {
-				repeat = to_int(cell[2])
+			if len(cell) >= 3 {
+				repeat = common.Clamp(to_int(cell[2]), 0, math.MaxInt32)
 			}
-			manager.SetCell(grid_id, row, &col, char, hl_id, repeat)
+			runs = append(runs, CellRun{char: char, attribID: int32(hl_id), count: int32(repeat)})
 		}
+		manager.lineRuns = runs
+		manager.SetRuns(grid_id, row, col, runs)
 	}
 }
 
@@ -315,7 +482,7 @@ func (manager *GridManager) grid_cursor_goto(args []interface{}) {
 		grid_id := to_int(arg[0])
 		row := to_int(arg[1])
 		col := to_int(arg[2])
-		Editor.cursor.SetPosition(grid_id, row, col)
+		manager.editor.cursor.SetPosition(grid_id, row, col)
 	}
 }
 
@@ -376,7 +543,12 @@ func (manager *GridManager) win_float_pos(args []interface{}) {
 				row -= grid.rows
 			}
 
+			appeared := grid.hidden || grid.typ != GridTypeFloat
 			manager.SetGridPos(grid_id, win, row, col, grid.rows, grid.cols, GridTypeFloat)
+			// Popup menu has no window
+			if win == -1 && appeared {
+				WarpMouse(grid.PixelPos().Add(grid.CellSize().DivS(2)))
+			}
 		}
 	}
 }
@@ -438,3 +610,212 @@ func (manager *GridManager) win_viewport(args []interface{}) {
 		}
 	*/
 }
+
+// Message and cmdline events are checked instead of recovering, a malformed
+// one is skipped and the others in the batch are still shown.
+func (manager *GridManager) msg_show(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 3 {
+			logBadEventOnce("msg_show", "Skipped malformed msg_show:", arg)
+			continue
+		}
+		kind, ok1 := arg[0].(string)
+		content, ok2 := parseMessageContent(arg[1])
+		replaceLast, ok3 := arg[2].(bool)
+		if !ok1 || !ok2 || !ok3 {
+			logBadEventOnce("msg_show", "Skipped malformed msg_show:", arg)
+			continue
+		}
+		switch kind {
+		case "confirm", "confirm_sub":
+			message := messageText(content)
+			if manager.editor.confirmDialog.Show(message) {
+				continue
+			}
+			// Shown as a message, the user can still type the answer
+			logger.Log(logger.DEBUG, "Confirm message has no choices:", message)
+		default:
+			manager.editor.confirmDialog.Hide()
+		}
+		manager.editor.messages.Show(kind, content, replaceLast)
+	}
+}
+
+func (manager *GridManager) msg_status(name string, args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 1 {
+			logBadEventOnce(name, "Skipped malformed", name+":", arg)
+			continue
+		}
+		content, ok := parseMessageContent(arg[0])
+		if !ok {
+			logBadEventOnce(name, "Skipped malformed", name+":", arg)
+			continue
+		}
+		manager.editor.messages.SetStatus(name, content)
+	}
+}
+
+func (manager *GridManager) msg_history_show(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 1 {
+			logBadEventOnce("msg_history_show", "Skipped malformed msg_history_show:", arg)
+			continue
+		}
+		entries, ok := arg[0].([]interface{})
+		if !ok {
+			logBadEventOnce("msg_history_show", "Skipped malformed msg_history_show:", arg)
+			continue
+		}
+		history := []Message{}
+		for _, entry := range entries {
+			entry, ok := entry.([]interface{})
+			if !ok || len(entry) < 2 {
+				continue
+			}
+			kind, ok1 := entry[0].(string)
+			content, ok2 := parseMessageContent(entry[1])
+			if ok1 && ok2 {
+				history = append(history, Message{kind: kind, cells: content})
+			}
+		}
+		manager.editor.messages.ShowHistory(history)
+	}
+}
+
+func (manager *GridManager) cmdline_show(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 6 {
+			logBadEventOnce("cmdline_show", "Skipped malformed cmdline_show:", arg)
+			continue
+		}
+		content, ok1 := parseMessageContent(arg[0])
+		pos, ok2 := to_int_ok(arg[1])
+		firstc, ok3 := arg[2].(string)
+		prompt, ok4 := arg[3].(string)
+		indent, ok5 := to_int_ok(arg[4])
+		level, ok6 := to_int_ok(arg[5])
+		if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+			logBadEventOnce("cmdline_show", "Skipped malformed cmdline_show:", arg)
+			continue
+		}
+		manager.editor.cmdline.Show(level, CmdlineLevel{
+			content: content,
+			pos:     pos,
+			firstc:  firstc,
+			prompt:  prompt,
+			indent:  indent,
+		})
+	}
+}
+
+func (manager *GridManager) cmdline_pos(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 2 {
+			logBadEventOnce("cmdline_pos", "Skipped malformed cmdline_pos:", arg)
+			continue
+		}
+		pos, ok1 := to_int_ok(arg[0])
+		level, ok2 := to_int_ok(arg[1])
+		if !ok1 || !ok2 {
+			logBadEventOnce("cmdline_pos", "Skipped malformed cmdline_pos:", arg)
+			continue
+		}
+		manager.editor.cmdline.SetCursor(level, pos)
+	}
+}
+
+func (manager *GridManager) cmdline_special_char(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 3 {
+			logBadEventOnce("cmdline_special_char", "Skipped malformed cmdline_special_char:", arg)
+			continue
+		}
+		char, ok1 := arg[0].(string)
+		shift, ok2 := arg[1].(bool)
+		level, ok3 := to_int_ok(arg[2])
+		if !ok1 || !ok2 || !ok3 {
+			logBadEventOnce("cmdline_special_char", "Skipped malformed cmdline_special_char:", arg)
+			continue
+		}
+		manager.editor.cmdline.SetSpecialChar(level, char, shift)
+	}
+}
+
+func (manager *GridManager) cmdline_hide(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 1 {
+			logBadEventOnce("cmdline_hide", "Skipped malformed cmdline_hide:", arg)
+			continue
+		}
+		level, ok := to_int_ok(arg[0])
+		if !ok {
+			logBadEventOnce("cmdline_hide", "Skipped malformed cmdline_hide:", arg)
+			continue
+		}
+		manager.editor.cmdline.Hide(level)
+	}
+}
+
+// Lines of the block are contents like cmdline_show
+func (manager *GridManager) cmdline_block_show(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 1 {
+			logBadEventOnce("cmdline_block_show", "Skipped malformed cmdline_block_show:", arg)
+			continue
+		}
+		lines, ok := arg[0].([]interface{})
+		if !ok {
+			logBadEventOnce("cmdline_block_show", "Skipped malformed cmdline_block_show:", arg)
+			continue
+		}
+		block := [][]MessageCell{}
+		for _, line := range lines {
+			if content, ok := parseMessageContent(line); ok {
+				block = append(block, content)
+			}
+		}
+		manager.editor.cmdline.ShowBlock(block)
+	}
+}
+
+func (manager *GridManager) cmdline_block_append(args []interface{}) {
+	for _, arg := range args {
+		arg, ok := arg.([]interface{})
+		if !ok || len(arg) < 1 {
+			logBadEventOnce("cmdline_block_append", "Skipped malformed cmdline_block_append:", arg)
+			continue
+		}
+		content, ok := parseMessageContent(arg[0])
+		if !ok {
+			logBadEventOnce("cmdline_block_append", "Skipped malformed cmdline_block_append:", arg)
+			continue
+		}
+		manager.editor.cmdline.AppendBlock(content)
+	}
+}
+
+func (manager *GridManager) tabline_update(args []interface{}) {
+	for _, arg := range args {
+		arg := arg.([]interface{})
+		current := arg[0].(nvim.Tabpage)
+		tabs := []TablineTab{}
+		for _, tab := range arg[1].([]interface{}) {
+			tab := tab.(map[string]interface{})
+			tabs = append(tabs, TablineTab{
+				tab:  tab["tab"].(nvim.Tabpage),
+				name: tab["name"].(string),
+			})
+		}
+		// Current buffer and the buffers sent by newer versions are not used
+		manager.editor.tabline.SetTabs(current, tabs)
+	}
+}
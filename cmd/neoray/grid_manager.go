@@ -7,31 +7,53 @@ import (
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/fontkit"
 	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/hismailbulut/Neoray/pkg/window"
 	"github.com/neovim/go-client/nvim"
 )
 
 type GridManager struct {
+	editor      *EditorContext
 	grids       map[int]*Grid
 	sortedGrids []*Grid
+	// Destroyed floating windows stay here until their close animation ends
+	closingGrids []*Grid
+	// Cells of the last grid_line, reused
+	lineRuns []CellRun
+	// Grids of the detached ui are destroyed with the first event of the new
+	// attach, so the screen doesn't flash until neovim redraws
+	resetGrids bool
 	// These are used for creating new grids
 	totalGridsCreated int              // total number of grids created (including deleted ones)
 	kit               *fontkit.FontKit // last globally set font kit
 	fontSize          float64          // last globally set font size
 	// style information
 	attributes map[int]HighlightAttribute
-	foreground common.Color // Default foreground color
-	background common.Color // Default background color
-	special    common.Color // Default special color
+	groups     map[string]int // Attribute ids of the builtin highlight groups
+	foreground common.Color   // Default foreground color
+	background common.Color   // Default background color
+	special    common.Color   // Default special color
 }
 
-func NewGridManager() *GridManager {
+func NewGridManager(editor *EditorContext) *GridManager {
 	grid := &GridManager{
+		editor:     editor,
 		grids:      make(map[int]*Grid),
 		attributes: make(map[int]HighlightAttribute),
+		groups:     make(map[string]int),
 	}
 	return grid
 }
 
+// Returns the attribute of the builtin highlight group, colors may be unset
+func (manager *GridManager) GroupAttribute(name string) (HighlightAttribute, bool) {
+	id, ok := manager.groups[name]
+	if !ok {
+		return HighlightAttribute{}, false
+	}
+	attrib, ok := manager.attributes[id]
+	return attrib, ok
+}
+
 // Font related
 
 func (manager *GridManager) SetGridFontKit(id int, kit *fontkit.FontKit) {
@@ -49,20 +71,21 @@ func (manager *GridManager) SetGridFontKit(id int, kit *fontkit.FontKit) {
 			manager.CheckGridSize(grid, prevSize)
 		}
 	}
-	MarkForceDraw()
+	manager.editor.MarkForceDraw()
 }
 
+// Reloads the fonts with the current DPI, CheckDefaultGridSize must be called
+// after this if the window size is not changed.
 func (manager *GridManager) ResetFontSize() {
 	for _, grid := range manager.grids {
-		grid.SetFontSize(grid.renderer.FontSize(), Editor.window.DPI())
+		grid.SetFontSize(grid.renderer.FontSize(), manager.editor.ScaledDPI())
 	}
-	manager.CheckDefaultGridSize()
 }
 
 func (manager *GridManager) SetGridFontSize(id int, fontSize float64) {
 	if id == 1 {
 		for _, grid := range manager.grids {
-			grid.SetFontSize(fontSize, Editor.window.DPI())
+			grid.SetFontSize(fontSize, manager.editor.ScaledDPI())
 		}
 		manager.fontSize = fontSize
 		manager.CheckDefaultGridSize()
@@ -70,17 +93,17 @@ func (manager *GridManager) SetGridFontSize(id int, fontSize float64) {
 		grid := manager.Grid(id)
 		if grid != nil {
 			prevSize := grid.Size()
-			grid.SetFontSize(fontSize, Editor.window.DPI())
+			grid.SetFontSize(fontSize, manager.editor.ScaledDPI())
 			manager.CheckGridSize(grid, prevSize)
 		}
 	}
-	MarkForceDraw()
+	manager.editor.MarkForceDraw()
 }
 
 func (manager *GridManager) AddGridFontSize(id int, v float64) {
 	if id == 1 {
 		for _, grid := range manager.grids {
-			grid.AddFontSize(v, Editor.window.DPI())
+			grid.AddFontSize(v, manager.editor.ScaledDPI())
 		}
 		manager.fontSize += v
 		manager.CheckDefaultGridSize()
@@ -88,29 +111,49 @@ func (manager *GridManager) AddGridFontSize(id int, v float64) {
 		grid := manager.Grid(id)
 		if grid != nil {
 			prevSize := grid.Size()
-			grid.AddFontSize(v, Editor.window.DPI())
+			grid.AddFontSize(v, manager.editor.ScaledDPI())
 			manager.CheckGridSize(grid, prevSize)
 		}
 	}
-	MarkForceDraw()
+	manager.editor.MarkForceDraw()
 }
 
 func (manager *GridManager) SetBoxDrawing(useBoxDrawing, useBlockDrawing bool) {
 	for _, grid := range manager.grids {
 		grid.SetBoxDrawing(useBoxDrawing, useBlockDrawing)
 	}
-	MarkForceDraw()
+	manager.editor.MarkForceDraw()
+}
+
+func (manager *GridManager) SetUnderline(thickness, offset float64) {
+	for _, grid := range manager.grids {
+		grid.SetUnderline(thickness, offset)
+	}
+	manager.editor.MarkForceDraw()
+}
+
+func (manager *GridManager) SetWideFontKit(kit *fontkit.FontKit) {
+	for _, grid := range manager.grids {
+		grid.SetWideFontKit(kit)
+	}
+	manager.editor.MarkForceDraw()
+}
+
+func (manager *GridManager) SetLineSpace(lineSpace int) {
+	for _, grid := range manager.grids {
+		grid.SetLineSpace(lineSpace)
+	}
+	manager.CheckDefaultGridSize()
+	manager.editor.MarkForceDraw()
 }
 
 func (manager *GridManager) CheckDefaultGridSize() {
 	// We should resize the default grid after font or fontsize change because cell size may has changed
 	defaultGrid := manager.Grid(1)
-	if defaultGrid != nil {
-		cols := Editor.window.Size().Width() / defaultGrid.CellSize().Width()
-		rows := Editor.window.Size().Height() / defaultGrid.CellSize().Height()
-		if rows != defaultGrid.rows || cols != defaultGrid.cols {
-			Editor.nvim.TryResizeUI(rows, cols)
-		}
+	if defaultGrid != nil && !manager.editor.options.lockGridSize {
+		cols := (manager.editor.window.Size().Width() - manager.editor.minimap.Width()) / defaultGrid.CellSize().Width()
+		rows := (manager.editor.window.Size().Height() - manager.editor.tabline.Height()) / defaultGrid.CellSize().Height()
+		manager.editor.nvim.TryResizeUI(rows, cols)
 	}
 }
 
@@ -127,7 +170,7 @@ func (manager *GridManager) CheckGridSize(grid *Grid, prevSize common.Vector2[in
 		// But neovim gives us every grid, we must look it as a separate problem
 		// TODO: per grid font size is not supported at this time and this function is not called anywhere
 		// but we designed Neoray to support per grid font and size and it will be implemented in the future
-		Editor.nvim.TryResizeUIGrid(grid.id, rows, cols)
+		manager.editor.nvim.TryResizeUIGrid(grid.id, rows, cols)
 	}
 }
 
@@ -171,7 +214,7 @@ func (manager *GridManager) SortGrids() {
 func (manager *GridManager) CellAt(pos common.Vector2[int]) (int, int, int) {
 	id, row, col := -1, -1, -1
 	// The input_mouse api call wants 0 for grid when multigrid is not enabled
-	if !Editor.parsedArgs.multiGrid {
+	if !manager.editor.nvim.HasExt("multigrid") {
 		// get cell size of the global grid
 		defaultGrid := manager.Grid(1)
 		if defaultGrid != nil {
@@ -181,8 +224,11 @@ func (manager *GridManager) CellAt(pos common.Vector2[int]) (int, int, int) {
 			col = pos.X / cellSize.Width()
 		}
 	} else {
-		// Multigrid enabled
-		for _, grid := range manager.sortedGrids {
+		// Multigrid enabled, the front most grid has the position. Window
+		// grids include their winbar, the default grid has the statuslines
+		// and the separators.
+		for i := len(manager.sortedGrids) - 1; i >= 0; i-- {
+			grid := manager.sortedGrids[i]
 			if grid.hidden {
 				continue
 			}
@@ -210,7 +256,7 @@ func (manager *GridManager) printCellInfoAt(pos common.Vector2[int]) {
 	grid := manager.Grid(gridID)
 	if grid != nil {
 		cell := grid.CellAt(row, col)
-		attrib, ok := Editor.gridManager.attributes[cell.attribID]
+		attrib, ok := manager.editor.gridManager.attributes[cell.attribID]
 		if !ok {
 			attrib = HighlightAttribute{}
 		}
@@ -234,7 +280,8 @@ func (manager *GridManager) printCellInfoAt(pos common.Vector2[int]) {
 		Tex2: %v Area: %f
 		Fg:   %v
 		Bg:   %v
-		Sp:   %v`
+		Sp:   %v
+		Layers: %v`
 		logger.LogF(logger.DEBUG,
 			format,
 			gridID, row, col,
@@ -255,6 +302,7 @@ func (manager *GridManager) printCellInfoAt(pos common.Vector2[int]) {
 			vertex.Fg,
 			vertex.Bg,
 			vertex.Sp,
+			vertex.Layers,
 		)
 	}
 }
@@ -278,6 +326,54 @@ func (manager *GridManager) SetGridPos(id int, win nvim.Window, sRow, sCol, rows
 	}
 }
 
+// Returns the mouse shape for the position. Resize shapes are used over the
+// window separators and statuslines, arrow over the tabline and I-beam over
+// the text. Separators are only known when multigrid is enabled.
+func (manager *GridManager) MouseShapeAt(pos common.Vector2[int]) window.MouseShape {
+	id, row, col := manager.CellAt(pos)
+	if id == -1 {
+		return window.MouseShapeArrow
+	}
+	if id != 1 || !manager.editor.nvim.HasExt("multigrid") {
+		return window.MouseShapeIBeam
+	}
+	if grid, vertical := manager.SeparatorAt(row, col); grid != nil {
+		if vertical {
+			return window.MouseShapeHResize
+		}
+		return window.MouseShapeVResize
+	}
+	// Tabline is the first row if no window starts there
+	if row == 0 {
+		for _, grid := range manager.grids {
+			if grid.id != 1 && !grid.hidden && grid.typ == GridTypeNormal && grid.sRow == 0 {
+				return window.MouseShapeIBeam
+			}
+		}
+		return window.MouseShapeArrow
+	}
+	return window.MouseShapeIBeam
+}
+
+// Returns the window grid whose vertical separator or statusline is at the
+// cell of the default grid, vertical is true if it is the separator. Returns
+// nil if the cell is not a separator. Only works when multigrid is enabled
+// because windows are in the default grid otherwise.
+func (manager *GridManager) SeparatorAt(row, col int) (grid *Grid, vertical bool) {
+	for _, grid := range manager.grids {
+		if grid.id == 1 || grid.hidden || grid.typ != GridTypeNormal {
+			continue
+		}
+		if col == grid.sCol+grid.cols && row >= grid.sRow && row < grid.sRow+grid.rows {
+			return grid, true
+		}
+		if row == grid.sRow+grid.rows && col >= grid.sCol && col <= grid.sCol+grid.cols {
+			return grid, false
+		}
+	}
+	return nil, false
+}
+
 func (manager *GridManager) Grid(id int) *Grid {
 	grid, ok := manager.grids[id]
 	if ok {
@@ -297,13 +393,13 @@ func (manager *GridManager) ResizeGrid(id int, rows, cols int) {
 			manager.fontSize = DEFAULT_FONT_SIZE
 		}
 		var err error
-		grid, err = NewGrid(Editor.window, id, manager.totalGridsCreated, rows, cols, manager.kit, manager.fontSize, common.Vec2(0, 0))
+		grid, err = NewGrid(manager.editor, id, manager.totalGridsCreated, rows, cols, manager.kit, manager.fontSize, common.Vec2(0, 0))
 		if err != nil {
 			logger.Log(logger.FATAL, "Grid creation failed:", err)
 		}
 		manager.grids[id] = grid
 	}
-	MarkForceDraw()
+	manager.editor.MarkForceDraw()
 }
 
 func (manager *GridManager) ScrollGrid(id, top, bot, rows, left, right int) {
@@ -316,6 +412,9 @@ func (manager *GridManager) ScrollGrid(id, top, bot, rows, left, right int) {
 func (manager *GridManager) HideGrid(id int) {
 	grid, ok := manager.grids[id]
 	if ok {
+		if grid.typ == GridTypeFloat && !grid.hidden {
+			grid.Animate(false)
+		}
 		grid.hidden = true
 		// NOTE: Hide and destroy functions are only calling when multigrid is on.
 		// When this functions called from neovim, we know which grid is hided or
@@ -323,7 +422,7 @@ func (manager *GridManager) HideGrid(id int) {
 		// overlap and hiding a grid on top of a grid causes back grid needs to be
 		// rendered. This is also applies to setPos. We could also try to detect which
 		// grid must be drawed but fully drawing screen is fast and more stable.
-		MarkForceDraw()
+		manager.editor.MarkForceDraw()
 	}
 }
 
@@ -331,15 +430,41 @@ func (manager *GridManager) DestroyGrid(id int) {
 	grid, ok := manager.grids[id]
 	if ok {
 		delete(manager.grids, id)
-		grid.Destroy()
-		MarkForceDraw()
+		if grid.typ == GridTypeFloat && grid.IsRendering() {
+			// Neovim may use the same id for another grid, we can't keep
+			// it in the grids
+			if !grid.hidden {
+				grid.Animate(false)
+				grid.hidden = true
+			}
+			manager.closingGrids = append(manager.closingGrids, grid)
+		} else {
+			grid.Destroy()
+		}
+		manager.editor.MarkForceDraw()
+	}
+}
+
+// Destroys all grids except the default grid, used when attaching again. The
+// default grid keeps its content until neovim redraws it, so the screen
+// doesn't flash.
+func (manager *GridManager) ResetGrids() {
+	for id := range manager.grids {
+		if id != 1 {
+			manager.DestroyGrid(id)
+		}
 	}
+	manager.SortGrids()
 }
 
 func (manager *GridManager) Destroy() {
 	for k := range manager.grids {
 		manager.DestroyGrid(k)
 	}
+	for _, grid := range manager.closingGrids {
+		grid.Destroy()
+	}
+	manager.closingGrids = nil
 	logger.Log(logger.DEBUG, "Grid manager destroyed")
 }
 
@@ -347,31 +472,49 @@ func (manager *GridManager) ClearGrid(id int) {
 	grid, ok := manager.grids[id]
 	if ok {
 		for row := 0; row < grid.rows; row++ {
-			for col := 0; col < grid.cols; col++ {
-				grid.SetCell(row, col, 0, 0)
-			}
+			grid.SetCells(row, 0, grid.cols, 0, 0)
 		}
-		MarkDraw()
+		manager.editor.MarkDraw()
 	}
 }
 
-// Sets the cells at the (x, [y, y+repeat]) to the char and attr, advances y to the end
-func (manager *GridManager) SetCell(id, x int, y *int, char rune, attribId, repeat int) {
+// Sets the cells of the row starting from the column to the runs in one go,
+// the runs are cut at the end of the row.
+func (manager *GridManager) SetRuns(id, row, col int, runs []CellRun) {
 	grid, ok := manager.grids[id]
 	if !ok {
 		return
 	}
-	for i := 0; i < repeat; i++ {
-		if grid.IsInBounds(x, *y) {
-			grid.SetCell(x, *y, char, attribId)
-			*y++
-		}
+	if !grid.IsInBounds(row, col) {
+		return
+	}
+	end := col
+	for i := range runs {
+		runs[i].count = int32(common.Clamp(int(runs[i].count), 0, grid.cols-end))
+		end += int(runs[i].count)
+	}
+	grid.SetRuns(row, col, runs)
+}
+
+func (manager *GridManager) Flush() {
+	for _, grid := range manager.grids {
+		grid.Flush()
 	}
 }
 
 func (manager *GridManager) Update() {
 	EndBenchmark := bench.Begin()
 	manager.HandleEvents()
+	// Destroy closed grids
+	closing := manager.closingGrids[:0]
+	for _, grid := range manager.closingGrids {
+		if grid.IsRendering() {
+			closing = append(closing, grid)
+		} else {
+			grid.Destroy()
+		}
+	}
+	manager.closingGrids = closing
 	EndBenchmark("GridManager.Update")
 }
 
@@ -388,4 +531,7 @@ func (manager *GridManager) Render() {
 	for _, grid := range manager.sortedGrids {
 		grid.Render()
 	}
+	for _, grid := range manager.closingGrids {
+		grid.Render()
+	}
 }
@@ -3,24 +3,32 @@ package main
 import (
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/fontkit"
-	"github.com/hismailbulut/Neoray/pkg/opengl"
-	"github.com/hismailbulut/Neoray/pkg/window"
+	"github.com/hismailbulut/Neoray/pkg/render"
 )
 
 type GridRenderer struct {
-	atlas    *opengl.Atlas        // Font atlas of this renderer
-	buffer   *opengl.VertexBuffer // Vertex buffer of this renderer
+	editor   *EditorContext
+	atlas    *render.Atlas        // Font atlas of this renderer
+	buffer   render.VertexBuffer // Vertex buffer of this renderer
 	position common.Vector2[int]
 	rows     int
 	cols     int
+	unmerged []bool // rows changed since their backgrounds are merged
+	// Translucent backgrounds are composited over the grids below, others
+	// replace the pixels
+	blending bool
 }
 
-func NewGridRenderer(window *window.Window, rows, cols int, kit *fontkit.FontKit, fontSize float64, position common.Vector2[int]) (*GridRenderer, error) {
+func NewGridRenderer(editor *EditorContext, rows, cols int, kit *fontkit.FontKit, fontSize float64, position common.Vector2[int]) (*GridRenderer, error) {
 	renderer := new(GridRenderer)
-	renderer.atlas = window.GL().NewAtlas(kit, fontSize, window.DPI(), Editor.options.boxDrawingEnabled, Editor.options.boxDrawingEnabled)
-	renderer.buffer = window.GL().CreateVertexBuffer(rows * cols)
+	renderer.editor = editor
+	renderer.atlas = render.NewAtlas(editor.window.Renderer(), kit, fontSize, editor.ScaledDPI(), editor.options.boxDrawingEnabled, editor.options.boxDrawingEnabled)
+	renderer.atlas.SetUnderline(editor.options.underlineThickness, editor.options.underlineOffset)
+	renderer.buffer = editor.window.Renderer().CreateVertexBuffer(rows * cols)
+	renderer.buffer.SetRowSize(cols)
 	renderer.rows = rows
 	renderer.cols = cols
+	renderer.unmerged = make([]bool, rows)
 	renderer.position = position
 	renderer.UpdatePositions()
 	return renderer, nil
@@ -44,6 +52,23 @@ func (renderer *GridRenderer) SetBoxDrawing(useBoxDrawing, useBlockDrawing bool)
 	renderer.atlas.SetBoxDrawing(useBoxDrawing, useBlockDrawing)
 }
 
+func (renderer *GridRenderer) SetUnderline(thickness, offset float64) {
+	renderer.atlas.SetUnderline(thickness, offset)
+}
+
+func (renderer *GridRenderer) SetWideFontKit(kit *fontkit.FontKit) {
+	renderer.atlas.SetWideFontKit(kit)
+}
+
+func (renderer *GridRenderer) SetWarmUp(text string) {
+	renderer.atlas.SetWarmUp(text)
+}
+
+func (renderer *GridRenderer) SetLineSpace(lineSpace int) {
+	renderer.atlas.SetLineSpace(lineSpace)
+	renderer.UpdatePositions()
+}
+
 func (renderer *GridRenderer) SetPos(position common.Vector2[int]) {
 	renderer.position = position
 	renderer.UpdatePositions()
@@ -52,7 +77,9 @@ func (renderer *GridRenderer) SetPos(position common.Vector2[int]) {
 func (renderer *GridRenderer) Resize(rows, cols int) {
 	renderer.rows = rows
 	renderer.cols = cols
+	renderer.unmerged = make([]bool, rows)
 	renderer.buffer.Resize(rows * cols)
+	renderer.buffer.SetRowSize(cols)
 	renderer.UpdatePositions()
 }
 
@@ -94,10 +121,51 @@ func (renderer *GridRenderer) UpdatePositions() {
 		for col := 0; col < renderer.cols; col++ {
 			renderer.buffer.SetIndexPos(renderer.cellIndex(row, col), renderer.cellPos(row, col, cellSize))
 		}
+		renderer.unmerged[row] = true
+	}
+}
+
+// Cells without a glyph and undercurl only draw their background
+func isBackgroundOnly(vertex render.Vertex) bool {
+	return vertex.Tex1 == common.ZeroRectangleF32 && vertex.Tex2 == common.ZeroRectangleF32 && vertex.Sp.A == 0
+}
+
+// Adjacent background only cells with the same background are drawn as one
+// quad. First cell of the run covers the others, others have zero size and
+// the geometry shader skips them.
+func (renderer *GridRenderer) mergeBackgrounds() {
+	cellSize := renderer.atlas.ImageSize()
+	for row := 0; row < renderer.rows; row++ {
+		if !renderer.unmerged[row] {
+			continue
+		}
+		renderer.unmerged[row] = false
+		for col := 0; col < renderer.cols; {
+			pos := renderer.cellPos(row, col, cellSize)
+			vertex := renderer.buffer.VertexAt(renderer.cellIndex(row, col))
+			end := col + 1
+			if isBackgroundOnly(vertex) {
+				for end < renderer.cols {
+					next := renderer.buffer.VertexAt(renderer.cellIndex(row, end))
+					if !isBackgroundOnly(next) || next.Bg != vertex.Bg {
+						break
+					}
+					end++
+				}
+			}
+			pos.W *= float32(end - col)
+			renderer.buffer.SetIndexPos(renderer.cellIndex(row, col), pos)
+			for c := col + 1; c < end; c++ {
+				hidden := renderer.cellPos(row, c, cellSize)
+				hidden.W, hidden.H = 0, 0
+				renderer.buffer.SetIndexPos(renderer.cellIndex(row, c), hidden)
+			}
+			col = end
+		}
 	}
 }
 
-func (renderer *GridRenderer) CellVertexData(row, col int) opengl.Vertex {
+func (renderer *GridRenderer) CellVertexData(row, col int) render.Vertex {
 	return renderer.buffer.VertexAt(renderer.cellIndex(row, col))
 }
 
@@ -108,9 +176,11 @@ func (renderer *GridRenderer) CopyRow(dst, src, left, right int) {
 	for i := 0; i < src_end-src_begin; i++ {
 		renderer.buffer.CopyButPos(dst_begin+i, src_begin+i)
 	}
+	renderer.unmerged[dst] = true
 }
 
 func (renderer *GridRenderer) DrawCell(row, col int, char rune, attrib HighlightAttribute) {
+	renderer.unmerged[row] = true
 	// Calculate indices
 	index := renderer.cellIndex(row, col)
 	nextIndex := -1
@@ -124,11 +194,11 @@ func (renderer *GridRenderer) DrawCell(row, col int, char rune, attrib Highlight
 		// This is an empty cell, clear foreground data (not color)
 		// We will not clear foreground color because may the previous cell is a multiwidth character
 		// and it may set the foreground color of this cell
-		renderer.buffer.SetIndexTex1(index, common.ZeroRectangleF32)
+		renderer.buffer.SetIndexTex1(index, common.ZeroRectangleF32, 0)
 		renderer.buffer.SetIndexSp(index, common.ZeroColor)
 		if nextIndex != -1 {
 			// Clear next cells second texture
-			renderer.buffer.SetIndexTex2(nextIndex, common.ZeroRectangleF32)
+			renderer.buffer.SetIndexTex2(nextIndex, common.ZeroRectangleF32, 0)
 		}
 		return
 	}
@@ -142,7 +212,7 @@ func (renderer *GridRenderer) DrawCell(row, col int, char rune, attrib Highlight
 			// it's position to the shader
 			// Buffer must bound while we updating undercurl rectangle
 			renderer.buffer.Bind()
-			renderer.buffer.SetUndercurlRect(renderer.atlas.Normalize(undercurlRect))
+			renderer.buffer.SetUndercurlRect(renderer.atlas.Normalize(undercurlRect), undercurlRect.Layer)
 		}
 		renderer.buffer.SetIndexSp(index, attrib.special)
 	} else {
@@ -163,30 +233,55 @@ func (renderer *GridRenderer) DrawCell(row, col int, char rune, attrib Highlight
 			// Draw the parts more than width to the next cell
 			// NOTE: The more part has the same color with next cell
 			// NOTE: Multiwidth cells causes glyphs to overlap
-			secAtlasPos := common.Rectangle[int]{
-				X: atlasPos.X + cellSize.Width(),
-				Y: atlasPos.Y,
-				W: cellSize.Width(),
-				H: cellSize.Height(),
+			secAtlasPos := render.AtlasPos{
+				Rectangle: common.Rectangle[int]{
+					X: atlasPos.X + cellSize.Width(),
+					Y: atlasPos.Y,
+					W: cellSize.Width(),
+					H: cellSize.Height(),
+				},
+				Layer: atlasPos.Layer,
 			}
-			renderer.buffer.SetIndexTex2(nextIndex, renderer.atlas.Normalize(secAtlasPos))
+			renderer.buffer.SetIndexTex2(nextIndex, renderer.atlas.Normalize(secAtlasPos), secAtlasPos.Layer)
 			renderer.buffer.SetIndexFg(nextIndex, attrib.foreground)
 		}
 	} else if nextIndex != -1 {
 		// Clear second texture.
-		renderer.buffer.SetIndexTex2(nextIndex, common.ZeroRectangleF32)
+		renderer.buffer.SetIndexTex2(nextIndex, common.ZeroRectangleF32, 0)
 	}
 	// Draw
-	renderer.buffer.SetIndexTex1(index, renderer.atlas.Normalize(atlasPos))
+	renderer.buffer.SetIndexTex1(index, renderer.atlas.Normalize(atlasPos), atlasPos.Layer)
 	renderer.buffer.SetIndexFg(index, attrib.foreground)
 }
 
-func (renderer *GridRenderer) Render() {
+// Default backgrounds will be drawn with backgroundAlpha
+// Opacity and offset are used for animating the grid, opacity 1 and zero
+// offset renders the grid as is.
+func (renderer *GridRenderer) Render(backgroundAlpha, opacity float32, offset common.Vector2[float32]) {
+	renderer.mergeBackgrounds()
 	renderer.atlas.BindTexture()
 	renderer.buffer.Bind()
 	renderer.buffer.Update()
-	renderer.buffer.SetProjection(Editor.window.Viewport().ToF32())
+	renderer.buffer.SetProjection(renderer.editor.ProjectionRect())
+	renderer.buffer.SetMinContrast(renderer.editor.options.minContrast)
+	renderer.buffer.SetBackgroundAlpha(backgroundAlpha)
+	animating := opacity < 1 || offset != (common.Vector2[float32]{})
+	if animating {
+		renderer.buffer.SetOpacity(opacity)
+		renderer.buffer.SetOffset(offset)
+	}
+	if animating || renderer.blending {
+		renderer.editor.window.Renderer().SetBlending(true)
+	}
 	renderer.buffer.Render()
+	if animating {
+		// Every buffer uses the same shader, restore the uniforms for others
+		renderer.buffer.SetOpacity(1)
+		renderer.buffer.SetOffset(common.Vector2[float32]{})
+	}
+	if animating || renderer.blending {
+		renderer.editor.window.Renderer().SetBlending(false)
+	}
 }
 
 func (renderer *GridRenderer) Destroy() {
@@ -0,0 +1,199 @@
+package main
+
+import "github.com/hismailbulut/Neoray/pkg/common"
+
+// Consecutive cells with the same character and attribute. Neovim sends
+// grid_line cells as runs too, most of the rows are a few runs of spaces.
+type CellRun struct {
+	char     rune
+	attribID int32
+	count    int32
+}
+
+func (run CellRun) Cell() Cell {
+	return Cell{char: run.char, attribID: int(run.attribID)}
+}
+
+// GridRow stores the cells of a row as runs. Cells between dirtyBegin and
+// dirtyEnd are changed since the last draw.
+type GridRow struct {
+	runs       []CellRun
+	spare      []CellRun // previous runs, reused when rebuilding
+	cols       int
+	dirtyBegin int
+	dirtyEnd   int
+	// Last found run and its first column, cells are mostly read from left
+	// to right and the search continues from there
+	cursor      int
+	cursorBegin int
+}
+
+func NewGridRow(cols int) GridRow {
+	row := GridRow{}
+	row.Resize(cols)
+	return row
+}
+
+func (row *GridRow) Len() int {
+	return row.cols
+}
+
+// Returns the index of the run containing the column and its first column,
+// the length of the runs if the column is out of the row.
+func (row *GridRow) find(col int) (int, int) {
+	i, begin := row.cursor, row.cursorBegin
+	if i >= len(row.runs) || col < begin {
+		i, begin = 0, 0
+	}
+	for i < len(row.runs) && begin+int(row.runs[i].count) <= col {
+		begin += int(row.runs[i].count)
+		i++
+	}
+	row.cursor, row.cursorBegin = i, begin
+	return i, begin
+}
+
+// Returns the cell at the column, doesn't check bounds
+func (row *GridRow) At(col int) Cell {
+	if i, _ := row.find(col); i < len(row.runs) {
+		return row.runs[i].Cell()
+	}
+	return Cell{}
+}
+
+// Appends the run to the runs, merges it with the last one if they are same
+func appendRun(runs []CellRun, run CellRun) []CellRun {
+	if run.count <= 0 {
+		return runs
+	}
+	if len(runs) > 0 {
+		last := &runs[len(runs)-1]
+		if last.char == run.char && last.attribID == run.attribID {
+			last.count += run.count
+			return runs
+		}
+	}
+	return append(runs, run)
+}
+
+// Appends the cells between left and right to the runs
+func (row *GridRow) appendRange(runs []CellRun, left, right int) []CellRun {
+	i, begin := row.find(left)
+	for ; i < len(row.runs) && begin < right; i++ {
+		run := row.runs[i]
+		end := begin + int(run.count)
+		run.count = int32(common.Min(end, right) - common.Max(begin, left))
+		runs = appendRun(runs, run)
+		begin = end
+	}
+	return runs
+}
+
+// Replaces the cells between left and right with the runs appended by middle
+func (row *GridRow) rebuild(left, right int, middle func(runs []CellRun) []CellRun) {
+	runs := row.appendRange(row.spare[:0], 0, left)
+	runs = middle(runs)
+	runs = row.appendRange(runs, right, row.cols)
+	row.spare = row.runs
+	row.runs = runs
+	row.cursor, row.cursorBegin = 0, 0
+	row.MarkDirty(left, right)
+}
+
+// Returns the number of the cells different from the runs starting from col
+func (row *GridRow) changed(col int, runs []CellRun) int {
+	changed := 0
+	i, begin := row.find(col)
+	for _, run := range runs {
+		end := col + int(run.count)
+		for col < end && i < len(row.runs) {
+			old := row.runs[i]
+			oldEnd := begin + int(old.count)
+			count := common.Min(end, oldEnd) - col
+			if old.char != run.char || old.attribID != run.attribID {
+				changed += count
+			}
+			col += count
+			if col == oldEnd {
+				begin = oldEnd
+				i++
+			}
+		}
+	}
+	return changed
+}
+
+// Sets the cells starting from col to the runs with a single rebuild, like a
+// line of grid_line. Returns the number of the cells changed. Doesn't check
+// bounds, counts of the runs must not be negative.
+func (row *GridRow) SetRuns(col int, runs []CellRun) int {
+	count := 0
+	for _, run := range runs {
+		count += int(run.count)
+	}
+	changed := row.changed(col, runs)
+	if changed == 0 {
+		row.MarkDirty(col, col+count)
+		return 0
+	}
+	row.rebuild(col, col+count, func(dst []CellRun) []CellRun {
+		for _, run := range runs {
+			dst = appendRun(dst, run)
+		}
+		return dst
+	})
+	return changed
+}
+
+// Sets count cells starting from col, returns the number of the cells changed.
+// Doesn't check bounds.
+func (row *GridRow) Set(col, count int, char rune, attribID int) int {
+	return row.SetRuns(col, []CellRun{{char: char, attribID: int32(attribID), count: int32(count)}})
+}
+
+// Copies the cells between left and right from the other row. Vertex data is
+// copied by the renderer, only the cells that are dirty in the source row
+// remain dirty.
+func (row *GridRow) Copy(src *GridRow, left, right int) {
+	begin, end := row.dirtyBegin, row.dirtyEnd
+	row.rebuild(left, right, func(runs []CellRun) []CellRun {
+		return src.appendRange(runs, left, right)
+	})
+	row.dirtyBegin, row.dirtyEnd = begin, end
+	row.MarkDirty(common.Max(src.dirtyBegin, left), common.Min(src.dirtyEnd, right))
+}
+
+// Resizing keeps the cells, new cells are empty
+func (row *GridRow) Resize(cols int) {
+	if cols < row.cols {
+		runs := row.appendRange(row.spare[:0], 0, cols)
+		row.spare = row.runs
+		row.runs = runs
+		row.cursor, row.cursorBegin = 0, 0
+	} else {
+		row.runs = appendRun(row.runs, CellRun{count: int32(cols - row.cols)})
+	}
+	row.cols = cols
+	row.ClearDirty()
+}
+
+func (row *GridRow) MarkDirty(begin, end int) {
+	if begin >= end {
+		return
+	}
+	if row.dirtyBegin >= row.dirtyEnd {
+		row.dirtyBegin, row.dirtyEnd = begin, end
+		return
+	}
+	row.dirtyBegin = common.Min(row.dirtyBegin, begin)
+	row.dirtyEnd = common.Max(row.dirtyEnd, end)
+}
+
+// Returns the range of the changed cells, empty if begin >= end
+func (row *GridRow) Dirty() (int, int) {
+	return row.dirtyBegin, row.dirtyEnd
+}
+
+func (row *GridRow) ClearDirty() {
+	row.dirtyBegin, row.dirtyEnd = 0, 0
+}
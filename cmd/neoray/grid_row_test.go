@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func rowString(row *GridRow) string {
+	text := []rune{}
+	for col := 0; col < row.Len(); col++ {
+		char := row.At(col).char
+		if char == 0 {
+			char = '.'
+		}
+		text = append(text, char)
+	}
+	return string(text)
+}
+
+func TestGridRow(t *testing.T) {
+	row := NewGridRow(10)
+	if len(row.runs) != 1 {
+		t.Fatalf("Empty row must be one run, got %v", row.runs)
+	}
+	if changed := row.Set(2, 3, 'a', 1); changed != 3 {
+		t.Errorf("Set must change 3 cells, changed %d", changed)
+	}
+	if changed := row.Set(3, 1, 'a', 1); changed != 0 {
+		t.Errorf("Setting the same cell must not change it, changed %d", changed)
+	}
+	row.Set(5, 2, 'a', 1)
+	if got := rowString(&row); got != "..aaaaa..." {
+		t.Errorf("Row is %q", got)
+	}
+	// Same runs are merged
+	if len(row.runs) != 3 {
+		t.Errorf("Row must have 3 runs, got %v", row.runs)
+	}
+	if begin, end := row.Dirty(); begin != 2 || end != 7 {
+		t.Errorf("Dirty range is %d %d", begin, end)
+	}
+	row.ClearDirty()
+	row.Set(4, 1, 'b', 2)
+	if got := rowString(&row); got != "..aabaa..." {
+		t.Errorf("Row is %q", got)
+	}
+	if row.At(4).attribID != 2 || row.At(5).attribID != 1 {
+		t.Errorf("Wrong attributes %v", row.runs)
+	}
+	// Copy
+	other := NewGridRow(10)
+	other.Copy(&row, 3, 6)
+	if got := rowString(&other); got != "...aba...." {
+		t.Errorf("Copied row is %q", got)
+	}
+	if begin, end := other.Dirty(); begin != 4 || end != 5 {
+		t.Errorf("Only the dirty cells of the source must be dirty, got %d %d", begin, end)
+	}
+	// A line of grid_line is set at once
+	row.ClearDirty()
+	runs := []CellRun{{char: 'a', attribID: 1, count: 2}, {char: 'c', attribID: 3, count: 1}, {char: 'a', attribID: 1, count: 1}}
+	if changed := row.SetRuns(2, runs); changed != 1 {
+		t.Errorf("SetRuns must change 1 cell, changed %d", changed)
+	}
+	if got := rowString(&row); got != "..aacaa..." {
+		t.Errorf("Row is %q", got)
+	}
+	if begin, end := row.Dirty(); begin != 2 || end != 6 {
+		t.Errorf("Dirty range is %d %d", begin, end)
+	}
+	if row.At(9).char != 0 || row.At(4).attribID != 3 || row.At(0).char != 0 {
+		t.Errorf("Cells read out of order are wrong %v", row.runs)
+	}
+	// Resize
+	row.Resize(4)
+	if got := rowString(&row); got != "..aa" {
+		t.Errorf("Shrunk row is %q", got)
+	}
+	row.Resize(6)
+	if got := rowString(&row); got != "..aa.." {
+		t.Errorf("Grown row is %q", got)
+	}
+}
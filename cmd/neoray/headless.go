@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Headless keeps the window hidden, renders every tick and writes the frames
+// as PNG files until the given number of frames is reached, then quits. This
+// is used for render regression tests, neovim can be scripted with the
+// forwarded flags like -c or -S.
+type Headless struct {
+	frames int // zero means disabled
+	dir    string
+	count  int
+}
+
+func NewHeadless(frames int, dir string) *Headless {
+	return &Headless{
+		frames: frames,
+		dir:    dir,
+	}
+}
+
+func (headless *Headless) IsEnabled() bool {
+	return headless.frames > 0
+}
+
+func (headless *Headless) Update() {
+	if !headless.IsEnabled() || Editor.state < EditorWindowShown {
+		return
+	}
+	// Every tick must be rendered, otherwise frames are skipped when
+	// nothing changes
+	Editor.MarkRender()
+}
+
+// Call this after rendering the screen.
+func (headless *Headless) Capture() {
+	if !headless.IsEnabled() || headless.count >= headless.frames {
+		return
+	}
+	headless.count++
+	file := filepath.Join(headless.dir, fmt.Sprintf("frame-%04d.png", headless.count))
+	err := headless.write(file)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to write frame:", err)
+	} else {
+		logger.Log(logger.DEBUG, "Frame written to", file)
+	}
+	if headless.count >= headless.frames {
+		logger.Log(logger.TRACE, "Headless mode finished,", headless.count, "frames written to", headless.dir)
+		select {
+		case Editor.quitChan <- true:
+		default:
+			// Already quitting
+		}
+	}
+}
+
+func (headless *Headless) write(file string) error {
+	img := Editor.window.Renderer().ReadPixels(Editor.window.Viewport())
+	err := os.MkdirAll(headless.dir, 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(out, img)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Neovim finds the health checks in the runtimepath only, this is written to
+// the runtime directory of Neoray and calls the lua module
+//
+//go:embed neoray_health.lua
+var NeorayHealthModule string
+
+// Items are pairs of level and message, levels are the names of the
+// vim.health functions: ok, warn, error and info
+type HealthSection struct {
+	Name  string     `msgpack:"name"`
+	Items [][]string `msgpack:"items"`
+}
+
+func (section *HealthSection) add(level, format string, args ...interface{}) {
+	section.Items = append(section.Items, []string{level, fmt.Sprintf(format, args...)})
+}
+
+// Writes the health module to the cache directory and returns the directory,
+// which must be added to the runtimepath. Returns empty string if it can't be
+// written.
+func WriteHealthRuntime() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to find cache directory:", err)
+		return ""
+	}
+	dir := filepath.Join(cacheDir, "neoray", "runtime")
+	file := filepath.Join(dir, "lua", "neoray", "health.lua")
+	if data, err := os.ReadFile(file); err == nil && string(data) == NeorayHealthModule {
+		return dir
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err == nil {
+		err = os.WriteFile(file, []byte(NeorayHealthModule), 0644)
+	}
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to write health module:", err)
+		return ""
+	}
+	return dir
+}
+
+// Returns the report of :checkhealth neoray, call from main thread
+func HealthReport() []HealthSection {
+	neoray := HealthSection{Name: "Neoray"}
+	neoray.add("info", "Version %d.%d.%d %v", VERSION_MAJOR, VERSION_MINOR, VERSION_PATCH, bench.BUILD_TYPE)
+	neoray.add("info", "Neovim api level %d", Editor.nvim.apiLevel)
+	if Editor.nvim.attached {
+		neoray.add("info", "Attached to a running neovim")
+	} else {
+		neoray.add("info", "Started neovim with %s", Editor.parsedArgs.execPath)
+	}
+
+	renderer := HealthSection{Name: "Renderer"}
+	info := Editor.window.Renderer().Info()
+	renderer.add("ok", "OpenGL %s", info.Version)
+	renderer.add("info", "Renderer: %s (%s)", info.Renderer, info.Vendor)
+	renderer.add("info", "GLSL: %s", info.ShadingLanguageVersion)
+	renderer.add("info", "Max texture size: %d, layers: %d", info.MaxTextureSize, info.MaxArrayTextureLayers)
+	if Editor.window.IsDoubleBuffered() {
+		renderer.add("info", "Double buffered")
+	}
+
+	font := HealthSection{Name: "Font"}
+	kit := Editor.uiOptions.guifontKit
+	if Editor.uiOptions.guifont == "" {
+		font.add("info", "guifont is empty, default font is used")
+	} else if kit == nil {
+		font.add("error", "Font of guifont %s not found, run Neoray with --list-fonts <file> to see the fonts", Editor.uiOptions.guifont)
+	} else {
+		font.add("ok", "guifont %s", Editor.uiOptions.guifont)
+		names := []string{"Regular", "Bold", "Italic", "BoldItalic"}
+		for i, face := range []*fontkit.Font{kit.Regular(), kit.Bold(), kit.Italic(), kit.BoldItalic()} {
+			if face == nil {
+				font.add("info", "%s: not found, the closest face is used", names[i])
+			} else {
+				font.add("info", "%s: %s", names[i], face.FilePath())
+			}
+		}
+	}
+	if Editor.uiOptions.guifontwide != "" && Editor.uiOptions.guifontwideKit == nil {
+		font.add("error", "Font of guifontwide %s not found", Editor.uiOptions.guifontwide)
+	}
+
+	display := HealthSection{Name: "Display"}
+	display.add("info", "DPI: %.1f, scale factor: %.2f", Editor.window.DPI(), Editor.scaleFactor)
+	switch Editor.options.colorProfile {
+	case "":
+		display.add("info", "Color management is disabled")
+	case "auto":
+		if path := Editor.window.ColorProfilePath(); path != "" {
+			display.add("ok", "Color profile of the monitor: %s", path)
+		} else {
+			display.add("warn", "Monitor has no color profile, colors are not converted")
+		}
+	default:
+		display.add("info", "Color profile: %s", Editor.options.colorProfile)
+	}
+
+	options := HealthSection{Name: "Options"}
+	value := reflect.ValueOf(Editor.options)
+	for i := 0; i < value.NumField(); i++ {
+		options.add("info", "%s = %v", value.Type().Field(i).Name, value.Field(i))
+	}
+
+	return []HealthSection{neoray, renderer, font, display, options}
+}
@@ -11,18 +11,20 @@ import (
 	"path/filepath"
 
 	"github.com/hismailbulut/Neoray/pkg/common"
-	"github.com/hismailbulut/Neoray/pkg/opengl"
+	"github.com/hismailbulut/Neoray/pkg/render"
 	"github.com/hismailbulut/Neoray/pkg/window"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/webp"
 )
 
+// ImageViewer shows the image files opened in neovim. Images written by the
+// programs in :terminal buffers are drawn by TerminalImages.
 type ImageViewer struct {
 	hidden    bool
 	imageChan chan string
 	window    *window.Window
-	texture   opengl.Texture
-	buffer    *opengl.VertexBuffer
+	texture   render.Texture
+	buffer    render.VertexBuffer
 }
 
 func NewImageViewer(window *window.Window) *ImageViewer {
@@ -30,8 +32,8 @@ func NewImageViewer(window *window.Window) *ImageViewer {
 		hidden:    true,
 		imageChan: make(chan string, 4),
 		window:    window,
-		texture:   window.GL().CreateTexture(64, 64), // Temporary size
-		buffer:    window.GL().CreateVertexBuffer(1),
+		texture:   window.Renderer().CreateTexture(64, 64), // Temporary size
+		buffer:    window.Renderer().CreateVertexBuffer(1),
 	}
 }
 
@@ -105,9 +107,9 @@ func (viewer *ImageViewer) SetImage(path string) error {
 		W: imgRGBA.Bounds().Dx(),
 		H: imgRGBA.Bounds().Dy(),
 	}
-	viewer.texture.Draw(imgRGBA, dest)
+	viewer.texture.Draw(imgRGBA, dest, 0)
 	// This is always same for every texture
-	viewer.buffer.SetIndexTex1(0, common.Rectangle[float32]{X: 0, Y: 0, W: 1, H: 1})
+	viewer.buffer.SetIndexTex1(0, common.Rectangle[float32]{X: 0, Y: 0, W: 1, H: 1}, 0)
 	return nil
 }
 
@@ -116,7 +118,7 @@ func (viewer *ImageViewer) Show() {
 		return
 	}
 	viewer.hidden = false
-	MarkDraw()
+	Editor.MarkDraw()
 }
 
 func (viewer *ImageViewer) Hide() {
@@ -124,7 +126,7 @@ func (viewer *ImageViewer) Hide() {
 		return
 	}
 	viewer.hidden = true
-	MarkRender()
+	Editor.MarkRender()
 }
 
 func (viewer *ImageViewer) IsVisible() bool {
@@ -148,8 +150,8 @@ func (viewer *ImageViewer) Draw() {
 	}
 	// We fit texture width and height to screen area
 	// And keep aspect ratio while doing this
-	w := float32(viewer.window.Size().Width())
-	h := float32(viewer.window.Size().Height())
+	w := float32(Editor.ScreenSize().Width())
+	h := float32(Editor.ScreenSize().Height())
 	imgW := float32(viewer.texture.Size().Width())
 	imgH := float32(viewer.texture.Size().Height())
 	wRatio := w / imgW
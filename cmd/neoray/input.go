@@ -13,6 +13,7 @@ const (
 	ModAlt
 	ModSuper
 	ModAltGr
+	ModHyper
 )
 
 var (
@@ -84,10 +85,141 @@ var (
 		dragGrid    int
 		dragRow     int
 		dragCol     int
+		// Window separator dragged with mouse, zero if none
+		sepGrid     int
+		sepVertical bool
+		// Statusline press is sent to neovim for the click functions
+		sepStatusline bool
+		// Mouse pressed on the tabline
+		tabDrag bool
+		// Mouse pressed on the minimap
+		minimapDrag bool
+		// Ctrl+click opened a terminal link
+		linkClick bool
+		// Press in the visual selection isn't sent to neovim yet
+		selectionPress bool
+		// Held key repeated by us when the repeat options are set
+		repeat KeyRepeat
+		// Char of the skipped repeat event must be skipped too
+		skipChar bool
+		// Last mode and the input method state of the text modes
+		imeMode string
+		imeOpen bool
 	}
 )
 
+// Key repeat of the OS is used by default. When the delay or rate options
+// are set, OS repeats are ignored and the last pressed key is repeated here.
+type KeyRepeat struct {
+	key     glfw.Key
+	keycode string  // keycode sent when the key is pressed
+	held    float32 // seconds
+	next    float32 // seconds after the delay
+}
+
+const (
+	DEFAULT_KEY_REPEAT_DELAY = 500 // milliseconds
+	DEFAULT_KEY_REPEAT_RATE  = 30  // per second
+	// Maximum repeats sent in a tick, when the tick rate is lower than the
+	// repeat rate
+	MAX_KEY_REPEATS_PER_TICK = 4
+)
+
+func customKeyRepeat() bool {
+	return Editor.options.keyRepeatDelay > 0 || Editor.options.keyRepeatRate > 0
+}
+
+func isArrowKey(key glfw.Key) bool {
+	switch key {
+	case glfw.KeyUp, glfw.KeyDown, glfw.KeyLeft, glfw.KeyRight:
+		return true
+	}
+	return false
+}
+
+// Call this every tick, sends the repeats of the held key
+func UpdateKeyRepeat(delta float32) {
+	repeat := &inputCache.repeat
+	if !customKeyRepeat() || repeat.keycode == "" {
+		return
+	}
+	if isArrowKey(repeat.key) && !Editor.options.keyRepeatArrows {
+		return
+	}
+	delay := float32(Editor.options.keyRepeatDelay) / 1000
+	if delay <= 0 {
+		delay = DEFAULT_KEY_REPEAT_DELAY / 1000.0
+	}
+	interval := float32(1) / DEFAULT_KEY_REPEAT_RATE
+	if Editor.options.keyRepeatRate > 0 {
+		interval = 1 / float32(Editor.options.keyRepeatRate)
+	}
+	repeat.held += delta
+	for i := 0; repeat.held-delay >= repeat.next; i++ {
+		if i < MAX_KEY_REPEATS_PER_TICK {
+			sendKeyInput(repeat.keycode)
+		}
+		repeat.next += interval
+	}
+}
+
+// Text is typed in these modes, others are commands
+func isTextMode(mode string) bool {
+	switch mode {
+	case "insert", "replace", "cmdline_normal", "cmdline_insert", "cmdline_replace":
+		return true
+	}
+	return false
+}
+
+// Closes the input method when leaving the text modes and opens it again if
+// it was open when entering them, so commands aren't sent to the input method.
+func switchIMEMode(mode string) {
+	if !Editor.options.imeAutoSwitch {
+		inputCache.imeMode = ""
+		return
+	}
+	text := isTextMode(mode)
+	if inputCache.imeMode != "" && isTextMode(inputCache.imeMode) == text {
+		inputCache.imeMode = mode
+		return
+	}
+	if text {
+		Editor.window.SetIMEOpen(inputCache.imeOpen)
+	} else {
+		if inputCache.imeMode != "" {
+			inputCache.imeOpen = Editor.window.IMEOpen()
+		}
+		if !Editor.window.SetIMEOpen(false) {
+			logger.Log(logger.WARN, "Switching the input method is not supported on this platform")
+			Editor.options.imeAutoSwitch = false
+		}
+	}
+	inputCache.imeMode = mode
+}
+
 func sendKeyInput(keycode string) {
+	Editor.keycast.KeyInput(keycode)
+	if Editor.quickOpen.IsVisible() {
+		Editor.quickOpen.KeyInput(keycode)
+		return
+	}
+	if Editor.unicodeInput.IsVisible() {
+		Editor.unicodeInput.KeyInput(keycode)
+		return
+	}
+	if Editor.settings.IsVisible() {
+		Editor.settings.KeyInput(keycode)
+		return
+	}
+	if Editor.clipboardHistory.IsVisible() {
+		Editor.clipboardHistory.KeyInput(keycode)
+		return
+	}
+	if Editor.pasteGuard.IsVisible() {
+		Editor.pasteGuard.KeyInput(keycode)
+		return
+	}
 	if !checkNeorayKeybindings(keycode) {
 		Editor.nvim.Input(keycode)
 	}
@@ -125,7 +257,7 @@ func sendMouseInput(button, action string, mods common.BitMask, grid, row, colum
 	}
 	keycode = "<" + modsStr(mods) + keycode + ">"
 	if !checkNeorayKeybindings(keycode) {
-		if !Editor.parsedArgs.multiGrid {
+		if !Editor.nvim.HasExt("multigrid") {
 			// We can assert that grid is one
 			// :h nvim_input_mouse() says send 0 for grid if multigrid is off
 			grid = 0
@@ -136,29 +268,26 @@ func sendMouseInput(button, action string, mods common.BitMask, grid, row, colum
 
 // Returns true if the key is emitted from neoray, and dont send it to neovim.
 func checkNeorayKeybindings(keycode string) bool {
-	// Handle neoray keybindings
-	switch keycode {
-	case Editor.options.keyIncreaseFontSize:
-		Editor.gridManager.AddGridFontSize(1, 0.5)
-		Editor.contextMenu.AddFontSize(0.5)
-		return true
-	case Editor.options.keyDecreaseFontSize:
-		Editor.gridManager.AddGridFontSize(1, -0.5)
-		Editor.contextMenu.AddFontSize(-0.5)
-		return true
-	case Editor.options.keyToggleFullscreen:
-		Editor.window.ToggleFullscreen()
-		return true
-	default: // Do not return true
-		// Hide image preview if it is visible
-		if Editor.imageViewer.IsVisible() {
-			Editor.imageViewer.Hide()
-		}
-		// Hide context menu if it is visible
-		if Editor.contextMenu.IsVisible() {
-			Editor.contextMenu.Hide()
+	if keycode == "<C-k>" && Editor.options.digraphHelper {
+		switch Editor.cursor.mode.Name() {
+		case "insert", "replace", "cmdline_normal", "cmdline_insert", "cmdline_replace":
+			if Editor.unicodeInput.ShowDigraphs() {
+				return true
+			}
 		}
 	}
+	// Handle neoray keybindings, g:neoray_keybinds
+	if runKeybind(keycode) {
+		return true
+	}
+	// Hide image preview if it is visible
+	if Editor.imageViewer.IsVisible() {
+		Editor.imageViewer.Hide()
+	}
+	// Hide context menu if it is visible
+	if Editor.contextMenu.IsVisible() {
+		Editor.contextMenu.Hide()
+	}
 	// Debugging only keybindings
 	if bench.IsDebugBuild() {
 		switch keycode {
@@ -175,9 +304,16 @@ func checkNeorayKeybindings(keycode string) bool {
 }
 
 func CharInputHandler(char rune) {
+	if inputCache.skipChar {
+		inputCache.skipChar = false
+		return
+	}
 	keycode := parseCharInput(char, inputCache.modifiers)
 	if keycode != "" {
 		sendKeyInput(keycode)
+		if inputCache.repeat.key != 0 && inputCache.repeat.keycode == "" {
+			inputCache.repeat.keycode = keycode
+		}
 		// Hide mouse if mousehide option set
 		if Editor.uiOptions.mousehide {
 			Editor.window.HideMouseCursor()
@@ -198,6 +334,11 @@ func parseCharInput(char rune, mods common.BitMask) string {
 		}
 	}
 
+	// Super and Hyper combinations are sent from the key callback
+	if mods.Has(ModSuper) || mods.Has(ModHyper) {
+		return ""
+	}
+
 	// Dont send S alone with any char
 	if mods.HasOnly(ModShift) {
 		mods.Disable(ModShift)
@@ -217,6 +358,12 @@ func parseCharInput(char rune, mods common.BitMask) string {
 
 func KeyInputHandler(key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
 
+	// Hyper is only known from its keys, where the platform reports them
+	if Editor.window.IsHyperKey(scancode) {
+		inputCache.modifiers.EnableIf(ModHyper, action != glfw.Release)
+		return
+	}
+
 	// Toggle modifiers
 	switch key {
 	case glfw.KeyLeftAlt:
@@ -239,7 +386,15 @@ func KeyInputHandler(key glfw.Key, scancode int, action glfw.Action, mods glfw.M
 	// 	Altgr is always a problem, why it's not a different mod?
 
 	inputCache.modifiers.EnableIf(ModShift, action != glfw.Release && mods&glfw.ModShift != 0)
-	inputCache.modifiers.EnableIf(ModSuper, action != glfw.Release && mods&glfw.ModSuper != 0)
+	// Super (Windows, Command) is sent as <D-...> and Hyper as <T-...>. Hyper
+	// shares the modifier of Super on most X11 layouts, Super can't be told
+	// apart while Hyper is held.
+	inputCache.modifiers.EnableIf(ModSuper, action != glfw.Release && mods&glfw.ModSuper != 0 && !inputCache.modifiers.Has(ModHyper))
+	if (inputCache.modifiers.Has(ModSuper) || inputCache.modifiers.Has(ModHyper)) && !Editor.options.superKey {
+		// Super combinations belong to the system
+		inputCache.skipChar = action != glfw.Release
+		return
+	}
 
 	// Check is the modifiers are correct
 	if (inputCache.modifiers.Has(ModAlt) != (mods&glfw.ModAlt != 0)) || (inputCache.modifiers.Has(ModControl) != (mods&glfw.ModControl != 0)) {
@@ -250,11 +405,28 @@ func KeyInputHandler(key glfw.Key, scancode int, action glfw.Action, mods glfw.M
 		}
 	}
 
+	switch action {
+	case glfw.Press:
+		inputCache.repeat = KeyRepeat{key: key}
+		inputCache.skipChar = false
+	case glfw.Release:
+		if key == inputCache.repeat.key {
+			inputCache.repeat = KeyRepeat{}
+		}
+		return
+	case glfw.Repeat:
+		if customKeyRepeat() || (isArrowKey(key) && !Editor.options.keyRepeatArrows) {
+			inputCache.skipChar = true
+			return
+		}
+	}
+
 	// Keys
-	if action != glfw.Release {
-		keycode := parseKeyInput(key, scancode, inputCache.modifiers)
-		if keycode != "" {
-			sendKeyInput(keycode)
+	keycode := parseKeyInput(key, scancode, inputCache.modifiers)
+	if keycode != "" {
+		sendKeyInput(keycode)
+		if action == glfw.Press {
+			inputCache.repeat.keycode = keycode
 		}
 	}
 }
@@ -309,19 +481,40 @@ func MouseInputHandler(button glfw.MouseButton, action glfw.Action, mods glfw.Mo
 	var buttonCode string
 	switch button {
 	case glfw.MouseButtonLeft:
-		if action == glfw.Press && Editor.options.contextMenuEnabled {
-			if Editor.contextMenu.MouseClick(false, inputCache.mousePos) {
-				// Mouse clicked to context menu, dont send to neovim.
-				// TODO: We also need to dont send release action to neovim.
-				return
-			}
+		if action == glfw.Press && Editor.widgets.MouseClick(inputCache.mousePos) {
+			// Mouse clicked to a widget, dont send to neovim.
+			// TODO: We also need to dont send release action to neovim.
+			return
+		}
+		if action == glfw.Press && Editor.minimap.MouseClick(inputCache.mousePos) {
+			inputCache.minimapDrag = true
+			return
+		}
+		if action == glfw.Release && inputCache.minimapDrag {
+			inputCache.minimapDrag = false
+			return
 		}
+		if action == glfw.Press && inputCache.modifiers.Has(ModControl) && Editor.terminalLinks.Open(inputCache.mousePos) {
+			inputCache.linkClick = true
+			return
+		}
+		if action == glfw.Release && inputCache.linkClick {
+			inputCache.linkClick = false
+			return
+		}
+		if separatorMouseInput(action) {
+			return
+		}
+		if selectionMouseInput(action) {
+			return
+		}
+		tabMouseInput(action)
 		buttonCode = "left"
 	case glfw.MouseButtonRight:
 		// We don't send right button to neovim if popup menu enabled.
 		if Editor.options.contextMenuEnabled {
 			if action == glfw.Press {
-				Editor.contextMenu.MouseClick(true, inputCache.mousePos)
+				Editor.contextMenu.ShowAt(inputCache.mousePos)
 			}
 			return
 		}
@@ -352,15 +545,17 @@ func MouseMoveHandler(xpos, ypos float64) {
 		Editor.window.ShowMouseCursor()
 	}
 
-	inputCache.mousePos.X = int(xpos)
-	inputCache.mousePos.Y = int(ypos)
+	inputCache.mousePos = Editor.WindowToScreen(xpos, ypos)
+	Editor.window.SetMouseShape(Editor.gridManager.MouseShapeAt(inputCache.mousePos))
 
-	if Editor.options.contextMenuEnabled {
-		Editor.contextMenu.MouseMove(inputCache.mousePos)
-	}
+	Editor.widgets.MouseMove(inputCache.mousePos)
 
 	// If mouse moving when holding button, it's a drag event
-	if inputCache.mouseAction == glfw.Press {
+	if inputCache.minimapDrag {
+		Editor.minimap.MouseDrag(inputCache.mousePos)
+	} else if inputCache.sepGrid != 0 {
+		dragSeparator()
+	} else if inputCache.mouseAction == glfw.Press && !dragSelectionOut(xpos, ypos) {
 		grid, row, col := Editor.gridManager.CellAt(inputCache.mousePos)
 		// NOTE: Drag event has some multigrid issues
 		// Sending drag event on same row and column causes whole word is selected
@@ -370,6 +565,94 @@ func MouseMoveHandler(xpos, ypos float64) {
 			inputCache.dragRow = row
 			inputCache.dragCol = col
 		}
+	} else {
+		Editor.terminalLinks.MouseMove(Editor.gridManager.CellAt(inputCache.mousePos))
+	}
+}
+
+// Starts or ends dragging the window separator under the mouse, returns true
+// if the input is used. Statuslines are in the default grid and may have %@
+// click functions, neovim also receives the press and the release there. It
+// doesn't resize the window without drag events.
+func separatorMouseInput(action glfw.Action) bool {
+	if action == glfw.Release {
+		if inputCache.sepGrid == 0 {
+			return false
+		}
+		if inputCache.sepStatusline {
+			sendMouseInput("left", "release", inputCache.modifiers, 1, inputCache.dragRow, inputCache.dragCol)
+		}
+		inputCache.sepGrid = 0
+		inputCache.sepStatusline = false
+		inputCache.mouseAction = action
+		return true
+	}
+	if !Editor.nvim.HasExt("multigrid") {
+		return false
+	}
+	id, row, col := Editor.gridManager.CellAt(inputCache.mousePos)
+	if id != 1 {
+		return false
+	}
+	grid, vertical := Editor.gridManager.SeparatorAt(row, col)
+	if grid == nil {
+		return false
+	}
+	inputCache.sepGrid = grid.id
+	inputCache.sepVertical = vertical
+	inputCache.sepStatusline = !vertical
+	if inputCache.sepStatusline {
+		// Released at the same cell, the window may be resized until then
+		inputCache.dragRow = row
+		inputCache.dragCol = col
+		sendMouseInput("left", "press", inputCache.modifiers, 1, row, col)
+	}
+	return true
+}
+
+// Neovim reorders the tabs itself when they are dragged in the tabline. When a
+// tab is dragged out of the window, it is opened in a new Neoray window. The
+// externalized tabline starts dragging when a tab is clicked and moves the tab
+// with :tabmove when it is released.
+func tabMouseInput(action glfw.Action) {
+	if action == glfw.Press {
+		id, row, _ := Editor.gridManager.CellAt(inputCache.mousePos)
+		inputCache.tabDrag = id == 1 && row == 0 && Editor.uiOptions.showtabline > 0 && !Editor.nvim.HasExt("tabline")
+		return
+	}
+	if !inputCache.tabDrag {
+		return
+	}
+	inputCache.tabDrag = false
+	pos := Editor.ScreenToWindow(inputCache.mousePos)
+	size := Editor.window.Size()
+	outside := pos.X < 0 || pos.Y < 0 || pos.X >= size.Width() || pos.Y >= size.Height()
+	if Editor.nvim.HasExt("tabline") {
+		Editor.tabline.MouseRelease(outside)
+	} else if outside {
+		Editor.nvim.TearOffTab(0)
+	}
+}
+
+// Resizes the window of the dragged separator to the mouse position
+func dragSeparator() {
+	grid := Editor.gridManager.Grid(inputCache.sepGrid)
+	defaultGrid := Editor.gridManager.Grid(1)
+	if grid == nil || defaultGrid == nil || grid.hidden {
+		inputCache.sepGrid = 0
+		return
+	}
+	cellSize := defaultGrid.CellSize()
+	if inputCache.sepVertical {
+		width := inputCache.mousePos.X/cellSize.Width() - grid.sCol
+		if width > 0 && width != grid.cols {
+			Editor.nvim.SetWindowWidth(grid.window, width)
+		}
+	} else {
+		height := inputCache.mousePos.Y/cellSize.Height() - grid.sRow
+		if height > 0 && height != grid.rows {
+			Editor.nvim.SetWindowHeight(grid.window, height)
+		}
 	}
 }
 
@@ -393,6 +676,79 @@ func DropHandler(names []string) {
 	}
 }
 
+// Text dropped from other applications is pasted at the drop position. Only
+// supported on Windows, see StartTextDrag.
+func TextDropHandler(text string, xpos, ypos float64) {
+	if Editor.window.IsMinimized() {
+		return
+	}
+	grid, row, col := Editor.gridManager.CellAt(Editor.WindowToScreen(xpos, ypos))
+	sendMouseInput("left", "press", 0, grid, row, col)
+	sendMouseInput("left", "release", 0, grid, row, col)
+	Editor.nvim.Paste(text)
+}
+
+// A press in the visual selection is held back from neovim, dragging it out of
+// the window drags the selected text to other applications. Returns true if the
+// press is held. The held press is sent when the mouse is released or moved to
+// another cell in the window, so the selection works as usual.
+func selectionMouseInput(action glfw.Action) bool {
+	if action == glfw.Release {
+		if inputCache.selectionPress {
+			sendHeldPress()
+		}
+		return false
+	}
+	if !Editor.window.TextDragSupported() {
+		return false
+	}
+	switch Editor.cursor.mode.current_mode_name {
+	case "visual", "select":
+	default:
+		return false
+	}
+	id, row, col := Editor.gridManager.CellAt(inputCache.mousePos)
+	grid := Editor.gridManager.Grid(id)
+	if grid == nil || !Editor.nvim.SelectionContains(grid.sRow+row, grid.sCol+col) {
+		return false
+	}
+	inputCache.selectionPress = true
+	inputCache.mouseButton = "left"
+	inputCache.mouseAction = action
+	inputCache.dragGrid = id
+	inputCache.dragRow = row
+	inputCache.dragCol = col
+	return true
+}
+
+func sendHeldPress() {
+	inputCache.selectionPress = false
+	sendMouseInput("left", "press", inputCache.modifiers, inputCache.dragGrid, inputCache.dragRow, inputCache.dragCol)
+}
+
+// Starts dragging the selected text if the held press is dragged out of the
+// window. Returns true if the drag is started, the mouse button is released
+// when it is dropped.
+func dragSelectionOut(xpos, ypos float64) bool {
+	if !inputCache.selectionPress {
+		return false
+	}
+	size := Editor.window.Size()
+	if xpos >= 0 && ypos >= 0 && xpos < float64(size.Width()) && ypos < float64(size.Height()) {
+		grid, row, col := Editor.gridManager.CellAt(inputCache.mousePos)
+		if grid != inputCache.dragGrid || row != inputCache.dragRow || col != inputCache.dragCol {
+			sendHeldPress()
+		}
+		return false
+	}
+	inputCache.selectionPress = false
+	inputCache.mouseAction = glfw.Release
+	if text := Editor.nvim.SelectedText(); text != "" {
+		Editor.window.StartTextDrag(text)
+	}
+	return true
+}
+
 func modsStr(mods common.BitMask) string {
 	str := ""
 	if mods.Has(ModAlt) {
@@ -407,5 +763,8 @@ func modsStr(mods common.BitMask) string {
 	if mods.Has(ModSuper) {
 		str += "D-"
 	}
+	if mods.Has(ModHyper) {
+		str += "T-"
+	}
 	return str
 }
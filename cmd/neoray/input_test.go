@@ -14,6 +14,10 @@ func TestMain(m *testing.M) {
 		return
 	}
 	c := m.Run()
+	// Created once by the golden and the fuzz tests
+	if Editor.window != nil {
+		Editor.window.Destroy()
+	}
 	glfw.Terminate()
 	os.Exit(c)
 }
@@ -60,6 +64,14 @@ func Test_parseCharInput(t *testing.T) {
 			},
 			want: "S",
 		},
+		{
+			name: "Super + s",
+			args: args{
+				char: 's',
+				mods: ModSuper,
+			},
+			want: "", // handled in key callback
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -121,6 +133,14 @@ func Test_parseKeyInput(t *testing.T) {
 			},
 			want: "<M-C-S-D-Home>", // Yes neoray must send this
 		},
+		{
+			name: "Hyper + F5",
+			args: args{
+				key:  glfw.KeyF5,
+				mods: ModHyper,
+			},
+			want: "<T-F5>",
+		},
 		{
 			name: "g", // must handled in char callback
 			args: args{
@@ -2,18 +2,36 @@ package main
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/hismailbulut/Neoray/pkg/logger"
 )
 
 const (
-	DEFAULT_ADDRESS     = "localhost:17717"
-	DEFAULT_TIMEOUT     = time.Second / 2
-	DEFAULT_BUFFER_SIZE = 1024
+	DEFAULT_ADDRESS = "localhost:17717"
+	DEFAULT_TIMEOUT = time.Second / 2
+	// Clients can't send more than this in a connection, the calls are small
+	// and they are decoded before the token is checked
+	IPC_MAX_CONN_SIZE = 1 << 20
+	// Workspace servers listen on a port between these, chosen by the hash of
+	// the project root
+	WORKSPACE_PORT_BEGIN = 17718
+	WORKSPACE_PORT_COUNT = 10000
+	// Increase this when a message type is added. Servers older than the
+	// version handshake are version 0.
+	IPC_PROTOCOL_VERSION = 1
 )
 
 type IpcMessageType int
@@ -21,6 +39,8 @@ type IpcMessageType int
 type IpcFuncCall struct {
 	MsgType    IpcMessageType
 	MacAddress uint64
+	Root       string // project root, empty if not scoped to a workspace
+	Token      string `json:",omitempty"`
 	Args       []interface{}
 }
 
@@ -30,8 +50,22 @@ const (
 	IPC_MSG_TYPE_OPEN_FILE
 	IPC_MSG_TYPE_GOTO_LINE
 	IPC_MSG_TYPE_GOTO_COLUMN
+	IPC_MSG_TYPE_SET_CWD
+	IPC_MSG_TYPE_WAIT_FILE
+	IPC_MSG_TYPE_HELLO
+	IPC_MSG_TYPE_ERROR
 )
 
+// Message types the server handles, sent to the clients in the handshake.
+// Version 0 servers only handle the first three.
+var ipcCapabilities = []IpcMessageType{
+	IPC_MSG_TYPE_OPEN_FILE,
+	IPC_MSG_TYPE_GOTO_LINE,
+	IPC_MSG_TYPE_GOTO_COLUMN,
+	IPC_MSG_TYPE_SET_CWD,
+	IPC_MSG_TYPE_WAIT_FILE,
+}
+
 func (msgType IpcMessageType) String() string {
 	switch msgType {
 	case IPC_MSG_TYPE_OK:
@@ -44,9 +78,63 @@ func (msgType IpcMessageType) String() string {
 		return "GOTO_LINE"
 	case IPC_MSG_TYPE_GOTO_COLUMN:
 		return "GOTO_COLUMN"
+	case IPC_MSG_TYPE_SET_CWD:
+		return "SET_CWD"
+	case IPC_MSG_TYPE_WAIT_FILE:
+		return "WAIT_FILE"
+	case IPC_MSG_TYPE_HELLO:
+		return "HELLO"
+	case IPC_MSG_TYPE_ERROR:
+		return "ERROR"
 	default:
-		panic("Invalid message type.")
+		// Message types come from other processes, don't panic
+		return fmt.Sprintf("INVALID(%d)", int(msgType))
+	}
+}
+
+// Decodes the function call and validates its arguments. Data comes from
+// another process and may be anything, after this the arguments can be used
+// without checking.
+func decodeIpcCall(data []byte) (IpcFuncCall, error) {
+	var call IpcFuncCall
+	err := json.Unmarshal(data, &call)
+	if err != nil {
+		return call, err
+	}
+	return call, validateIpcCall(call)
+}
+
+// Calls are sent as consecutive json objects, a call may arrive in multiple
+// reads or with the next one. They are read with a json.Decoder and validated
+// with this.
+func validateIpcCall(call IpcFuncCall) error {
+	// json.Unmarshal uses these types for interfaces
+	// bool, for JSON booleans
+	// float64, for JSON numbers
+	// string, for JSON strings
+	// []interface{}, for JSON arrays
+	// map[string]interface{}, for JSON objects
+	// nil for JSON null
+	valid := false
+	switch call.MsgType {
+	case IPC_MSG_TYPE_OK, IPC_MSG_TYPE_CLOSE_CONN:
+		valid = true
+	case IPC_MSG_TYPE_OPEN_FILE, IPC_MSG_TYPE_SET_CWD, IPC_MSG_TYPE_WAIT_FILE, IPC_MSG_TYPE_ERROR:
+		if len(call.Args) == 1 {
+			_, valid = call.Args[0].(string)
+		}
+	case IPC_MSG_TYPE_GOTO_LINE, IPC_MSG_TYPE_GOTO_COLUMN, IPC_MSG_TYPE_HELLO:
+		if len(call.Args) == 1 {
+			_, valid = call.Args[0].(float64)
+		}
+	default:
+		// Sent by a newer Neoray
+		return fmt.Errorf("unknown message type %v", call.MsgType)
+	}
+	if !valid {
+		return fmt.Errorf("invalid function call %v", call)
 	}
+	return nil
 }
 
 func getMacAddress() uint64 {
@@ -74,62 +162,196 @@ func getMacAddress() uint64 {
 	return 0
 }
 
+// Finds the project root by searching .git upwards from the directory. If
+// there is no .git, the directory itself is the root.
+func FindProjectRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// Returns the address of the server for the project root, or the default
+// address if the root is empty
+func ipcAddress(root string) string {
+	if root == "" {
+		return DEFAULT_ADDRESS
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(filepath.Clean(root)))
+	return fmt.Sprintf("localhost:%d", WORKSPACE_PORT_BEGIN+hash.Sum32()%WORKSPACE_PORT_COUNT)
+}
+
+// Connection settings of the single instance. Server listens on localhost if
+// the address is empty. A server reachable from the network needs a token,
+// clients send it with every call. TLS is used if the certificate is given,
+// clients trust only this certificate and servers need the key too.
+type IpcConfig struct {
+	address  string
+	token    string
+	certFile string
+	keyFile  string
+}
+
+// Returns true if only the processes of this machine can connect to the address
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 type IpcClient struct {
-	conn net.Conn
-	mac  uint64
+	conn    net.Conn
+	decoder *json.Decoder
+	mac     uint64
+	root    string
+	token   string
+	// Protocol version and message types of the server, nil capabilities
+	// until the handshake is done
+	version      int
+	capabilities map[IpcMessageType]bool
 }
 
-func CreateClient() (*IpcClient, error) {
+func CreateClient(root string, config IpcConfig) (*IpcClient, error) {
+	address := config.address
+	if address == "" {
+		address = ipcAddress(root)
+	}
 	// NOTE: Timeout parameter may not be enough for tcp connection, but speeds up startup
-	conn, err := net.DialTimeout("tcp", DEFAULT_ADDRESS, DEFAULT_TIMEOUT)
+	dialer := &net.Dialer{Timeout: DEFAULT_TIMEOUT}
+	var conn net.Conn
+	var err error
+	if config.certFile != "" {
+		cert, readErr := os.ReadFile(config.certFile)
+		if readErr != nil {
+			return nil, readErr
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("no certificate found in %s", config.certFile)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{RootCAs: pool})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
 	if err != nil {
 		return nil, err
 	}
 	client := IpcClient{
-		conn: conn,
-		mac:  getMacAddress(),
+		conn:    conn,
+		decoder: json.NewDecoder(conn),
+		mac:     getMacAddress(),
+		root:    root,
+		token:   config.token,
 	}
 	return &client, nil
 }
 
+// Sends our protocol version and receives the version and the capabilities of
+// the server. Version 0 servers answer OK to any call without the version,
+// they also log the unknown HELLO and raise their window like every call
+// does. This is why the handshake is only done when a message type newer than
+// version 0 is asked, see Supports.
+func (client *IpcClient) handshake() {
+	client.version = 0
+	client.capabilities = make(map[IpcMessageType]bool)
+	for _, msgType := range ipcCapabilities[:3] {
+		client.capabilities[msgType] = true
+	}
+	client.conn.SetReadDeadline(time.Now().Add(DEFAULT_TIMEOUT))
+	defer client.conn.SetReadDeadline(time.Time{})
+	resp, ok := client.call(IPC_MSG_TYPE_HELLO, IPC_PROTOCOL_VERSION)
+	if !ok || len(resp.Args) != 2 {
+		logger.Log(logger.DEBUG, "Server answered the handshake without a version, assuming version 0")
+		// Decoder keeps returning the timeout error if it didn't answer
+		client.decoder = json.NewDecoder(client.conn)
+		return
+	}
+	version, _ := resp.Args[0].(float64)
+	client.version = int(version)
+	names, _ := resp.Args[1].([]interface{})
+	for _, name := range names {
+		for _, msgType := range ipcCapabilities {
+			if name == msgType.String() {
+				client.capabilities[msgType] = true
+			}
+		}
+	}
+	logger.Log(logger.DEBUG, "Server protocol version:", client.version, "capabilities:", names)
+}
+
+// Returns true if the server handles the message type, does the handshake
+// first time.
+func (client *IpcClient) Supports(msgType IpcMessageType) bool {
+	if client.capabilities == nil {
+		client.handshake()
+	}
+	return client.capabilities[msgType]
+}
+
 func (client *IpcClient) Call(msgType IpcMessageType, args ...interface{}) bool {
+	_, ok := client.call(msgType, args...)
+	return ok
+}
+
+// Sends the call and returns the response of the server
+func (client *IpcClient) call(msgType IpcMessageType, args ...interface{}) (IpcFuncCall, bool) {
 	logger.Log(logger.DEBUG, "Sending signal:", msgType)
 	// Encode function
 	jsonData, err := json.Marshal(IpcFuncCall{
 		MsgType:    msgType,
 		MacAddress: client.mac,
+		Root:       client.root,
+		Token:      client.token,
 		Args:       args,
 	})
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to encode function call:", err)
-		return false
+		return IpcFuncCall{}, false
 	}
 	_, err = client.conn.Write(jsonData)
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to send signal:", err)
-		return false
+		return IpcFuncCall{}, false
 	}
 	// Read response from server
-	resp := make([]byte, DEFAULT_BUFFER_SIZE)
-	n, err := client.conn.Read(resp)
+	var funcCall IpcFuncCall
+	err = client.decoder.Decode(&funcCall)
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to read response:", err)
-		return false
+		return IpcFuncCall{}, false
 	}
-	resp = resp[:n]
-	// Decode response
-	var funcCall IpcFuncCall
-	err = json.Unmarshal(resp, &funcCall)
+	err = validateIpcCall(funcCall)
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to decode response:", err)
-		return false
+		return funcCall, false
 	}
-	// Check mac address
+	// Check mac address, server may be on another machine if we have a token
 	// NOTE: Actually we don't need to check for mac address in client because
 	// client already sent command to execute but anyway, it seems more secure
-	if funcCall.MacAddress != client.mac {
+	if client.token == "" && funcCall.MacAddress != client.mac {
 		logger.Log(logger.WARN, "Signal rejected: Connected server is not running on same machine.")
-		return false
+		return funcCall, false
+	}
+	if funcCall.Root != client.root {
+		logger.Log(logger.WARN, "Signal rejected: Connected server is in another workspace.")
+		return funcCall, false
 	}
 	// First client sends close call to server, if server accepts, it resends
 	// close call to client and closes its connection. After server closes, client
@@ -137,14 +359,17 @@ func (client *IpcClient) Call(msgType IpcMessageType, args ...interface{}) bool
 	if funcCall.MsgType == IPC_MSG_TYPE_CLOSE_CONN {
 		logger.Log(logger.TRACE, "Disconnected from server.")
 		client.conn.Close()
-		return true
+		return funcCall, true
+	} else if funcCall.MsgType == IPC_MSG_TYPE_ERROR {
+		logger.Log(logger.WARN, "Server rejected the signal:", funcCall.Args[0])
+		return funcCall, false
 	} else if funcCall.MsgType != IPC_MSG_TYPE_OK {
 		// Server always has to send OK. if we are not receive any ok this means there is a
 		// problem in connection
 		logger.Log(logger.TRACE, "Client sent non OK response:", funcCall.MsgType)
-		return false
+		return funcCall, false
 	}
-	return true
+	return funcCall, true
 }
 
 func (client *IpcClient) Close() {
@@ -154,21 +379,47 @@ func (client *IpcClient) Close() {
 
 // Server is a listener, not sends messages but processes incoming messages from clients
 type IpcServer struct {
-	listener  net.Listener
-	mac       uint64
-	callsChan chan IpcFuncCall
+	listener net.Listener
+	mac      uint64
+	root     string
+	token    string
+	// Channels of the clients waiting for the files to be written or closed,
+	// keys are the cleaned full paths
+	waiters     map[string][]chan bool
+	waitersLock sync.Mutex
 }
 
-// Create a server and process incoming signals.
-func CreateServer() (*IpcServer, error) {
-	listener, err := net.Listen("tcp", DEFAULT_ADDRESS)
+// Create a server and process incoming signals. Root is the project root if
+// the server is scoped to a workspace, otherwise empty.
+func CreateServer(root string, config IpcConfig) (*IpcServer, error) {
+	address := config.address
+	if address == "" {
+		address = ipcAddress(root)
+	}
+	// Anyone can open files and run commands otherwise
+	if config.token == "" && !isLoopback(address) {
+		return nil, fmt.Errorf("a token is required to listen on %s", address)
+	}
+	var listener net.Listener
+	var err error
+	if config.certFile != "" {
+		cert, loadErr := tls.LoadX509KeyPair(config.certFile, config.keyFile)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		listener, err = tls.Listen("tcp", address, &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
 	if err != nil {
 		return nil, err
 	}
 	server := IpcServer{
-		listener:  listener,
-		mac:       getMacAddress(),
-		callsChan: make(chan IpcFuncCall, 16),
+		listener: listener,
+		mac:      getMacAddress(),
+		root:     root,
+		token:    config.token,
+		waiters:  make(map[string][]chan bool),
 	}
 	go server.mainLoop()
 	return &server, nil
@@ -176,13 +427,13 @@ func CreateServer() (*IpcServer, error) {
 
 func (server *IpcServer) mainLoop() {
 	// Encode ok message because we always use it
-	encodedOK, err := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_OK, MacAddress: server.mac})
+	encodedOK, err := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_OK, MacAddress: server.mac, Root: server.root})
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to encode OK:", err)
 		return
 	}
 	// Encode CLOSE message because we always use it
-	encodedCLOSE, err := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_CLOSE_CONN, MacAddress: server.mac})
+	encodedCLOSE, err := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_CLOSE_CONN, MacAddress: server.mac, Root: server.root})
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to encode CLOSE:", err)
 		return
@@ -201,27 +452,78 @@ func (server *IpcServer) mainLoop() {
 		// handle connection concurrently
 		go func() {
 			defer conn.Close()
+			decoder := json.NewDecoder(io.LimitReader(conn, IPC_MAX_CONN_SIZE))
 			for {
-				data := make([]byte, DEFAULT_BUFFER_SIZE)
-				n, err := conn.Read(data)
-				if err != nil {
-					logger.Log(logger.WARN, "Failed to read client data:", err)
-					continue
-				}
-				data = data[:n]
-				// decode data
 				var funcCall IpcFuncCall
-				err = json.Unmarshal(data, &funcCall)
+				err := decoder.Decode(&funcCall)
+				var typeErr *json.UnmarshalTypeError
+				if err != nil && !errors.As(err, &typeErr) {
+					// Connection is closed, broken or the data is not json,
+					// reading again fails forever
+					if !errors.Is(err, io.EOF) {
+						logger.Log(logger.WARN, "Failed to read client data:", err)
+					}
+					return
+				}
+				if err == nil {
+					err = validateIpcCall(funcCall)
+				}
 				if err != nil {
+					// Client waits for a response, the stream can be used
+					// after the error
 					logger.Log(logger.WARN, "Failed to decode client data:", err)
+					encodedERROR, _ := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_ERROR, MacAddress: server.mac, Root: server.root, Args: []interface{}{err.Error()}})
+					_, err = conn.Write(encodedERROR)
+					if err != nil {
+						logger.Log(logger.WARN, "Failed to send response to client.")
+						return
+					}
 					continue
 				}
-				// check mac address
-				if funcCall.MacAddress != server.mac {
+				// Tokens are compared in constant time, comparison time
+				// mustn't tell how many bytes are correct
+				if subtle.ConstantTimeCompare([]byte(funcCall.Token), []byte(server.token)) != 1 {
+					logger.Log(logger.WARN, "Signal Rejected: Client", conn.RemoteAddr(), "sent a wrong token.")
+					encodedERROR, _ := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_ERROR, MacAddress: server.mac, Root: server.root, Args: []interface{}{"authentication failed"}})
+					conn.Write(encodedERROR)
+					return
+				}
+				// check mac address, clients have the token may be on
+				// another machine
+				if server.token == "" && funcCall.MacAddress != server.mac {
 					logger.Log(logger.WARN, "Signal Rejected: Connected client is not running on same machine.")
 					break
 				}
+				// Different projects may have the same port
+				if funcCall.Root != server.root {
+					logger.Log(logger.WARN, "Signal Rejected: Connected client is in another workspace.")
+					return
+				}
 				switch funcCall.MsgType {
+				case IPC_MSG_TYPE_HELLO:
+					logger.Log(logger.TRACE, "Client protocol version:", funcCall.Args[0])
+					names := make([]string, len(ipcCapabilities))
+					for i, msgType := range ipcCapabilities {
+						names[i] = msgType.String()
+					}
+					encodedHELLO, _ := json.Marshal(IpcFuncCall{MsgType: IPC_MSG_TYPE_OK, MacAddress: server.mac, Root: server.root, Args: []interface{}{IPC_PROTOCOL_VERSION, names}})
+					_, err = conn.Write(encodedHELLO)
+					if err != nil {
+						logger.Log(logger.WARN, "Failed to send response to client.")
+					}
+					break
+				case IPC_MSG_TYPE_WAIT_FILE:
+					// Response is sent when the file is done, client blocks
+					// until then. Connection is closed without response if
+					// the server is closed before.
+					if !<-server.waitFile(funcCall.Args[0].(string)) {
+						return
+					}
+					_, err = conn.Write(encodedOK)
+					if err != nil {
+						logger.Log(logger.WARN, "Failed to send response to client.")
+					}
+					break
 				case IPC_MSG_TYPE_CLOSE_CONN:
 					logger.Log(logger.TRACE, "Client", conn.RemoteAddr(), "disconnected.")
 					_, err = conn.Write(encodedCLOSE)
@@ -231,7 +533,9 @@ func (server *IpcServer) mainLoop() {
 					}
 					return
 				default:
-					server.callsChan <- funcCall
+					Editor.dispatch.Dispatch(func() {
+						server.handleCall(funcCall)
+					})
 					_, err = conn.Write(encodedOK)
 					if err != nil {
 						logger.Log(logger.WARN, "Failed to send response to client.")
@@ -243,37 +547,66 @@ func (server *IpcServer) mainLoop() {
 	}
 }
 
-func (server *IpcServer) Update() {
-	for len(server.callsChan) > 0 {
-		call := <-server.callsChan
-		// bool, for JSON booleans
-		// float64, for JSON numbers
-		// string, for JSON strings
-		// []interface{}, for JSON arrays
-		// map[string]interface{}, for JSON objects
-		// nil for JSON null
-		switch call.MsgType {
-		case IPC_MSG_TYPE_OPEN_FILE:
-			path := call.Args[0].(string)
-			Editor.nvim.EditFile(path)
-			break
-		case IPC_MSG_TYPE_GOTO_LINE:
-			line := int(call.Args[0].(float64))
-			Editor.nvim.MoveCursor(line, 0)
-			break
-		case IPC_MSG_TYPE_GOTO_COLUMN:
-			column := int(call.Args[0].(float64))
-			Editor.nvim.MoveCursor(0, column)
-			break
-		default:
-			logger.Log(logger.WARN, "Server received invalid signal:", call)
-			break
-		}
-		Editor.window.Raise()
+// Runs in the main thread
+func (server *IpcServer) handleCall(call IpcFuncCall) {
+	// Arguments are validated while decoding
+	switch call.MsgType {
+	case IPC_MSG_TYPE_OPEN_FILE:
+		path := call.Args[0].(string)
+		Editor.nvim.EditFile(path)
+		break
+	case IPC_MSG_TYPE_GOTO_LINE:
+		line := int(call.Args[0].(float64))
+		Editor.nvim.MoveCursor(line, 0)
+		break
+	case IPC_MSG_TYPE_GOTO_COLUMN:
+		column := int(call.Args[0].(float64))
+		Editor.nvim.MoveCursor(0, column)
+		break
+	case IPC_MSG_TYPE_SET_CWD:
+		// Other windows keep their directories
+		path := call.Args[0].(string)
+		go Editor.nvim.ChangeDir(path, true)
+		break
+	default:
+		logger.Log(logger.WARN, "Server received invalid signal:", call)
+		break
+	}
+	Editor.window.Raise()
+}
+
+// Returned channel receives true when the file is written or its buffer is
+// deleted, and false when the server is closed
+func (server *IpcServer) waitFile(path string) chan bool {
+	done := make(chan bool, 1)
+	path = filepath.Clean(path)
+	server.waitersLock.Lock()
+	defer server.waitersLock.Unlock()
+	server.waiters[path] = append(server.waiters[path], done)
+	return done
+}
+
+// Releases the clients waiting for the file, called when a buffer is written
+// or deleted
+func (server *IpcServer) FileDone(path string) {
+	path = filepath.Clean(path)
+	server.waitersLock.Lock()
+	defer server.waitersLock.Unlock()
+	for _, done := range server.waiters[path] {
+		done <- true
 	}
+	delete(server.waiters, path)
 }
 
 func (server *IpcServer) Close() {
+	server.waitersLock.Lock()
+	for path, waiters := range server.waiters {
+		for _, done := range waiters {
+			done <- false
+		}
+		delete(server.waiters, path)
+	}
+	server.waitersLock.Unlock()
 	server.listener.Close()
 	logger.Log(logger.DEBUG, "IPC server closed")
 }
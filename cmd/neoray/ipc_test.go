@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_decodeIpcCall(t *testing.T) {
+	tests := []struct {
+		data  string
+		valid bool
+	}{
+		{`{"MsgType":2,"Args":["/tmp/a.go"]}`, true},
+		{`{"MsgType":2,"Args":[1]}`, false},
+		{`{"MsgType":3,"Args":[10]}`, true},
+		{`{"MsgType":6,"Args":[1]}`, false},
+		{`{"MsgType":7,"Args":[1]}`, true},
+		{`{"MsgType":7,"Args":[]}`, false},
+		{`{"MsgType":8,"Args":["unknown message type"]}`, true},
+		{`{"MsgType":99}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		_, err := decodeIpcCall([]byte(tt.data))
+		if (err == nil) != tt.valid {
+			t.Errorf("decodeIpcCall(%s) error = %v, want valid %v", tt.data, err, tt.valid)
+		}
+	}
+	// Newer clients must get a clear error
+	_, err := decodeIpcCall([]byte(`{"MsgType":99}`))
+	if err == nil || err.Error() != "unknown message type INVALID(99)" {
+		t.Errorf("Unknown message type error is %v", err)
+	}
+}
+
+func Test_isLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:17717":    true,
+		"127.0.0.1:17717":    true,
+		"[::1]:17717":        true,
+		"0.0.0.0:17717":      false,
+		"192.168.1.10:17717": false,
+		"example.com:17717":  false,
+		"localhost":          false, // no port
+	}
+	for address, want := range tests {
+		if got := isLoopback(address); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+// Calls larger than a single read must be received whole
+func TestIpcLargeCall(t *testing.T) {
+	root := strings.Repeat("/project", 1000)
+	config := IpcConfig{address: "127.0.0.1:0"}
+	server, err := CreateServer(root, config)
+	if err != nil {
+		t.Skip("Can't listen:", err)
+	}
+	defer server.Close()
+	config.address = server.listener.Addr().String()
+	client, err := CreateClient(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.Supports(IPC_MSG_TYPE_WAIT_FILE) {
+		t.Error("Server doesn't support WAIT_FILE")
+	}
+	if client.version != IPC_PROTOCOL_VERSION {
+		t.Errorf("Handshake version = %d, want %d", client.version, IPC_PROTOCOL_VERSION)
+	}
+	if !client.Call(IPC_MSG_TYPE_CLOSE_CONN) {
+		t.Error("Close call failed")
+	}
+}
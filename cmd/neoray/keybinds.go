@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Names of the gui actions, keys of the g:neoray_keybinds
+const (
+	KEYBIND_FULLSCREEN        = "fullscreen"
+	KEYBIND_ZOOM_IN           = "zoom_in"
+	KEYBIND_ZOOM_OUT          = "zoom_out"
+	KEYBIND_PASTE             = "paste"
+	KEYBIND_NEW_WINDOW        = "new_window"
+	KEYBIND_TRANSPARENCY_UP   = "transparency_up"
+	KEYBIND_TRANSPARENCY_DOWN = "transparency_down"
+	KEYBIND_QUICK_OPEN        = "quick_open"
+	KEYBIND_UNICODE_INPUT     = "unicode_input"
+	KEYBIND_SETTINGS          = "settings"
+	KEYBIND_SCALE_UP          = "scale_up"
+	KEYBIND_SCALE_DOWN        = "scale_down"
+	KEYBIND_CLIPBOARD_HISTORY = "clipboard_history"
+)
+
+const TRANSPARENCY_STEP = 0.05
+
+// Keybinds maps the gui actions to the key chords. Chords are vim style
+// keycodes, like <C-S-p>, and an action without a chord is disabled.
+type Keybinds map[string]string
+
+func DefaultKeybinds() Keybinds {
+	return Keybinds{
+		KEYBIND_FULLSCREEN:        "<F11>",
+		KEYBIND_ZOOM_IN:           "<C-kPlus>",
+		KEYBIND_ZOOM_OUT:          "<C-kMinus>",
+		KEYBIND_PASTE:             "<C-S-v>",
+		KEYBIND_NEW_WINDOW:        "<C-S-n>",
+		KEYBIND_TRANSPARENCY_UP:   "",
+		KEYBIND_TRANSPARENCY_DOWN: "",
+		KEYBIND_QUICK_OPEN:        "<C-S-p>",
+		KEYBIND_UNICODE_INPUT:     "<C-S-u>",
+		KEYBIND_SETTINGS:          "<C-,>",
+		KEYBIND_SCALE_UP:          "<C-ScrollWheelUp>",
+		KEYBIND_SCALE_DOWN:        "<C-ScrollWheelDown>",
+		KEYBIND_CLIPBOARD_HISTORY: "",
+	}
+}
+
+// Parses g:neoray_keybinds. Actions not in the dictionary keep their default
+// chords, invalid entries and chords bound to more than one action are
+// reported and skipped.
+func ParseKeybinds(dict map[string]interface{}) (Keybinds, []error) {
+	keybinds := DefaultKeybinds()
+	var errs []error
+	// Sorted, the same entry is skipped every time when chords are duplicate
+	actions := make([]string, 0, len(dict))
+	for action := range dict {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	bound := make(map[string]string)
+	for _, action := range actions {
+		str, ok := dict[action].(string)
+		if !ok {
+			errs = append(errs, fmt.Errorf("chord of %s must be a string", action))
+			continue
+		}
+		chord := normalizeChord(str)
+		if other, ok := bound[chord]; ok && chord != "" {
+			errs = append(errs, fmt.Errorf("%s and %s are bound to the same chord %s", other, action, chord))
+			continue
+		}
+		if err := keybinds.Set(action, chord); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		bound[chord] = action
+	}
+	// Map iteration order is random
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return keybinds, errs
+}
+
+// Binds the chord to the action, empty chord or <> disables it. The action the
+// chord was bound to before loses it, so the last binding wins.
+func (keybinds Keybinds) Set(action, chord string) error {
+	if _, ok := keybinds[action]; !ok {
+		return fmt.Errorf("unknown action %s", action)
+	}
+	chord = normalizeChord(chord)
+	if chord != "" {
+		for other, otherChord := range keybinds {
+			if otherChord == chord {
+				keybinds[other] = ""
+			}
+		}
+	}
+	keybinds[action] = chord
+	return nil
+}
+
+// Returns the action bound to the keycode, empty if there is none. A chord is
+// bound to one action at most, see Set.
+func (keybinds Keybinds) Resolve(keycode string) string {
+	if keycode == "" {
+		return ""
+	}
+	for action, chord := range keybinds {
+		if chord == keycode {
+			return action
+		}
+	}
+	return ""
+}
+
+// Modifiers are written in the same order with the keycodes we send to
+// neovim and in upper case, so the user can write <c-s-p> or <S-C-p>.
+func normalizeChord(chord string) string {
+	chord = strings.TrimSpace(chord)
+	if len(chord) < 3 || chord[0] != '<' || chord[len(chord)-1] != '>' {
+		if chord == "<>" {
+			return ""
+		}
+		return chord
+	}
+	key := chord[1 : len(chord)-1]
+	var mods common.BitMask
+	for len(key) > 2 && key[1] == '-' {
+		switch key[0] {
+		case 'M', 'm', 'A', 'a':
+			mods.Enable(ModAlt)
+		case 'C', 'c':
+			mods.Enable(ModControl)
+		case 'S', 's':
+			mods.Enable(ModShift)
+		case 'D', 'd':
+			mods.Enable(ModSuper)
+		default:
+			// Not a modifier, leave as it is
+			return chord
+		}
+		key = key[2:]
+	}
+	return "<" + modsStr(mods) + key + ">"
+}
+
+// Runs the action bound to the keycode, returns false if there is none
+func runKeybind(keycode string) bool {
+	switch Editor.options.keybinds.Resolve(keycode) {
+	case KEYBIND_FULLSCREEN:
+		Editor.window.ToggleFullscreen()
+	case KEYBIND_ZOOM_IN:
+		Editor.gridManager.AddGridFontSize(1, 0.5)
+		Editor.contextMenu.AddFontSize(0.5)
+	case KEYBIND_ZOOM_OUT:
+		Editor.gridManager.AddGridFontSize(1, -0.5)
+		Editor.contextMenu.AddFontSize(-0.5)
+	case KEYBIND_PASTE:
+		PasteClipboard()
+	case KEYBIND_NEW_WINDOW:
+		if err := OpenNewWindow(); err != nil {
+			Editor.nvim.EchoError("Failed to open new window: %v", err)
+		}
+	case KEYBIND_TRANSPARENCY_UP:
+		AddTransparency(TRANSPARENCY_STEP)
+	case KEYBIND_TRANSPARENCY_DOWN:
+		AddTransparency(-TRANSPARENCY_STEP)
+	case KEYBIND_QUICK_OPEN:
+		Editor.quickOpen.Show()
+	case KEYBIND_UNICODE_INPUT:
+		Editor.unicodeInput.Show()
+	case KEYBIND_SETTINGS:
+		Editor.settings.Show()
+	case KEYBIND_SCALE_UP:
+		Editor.nvim.AddScaleFactor(SCALE_FACTOR_STEP)
+	case KEYBIND_SCALE_DOWN:
+		Editor.nvim.AddScaleFactor(-SCALE_FACTOR_STEP)
+	case KEYBIND_CLIPBOARD_HISTORY:
+		Editor.clipboardHistory.Show()
+	default:
+		return false
+	}
+	return true
+}
+
+// Starts another Neoray with the arguments, it has its own neovim
+func OpenNewWindow(args ...string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logger.Log(logger.DEBUG, "Opening new window:", args)
+	cmd := exec.Command(exe, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Changes the Transparency option, 1 is opaque
+func AddTransparency(value float32) {
+	Editor.options.transparency = common.Clamp(Editor.options.transparency+value, 0, 1)
+	logger.Log(logger.DEBUG, "Transparency is", Editor.options.transparency)
+	Editor.MarkRender()
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func Test_normalizeChord(t *testing.T) {
+	tests := []struct {
+		chord string
+		want  string
+	}{
+		{"<C-S-p>", "<C-S-p>"},
+		{"<s-c-p>", "<C-S-p>"},
+		{"<A-C-CR>", "<M-C-CR>"},
+		{" <D-v> ", "<D-v>"},
+		{"<F11>", "<F11>"},
+		{"<C-->", "<C-->"},
+		{"<>", ""},
+		{"", ""},
+		{"<X-a>", "<X-a>"},
+	}
+	for _, tt := range tests {
+		if got := normalizeChord(tt.chord); got != tt.want {
+			t.Errorf("normalizeChord(%q) = %q, want %q", tt.chord, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeybinds(t *testing.T) {
+	keybinds, errs := ParseKeybinds(map[string]interface{}{
+		KEYBIND_PASTE:           "<d-v>",
+		KEYBIND_FULLSCREEN:      "",
+		KEYBIND_TRANSPARENCY_UP: "<C-S-Up>",
+		"unknown":               "<C-x>",
+		KEYBIND_ZOOM_IN:         1,
+		KEYBIND_QUICK_OPEN:      "<F11>",
+		KEYBIND_SETTINGS:        "<F11>",
+		KEYBIND_SCALE_UP:        "<C-S-n>",
+	})
+	if len(errs) != 3 {
+		t.Errorf("Got %d errors, want 3: %v", len(errs), errs)
+	}
+	tests := []struct {
+		keycode string
+		want    string
+	}{
+		{"<D-v>", KEYBIND_PASTE},
+		{"<C-S-v>", ""},
+		{"<F11>", KEYBIND_QUICK_OPEN},
+		{"<C-S-n>", KEYBIND_SCALE_UP},
+		{"<C-S-Up>", KEYBIND_TRANSPARENCY_UP},
+		{"<C-kPlus>", KEYBIND_ZOOM_IN},
+		{"<C-x>", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := keybinds.Resolve(tt.keycode); got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.keycode, got, tt.want)
+		}
+	}
+}
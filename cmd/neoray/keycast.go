@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+const (
+	KEYCAST_MAX_COLS  = 40  // Maximum width of the overlay in cells
+	KEYCAST_MAX_KEYS  = 16  // Maximum number of the keys remembered
+	KEYCAST_HOLD_TIME = 1.5 // Seconds before fading out after the last key
+	KEYCAST_FADE_TIME = 0.5 // Seconds of fading out
+)
+
+type KeycastKey struct {
+	keycode string
+	count   int // Number of times pressed repeatedly
+}
+
+// Keycast shows the pressed keys in the bottom right corner of the window and
+// fades them out after a while. It is useful for screencasts.
+type Keycast struct {
+	pos         common.Vector2[int]
+	enabled     bool
+	cols        int
+	keys        []KeycastKey
+	time        float32 // Seconds since the last key
+	fade        *Tween  // X is the opacity
+	renderer    *GridRenderer
+	requestChan chan bool
+}
+
+func NewKeycast() *Keycast {
+	keycast := new(Keycast)
+	keycast.cols = 1
+	keycast.requestChan = make(chan bool, 1)
+	keycast.fade = Editor.animator.NewTween(common.Vec2[float32](1, 0), Editor.MarkRender)
+	var err error
+	keycast.renderer, err = NewGridRenderer(Editor, 1, keycast.cols, nil, DEFAULT_FONT_SIZE, keycast.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create keycast renderer")
+	}
+	return keycast
+}
+
+func (keycast *Keycast) SetFontKit(kit *fontkit.FontKit) {
+	keycast.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (keycast *Keycast) SetFontSize(size float64) {
+	keycast.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (keycast *Keycast) IsVisible() bool {
+	return keycast.enabled && len(keycast.keys) > 0
+}
+
+// Can be called from any goroutine
+func (keycast *Keycast) RequestToggle() {
+	select {
+	case keycast.requestChan <- true:
+	default:
+	}
+}
+
+func (keycast *Keycast) Toggle() {
+	keycast.enabled = !keycast.enabled
+	keycast.keys = keycast.keys[:0]
+	logger.Log(logger.DEBUG, "Keycast enabled:", keycast.enabled)
+	Editor.MarkRender()
+}
+
+// Call this for every key pressed by the user.
+func (keycast *Keycast) KeyInput(keycode string) {
+	if !keycast.enabled {
+		return
+	}
+	if len(keycast.keys) > 0 && keycast.keys[len(keycast.keys)-1].keycode == keycode {
+		keycast.keys[len(keycast.keys)-1].count++
+	} else {
+		keycast.keys = append(keycast.keys, KeycastKey{keycode: keycode, count: 1})
+		if len(keycast.keys) > KEYCAST_MAX_KEYS {
+			keycast.keys = keycast.keys[1:]
+		}
+	}
+	keycast.time = 0
+	keycast.fade.Set(common.Vec2[float32](1, 0))
+	Editor.MarkDraw()
+}
+
+func (keycast *Keycast) Update(delta float32) {
+	if len(keycast.requestChan) > 0 {
+		<-keycast.requestChan
+		keycast.Toggle()
+	}
+	if !keycast.IsVisible() {
+		return
+	}
+	keycast.time += delta
+	if !keycast.fade.IsFinished() {
+		return
+	}
+	if keycast.fade.Value().X <= 0 {
+		// Faded out
+		keycast.keys = keycast.keys[:0]
+		Editor.MarkRender()
+	} else if keycast.time >= KEYCAST_HOLD_TIME {
+		keycast.fade.AnimateTo(common.Vec2[float32](0, 0), KEYCAST_FADE_TIME, common.EaseLinear)
+	}
+}
+
+// Returns the keys as text, the oldest ones are cut if it doesn't fit
+func (keycast *Keycast) text() []rune {
+	parts := make([]string, len(keycast.keys))
+	for i, key := range keycast.keys {
+		parts[i] = key.keycode
+		if key.count > 1 {
+			parts[i] += fmt.Sprintf("×%d", key.count)
+		}
+	}
+	text := []rune(" " + strings.Join(parts, " ") + " ")
+	if len(text) > KEYCAST_MAX_COLS {
+		text = append([]rune(" …"), text[len(text)-KEYCAST_MAX_COLS+2:]...)
+	}
+	return text
+}
+
+func (keycast *Keycast) Draw() {
+	if !keycast.IsVisible() {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	text := keycast.text()
+	if len(text) != keycast.cols {
+		keycast.cols = len(text)
+		keycast.renderer.Resize(1, keycast.cols)
+	}
+	// Bottom right corner with one cell margin
+	cellSize := keycast.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	keycast.pos = common.Vector2[int]{
+		X: common.Max(windowSize.Width()-(keycast.cols+1)*cellSize.Width()-Editor.minimap.Width(), 0),
+		Y: common.Max(windowSize.Height()-2*cellSize.Height(), 0),
+	}
+	keycast.renderer.SetPos(keycast.pos)
+	attrib := WidgetAttribute("Pmenu")
+	attrib.bold = true
+	keycast.renderer.DrawText(0, 0, text, attrib)
+	EndBenchmark("Keycast.Draw")
+}
+
+func (keycast *Keycast) Render() {
+	if !keycast.IsVisible() {
+		return
+	}
+	keycast.renderer.Render(1, keycast.fade.Value().X, common.Vector2[float32]{})
+}
+
+func (keycast *Keycast) Destroy() {
+	Editor.animator.Remove(keycast.fade)
+	keycast.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Keycast destroyed")
+}
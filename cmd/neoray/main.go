@@ -30,6 +30,14 @@ func init() {
 
 func main() {
 	StartTime = time.Now()
+	// Exit code of the neovim, set after the main loop. Deferred first because
+	// os.Exit doesn't run the other deferred functions.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 	// Init logger
 	logger.Init(NAME, logger.Version{Major: VERSION_MAJOR, Minor: VERSION_MINOR, Patch: VERSION_PATCH}, bench.BUILD_TYPE, true)
 	defer logger.Shutdown()
@@ -45,6 +53,28 @@ func main() {
 	if quit {
 		return
 	}
+	// Stdout is the rpc channel, everything else is printed to stderr
+	if Editor.parsedArgs.channel == "stdio" {
+		stdioChannel = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	// Profiling must be started before everything to measure startup
+	if Editor.parsedArgs.traceFile != "" {
+		bench.StartTrace(Editor.parsedArgs.traceFile)
+		defer func() {
+			err := bench.StopTrace()
+			if err != nil {
+				logger.Log(logger.ERROR, "Failed to write trace:", err)
+			}
+		}()
+	}
+	if Editor.parsedArgs.profileFile != "" {
+		err := bench.StartCPUProfile(Editor.parsedArgs.profileFile)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to start cpu profile:", err)
+		}
+		defer bench.StopCPUProfile()
+	}
 	// If ProcessBefore returns true, neoray will not start.
 	// Initializes logfile if required argument passed
 	// And also initializes server if required argument passed
@@ -62,4 +92,5 @@ func main() {
 	logger.Log(logger.TRACE, "Initialization time:", time.Since(StartTime))
 	// MainLoop is main loop of the neoray.
 	MainLoop()
+	exitCode = Editor.nvim.exitCode
 }
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Older messages are dropped, only the last ones can be seen anyway
+const MESSAGES_MAX_COUNT = 100
+
+// A character of a message or the cmdline with its highlight
+type MessageCell struct {
+	char     rune
+	attribID int
+}
+
+type Message struct {
+	kind  string
+	cells []MessageCell
+}
+
+// Parses the content of a message or the cmdline, which is an array of
+// [attr_id, text] chunks. Returns false if the content is malformed.
+func parseMessageContent(content interface{}) ([]MessageCell, bool) {
+	chunks, ok := content.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	cells := []MessageCell{}
+	for _, chunk := range chunks {
+		chunk, ok := chunk.([]interface{})
+		if !ok || len(chunk) < 2 {
+			return nil, false
+		}
+		attribID, ok := to_int_ok(chunk[0])
+		if !ok {
+			return nil, false
+		}
+		text, ok := chunk[1].(string)
+		if !ok {
+			return nil, false
+		}
+		for _, char := range text {
+			cells = append(cells, MessageCell{char: char, attribID: attribID})
+		}
+	}
+	return cells, true
+}
+
+func messageText(cells []MessageCell) string {
+	var text strings.Builder
+	for _, cell := range cells {
+		text.WriteRune(cell.char)
+	}
+	return text.String()
+}
+
+func textCells(text string, attribID int) []MessageCell {
+	cells := []MessageCell{}
+	for _, char := range text {
+		cells = append(cells, MessageCell{char: char, attribID: attribID})
+	}
+	return cells
+}
+
+// Splits the cells to the lines at the newlines and wraps the lines longer
+// than cols. Tabs are shown as a space.
+func wrapMessageCells(cells []MessageCell, cols int) [][]MessageCell {
+	cols = common.Max(cols, 1)
+	lines := [][]MessageCell{{}}
+	for _, cell := range cells {
+		last := len(lines) - 1
+		if cell.char == '\n' {
+			lines = append(lines, []MessageCell{})
+			continue
+		}
+		if len(lines[last]) == cols {
+			lines = append(lines, []MessageCell{})
+			last++
+		}
+		if cell.char == '\t' {
+			cell.char = ' '
+		}
+		lines[last] = append(lines[last], cell)
+	}
+	return lines
+}
+
+// Returns the attribute of the highlight id for drawing over the grids, the
+// default background is opaque.
+func messageAttribute(attribID int) HighlightAttribute {
+	cell := Cell{attribID: attribID}
+	attrib := cell.Attribute(Editor.gridManager)
+	attrib.background.A = 1
+	attrib.blend = 0
+	return attrib
+}
+
+// Draws the cells to the row and clears the rest of the row
+func drawMessageCells(renderer *GridRenderer, row int, cells []MessageCell) {
+	for col := 0; col < renderer.cols; col++ {
+		cell := MessageCell{}
+		if col < len(cells) {
+			cell = cells[col]
+		}
+		char := cell.char
+		if char == ' ' {
+			char = 0
+		}
+		renderer.DrawCell(row, col, char, messageAttribute(cell.attribID))
+	}
+}
+
+// Messages shows the messages of neovim at the bottom of the window when
+// ext_messages is enabled, above the cmdline if it is visible. Messages stay
+// until neovim clears them like in the message area. The mode, the partial
+// command and the ruler are shown in the last row when the cmdline is hidden.
+// Confirm prompts are shown by the ConfirmDialog.
+type Messages struct {
+	pos      common.Vector2[int]
+	messages []Message
+	history  bool // Messages are the :messages history
+	showmode []MessageCell
+	showcmd  []MessageCell
+	ruler    []MessageCell
+	rows     int // Zero when nothing is drawn
+	cols     int
+	renderer *GridRenderer
+}
+
+func NewMessages() *Messages {
+	messages := new(Messages)
+	var err error
+	messages.renderer, err = NewGridRenderer(Editor, 1, 1, nil, DEFAULT_FONT_SIZE, messages.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create messages renderer")
+	}
+	return messages
+}
+
+func (messages *Messages) SetFontKit(kit *fontkit.FontKit) {
+	messages.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (messages *Messages) SetFontSize(size float64) {
+	messages.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+// Call this when neovim sends msg_show. Replaces the last message if
+// replaceLast is true, an empty message only removes it.
+func (messages *Messages) Show(kind string, cells []MessageCell, replaceLast bool) {
+	if messages.history {
+		messages.history = false
+		messages.messages = nil
+	}
+	if replaceLast && len(messages.messages) > 0 {
+		messages.messages = messages.messages[:len(messages.messages)-1]
+	}
+	if len(cells) > 0 {
+		messages.messages = append(messages.messages, Message{kind: kind, cells: cells})
+		if len(messages.messages) > MESSAGES_MAX_COUNT {
+			messages.messages = messages.messages[1:]
+		}
+	}
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends msg_history_show
+func (messages *Messages) ShowHistory(entries []Message) {
+	messages.history = true
+	messages.messages = entries
+	Editor.MarkDraw()
+}
+
+// Call this when neovim sends msg_clear
+func (messages *Messages) Clear() {
+	if len(messages.messages) > 0 {
+		messages.messages = nil
+		messages.history = false
+		Editor.MarkDraw()
+	}
+}
+
+// Call this when neovim sends msg_showmode, msg_showcmd or msg_ruler
+func (messages *Messages) SetStatus(name string, cells []MessageCell) {
+	switch name {
+	case "msg_showmode":
+		messages.showmode = cells
+	case "msg_showcmd":
+		messages.showcmd = cells
+	case "msg_ruler":
+		messages.ruler = cells
+	}
+	Editor.MarkDraw()
+}
+
+// Removes everything, call this when ext_messages is disabled
+func (messages *Messages) Reset() {
+	messages.messages = nil
+	messages.history = false
+	messages.showmode = nil
+	messages.showcmd = nil
+	messages.ruler = nil
+	messages.rows = 0
+	Editor.MarkRender()
+}
+
+// Mode at the left, the partial command and the ruler at the right
+func (messages *Messages) statusLine(cols int) []MessageCell {
+	line := make([]MessageCell, cols)
+	copy(line, messages.showmode)
+	right := append([]MessageCell{}, messages.showcmd...)
+	if len(right) > 0 && len(messages.ruler) > 0 {
+		right = append(right, MessageCell{char: ' '})
+	}
+	right = append(right, messages.ruler...)
+	begin := common.Max(cols-len(right)-1, 0)
+	copy(line[begin:], right)
+	return line
+}
+
+func (messages *Messages) Draw() {
+	if !Editor.nvim.HasExt("messages") {
+		messages.rows = 0
+		return
+	}
+	EndBenchmark := bench.Begin()
+	cellSize := messages.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	cols := common.Max((windowSize.Width()-Editor.minimap.Width())/cellSize.Width(), 1)
+	screenRows := windowSize.Height() / cellSize.Height()
+	// The cmdline takes the place of the status row
+	cmdlineRows := Editor.cmdline.Rows()
+	hasStatus := cmdlineRows == 0 && len(messages.showmode)+len(messages.showcmd)+len(messages.ruler) > 0
+	statusRows := 0
+	if hasStatus {
+		statusRows = 1
+	}
+	lines := [][]MessageCell{}
+	for _, message := range messages.messages {
+		wrapped := wrapMessageCells(message.cells, cols)
+		// Outputs of the commands, like :ls, start with a newline
+		if len(wrapped) > 1 && len(wrapped[0]) == 0 {
+			wrapped = wrapped[1:]
+		}
+		lines = append(lines, wrapped...)
+	}
+	maxRows := common.Max(screenRows-cmdlineRows-statusRows, 0)
+	if len(lines) > maxRows {
+		lines = lines[len(lines)-maxRows:]
+	}
+	messages.rows = len(lines) + statusRows
+	if messages.rows == 0 {
+		return
+	}
+	if messages.rows != messages.renderer.rows || cols != messages.cols {
+		messages.cols = cols
+		messages.renderer.Resize(messages.rows, cols)
+	}
+	messages.pos = common.Vector2[int]{
+		X: 0,
+		Y: common.Max(windowSize.Height()-(messages.rows+cmdlineRows)*cellSize.Height(), 0),
+	}
+	messages.renderer.SetPos(messages.pos)
+	for row, line := range lines {
+		drawMessageCells(messages.renderer, row, line)
+	}
+	if hasStatus {
+		drawMessageCells(messages.renderer, len(lines), messages.statusLine(cols))
+	}
+	EndBenchmark("Messages.Draw")
+}
+
+func (messages *Messages) Render() {
+	if messages.rows == 0 {
+		return
+	}
+	messages.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+func (messages *Messages) Destroy() {
+	messages.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Messages destroyed")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseMessageContent(t *testing.T) {
+	content := []interface{}{
+		[]interface{}{int64(0), "ab"},
+		[]interface{}{uint64(7), "c"},
+	}
+	want := []MessageCell{{'a', 0}, {'b', 0}, {'c', 7}}
+	got, ok := parseMessageContent(content)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMessageContent = %v %v, want %v", got, ok, want)
+	}
+	for _, bad := range []interface{}{
+		"text",
+		[]interface{}{"text"},
+		[]interface{}{[]interface{}{int64(0)}},
+		[]interface{}{[]interface{}{"0", "text"}},
+		[]interface{}{[]interface{}{int64(0), int64(1)}},
+	} {
+		if _, ok := parseMessageContent(bad); ok {
+			t.Errorf("parseMessageContent(%v) is ok, want malformed", bad)
+		}
+	}
+}
+
+func Test_wrapMessageCells(t *testing.T) {
+	text := func(lines [][]MessageCell) []string {
+		result := []string{}
+		for _, line := range lines {
+			result = append(result, messageText(line))
+		}
+		return result
+	}
+	tests := []struct {
+		text string
+		cols int
+		want []string
+	}{
+		{"abc", 10, []string{"abc"}},
+		{"abcdef", 4, []string{"abcd", "ef"}},
+		{"abcd", 4, []string{"abcd"}},
+		{"\nab\ncd", 10, []string{"", "ab", "cd"}},
+		{"a\tb", 10, []string{"a b"}},
+	}
+	for _, test := range tests {
+		got := text(wrapMessageCells(textCells(test.text, 0), test.cols))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrapMessageCells(%q, %d) = %q, want %q", test.text, test.cols, got, test.want)
+		}
+	}
+}
+
+func TestCmdlineLevel_layout(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      CmdlineLevel
+		want       string
+		wantCursor int
+	}{
+		{
+			name:       "Cursor at the end",
+			level:      CmdlineLevel{content: textCells("echo", 0), pos: 4, firstc: ":"},
+			want:       ":echo",
+			wantCursor: 5,
+		},
+		{
+			name:       "Multibyte content",
+			level:      CmdlineLevel{content: textCells("çağ", 0), pos: 3, firstc: "/"},
+			want:       "/çağ",
+			wantCursor: 3,
+		},
+		{
+			name:       "Prompt and indent",
+			level:      CmdlineLevel{content: textCells("x", 0), pos: 0, prompt: "Name: ", indent: 2},
+			want:       "Name:   x",
+			wantCursor: 8,
+		},
+		{
+			name:       "Special character over the cursor",
+			level:      CmdlineLevel{content: textCells("ab", 0), pos: 1, firstc: ":", special: "^"},
+			want:       ":a^",
+			wantCursor: 2,
+		},
+		{
+			name:       "Special character inserted",
+			level:      CmdlineLevel{content: textCells("ab", 0), pos: 1, firstc: ":", special: "^", shift: true},
+			want:       ":a^b",
+			wantCursor: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cells, cursor := test.level.layout()
+			if got := messageText(cells); got != test.want || cursor != test.wantCursor {
+				t.Errorf("layout = %q %d, want %q %d", got, cursor, test.want, test.wantCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/hismailbulut/Neoray/pkg/render"
+	"github.com/hismailbulut/Neoray/pkg/window"
+)
+
+const (
+	MINIMAP_WIDTH       = 120 // Width of the minimap in pixels
+	MINIMAP_CHAR_WIDTH  = 1   // Every character is this pixels wide
+	MINIMAP_LINE_HEIGHT = 2   // Every line is this pixels high
+	// Buffer lines are fetched at most once in this duration
+	MINIMAP_FETCH_INTERVAL = 200 * time.Millisecond
+)
+
+// Lines of the current buffer visible in the minimap
+type MinimapData struct {
+	start   int      // line number of the first line, starts from 1
+	top     int      // first line of the window, line('w0')
+	bottom  int      // last line of the window, line('w$')
+	count   int      // number of the lines, line('$')
+	tabstop int      // &tabstop of the buffer
+	lines   []string // lines starting from start
+}
+
+// Minimap renders a miniature of the current buffer at the right edge of the
+// window. Lines are fetched from neovim in the background after every flush
+// and every character is drawn as a small rectangle with the foreground
+// color, there are no glyphs. Clicking or dragging jumps to the line.
+type Minimap struct {
+	buffer     render.VertexBuffer
+	data       MinimapData
+	dataChan   chan MinimapData
+	fetching   bool
+	dirty      bool
+	needsBuild bool
+	lastFetch  time.Time
+	lastSize   common.Vector2[int]
+	dragLine   int // Last line jumped while dragging
+}
+
+func NewMinimap(window *window.Window) *Minimap {
+	minimap := new(Minimap)
+	minimap.buffer = window.Renderer().CreateVertexBuffer(1)
+	minimap.dataChan = make(chan MinimapData, 1)
+	return minimap
+}
+
+func (minimap *Minimap) IsEnabled() bool {
+	return Editor.options.minimapEnabled
+}
+
+// Returns the width of the minimap, zero if disabled. The default grid must
+// not use this width.
+func (minimap *Minimap) Width() int {
+	if !minimap.IsEnabled() {
+		return 0
+	}
+	return MINIMAP_WIDTH
+}
+
+func (minimap *Minimap) rect() common.Rectangle[int] {
+	size := Editor.ScreenSize()
+	return common.Rectangle[int]{
+		X: size.Width() - minimap.Width(),
+		Y: 0,
+		W: minimap.Width(),
+		H: size.Height(),
+	}
+}
+
+// Number of lines fit the minimap
+func (minimap *Minimap) capacity() int {
+	return common.Max(Editor.ScreenSize().Height()/MINIMAP_LINE_HEIGHT, 1)
+}
+
+// Call this after every flush, lines will be fetched in the next update
+func (minimap *Minimap) MarkDirty() {
+	minimap.dirty = true
+}
+
+func (minimap *Minimap) Update() {
+	if !minimap.IsEnabled() || Editor.state < EditorWindowShown {
+		return
+	}
+	select {
+	case data := <-minimap.dataChan:
+		minimap.fetching = false
+		if data.lines != nil {
+			minimap.data = data
+			minimap.needsBuild = true
+			Editor.MarkRender()
+		}
+	default:
+	}
+	if minimap.dirty && !minimap.fetching && time.Since(minimap.lastFetch) >= MINIMAP_FETCH_INTERVAL {
+		minimap.dirty = false
+		minimap.fetching = true
+		minimap.lastFetch = time.Now()
+		go minimap.fetch(minimap.capacity())
+	}
+}
+
+// Fetches the lines around the window, always sends to the channel even if
+// fails because this is the only way to know fetching is finished.
+func (minimap *Minimap) fetch(capacity int) {
+	data := MinimapData{}
+	defer func() {
+		minimap.dataChan <- data
+	}()
+	var info []int
+	err := Editor.nvim.handle.Eval("[line('w0'), line('w$'), line('$'), &tabstop]", &info)
+	if err != nil || len(info) != 4 {
+		logger.Log(logger.ERROR, "Minimap failed to get window info:", err)
+		return
+	}
+	top, bottom, count := info[0], info[1], info[2]
+	// Scroll the minimap proportionally when the buffer doesn't fit
+	start := 1
+	if count > capacity {
+		visible := bottom - top + 1
+		if count > visible {
+			start += (top - 1) * (count - capacity) / (count - visible)
+		}
+	}
+	end := common.Min(start+capacity-1, count)
+	lines, err := Editor.nvim.handle.BufferLines(0, start-1, end, false)
+	if err != nil {
+		logger.Log(logger.ERROR, "Minimap failed to get buffer lines:", err)
+		return
+	}
+	data.start = start
+	data.top = top
+	data.bottom = bottom
+	data.count = count
+	data.tabstop = common.Max(info[3], 1)
+	data.lines = make([]string, len(lines))
+	for i, line := range lines {
+		data.lines[i] = string(line)
+	}
+}
+
+// Mixes the colors without blending, t is the weight of the b
+func mixColors(a, b common.Color, t float32) common.Color {
+	return common.Color{
+		R: a.R + (b.R-a.R)*t,
+		G: a.G + (b.G-a.G)*t,
+		B: a.B + (b.B-a.B)*t,
+		A: 1,
+	}
+}
+
+// Rebuilds the vertex buffer from the lines. First quad is the background,
+// second is the viewport indicator and the rest are the runs of characters.
+func (minimap *Minimap) build() {
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("Minimap.build")
+	rect := minimap.rect()
+	maxCols := MINIMAP_WIDTH / MINIMAP_CHAR_WIDTH
+	type run struct{ row, col, len int }
+	runs := []run{}
+	for row, line := range minimap.data.lines {
+		col := 0
+		begin := -1
+		for _, c := range line {
+			if col >= maxCols {
+				break
+			}
+			space := c == ' ' || c == '\t'
+			if !space && begin == -1 {
+				begin = col
+			} else if space && begin != -1 {
+				runs = append(runs, run{row, begin, col - begin})
+				begin = -1
+			}
+			if c == '\t' {
+				col += minimap.data.tabstop - col%minimap.data.tabstop
+			} else {
+				col++
+			}
+		}
+		if begin != -1 {
+			runs = append(runs, run{row, begin, common.Min(col, maxCols) - begin})
+		}
+	}
+	minimap.buffer.Resize(len(runs) + 2)
+	bg := Editor.gridManager.background
+	fg := Editor.gridManager.foreground
+	// Background
+	minimap.buffer.SetIndexPos(0, rect.ToF32())
+	minimap.buffer.SetIndexBg(0, mixColors(bg, fg, 0.04))
+	// Viewport
+	top := minimap.data.top - minimap.data.start
+	bottom := minimap.data.bottom - minimap.data.start + 1
+	minimap.buffer.SetIndexPos(1, common.Rectangle[float32]{
+		X: float32(rect.X),
+		Y: float32(rect.Y + top*MINIMAP_LINE_HEIGHT),
+		W: float32(rect.W),
+		H: float32((bottom - top) * MINIMAP_LINE_HEIGHT),
+	})
+	minimap.buffer.SetIndexBg(1, mixColors(bg, fg, 0.15))
+	// Characters
+	textColor := mixColors(bg, fg, 0.5)
+	for i, r := range runs {
+		minimap.buffer.SetIndexPos(i+2, common.Rectangle[float32]{
+			X: float32(rect.X + r.col*MINIMAP_CHAR_WIDTH),
+			Y: float32(rect.Y + r.row*MINIMAP_LINE_HEIGHT),
+			W: float32(r.len * MINIMAP_CHAR_WIDTH),
+			H: MINIMAP_LINE_HEIGHT - 1,
+		})
+		minimap.buffer.SetIndexBg(i+2, textColor)
+	}
+	minimap.needsBuild = false
+}
+
+func (minimap *Minimap) Draw() {
+	if !minimap.IsEnabled() || minimap.data.lines == nil {
+		return
+	}
+	// Window may be resized
+	if size := Editor.ScreenSize(); size != minimap.lastSize {
+		minimap.lastSize = size
+		minimap.needsBuild = true
+		minimap.MarkDirty()
+	}
+	if minimap.needsBuild {
+		minimap.build()
+	}
+}
+
+func (minimap *Minimap) Render() {
+	if !minimap.IsEnabled() || minimap.data.lines == nil {
+		return
+	}
+	defaultGrid := Editor.gridManager.Grid(1)
+	if defaultGrid == nil {
+		return
+	}
+	// We only draw backgrounds but the shader needs an atlas
+	defaultGrid.renderer.atlas.BindTexture()
+	minimap.buffer.Bind()
+	minimap.buffer.Update()
+	minimap.buffer.SetProjection(Editor.ProjectionRect())
+	minimap.buffer.Render()
+}
+
+// Call this when the option changed
+func (minimap *Minimap) SetEnabled(enabled bool) {
+	Editor.options.minimapEnabled = enabled
+	minimap.data = MinimapData{}
+	minimap.MarkDirty()
+	Editor.gridManager.CheckDefaultGridSize()
+	Editor.MarkRender()
+}
+
+// Call this function when mouse clicked. Jumps to the line under the mouse
+// and returns true if the position is on the minimap.
+func (minimap *Minimap) MouseClick(pos common.Vector2[int]) bool {
+	if !minimap.IsEnabled() || !pos.IsInRect(minimap.rect()) {
+		return false
+	}
+	if minimap.data.lines != nil {
+		minimap.dragLine = minimap.lineAt(pos)
+		go Editor.nvim.Command("call cursor(%d, 0) | normal! zz", minimap.dragLine)
+	}
+	return true
+}
+
+// Call this when the mouse moves after clicking the minimap, jumps to the line
+// under the mouse
+func (minimap *Minimap) MouseDrag(pos common.Vector2[int]) {
+	if !minimap.IsEnabled() || minimap.data.lines == nil {
+		return
+	}
+	if line := minimap.lineAt(pos); line != minimap.dragLine {
+		minimap.dragLine = line
+		go Editor.nvim.Command("call cursor(%d, 0) | normal! zz", line)
+	}
+}
+
+// Returns the line at the position, clamped to the visible lines
+func (minimap *Minimap) lineAt(pos common.Vector2[int]) int {
+	line := minimap.data.start + (pos.Y-minimap.rect().Y)/MINIMAP_LINE_HEIGHT
+	return common.Clamp(line, minimap.data.start, minimap.data.start+len(minimap.data.lines)-1)
+}
+
+// Returns the line under the position, or the lines of the window if the
+// position is on the viewport indicator
+func (minimap *Minimap) TooltipAt(pos common.Vector2[int]) string {
+	if !minimap.IsEnabled() || minimap.data.lines == nil || !pos.IsInRect(minimap.rect()) {
+		return ""
+	}
+	line := minimap.lineAt(pos)
+	if line >= minimap.data.top && line <= minimap.data.bottom {
+		return fmt.Sprintf("Lines %d-%d of %d", minimap.data.top, minimap.data.bottom, minimap.data.count)
+	}
+	return fmt.Sprintf("Line %d of %d", line, minimap.data.count)
+}
+
+func (minimap *Minimap) Destroy() {
+	minimap.buffer.Destroy()
+	logger.Log(logger.DEBUG, "Minimap destroyed")
+}
@@ -0,0 +1,485 @@
+-- Lua interface of Neoray, executed when Neoray attaches and available as
+-- require('neoray'). Arguments of the chunk are the channel id of the Neoray
+-- and the runtime directory has the health check, empty if it couldn't be
+-- written. When more than one Neoray is attached, the last one is used.
+
+local chan, runtime = ...
+
+---@alias neoray.Option
+---| 'CursorAnimTime'
+---| 'BusySpinner'
+---| 'Transparency'
+---| 'FloatTransparency'
+---| 'FloatAnimTime'
+---| 'SwitchAnimTime'
+---| 'MessageAnimTime'
+---| 'TargetTPS'
+---| 'ContextMenu'
+---| 'ContextButton'
+---| 'BoxDrawing'
+---| 'ImageViewer'
+---| 'WindowState'
+---| 'WindowSize'
+---| 'UnderlineThickness'
+---| 'UnderlineOffset'
+---| 'MinContrast'
+---| 'CheckUpdates'
+---| 'SessionAutosave'
+---| 'Minimap'
+---| 'LockGridSize'
+---| 'MouseWarp'
+---| 'KeyRepeatDelay'
+---| 'KeyRepeatRate'
+---| 'KeyRepeatArrows'
+---| 'SuperKey'
+---| 'DigraphHelper'
+---| 'IMEAutoSwitch'
+---| 'GlyphWarmUp'
+---| 'RenderRate'
+---| 'ColorProfile'
+---| 'PasteProtection'
+---| 'ClipboardHistory'
+---| 'TerminalClipboard'
+---| 'DiffGutter'
+---| 'TerminalImages'
+---| 'KeyFullscreen'
+---| 'KeyZoomIn'
+---| 'KeyZoomOut'
+---| 'KeyQuickOpen'
+---| 'KeyUnicodeInput'
+---| 'KeySettings'
+---| 'KeyScaleUp'
+---| 'KeyScaleDown'
+
+local M = {}
+
+---Channel id of the Neoray
+M.channel = chan
+
+---Sets an option like :NeoraySet, values are converted to strings.
+---@param name neoray.Option
+---@param ... string|number|boolean
+function M.set_option(name, ...)
+	local args = { 'NeorayOptionSet', name }
+	for i = 1, select('#', ...) do
+		table.insert(args, tostring(select(i, ...)))
+	end
+	if #args < 3 then
+		error('set_option needs a value')
+	end
+	vim.rpcnotify(chan, unpack(args))
+end
+
+---Enters fullscreen if enable is true, leaves if false and toggles if nil.
+---@param enable boolean?
+function M.fullscreen(enable)
+	local request = 'toggle_fullscreen'
+	if enable == true then
+		request = 'fullscreen'
+	elseif enable == false then
+		request = 'windowed'
+	end
+	vim.rpcnotify(chan, 'NeorayWindowRequest', request)
+end
+
+---Shows the message with vim.notify and requests attention, the taskbar
+---entry flashes if the window is not focused.
+---@param msg string
+---@param level integer? one of vim.log.levels
+function M.notify(msg, level)
+	vim.notify(msg, level)
+	vim.rpcnotify(chan, 'NeorayWindowRequest', 'attention')
+end
+
+---Returns the performance counters.
+---@return table<string, number>
+function M.stats()
+	return vim.rpcrequest(chan, 'NeorayStats')
+end
+
+function M.quick_open()
+	vim.rpcnotify(chan, 'NeorayQuickOpen')
+end
+
+---Returns the clipboard history, newest first.
+---@return string[]
+function M.clipboard_history()
+	return vim.rpcrequest(chan, 'NeorayClipboardHistory')
+end
+
+---Pastes an entry of the clipboard history, 1 is the newest. Shows the picker
+---without the index.
+---@param index integer?
+function M.clipboard_paste(index)
+	if index == nil then
+		vim.rpcnotify(chan, 'NeorayClipboardPicker')
+	else
+		vim.rpcnotify(chan, 'NeorayClipboardPaste', index - 1)
+	end
+end
+
+---Returns the rectangle of the cell in the Neoray window, in pixels and the
+---same coordinates with the mouse. Grid 0 means the row and column are screen
+---cells, vim.fn.screenpos() gives them for the buffer positions. Row and col
+---are 0-indexed.
+---@param grid integer
+---@param row integer
+---@param col integer
+---@return { x: integer, y: integer, width: integer, height: integer }
+function M.cell_to_pixel(grid, row, col)
+	return vim.rpcrequest(chan, 'NeorayCellToPixel', grid, row, col)
+end
+
+---Returns the cell at the pixel of the Neoray window, reverse of
+---cell_to_pixel. Grid is always 1 without multigrid.
+---@param x integer
+---@param y integer
+---@return { grid: integer, row: integer, col: integer }
+function M.pixel_to_cell(x, y)
+	return vim.rpcrequest(chan, 'NeorayPixelToCell', x, y)
+end
+
+function M.unicode_input()
+	vim.rpcnotify(chan, 'NeorayUnicodeInput')
+end
+
+function M.settings()
+	vim.rpcnotify(chan, 'NeoraySettings')
+end
+
+---Closes the window and leaves neovim running, only possible when Neoray is
+---attached to a neovim it didn't start.
+function M.detach()
+	vim.rpcnotify(chan, 'NeorayDetach')
+end
+
+---Reports the state of the Neoray for :checkhealth neoray
+function M.check_health()
+	-- Functions are renamed in neovim 0.10
+	local health = vim.health or require('health')
+	local report = {
+		start = health.start or health.report_start,
+		ok = health.ok or health.report_ok,
+		warn = health.warn or health.report_warn,
+		error = health.error or health.report_error,
+		info = health.info or health.report_info,
+	}
+	local ok, sections = pcall(vim.rpcrequest, chan, 'NeorayHealth')
+	if not ok then
+		report.start('Neoray')
+		report.error('Neoray is not responding: ' .. tostring(sections))
+		return
+	end
+	for _, section in ipairs(sections) do
+		report.start(section.name)
+		for _, item in ipairs(section.items) do
+			report[item[1]](item[2])
+		end
+	end
+	report.start('Clipboard')
+	if vim.fn.has('clipboard') == 1 then
+		report.ok('Clipboard provider: ' .. vim.fn['provider#clipboard#Executable']())
+	else
+		report.warn('No clipboard provider, "+ and "* registers are not available', {
+			'Neoray copies and pastes with the system clipboard but yanks need a provider',
+			'Install xclip, xsel or wl-clipboard on Linux',
+		})
+	end
+end
+
+-- OSC 8 hyperlinks of the terminal buffers are kept as extmarks, Neoray
+-- underlines the one under the mouse and opens it with ctrl+click
+local links_ns = vim.api.nvim_create_namespace('neoray_links')
+local hover_ns = vim.api.nvim_create_namespace('neoray_link_hover')
+local links = {} -- buffer -> { open = link started but not closed, urls = extmark id -> url }
+local hovered -- buffer of the underlined link
+
+---Handles an OSC 8 sequence of a terminal buffer. Cursor is the (1,0)-indexed
+---position of the terminal cursor when the sequence is received.
+---@param buf integer
+---@param seq string
+---@param cursor integer[]
+function M.term_request(buf, seq, cursor)
+	local url = seq:match('^\27%]8;[^;]*;(.*)$')
+	if not url then
+		return
+	end
+	url = url:gsub('\27\\$', ''):gsub('\7$', '')
+	local state = links[buf] or { urls = {} }
+	links[buf] = state
+	local row, col = cursor[1] - 1, cursor[2]
+	-- A link ends with an empty url or when another one starts
+	local open = state.open
+	state.open = nil
+	if open and (row > open.row or (row == open.row and col > open.col)) then
+		local id = vim.api.nvim_buf_set_extmark(buf, links_ns, open.row, open.col, {
+			end_row = row,
+			end_col = col,
+			strict = false,
+		})
+		state.urls[id] = open.url
+	end
+	if url ~= '' then
+		state.open = { row = row, col = col, url = url }
+	end
+end
+
+---Underlines the hyperlink at the cell of the window and returns its url,
+---empty if there is none. Window 0 means the row and column are screen
+---cells.
+---@param win integer
+---@param row integer
+---@param col integer
+---@return string
+function M.hover_link(win, row, col)
+	if hovered and vim.api.nvim_buf_is_valid(hovered) then
+		vim.api.nvim_buf_clear_namespace(hovered, hover_ns, 0, -1)
+	end
+	hovered = nil
+	if next(links) == nil then
+		return ''
+	end
+	if win == 0 then
+		for _, w in ipairs(vim.api.nvim_tabpage_list_wins(0)) do
+			local pos = vim.api.nvim_win_get_position(w)
+			if row >= pos[1] and row < pos[1] + vim.api.nvim_win_get_height(w)
+				and col >= pos[2] and col < pos[2] + vim.api.nvim_win_get_width(w) then
+				win, row, col = w, row - pos[1], col - pos[2]
+				break
+			end
+		end
+		if win == 0 then
+			return ''
+		end
+	end
+	local buf = vim.api.nvim_win_get_buf(win)
+	local state = links[buf]
+	if not state then
+		return ''
+	end
+	local info = vim.fn.getwininfo(win)[1]
+	local lnum = info.topline + row
+	if lnum > vim.api.nvim_buf_line_count(buf) or col < info.textoff then
+		return ''
+	end
+	-- Cells to bytes, terminal lines may have wide characters
+	local bytecol = vim.fn.virtcol2col(win, lnum, col - info.textoff + 1) - 1
+	if bytecol < 0 then
+		return ''
+	end
+	local marks = vim.api.nvim_buf_get_extmarks(buf, links_ns, { lnum - 1, 0 }, { lnum - 1, -1 }, {
+		details = true,
+		overlap = true,
+	})
+	for _, mark in ipairs(marks) do
+		local id, srow, scol, details = mark[1], mark[2], mark[3], mark[4]
+		local erow, ecol = details.end_row or srow, details.end_col or scol
+		local r = lnum - 1
+		if (r > srow or (r == srow and bytecol >= scol)) and (r < erow or (r == erow and bytecol < ecol)) and state.urls[id] then
+			vim.api.nvim_buf_set_extmark(buf, hover_ns, srow, scol, {
+				end_row = erow,
+				end_col = ecol,
+				hl_group = 'NeorayLinkHover',
+				strict = false,
+			})
+			hovered = buf
+			return state.urls[id]
+		end
+	end
+	return ''
+end
+
+-- Kitty graphics and sixel images of the terminal buffers are anchored with
+-- extmarks at the cursor, Neoray decodes them and draws over the cells
+local images_ns = vim.api.nvim_create_namespace('neoray_images')
+local images = {} -- buffer -> extmark of the kitty image sent in chunks, false if none, nil if no images
+
+---Sends a kitty graphics (APC) or sixel (DCS) sequence of a terminal buffer to
+---Neoray with the extmark of the image. Returns false if the sequence is not
+---an image. Chunks of a kitty image use the mark of the first chunk.
+---@param buf integer
+---@param seq string
+---@param cursor integer[]
+---@return boolean
+function M.term_image(buf, seq, cursor)
+	local control = seq:match('^\27_G([^;\27]*)')
+	if not control and not seq:find('^\27P[%d;]*q') then
+		return false
+	end
+	local id = images[buf]
+	if not id then
+		local ok
+		ok, id = pcall(vim.api.nvim_buf_set_extmark, buf, images_ns, cursor[1] - 1, cursor[2], { strict = false })
+		if not ok then
+			return true
+		end
+	end
+	local more = control and (',' .. control .. ','):find(',m=1,', 1, true)
+	images[buf] = more and id or false
+	vim.rpcnotify(chan, 'NeorayTermImage', buf, id, seq)
+	return true
+end
+
+---Deletes the extmarks of the images Neoray doesn't draw
+---@param buf integer
+---@param ids integer[]
+function M.delete_term_images(buf, ids)
+	if vim.api.nvim_buf_is_valid(buf) then
+		for _, id in ipairs(ids) do
+			vim.api.nvim_buf_del_extmark(buf, images_ns, id)
+		end
+	end
+end
+
+---Writes the answer of a kitty graphics query to the program of the terminal
+---@param buf integer
+---@param data string
+function M.term_respond(buf, data)
+	local ok, channel = pcall(vim.api.nvim_get_option_value, 'channel', { buf = buf })
+	if ok and channel > 0 then
+		pcall(vim.api.nvim_chan_send, channel, data)
+	end
+end
+
+---Returns the images in the windows of the current tabpage as { win, screen
+---row, screen col, height, width, row, col, buf, id } lists. Row and col are
+---the cell of the image relative to the window, row is negative if the image
+---starts above the window.
+---@return integer[][]
+function M.term_images()
+	local placements = {}
+	for _, win in ipairs(vim.api.nvim_tabpage_list_wins(0)) do
+		local buf = vim.api.nvim_win_get_buf(win)
+		if images[buf] ~= nil and vim.api.nvim_win_get_config(win).relative == '' then
+			local info = vim.fn.getwininfo(win)[1]
+			local pos = vim.fn.win_screenpos(win)
+			local marks = vim.api.nvim_buf_get_extmarks(buf, images_ns, 0, { info.botline - 1, -1 }, {})
+			for _, mark in ipairs(marks) do
+				local id, row, col = mark[1], mark[2], mark[3]
+				local line = vim.api.nvim_buf_get_lines(buf, row, row + 1, false)[1] or ''
+				table.insert(placements, {
+					win,
+					pos[1] - 1,
+					pos[2] - 1,
+					info.height,
+					info.width,
+					row - info.topline + 1,
+					info.textoff + vim.fn.strdisplaywidth(line:sub(1, col)),
+					buf,
+					id,
+				})
+			end
+		end
+	end
+	return placements
+end
+
+-- Words in the sign highlights of the diff plugins, like GitSignsAdd,
+-- MiniDiffSignChange and SignifySignDelete
+local diff_words = { 'add', 'change', 'delete', 'untracked' }
+
+local function is_diff_hl(name)
+	name = name:lower()
+	for _, word in ipairs(diff_words) do
+		if name:find(word, 1, true) then
+			return true
+		end
+	end
+	return false
+end
+
+-- Returns the highlight groups of the signs at the lines, legacy signs are
+-- extmarks since neovim 0.10
+local function sign_highlights(buf, top, bot)
+	local hls = {}
+	local ok, marks = pcall(vim.api.nvim_buf_get_extmarks, buf, -1, { top - 1, 0 }, { bot - 1, -1 }, {
+		details = true,
+		type = 'sign',
+	})
+	if ok then
+		for _, mark in ipairs(marks) do
+			local hl = mark[4].sign_hl_group
+			if hl and is_diff_hl(hl) then
+				hls[mark[2] + 1] = hls[mark[2] + 1] or hl
+			end
+		end
+		return hls
+	end
+	for _, sign in ipairs(vim.fn.sign_getplaced(buf, { group = '*' })[1].signs) do
+		if sign.lnum >= top and sign.lnum <= bot and not hls[sign.lnum] then
+			local defined = vim.fn.sign_getdefined(sign.name)[1]
+			if defined and defined.texthl and is_diff_hl(defined.texthl) then
+				hls[sign.lnum] = defined.texthl
+			end
+		end
+	end
+	return hls
+end
+
+---Returns the diff signs of the visible lines in the windows of the current
+---tabpage as { window, screen row, screen column, row, color } lists. Screen
+---position is the 0-indexed position of the window, row is relative to it.
+---@return integer[][]
+function M.diff_signs()
+	local signs = {}
+	local colors = {}
+	for _, win in ipairs(vim.api.nvim_tabpage_list_wins(0)) do
+		if vim.api.nvim_win_get_config(win).relative == '' then
+			local info = vim.fn.getwininfo(win)[1]
+			local pos = vim.fn.win_screenpos(win)
+			for lnum, hl in pairs(sign_highlights(info.bufnr, info.topline, info.botline)) do
+				if colors[hl] == nil then
+					local fg = vim.fn.synIDattr(vim.fn.synIDtrans(vim.fn.hlID(hl)), 'fg#')
+					colors[hl] = tonumber(fg:sub(2), 16) or -1
+				end
+				local row = vim.fn.screenpos(win, lnum, 1).row
+				-- Zero when the line is not visible, like in a closed fold
+				if colors[hl] >= 0 and row > 0 then
+					table.insert(signs, { win, pos[1] - 1, pos[2] - 1, row - pos[1], colors[hl] })
+				end
+			end
+		end
+	end
+	return signs
+end
+
+if vim.fn.exists('##TermRequest') == 1 then
+	vim.api.nvim_set_hl(0, 'NeorayLinkHover', { underline = true, default = true })
+	local group = vim.api.nvim_create_augroup('Neoray' .. chan, { clear = false })
+	vim.api.nvim_create_autocmd('TermRequest', {
+		group = group,
+		callback = function(ev)
+			-- Cursor is sent since neovim 0.11
+			if type(ev.data) == 'table' and ev.data.cursor and not M.term_image(ev.buf, ev.data.sequence, ev.data.cursor) then
+				M.term_request(ev.buf, ev.data.sequence, ev.data.cursor)
+			end
+		end,
+	})
+	vim.api.nvim_create_autocmd('BufWipeout', {
+		group = group,
+		callback = function(ev)
+			links[ev.buf] = nil
+			if images[ev.buf] ~= nil then
+				images[ev.buf] = nil
+				vim.rpcnotify(chan, 'NeorayTermImagesWiped', ev.buf)
+			end
+		end,
+	})
+end
+
+-- Plugin managers may reset the runtimepath while loading the config
+if runtime ~= '' then
+	local function add_runtime()
+		if not vim.tbl_contains(vim.opt.runtimepath:get(), runtime) then
+			vim.opt.runtimepath:append(runtime)
+		end
+	end
+	add_runtime()
+	vim.api.nvim_create_autocmd('VimEnter', {
+		-- Group of the runtime script, removed when detached
+		group = vim.api.nvim_create_augroup('Neoray' .. chan, { clear = false }),
+		callback = add_runtime,
+	})
+end
+
+package.loaded['neoray'] = M
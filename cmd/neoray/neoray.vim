@@ -1,5 +1,5 @@
 # This is template for Neoray runtime files
-function s:NeorayOptionSet(...)
+function! s:NeorayOptionSet(...)
 	if a:0 < 2
 		echoerr 'NeoraySet needs at least 2 arguments'
 		return
@@ -8,11 +8,16 @@ function s:NeorayOptionSet(...)
 endfunction
 
 # TODO: The completion must respect user input
-function s:NeorayCompletion(A, L, P)
+function! s:NeorayCompletion(A, L, P)
 	return 
 	\	[
 	\	'CursorAnimTime',
+	\	'BusySpinner',
 	\	'Transparency',
+	\	'FloatTransparency',
+	\	'FloatAnimTime',
+	\	'SwitchAnimTime',
+	\	'MessageAnimTime',
 	\	'TargetTPS',
 	\	'ContextMenu',
 	\	'ContextButton',
@@ -20,16 +25,184 @@ function s:NeorayCompletion(A, L, P)
 	\	'ImageViewer',
 	\	'WindowState',
 	\	'WindowSize',
+	\	'UnderlineThickness',
+	\	'UnderlineOffset',
+	\	'MinContrast',
+	\	'CheckUpdates',
+	\	'SessionAutosave',
+	\	'Minimap',
+	\	'LockGridSize',
+	\	'MouseWarp',
+	\	'KeyRepeatDelay',
+	\	'KeyRepeatRate',
+	\	'KeyRepeatArrows',
+	\	'SuperKey',
+	\	'DigraphHelper',
+	\	'IMEAutoSwitch',
+	\	'GlyphWarmUp',
+	\	'RenderRate',
+	\	'ColorProfile',
+	\	'PasteProtection',
+	\	'ClipboardHistory',
+	\	'TerminalClipboard',
+	\	'DiffGutter',
+	\	'TerminalImages',
 	\	'KeyFullscreen',
 	\	'KeyZoomIn',
-	\	'KeyZoomOut' 
+	\	'KeyZoomOut',
+	\	'KeyQuickOpen',
+	\	'KeyUnicodeInput',
+	\	'KeySettings',
+	\	'KeyScaleUp',
+	\	'KeyScaleDown'
 	\	]
 endfunction
 
-command -nargs=+ -complete=customlist,s:NeorayCompletion NeoraySet call s:NeorayOptionSet(<f-args>)
+command! -nargs=+ -complete=customlist,s:NeorayCompletion NeoraySet call s:NeorayOptionSet(<f-args>)
+
+# Shows the file dialog and runs the command with the selected file, save
+# dialog is used for write commands
+function! s:NeorayBrowse(cmd)
+	if a:cmd =~# '^\(w\|wq\|write\|sav\|saveas\|up\|update\)!\=$'
+		let l:file = rpcrequest($(CHANID), 'NeoraySaveFileDialog', expand('%:p:h'))
+	else
+		let l:file = rpcrequest($(CHANID), 'NeorayOpenFileDialog', expand('%:p:h'))
+	endif
+	if l:file != ''
+		execute a:cmd . ' ' . fnameescape(l:file)
+	endif
+endfunction
+
+command! -nargs=1 -complete=command NeorayBrowse call s:NeorayBrowse(<q-args>)
+command! NeorayQuickOpen call rpcnotify($(CHANID), 'NeorayQuickOpen')
+command! NeorayClipboardHistory call rpcnotify($(CHANID), 'NeorayClipboardPicker')
+command! NeorayUnicodeInput call rpcnotify($(CHANID), 'NeorayUnicodeInput')
+command! NeoraySettings call rpcnotify($(CHANID), 'NeoraySettings')
+command! NeorayKeycastToggle call rpcnotify($(CHANID), 'NeorayKeycastToggle')
+command! -nargs=? -complete=file NeorayRecordStart call rpcnotify($(CHANID), 'NeorayRecordStart', <q-args> == '' ? '' : fnamemodify(<q-args>, ':p'), getcwd())
+command! NeorayRecordStop call rpcnotify($(CHANID), 'NeorayRecordStop')
+command! NeorayDetach call rpcnotify($(CHANID), 'NeorayDetach')
+
+# Externalized ui features can be changed at runtime, Neoray attaches again
+function! s:NeorayExtCompletion(A, L, P)
+	return filter(['multigrid', 'messages', 'popupmenu', 'tabline', 'cmdline', 'on', 'off'], 'v:val =~# "^" . a:A')
+endfunction
+
+command! -nargs=+ -complete=customlist,s:NeorayExtCompletion NeorayExt call rpcnotify($(CHANID), 'NeorayExt', <f-args>)
+command! NeorayToggleMultigrid NeorayExt multigrid
+
+# Sessions are created with :mksession and the window state is appended to the
+# end of the file
+function! s:NeoraySessionSave(file)
+	let l:file = a:file != '' ? a:file : (v:this_session != '' ? v:this_session : 'Session.vim')
+	execute 'mksession! ' . fnameescape(l:file)
+	let l:state = rpcrequest($(CHANID), 'NeorayWindowSession')
+	call writefile(['', '" Neoray window state', 'if exists(":NeorayRestoreWindow") == 2', '  NeorayRestoreWindow ' . l:state, 'endif'], l:file, 'a')
+endfunction
+
+function! s:NeoraySessionLoad(file)
+	let l:file = a:file != '' ? a:file : (v:this_session != '' ? v:this_session : 'Session.vim')
+	execute 'source ' . fnameescape(l:file)
+endfunction
+
+command! -nargs=? -complete=file NeoraySessionSave call s:NeoraySessionSave(<q-args>)
+command! -nargs=? -complete=file NeoraySessionLoad call s:NeoraySessionLoad(<q-args>)
+command! -nargs=+ NeorayRestoreWindow call rpcnotify($(CHANID), 'NeorayRestoreWindow', <f-args>)
+
+# Performance counters, g:neoray_stats is also updated once a second
+function! NeorayStats()
+	return rpcrequest($(CHANID), 'NeorayStats')
+endfunction
+
+# Clipboard history, newest first. NeorayClipboardPaste(0) pastes the newest.
+function! NeorayClipboardHistory()
+	return rpcrequest($(CHANID), 'NeorayClipboardHistory')
+endfunction
+
+function! NeorayClipboardPaste(index)
+	call rpcnotify($(CHANID), 'NeorayClipboardPaste', a:index)
+endfunction
+
+# Pixel rectangle of the cell in the window and the cell at the pixel, grid 0
+# means screen cells
+function! NeorayCellToPixel(grid, row, col)
+	return rpcrequest($(CHANID), 'NeorayCellToPixel', a:grid, a:row, a:col)
+endfunction
+
+function! NeorayPixelToCell(x, y)
+	return rpcrequest($(CHANID), 'NeorayPixelToCell', a:x, a:y)
+endfunction
+
+# Neovim doesn't support :browse, use ours instead
+cnoreabbrev <expr> browse getcmdtype() == ':' && getcmdline() ==# 'browse' ? 'NeorayBrowse' : 'browse'
+
+# Scale factor is sent every time g:neoray_scale_factor changes, deleting it
+# resets to 1
+function! s:NeorayScaleFactorChanged(dict, key, value)
+	call rpcnotify($(CHANID), 'NeorayScaleFactor', get(a:value, 'new', 1.0))
+endfunction
+
+call dictwatcheradd(g:, 'neoray_scale_factor', function('s:NeorayScaleFactorChanged'))
+if exists('g:neoray_scale_factor')
+	call s:NeorayScaleFactorChanged(g:, 'neoray_scale_factor', {'new': g:neoray_scale_factor})
+endif
+
+# Ticks per second while the window is not focused, deleting it disables
+function! s:NeorayUnfocusedTPSChanged(dict, key, value)
+	call rpcnotify($(CHANID), 'NeorayUnfocusedTPS', get(a:value, 'new', 0))
+endfunction
+
+call dictwatcheradd(g:, 'neoray_unfocused_tps', function('s:NeorayUnfocusedTPSChanged'))
+if exists('g:neoray_unfocused_tps')
+	call s:NeorayUnfocusedTPSChanged(g:, 'neoray_unfocused_tps', {'new': g:neoray_unfocused_tps})
+endif
+
+# Window icon is a png file or list of png files in different sizes, deleting
+# it restores the default icon
+function! s:NeorayWindowIconChanged(dict, key, value)
+	let l:icon = get(a:value, 'new', [])
+	let l:files = type(l:icon) == v:t_list ? l:icon : [l:icon]
+	call rpcnotify($(CHANID), 'NeorayWindowIcon', map(copy(l:files), 'expand(v:val)'))
+endfunction
+
+call dictwatcheradd(g:, 'neoray_window_icon', function('s:NeorayWindowIconChanged'))
+if exists('g:neoray_window_icon')
+	call s:NeorayWindowIconChanged(g:, 'neoray_window_icon', {'new': g:neoray_window_icon})
+endif
+
+# Gui keybindings, actions not in the dictionary keep their default chords and
+# deleting it restores all of them
+function! s:NeorayKeybindsChanged(dict, key, value)
+	call rpcnotify($(CHANID), 'NeorayKeybinds', get(a:value, 'new', {}))
+endfunction
+
+call dictwatcheradd(g:, 'neoray_keybinds', function('s:NeorayKeybindsChanged'))
+if exists('g:neoray_keybinds')
+	call s:NeorayKeybindsChanged(g:, 'neoray_keybinds', {'new': g:neoray_keybinds})
+endif
+
+# Title template is expanded by Neoray, deleting it restores the title set by
+# neovim
+function! s:NeorayUpdateTitle()
+	call rpcnotify($(CHANID), 'NeorayTitle', {
+		\	'template': get(g:, 'neoray_title', ''),
+		\	'file': expand('%:p'),
+		\	'modified': &modified ? v:true : v:false,
+		\	'cwd': fnamemodify(getcwd(), ':~'),
+		\ })
+endfunction
+
+function! s:NeorayTitleChanged(dict, key, value)
+	call s:NeorayUpdateTitle()
+endfunction
+
+call dictwatcheradd(g:, 'neoray_title', function('s:NeorayTitleChanged'))
+if exists('g:neoray_title')
+	call s:NeorayUpdateTitle()
+endif
 
 # Delete buffer but keep window layout
-function s:NeorayDeleteBuffer()
+function! s:NeorayDeleteBuffer()
     let l:currentBufNum = bufnr("%")
     let l:alternateBufNum = bufnr("#")
     if buflisted(l:alternateBufNum)
@@ -45,9 +218,18 @@ function s:NeorayDeleteBuffer()
     endif
 endfunction
 
-augroup Neoray
+# Every Neoray attached to the same neovim has its own group, and removes it
+# when detached
+augroup Neoray$(CHANID)
+	autocmd!
 	autocmd VimEnter * call rpcnotify($(CHANID), 'NeorayVimEnter')
-	autocmd VimLeave * call rpcnotify($(CHANID), 'NeorayVimLeave')
+	autocmd VimLeave * call rpcnotify($(CHANID), 'NeorayVimLeave', v:exiting)
+	autocmd BufWritePost,BufDelete * call rpcnotify($(CHANID), 'NeorayBufferDone', expand('<afile>:p'))
 	autocmd BufReadPre *.png,*.jpg,*.jpeg,*.gif,*.webp,*.bmp let s:imageViewed = rpcrequest($(CHANID), "NeorayViewImage", expand("%:p"))
 	autocmd BufReadPost *.png,*.jpg,*.jpeg,*.gif,*.webp,*.bmp if s:imageViewed == 1 | call s:NeorayDeleteBuffer() | endif
+	autocmd BufEnter,BufFilePost,BufModifiedSet,DirChanged * if exists('g:neoray_title') | call s:NeorayUpdateTitle() | endif
+	" Escape sequences of the programs in :terminal, only OSC 52 is sent
+	if exists('##TermRequest')
+		autocmd TermRequest * if v:termrequest =~# '^\e\]52;' | call rpcnotify($(CHANID), 'NeorayTermRequest', v:termrequest) | endif
+	endif
 augroup end
@@ -0,0 +1,7 @@
+-- Written by Neoray to its runtime directory, :checkhealth only finds the
+-- health checks in the runtimepath
+return {
+	check = function()
+		require('neoray').check_health()
+	end,
+}
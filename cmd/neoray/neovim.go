@@ -3,56 +3,148 @@ package main
 import (
 	_ "embed"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/hismailbulut/Neoray/pkg/bench"
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/logger"
 	"github.com/neovim/go-client/nvim"
+	"github.com/sqweek/dialog"
+)
+
+const (
+	// Neovim 0.5.0, api level is increased with every minor release
+	MIN_NVIM_API_LEVEL = 7
+	MIN_NVIM_VERSION   = "0.5.0"
+	// Neovim 0.9.0 added nvim_ui_set_focus
+	FOCUS_API_LEVEL = 11
+	// Neovim 0.11.0 sends the cursor with TermRequest, needed by the hyperlinks
+	TERM_LINK_API_LEVEL = 13
+	// Blocking calls ask the user to wait or quit after this
+	RPC_TIMEOUT = 5 * time.Second
+	// Pasted texts larger than this are sent in multiple calls
+	PASTE_CHUNK_SIZE = 1 << 20
 )
 
 const (
 	// New options
-	OPTION_CURSOR_ANIM    = "CursorAnimTime"
-	OPTION_TRANSPARENCY   = "Transparency"
-	OPTION_TARGET_TPS     = "TargetTPS"
-	OPTION_CONTEXT_MENU   = "ContextMenu"
-	OPTION_CONTEXT_BUTTON = "ContextButton"
-	OPTION_BOX_DRAWING    = "BoxDrawing"
-	OPTION_IMAGE_VIEWER   = "ImageViewer"
-	OPTION_WINDOW_STATE   = "WindowState"
-	OPTION_WINDOW_SIZE    = "WindowSize"
+	OPTION_CURSOR_ANIM         = "CursorAnimTime"
+	OPTION_BUSY_SPINNER        = "BusySpinner"
+	OPTION_TRANSPARENCY        = "Transparency"
+	OPTION_FLOAT_TRANSPARENCY  = "FloatTransparency"
+	OPTION_FLOAT_ANIM          = "FloatAnimTime"
+	OPTION_SWITCH_ANIM         = "SwitchAnimTime"
+	OPTION_MESSAGE_ANIM        = "MessageAnimTime"
+	OPTION_TARGET_TPS          = "TargetTPS"
+	OPTION_CONTEXT_MENU        = "ContextMenu"
+	OPTION_CONTEXT_BUTTON      = "ContextButton"
+	OPTION_BOX_DRAWING         = "BoxDrawing"
+	OPTION_IMAGE_VIEWER        = "ImageViewer"
+	OPTION_WINDOW_STATE        = "WindowState"
+	OPTION_WINDOW_SIZE         = "WindowSize"
+	OPTION_UNDERLINE_THICKNESS = "UnderlineThickness"
+	OPTION_UNDERLINE_OFFSET    = "UnderlineOffset"
+	OPTION_MIN_CONTRAST        = "MinContrast"
+	OPTION_CHECK_UPDATES       = "CheckUpdates"
+	OPTION_SESSION_AUTOSAVE    = "SessionAutosave"
+	OPTION_MINIMAP             = "Minimap"
+	OPTION_LOCK_GRID_SIZE      = "LockGridSize"
+	OPTION_MOUSE_WARP          = "MouseWarp"
+	OPTION_REPEAT_DELAY        = "KeyRepeatDelay"
+	OPTION_REPEAT_RATE         = "KeyRepeatRate"
+	OPTION_REPEAT_ARROWS       = "KeyRepeatArrows"
+	OPTION_SUPER_KEY           = "SuperKey"
+	OPTION_DIGRAPH_HELPER      = "DigraphHelper"
+	OPTION_IME_AUTO_SWITCH     = "IMEAutoSwitch"
+	OPTION_GLYPH_WARM_UP       = "GlyphWarmUp"
+	OPTION_RENDER_RATE         = "RenderRate"
+	OPTION_COLOR_PROFILE       = "ColorProfile"
+	OPTION_PASTE_PROTECTION    = "PasteProtection"
+	OPTION_CLIPBOARD_HISTORY   = "ClipboardHistory"
+	OPTION_TERMINAL_CLIPBOARD  = "TerminalClipboard"
+	OPTION_DIFF_GUTTER         = "DiffGutter"
+	OPTION_TERMINAL_IMAGES     = "TerminalImages"
 	// Keybindings
 	OPTION_KEY_FULLSCRN = "KeyFullscreen"
 	OPTION_KEY_ZOOMIN   = "KeyZoomIn"
 	OPTION_KEY_ZOOMOUT  = "KeyZoomOut"
+	OPTION_KEY_QUICKOPN = "KeyQuickOpen"
+	OPTION_KEY_UNICODE  = "KeyUnicodeInput"
+	OPTION_KEY_SETTINGS = "KeySettings"
+	OPTION_KEY_SCALEUP  = "KeyScaleUp"
+	OPTION_KEY_SCALEDN  = "KeyScaleDown"
+)
+
+// Key options are the older way of g:neoray_keybinds, still supported
+var keyOptionActions = map[string]string{
+	OPTION_KEY_FULLSCRN: KEYBIND_FULLSCREEN,
+	OPTION_KEY_ZOOMIN:   KEYBIND_ZOOM_IN,
+	OPTION_KEY_ZOOMOUT:  KEYBIND_ZOOM_OUT,
+	OPTION_KEY_QUICKOPN: KEYBIND_QUICK_OPEN,
+	OPTION_KEY_UNICODE:  KEYBIND_UNICODE_INPUT,
+	OPTION_KEY_SETTINGS: KEYBIND_SETTINGS,
+	OPTION_KEY_SCALEUP:  KEYBIND_SCALE_UP,
+	OPTION_KEY_SCALEDN:  KEYBIND_SCALE_DOWN,
+}
+
+const (
+	SCALE_FACTOR_MIN  = 0.25
+	SCALE_FACTOR_MAX  = 4
+	SCALE_FACTOR_STEP = 0.1
 )
 
 //go:embed neoray.vim
 var NeorayRuntimeScript string
 
+//go:embed neoray.lua
+var NeorayLuaModule string
+
 type NvimProcess struct {
-	handle     *nvim.Nvim
-	eventChan  chan []interface{}
-	optionChan chan []string
-	// This is required for when closing neoray. If neoray connected via stdin-out
-	// it is responsible for closing nvim, but if neoray connected via tcp, it will
-	// not close nvim.
-	connectedViaTcp bool
+	editor    *EditorContext
+	handle    *nvim.Nvim
+	eventChan chan []interface{}
+	apiLevel  int
+	// Last size requested from neovim, X is columns and Y is rows. Neovim uses
+	// the smallest size of the attached uis, the default grid may be smaller
+	// than this when another ui is attached.
+	uiSize common.Vector2[int]
+	// Time of the first input not followed by a flush, zero if none
+	inputTime time.Time
+	// 1 while waiting the answer of the request sent after input, neovim
+	// answers it when not busy
+	probing int32
+	// This is required for when closing neoray. If neoray started nvim it is
+	// responsible for closing it, but if neoray connected via tcp or attached
+	// to the channel given by another program, it will not close nvim.
+	attached bool
+	// Ui features externalized when attached, names are without ext_ prefix
+	ext map[string]bool
+	// Number of attaches whose neoray_attach event is not handled yet, redraw
+	// events are dropped until then because they belong to the detached ui
+	pendingAttach int
+	// v:exiting of the VimLeave, Neoray exits with the same code
+	exitCode int
 }
 
-func CreateNvimProcess() *NvimProcess {
+// Original stdout when attached to the rpc channel given on stdin and stdout
+var stdioChannel *os.File
+
+func CreateNvimProcess(editor *EditorContext) *NvimProcess {
 	proc := &NvimProcess{
-		eventChan:  make(chan []interface{}, 256), // Thats enough
-		optionChan: make(chan []string, 16),
+		editor:    editor,
+		eventChan: make(chan []interface{}, 256), // Thats enough
 	}
 
-	if Editor.parsedArgs.address != "" {
+	if editor.parsedArgs.address != "" {
 		// Try to connect via tcp
 		var err error
-		proc.handle, err = nvim.Dial(Editor.parsedArgs.address,
+		proc.handle, err = nvim.Dial(editor.parsedArgs.address,
 			nvim.DialLogf(func(format string, args ...interface{}) {
 				logger.LogF(logger.TRACE, format, args...)
 			}),
@@ -60,23 +152,37 @@ func CreateNvimProcess() *NvimProcess {
 		if err != nil {
 			logger.Log(logger.ERROR, "Failed to connect existing neovim instance:", err)
 		} else {
-			logger.Log(logger.TRACE, "Connected to existing neovim at address:", Editor.parsedArgs.address)
-			proc.connectedViaTcp = true
+			logger.Log(logger.TRACE, "Connected to existing neovim at address:", editor.parsedArgs.address)
+			proc.attached = true
 		}
+	} else if stdioChannel != nil {
+		// The program started Neoray owns the neovim, like an ide or a test
+		var err error
+		proc.handle, err = nvim.New(os.Stdin, stdioChannel, stdioChannel,
+			func(format string, args ...interface{}) {
+				logger.LogF(logger.TRACE, format, args...)
+			},
+		)
+		if err != nil {
+			logger.Log(logger.FATAL, "Failed to attach to the stdio channel:", err)
+		}
+		logger.Log(logger.TRACE, "Attached to neovim over stdio")
+		proc.attached = true
 	}
 
-	if !proc.connectedViaTcp {
+	if !proc.attached {
 		// Connect via stdin-stdout
-		args := append([]string{"--embed"}, Editor.parsedArgs.others...)
+		args := editor.parsedArgs.NvimArgs()
 		var err error
 		proc.handle, err = nvim.NewChildProcess(
 			nvim.ChildProcessArgs(args...),
-			nvim.ChildProcessCommand(Editor.parsedArgs.execPath),
+			nvim.ChildProcessCommand(editor.parsedArgs.execPath),
+			nvim.ChildProcessEnv(ChildEnv(os.Environ(), editor.parsedArgs.env)),
 		)
 		if err != nil {
 			logger.Log(logger.FATAL, "Failed to start neovim instance:", err)
 		}
-		logger.Log(logger.TRACE, "Neovim started with command:", Editor.parsedArgs.execPath, args)
+		logger.Log(logger.TRACE, "Neovim started with command:", editor.parsedArgs.execPath, args)
 	}
 
 	// Serve blocks until the msgpack session closed. But sometimes it not returns.
@@ -90,28 +196,14 @@ func CreateNvimProcess() *NvimProcess {
 		} else {
 			logger.Log(logger.DEBUG, "nvim.Serve() exited without error")
 		}
-		Editor.quitChan <- true
+		editor.quitChan <- true
 	}()
 
-	info, err := proc.handle.APIInfo()
+	info, err := waitCall(proc, "nvim_get_api_info", proc.handle.APIInfo)
 	if err != nil {
 		logger.Log(logger.FATAL, "Failed to get api information:", err)
 	} else {
-		// Check neovim version
-		// info[1] is dictionary of infos and it has a key named 'version',
-		// and this key contains a map which has major, minor and patch informations
-
-		vInfo := info[1].(map[string]interface{})["version"].(map[string]interface{})
-		vMajor := to_int(vInfo["major"])
-		vMinor := to_int(vInfo["minor"])
-		vPatch := to_int(vInfo["patch"])
-
-		if vMinor < 5 {
-			logger.Log(logger.FATAL, "Neoray needs at least 0.5.0 version of neovim. Please update your neovim to a newer version.")
-		}
-
-		vStr := fmt.Sprintf("%d.%d.%d", vMajor, vMinor, vPatch)
-		logger.Log(logger.TRACE, "Neovim version", vStr)
+		proc.checkVersion(info)
 	}
 
 	// Set a variable that users can define their neoray specific customization.
@@ -138,11 +230,19 @@ func CreateNvimProcess() *NvimProcess {
 		logger.Log(logger.FATAL, "Failed to execute runtime script:", err)
 	}
 
+	// Lua module, require('neoray')
+	err = proc.handle.ExecLua(NeorayLuaModule, nil, proc.handle.ChannelID(), WriteHealthRuntime())
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to load lua module:", err)
+	}
+
 	// Register NeorayOptionSet
 	proc.RegisterHandler(
 		"NeorayOptionSet",
 		func(args ...string) {
-			proc.optionChan <- args
+			editor.dispatch.DispatchAfterFlush(func() {
+				proc.processOption(args)
+			})
 		},
 	)
 
@@ -158,9 +258,10 @@ func CreateNvimProcess() *NvimProcess {
 	// Register VimLeave
 	proc.RegisterHandler(
 		"NeorayVimLeave",
-		func() {
-			logger.Log(logger.DEBUG, "VimLeave")
-			Editor.quitChan <- true
+		func(code int) {
+			logger.Log(logger.DEBUG, "VimLeave, exit code:", code)
+			proc.exitCode = code
+			editor.quitChan <- true
 		},
 	)
 
@@ -168,9 +269,9 @@ func CreateNvimProcess() *NvimProcess {
 	proc.RegisterHandler(
 		"NeorayViewImage",
 		func(imgPath string) (bool, error) {
-			if Editor.options.imageViewerEnabled {
+			if editor.options.imageViewerEnabled {
 				logger.Log(logger.DEBUG, "ViewImage:", imgPath)
-				Editor.imageViewer.imageChan <- imgPath
+				editor.imageViewer.imageChan <- imgPath
 				return true, nil
 			} else {
 				return false, nil
@@ -178,9 +279,473 @@ func CreateNvimProcess() *NvimProcess {
 		},
 	)
 
+	// Register QuickOpen
+	proc.RegisterHandler(
+		"NeorayQuickOpen",
+		func() {
+			editor.quickOpen.Request()
+		},
+	)
+
+	// Register clipboard history
+	proc.RegisterHandler(
+		"NeorayClipboardPicker",
+		func() {
+			editor.dispatch.Dispatch(editor.clipboardHistory.Show)
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayClipboardHistory",
+		func() ([]string, error) {
+			var entries []string
+			editor.dispatch.Wait(func() {
+				entries = editor.clipboardHistory.Entries()
+			})
+			return entries, nil
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayClipboardPaste",
+		func(index int) {
+			editor.dispatch.Dispatch(func() {
+				if !editor.clipboardHistory.Paste(index) {
+					proc.EchoError("Clipboard history has no entry %d", index)
+				}
+			})
+		},
+	)
+
+	// Register cell positions for the overlays of the plugins
+	proc.RegisterHandler(
+		"NeorayCellToPixel",
+		func(grid, row, col int) (map[string]int, error) {
+			var rect common.Rectangle[int]
+			var err error
+			editor.dispatch.Wait(func() {
+				rect, err = editor.CellToWindow(grid, row, col)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"x": rect.X, "y": rect.Y, "width": rect.W, "height": rect.H}, nil
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayPixelToCell",
+		func(x, y int) (map[string]int, error) {
+			var grid, row, col int
+			var err error
+			editor.dispatch.Wait(func() {
+				grid, row, col, err = editor.WindowToCell(x, y)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"grid": grid, "row": row, "col": col}, nil
+		},
+	)
+
+	// Register terminal requests
+	proc.RegisterHandler(
+		"NeorayTermRequest",
+		func(seq string) {
+			editor.dispatch.Dispatch(func() {
+				HandleOSC52(seq)
+			})
+		},
+	)
+
+	// Register terminal images, sent by neoray.lua
+	proc.RegisterHandler(
+		"NeorayTermImage",
+		func(buf, id int, seq string) {
+			editor.terminalImages.Receive(nvim.Buffer(buf), id, seq)
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayTermImagesWiped",
+		func(buf int) {
+			editor.terminalImages.Wipe(nvim.Buffer(buf))
+		},
+	)
+
+	// Register UnicodeInput
+	proc.RegisterHandler(
+		"NeorayUnicodeInput",
+		func() {
+			editor.unicodeInput.Request()
+		},
+	)
+
+	// Register Settings
+	proc.RegisterHandler(
+		"NeoraySettings",
+		func() {
+			editor.settings.Request()
+		},
+	)
+
+	// Register Keycast
+	proc.RegisterHandler(
+		"NeorayKeycastToggle",
+		func() {
+			editor.keycast.RequestToggle()
+		},
+	)
+
+	// Register Recorder
+	proc.RegisterHandler(
+		"NeorayRecordStart",
+		func(file, dir string) {
+			editor.recorder.Request(RecordRequest{start: true, file: file, dir: dir})
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayRecordStop",
+		func() {
+			editor.recorder.Request(RecordRequest{start: false})
+		},
+	)
+
+	// Register file dialogs, returns empty string if user cancelled
+	proc.RegisterHandler(
+		"NeorayOpenFileDialog",
+		func(dir string) (string, error) {
+			return proc.requestFileDialog(false, dir), nil
+		},
+	)
+	proc.RegisterHandler(
+		"NeoraySaveFileDialog",
+		func(dir string) (string, error) {
+			return proc.requestFileDialog(true, dir), nil
+		},
+	)
+
+	// Register scale factor, sent when g:neoray_scale_factor changes
+	proc.RegisterHandler(
+		"NeorayScaleFactor",
+		func(factor interface{}) {
+			switch factor.(type) {
+			case int64, uint64, float64:
+				editor.dispatch.DispatchAfterFlush(func() {
+					SetScaleFactor(to_float64(factor))
+				})
+			default:
+				logger.Log(logger.WARN, "g:neoray_scale_factor must be a number")
+			}
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayUnfocusedTPS",
+		func(tps interface{}) {
+			switch tps.(type) {
+			case int64, uint64, float64:
+				editor.dispatch.DispatchAfterFlush(func() {
+					proc.setUnfocusedTPS(to_int(tps))
+				})
+			default:
+				logger.Log(logger.WARN, "g:neoray_unfocused_tps must be a number")
+			}
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayWindowIcon",
+		func(icon interface{}) {
+			switch icon := icon.(type) {
+			case string:
+				editor.dispatch.DispatchAfterFlush(func() {
+					LoadIcons([]string{icon})
+				})
+			case []interface{}:
+				files := make([]string, 0, len(icon))
+				for _, file := range icon {
+					file, ok := file.(string)
+					if !ok {
+						logger.Log(logger.WARN, "g:neoray_window_icon must be a list of files")
+						return
+					}
+					files = append(files, file)
+				}
+				editor.dispatch.DispatchAfterFlush(func() {
+					if len(files) == 0 {
+						LoadDefaultIcons()
+					} else {
+						LoadIcons(files)
+					}
+				})
+			default:
+				logger.Log(logger.WARN, "g:neoray_window_icon must be a file or list of files")
+			}
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayKeybinds",
+		func(dict map[string]interface{}) {
+			keybinds, errs := ParseKeybinds(dict)
+			for _, err := range errs {
+				proc.EchoError("g:neoray_keybinds: %v", err)
+			}
+			editor.dispatch.Dispatch(func() {
+				editor.options.keybinds = keybinds
+			})
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayTitle",
+		func(info TitleInfo) {
+			editor.dispatch.DispatchAfterFlush(func() {
+				editor.title.SetInfo(info)
+			})
+		},
+	)
+
+	// Register sessions
+	proc.RegisterHandler(
+		"NeorayWindowSession",
+		func() (string, error) {
+			var state string
+			editor.dispatch.Wait(func() {
+				state = windowSessionState()
+			})
+			return state, nil
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayStats",
+		func() (map[string]interface{}, error) {
+			return editor.stats.Latest(), nil
+		},
+	)
+	proc.RegisterHandler(
+		"NeorayRestoreWindow",
+		func(args ...string) {
+			editor.dispatch.Dispatch(func() {
+				restoreWindowSession(args)
+			})
+		},
+	)
+
+	// Register Detach
+	proc.RegisterHandler(
+		"NeorayDetach",
+		func() {
+			editor.dispatch.Dispatch(proc.Detach)
+		},
+	)
+
+	// Register WindowRequest, sent by the lua module
+	proc.RegisterHandler(
+		"NeorayWindowRequest",
+		func(request string) {
+			editor.dispatch.Dispatch(func() {
+				proc.windowRequest(request)
+			})
+		},
+	)
+
+	// Register Health, :checkhealth neoray waits for the report
+	proc.RegisterHandler(
+		"NeorayHealth",
+		func() ([]HealthSection, error) {
+			var report []HealthSection
+			editor.dispatch.Wait(func() {
+				report = HealthReport()
+			})
+			return report, nil
+		},
+	)
+
+	// Register Ext
+	proc.RegisterHandler(
+		"NeorayExt",
+		func(args ...string) {
+			editor.dispatch.Dispatch(func() {
+				proc.extRequest(args)
+			})
+		},
+	)
+
+	// Register BufferDone, clients started with --wait are waiting for it
+	proc.RegisterHandler(
+		"NeorayBufferDone",
+		func(path string) {
+			if editor.server != nil {
+				editor.server.FileDone(path)
+			}
+		},
+	)
+
 	return proc
 }
 
+// Dialogs must be shown in the main thread, blocks until the user selects a
+// file
+func (proc *NvimProcess) requestFileDialog(save bool, dir string) string {
+	var filename string
+	proc.editor.dispatch.Wait(func() {
+		filename = proc.fileDialog(save, dir)
+	})
+	return filename
+}
+
+// Checks the api level of the neovim and quits with a dialog if it is older
+// than we support. Older versions reject the ui options we are using and
+// fail without a clear reason.
+func (proc *NvimProcess) checkVersion(info []interface{}) {
+	// info[1] is dictionary of infos and it has a key named 'version',
+	// and this key contains a map which has major, minor, patch and
+	// api_level informations
+	var vMajor, vMinor, vPatch, apiLevel int
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Log(logger.WARN, "Failed to parse neovim version:", err)
+			}
+		}()
+		vInfo := info[1].(map[string]interface{})["version"].(map[string]interface{})
+		vMajor = to_int(vInfo["major"])
+		vMinor = to_int(vInfo["minor"])
+		vPatch = to_int(vInfo["patch"])
+		apiLevel = to_int(vInfo["api_level"])
+	}()
+	vStr := fmt.Sprintf("%d.%d.%d", vMajor, vMinor, vPatch)
+	logger.Log(logger.TRACE, "Neovim version", vStr, "api level", apiLevel)
+	proc.apiLevel = apiLevel
+	if apiLevel < MIN_NVIM_API_LEVEL {
+		msg := fmt.Sprintf("Found nvim %s, need >= %s\nPlease update your neovim to a newer version.", vStr, MIN_NVIM_VERSION)
+		logger.Log(logger.ERROR, msg)
+		dialog.Message(msg).Title("Neovim Version").Error()
+		proc.handle.Close()
+		logger.Shutdown()
+		os.Exit(1)
+	}
+}
+
+type callResult[T any] struct {
+	value T
+	err   error
+}
+
+// Starts the blocking call in another goroutine, its result is sent to the
+// channel. The channel is buffered, the goroutine ends even if the result is
+// not waited anymore.
+func startCall[T any](call func() (T, error)) <-chan callResult[T] {
+	done := make(chan callResult[T], 1)
+	go func() {
+		value, err := call()
+		done <- callResult[T]{value: value, err: err}
+	}()
+	return done
+}
+
+// Call from main thread. Runs the blocking call and waits for it. If neovim
+// doesn't answer in RPC_TIMEOUT, asks the user whether to wait more or quit,
+// so a stuck neovim doesn't freeze the window without a reason.
+func waitCall[T any](proc *NvimProcess, name string, call func() (T, error)) (T, error) {
+	done := startCall(call)
+	for {
+		select {
+		case result := <-done:
+			return result.value, result.err
+		case <-time.After(RPC_TIMEOUT):
+			logger.Log(logger.WARN, "Neovim is not responding to", name)
+			proc.notResponding()
+		}
+	}
+}
+
+// Same with waitCall for the other goroutines, like autosave. They can't ask
+// the user, the call fails after RPC_TIMEOUT and its result is dropped.
+func timedCall[T any](name string, call func() (T, error)) (T, error) {
+	select {
+	case result := <-startCall(call):
+		return result.value, result.err
+	case <-time.After(RPC_TIMEOUT):
+		logger.Log(logger.WARN, "Neovim is not responding to", name)
+		var zero T
+		return zero, fmt.Errorf("neovim didn't answer %s in %v", name, RPC_TIMEOUT)
+	}
+}
+
+// Call from main thread
+func (proc *NvimProcess) notResponding() {
+	if proc.editor.headless != nil && proc.editor.headless.IsEnabled() {
+		return
+	}
+	msg := "Neovim is not responding.\n\nDo you want to wait? Choosing no force quits Neoray and your unsaved changes will be lost."
+	if dialog.Message(msg).Title("Neovim Is Not Responding").YesNo() {
+		return
+	}
+	logger.Log(logger.ERROR, "Force quit because neovim is not responding")
+	// Neovim exits when our side of the pipe is closed
+	proc.Close()
+	logger.Shutdown()
+	os.Exit(1)
+}
+
+func (proc *NvimProcess) attachOptions() map[string]interface{} {
+	options := map[string]interface{}{
+		"rgb":          true,
+		"ext_linegrid": true,
+	}
+	for name := range proc.ext {
+		options["ext_"+name] = true
+		logger.Log(logger.DEBUG, "Ui feature", name, "externalized")
+	}
+	// Neovim externalizes the cmdline with the messages anyway
+	if proc.ext["messages"] {
+		options["ext_cmdline"] = true
+	}
+	return options
+}
+
+// Enables or disables an externalized ui feature by attaching again. Neovim
+// redraws everything, grids of the windows are kept until then. Call from main
+// thread.
+func (proc *NvimProcess) SetExt(name string, enabled bool) {
+	if proc.ext[name] == enabled {
+		return
+	}
+	logger.Log(logger.DEBUG, "Attaching again with", name, enabled)
+	err := proc.handle.DetachUI()
+	if err != nil {
+		logger.Log(logger.ERROR, "DetachUI failed:", err)
+		return
+	}
+	// Events of the old ui may still be on the way, neovim sends this after
+	// them. Everything is sent again after attached.
+	err = proc.handle.ExecLua("vim.rpcnotify(..., 'redraw', {'neoray_attach'})", nil, proc.handle.ChannelID())
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to mark the attach:", err)
+	} else {
+		proc.pendingAttach++
+	}
+	if enabled {
+		proc.ext[name] = true
+	} else {
+		delete(proc.ext, name)
+	}
+	if !proc.HasExt("messages") {
+		proc.editor.confirmDialog.Hide()
+		proc.editor.messages.Reset()
+	}
+	if !proc.HasExt("cmdline") {
+		proc.editor.cmdline.Reset()
+	}
+	err = proc.handle.AttachUI(proc.uiSize.X, proc.uiSize.Y, proc.attachOptions())
+	if err != nil {
+		logger.Log(logger.FATAL, "AttachUI failed:", err)
+	}
+}
+
+// Returns true if neovim sends the feature to us instead of drawing it
+func (proc *NvimProcess) HasExt(name string) bool {
+	if name == "cmdline" && proc.ext["messages"] {
+		return true
+	}
+	return proc.ext[name]
+}
+
 func (proc *NvimProcess) RegisterHandler(name string, handler interface{}) {
 	err := proc.handle.RegisterHandler(name, handler)
 	if err != nil {
@@ -195,19 +760,17 @@ func (proc *NvimProcess) StartUI(rows, cols int) {
 		}
 	})
 
-	options := map[string]interface{}{
-		"rgb":          true,
-		"ext_linegrid": true,
-	}
-
-	if Editor.parsedArgs.multiGrid {
-		options["ext_multigrid"] = true
-		logger.Log(logger.DEBUG, "Multigrid enabled.")
+	proc.ext = make(map[string]bool)
+	for name, enabled := range proc.editor.parsedArgs.ext {
+		if enabled {
+			proc.ext[name] = true
+		}
 	}
 
-	if err := proc.handle.AttachUI(cols, rows, options); err != nil {
+	if err := proc.handle.AttachUI(cols, rows, proc.attachOptions()); err != nil {
 		logger.Log(logger.FATAL, "AttachUI failed:", err)
 	}
+	proc.uiSize = common.Vec2(cols, rows)
 
 	// Dictionary describing the version
 	version := nvim.ClientVersion{
@@ -249,31 +812,166 @@ func (proc *NvimProcess) Disconnect() {
 	proc.handle.Unsubscribe("NeorayVimEnter")
 	proc.handle.Unsubscribe("NeorayVimLeave")
 	proc.handle.Unsubscribe("NeorayViewImage")
+	proc.handle.Unsubscribe("NeorayQuickOpen")
+	proc.handle.Unsubscribe("NeorayClipboardPicker")
+	proc.handle.Unsubscribe("NeorayClipboardHistory")
+	proc.handle.Unsubscribe("NeorayClipboardPaste")
+	proc.handle.Unsubscribe("NeorayCellToPixel")
+	proc.handle.Unsubscribe("NeorayPixelToCell")
+	proc.handle.Unsubscribe("NeorayTermRequest")
+	proc.handle.Unsubscribe("NeorayTermImage")
+	proc.handle.Unsubscribe("NeorayTermImagesWiped")
+	proc.handle.Unsubscribe("NeorayUnicodeInput")
+	proc.handle.Unsubscribe("NeoraySettings")
+	proc.handle.Unsubscribe("NeorayKeycastToggle")
+	proc.handle.Unsubscribe("NeorayRecordStart")
+	proc.handle.Unsubscribe("NeorayRecordStop")
+	proc.handle.Unsubscribe("NeorayOpenFileDialog")
+	proc.handle.Unsubscribe("NeoraySaveFileDialog")
+	proc.handle.Unsubscribe("NeorayWindowSession")
+	proc.handle.Unsubscribe("NeorayRestoreWindow")
+	proc.handle.Unsubscribe("NeorayStats")
+	proc.handle.Unsubscribe("NeorayScaleFactor")
+	proc.handle.Unsubscribe("NeorayUnfocusedTPS")
+	proc.handle.Unsubscribe("NeorayWindowIcon")
+	proc.handle.Unsubscribe("NeorayTitle")
+	proc.handle.Unsubscribe("NeorayKeybinds")
+	proc.handle.Unsubscribe("NeorayDetach")
+	proc.handle.Unsubscribe("NeorayBufferDone")
+	proc.handle.Unsubscribe("NeorayWindowRequest")
+	proc.handle.Unsubscribe("NeorayHealth")
+	proc.handle.Unsubscribe("NeorayExt")
+	// Other uis may still be attached, our autocommands must not notify a
+	// closed channel
+	proc.handle.Command(fmt.Sprintf("silent! autocmd! Neoray%d | silent! augroup! Neoray%d", proc.handle.ChannelID(), proc.handle.ChannelID()))
 	proc.handle.DetachUI()
 }
 
+// Call after running the dispatch queue
 func (proc *NvimProcess) Update() {
-	// We wait for first flush because some of the settings depends on default grid
-	// and we only make sure default grid has drawn after the first flush
-	if Editor.state >= EditorFirstFlush {
-		proc.CheckOptions()
-		// If this is the first option check we can show the window after it
+	// Settings depending on the default grid are dispatched after the first
+	// flush, we only make sure default grid has drawn after it
+	if proc.editor.state >= EditorFirstFlush {
+		// If this is the first tick after the flush we can show the window
 		// because all initializations and user settings are done
-		if Editor.state < EditorWindowShown {
-			Editor.window.Show()
+		if proc.editor.state < EditorWindowShown {
+			// Saved settings overrides init.vim
+			proc.editor.settings.Load()
+			if !proc.editor.headless.IsEnabled() {
+				proc.editor.window.Show()
+			}
 			SetEditorState(EditorWindowShown)
 			logger.Log(logger.TRACE, "Window is visible now in", time.Since(StartTime))
 		}
 	}
 }
 
-func (proc *NvimProcess) CheckOptions() {
-	for len(proc.optionChan) > 0 {
-		option := <-proc.optionChan
-		proc.processOption(option)
+// Returns empty string if the user cancelled
+func (proc *NvimProcess) fileDialog(save bool, dir string) string {
+	builder := dialog.File()
+	if dir != "" {
+		builder = builder.SetStartDir(dir)
+	}
+	var filename string
+	var err error
+	if save {
+		filename, err = builder.Title("Save File").Save()
+	} else {
+		filename, err = builder.Title("Open File").Load()
+	}
+	if err != nil && err != dialog.ErrCancelled {
+		logger.Log(logger.ERROR, "File dialog failed:", err)
+	}
+	proc.editor.window.Raise()
+	return filename
+}
+
+// Detaches the ui and closes the window but leaves neovim running, so the
+// session can be continued from another client. Neovim started by Neoray
+// quits when Neoray quits, it can't be detached.
+func (proc *NvimProcess) Detach() {
+	if !proc.attached {
+		proc.EchoError("Neoray started this neovim and can't leave it running, connect with --server to detach")
+		return
+	}
+	logger.Log(logger.DEBUG, "Detaching from neovim")
+	proc.Disconnect()
+	select {
+	case proc.editor.quitChan <- true:
+	default:
+		// Already quitting
 	}
 }
 
+// Window functions of the lua module, window can only be changed in the main
+// thread
+func (proc *NvimProcess) windowRequest(request string) {
+	logger.Log(logger.DEBUG, "Window request:", request)
+	switch request {
+	case "fullscreen":
+		if !proc.editor.window.IsFullscreen() {
+			proc.editor.window.ToggleFullscreen()
+		}
+	case "windowed":
+		if proc.editor.window.IsFullscreen() {
+			proc.editor.window.ToggleFullscreen()
+		}
+	case "toggle_fullscreen":
+		proc.editor.window.ToggleFullscreen()
+	case "attention":
+		if !proc.editor.focused {
+			proc.editor.window.RequestAttention()
+		}
+	default:
+		logger.Log(logger.WARN, "Invalid window request:", request)
+	}
+}
+
+// :NeorayExt {feature} [on|off], toggles without the second argument
+func (proc *NvimProcess) extRequest(args []string) {
+	name := args[0]
+	if !isExtFeature(name) {
+		proc.EchoError("Unknown ui feature %s, valid ones are %s", name, strings.Join(extFeatures, ", "))
+		return
+	}
+	enabled := !proc.ext[name]
+	if len(args) > 1 {
+		switch args[1] {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			proc.EchoError("NeorayExt needs on or off, got %s", args[1])
+			return
+		}
+	}
+	if name == "cmdline" && !enabled && proc.ext["messages"] {
+		proc.EchoError("Cmdline can't be disabled while messages is enabled")
+		return
+	}
+	proc.SetExt(name, enabled)
+}
+
+// g:neoray_unfocused_tps, zero means same with the TargetTPS
+func (proc *NvimProcess) setUnfocusedTPS(tps int) {
+	proc.editor.unfocusedTPS = common.Max(tps, 0)
+	logger.Log(logger.DEBUG, "Unfocused TPS is", proc.editor.unfocusedTPS)
+	ResetTicker()
+}
+
+// Adds to the scale factor and updates g:neoray_scale_factor
+func (proc *NvimProcess) AddScaleFactor(v float64) {
+	SetScaleFactor(math.Round((proc.editor.scaleFactor+v)*100) / 100)
+	factor := proc.editor.scaleFactor
+	go func() {
+		err := proc.handle.SetVar("neoray_scale_factor", factor)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to set g:neoray_scale_factor:", err)
+		}
+	}()
+}
+
 func (proc *NvimProcess) processOption(opt []string) {
 	// opt[0] is the name of the option, others are arguments
 	switch opt[0] {
@@ -281,22 +979,80 @@ func (proc *NvimProcess) processOption(opt []string) {
 		{
 			value, err := strconv.ParseFloat(opt[1], 32)
 			if err != nil {
-				logger.Log(logger.WARN, OPTION_CURSOR_ANIM, "value isn't valid.")
+				logger.Log(logger.WARN, OPTION_CURSOR_ANIM, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_CURSOR_ANIM, "is", opt[1])
+			proc.editor.options.cursorAnimTime = float32(value)
+		}
+	case OPTION_BUSY_SPINNER:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_BUSY_SPINNER, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_BUSY_SPINNER, "is", value)
+			proc.editor.options.busySpinner = value
+			proc.editor.MarkPartialDraw()
+		}
+	case OPTION_TRANSPARENCY:
+		{
+			value, err := strconv.ParseFloat(opt[1], 32)
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_TRANSPARENCY, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_TRANSPARENCY, "is", opt[1])
+			proc.editor.options.transparency = common.Clamp(float32(value), 0, 1)
+			proc.editor.MarkRender()
+		}
+	case OPTION_FLOAT_TRANSPARENCY:
+		{
+			// auto means same with the Transparency
+			value := -1.0
+			if opt[1] != "auto" {
+				var err error
+				value, err = strconv.ParseFloat(opt[1], 32)
+				if err != nil {
+					logger.Log(logger.WARN, OPTION_FLOAT_TRANSPARENCY, "value isn't valid.")
+					break
+				}
+				value = common.Clamp(value, 0, 1)
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_FLOAT_TRANSPARENCY, "is", opt[1])
+			proc.editor.options.floatTransparency = float32(value)
+			proc.editor.MarkRender()
+		}
+	case OPTION_FLOAT_ANIM:
+		{
+			value, err := strconv.ParseFloat(opt[1], 32)
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_FLOAT_ANIM, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_FLOAT_ANIM, "is", opt[1])
+			proc.editor.options.floatAnimTime = float32(value)
+		}
+	case OPTION_SWITCH_ANIM:
+		{
+			value, err := strconv.ParseFloat(opt[1], 32)
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_SWITCH_ANIM, "value isn't valid.")
 				break
 			}
-			logger.Log(logger.DEBUG, "Option", OPTION_CURSOR_ANIM, "is", opt[1])
-			Editor.options.cursorAnimTime = float32(value)
+			logger.Log(logger.DEBUG, "Option", OPTION_SWITCH_ANIM, "is", opt[1])
+			proc.editor.options.switchAnimTime = float32(value)
 		}
-	case OPTION_TRANSPARENCY:
+	case OPTION_MESSAGE_ANIM:
 		{
 			value, err := strconv.ParseFloat(opt[1], 32)
 			if err != nil {
-				logger.Log(logger.WARN, OPTION_TRANSPARENCY, "value isn't valid.")
+				logger.Log(logger.WARN, OPTION_MESSAGE_ANIM, "value isn't valid.")
 				break
 			}
-			logger.Log(logger.DEBUG, "Option", OPTION_TRANSPARENCY, "is", opt[1])
-			Editor.options.transparency = common.Clamp(float32(value), 0, 1)
-			MarkForceDraw()
+			logger.Log(logger.DEBUG, "Option", OPTION_MESSAGE_ANIM, "is", opt[1])
+			proc.editor.options.messageAnimTime = float32(value)
 		}
 	case OPTION_TARGET_TPS:
 		{
@@ -306,7 +1062,7 @@ func (proc *NvimProcess) processOption(opt []string) {
 				break
 			}
 			logger.Log(logger.DEBUG, "Option", OPTION_TARGET_TPS, "is", value)
-			Editor.options.targetTPS = value
+			proc.editor.options.targetTPS = value
 			ResetTicker()
 		}
 	case OPTION_CONTEXT_MENU:
@@ -317,14 +1073,14 @@ func (proc *NvimProcess) processOption(opt []string) {
 				break
 			}
 			logger.Log(logger.DEBUG, "Option", OPTION_CONTEXT_MENU, "is", value)
-			Editor.options.contextMenuEnabled = value
+			proc.editor.options.contextMenuEnabled = value
 		}
 	case OPTION_CONTEXT_BUTTON:
 		{
 			if len(opt) >= 3 {
 				cmd := strings.Join(opt[2:], " ")
 				logger.Log(logger.DEBUG, "Option", OPTION_CONTEXT_BUTTON, "name is", opt[1], "and command is", cmd)
-				Editor.contextMenu.AddButton(ContextButton{
+				proc.editor.contextMenu.AddButton(ContextButton{
 					name: opt[1],
 					fn:   func() { proc.Command(cmd) },
 				})
@@ -340,9 +1096,9 @@ func (proc *NvimProcess) processOption(opt []string) {
 				break
 			}
 			logger.Log(logger.DEBUG, "Option", OPTION_BOX_DRAWING, "is", value)
-			Editor.options.boxDrawingEnabled = value
+			proc.editor.options.boxDrawingEnabled = value
 			// Currently we didn't separate this two options but may be in the future
-			Editor.gridManager.SetBoxDrawing(Editor.options.boxDrawingEnabled, Editor.options.boxDrawingEnabled)
+			proc.editor.gridManager.SetBoxDrawing(proc.editor.options.boxDrawingEnabled, proc.editor.options.boxDrawingEnabled)
 		}
 	case OPTION_IMAGE_VIEWER:
 		{
@@ -352,22 +1108,22 @@ func (proc *NvimProcess) processOption(opt []string) {
 				break
 			}
 			logger.Log(logger.DEBUG, "Option", OPTION_IMAGE_VIEWER, "is", value)
-			Editor.options.imageViewerEnabled = value
+			proc.editor.options.imageViewerEnabled = value
 		}
 	case OPTION_WINDOW_STATE:
 		{
 			logger.Log(logger.DEBUG, "Option", OPTION_WINDOW_STATE, "is", opt[1])
 			switch opt[1] {
 			case "minimized":
-				Editor.window.Minimize()
+				proc.editor.window.Minimize()
 			case "maximized":
-				Editor.window.Maximize()
+				proc.editor.window.Maximize()
 			case "fullscreen":
-				if !Editor.window.IsFullscreen() {
-					Editor.window.ToggleFullscreen()
+				if !proc.editor.window.IsFullscreen() {
+					proc.editor.window.ToggleFullscreen()
 				}
 			case "centered":
-				Editor.window.Center()
+				proc.editor.window.Center()
 			}
 		}
 	case OPTION_WINDOW_SIZE:
@@ -395,20 +1151,231 @@ func (proc *NvimProcess) processOption(opt []string) {
 			logger.Log(logger.DEBUG, "Option", OPTION_WINDOW_SIZE, "is", cols, rows)
 			ResizeWindowInCellFormat(rows, cols)
 		}
-	case OPTION_KEY_FULLSCRN:
+	case OPTION_UNDERLINE_THICKNESS, OPTION_UNDERLINE_OFFSET:
+		{
+			// auto means use the values from the font
+			value := -1.0
+			if opt[1] != "auto" {
+				var err error
+				value, err = strconv.ParseFloat(opt[1], 64)
+				if err != nil || value < 0 {
+					logger.Log(logger.WARN, opt[0], "value isn't valid.")
+					break
+				}
+			}
+			logger.Log(logger.DEBUG, "Option", opt[0], "is", opt[1])
+			if opt[0] == OPTION_UNDERLINE_THICKNESS {
+				proc.editor.options.underlineThickness = value
+			} else {
+				proc.editor.options.underlineOffset = value
+			}
+			proc.editor.gridManager.SetUnderline(proc.editor.options.underlineThickness, proc.editor.options.underlineOffset)
+		}
+	case OPTION_MIN_CONTRAST:
+		{
+			value, err := strconv.ParseFloat(opt[1], 32)
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_MIN_CONTRAST, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_MIN_CONTRAST, "is", opt[1])
+			// Contrast ratio is between 1 and 21
+			proc.editor.options.minContrast = common.Clamp(float32(value), 1, 21)
+			proc.editor.MarkRender()
+		}
+	case OPTION_CHECK_UPDATES:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_CHECK_UPDATES, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_CHECK_UPDATES, "is", value)
+			proc.editor.options.checkUpdates = value
+			if value {
+				proc.editor.updater.Check()
+			}
+		}
+	case OPTION_SESSION_AUTOSAVE:
+		{
+			value, err := strconv.Atoi(opt[1])
+			if err != nil || value < 0 {
+				logger.Log(logger.WARN, OPTION_SESSION_AUTOSAVE, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_SESSION_AUTOSAVE, "is", value)
+			proc.editor.options.sessionAutosave = value
+		}
+	case OPTION_MINIMAP:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_MINIMAP, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_MINIMAP, "is", value)
+			proc.editor.minimap.SetEnabled(value)
+		}
+	case OPTION_LOCK_GRID_SIZE:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_LOCK_GRID_SIZE, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_LOCK_GRID_SIZE, "is", value)
+			proc.editor.options.lockGridSize = value
+			// Fit the grid to the window again when unlocked
+			proc.editor.gridManager.CheckDefaultGridSize()
+			proc.editor.MarkForceDraw()
+		}
+	case OPTION_MOUSE_WARP:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_MOUSE_WARP, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_MOUSE_WARP, "is", value)
+			proc.editor.options.mouseWarp = value
+		}
+	case OPTION_REPEAT_DELAY, OPTION_REPEAT_RATE:
+		{
+			value, err := strconv.Atoi(opt[1])
+			if err != nil || value < 0 {
+				logger.Log(logger.WARN, opt[0], "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", opt[0], "is", value)
+			if opt[0] == OPTION_REPEAT_DELAY {
+				proc.editor.options.keyRepeatDelay = value
+			} else {
+				proc.editor.options.keyRepeatRate = value
+			}
+		}
+	case OPTION_REPEAT_ARROWS:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_REPEAT_ARROWS, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_REPEAT_ARROWS, "is", value)
+			proc.editor.options.keyRepeatArrows = value
+		}
+	case OPTION_DIGRAPH_HELPER:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_DIGRAPH_HELPER, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_DIGRAPH_HELPER, "is", value)
+			proc.editor.options.digraphHelper = value
+		}
+	case OPTION_IME_AUTO_SWITCH:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_IME_AUTO_SWITCH, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_IME_AUTO_SWITCH, "is", value)
+			proc.editor.options.imeAutoSwitch = value
+		}
+	case OPTION_GLYPH_WARM_UP:
+		{
+			logger.Log(logger.DEBUG, "Option", OPTION_GLYPH_WARM_UP, "is", opt[1])
+			proc.editor.options.glyphWarmUp = opt[1]
+			if grid := proc.editor.gridManager.Grid(1); grid != nil {
+				grid.renderer.SetWarmUp(glyphWarmUpText(proc.editor.options.glyphWarmUp))
+			}
+		}
+	case OPTION_RENDER_RATE:
+		{
+			value, err := strconv.Atoi(opt[1])
+			if err != nil || value < 0 {
+				logger.Log(logger.WARN, OPTION_RENDER_RATE, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_RENDER_RATE, "is", value)
+			proc.editor.options.renderRate = value
+			if proc.editor.ticker != nil {
+				ResetTicker()
+			}
+		}
+	case OPTION_PASTE_PROTECTION:
+		{
+			value, err := strconv.Atoi(opt[1])
+			if err != nil || value < 0 {
+				logger.Log(logger.WARN, OPTION_PASTE_PROTECTION, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_PASTE_PROTECTION, "is", value)
+			proc.editor.options.pasteProtection = value
+		}
+	case OPTION_CLIPBOARD_HISTORY:
+		{
+			value, err := strconv.Atoi(opt[1])
+			if err != nil || value < 0 {
+				logger.Log(logger.WARN, OPTION_CLIPBOARD_HISTORY, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_CLIPBOARD_HISTORY, "is", value)
+			proc.editor.options.clipboardHistory = value
+			proc.editor.clipboardHistory.Trim()
+		}
+	case OPTION_TERMINAL_CLIPBOARD:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_TERMINAL_CLIPBOARD, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_TERMINAL_CLIPBOARD, "is", value)
+			proc.editor.options.terminalClipboard = value
+		}
+	case OPTION_DIFF_GUTTER:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_DIFF_GUTTER, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_DIFF_GUTTER, "is", value)
+			proc.editor.diffGutter.SetEnabled(value)
+		}
+	case OPTION_TERMINAL_IMAGES:
+		{
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_TERMINAL_IMAGES, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_TERMINAL_IMAGES, "is", value)
+			proc.editor.terminalImages.SetEnabled(value)
+		}
+	case OPTION_COLOR_PROFILE:
 		{
-			logger.Log(logger.DEBUG, "Option", OPTION_KEY_FULLSCRN, "is", opt[1])
-			Editor.options.keyToggleFullscreen = opt[1]
+			logger.Log(logger.DEBUG, "Option", OPTION_COLOR_PROFILE, "is", opt[1])
+			proc.editor.options.colorProfile = opt[1]
+			ApplyColorProfile()
 		}
-	case OPTION_KEY_ZOOMIN:
+	case OPTION_SUPER_KEY:
 		{
-			logger.Log(logger.DEBUG, "Option", OPTION_KEY_ZOOMIN, "is", opt[1])
-			Editor.options.keyIncreaseFontSize = opt[1]
+			value, err := strconv.ParseBool(opt[1])
+			if err != nil {
+				logger.Log(logger.WARN, OPTION_SUPER_KEY, "value isn't valid.")
+				break
+			}
+			logger.Log(logger.DEBUG, "Option", OPTION_SUPER_KEY, "is", value)
+			proc.editor.options.superKey = value
 		}
-	case OPTION_KEY_ZOOMOUT:
+	case OPTION_KEY_FULLSCRN, OPTION_KEY_ZOOMIN, OPTION_KEY_ZOOMOUT, OPTION_KEY_QUICKOPN,
+		OPTION_KEY_UNICODE, OPTION_KEY_SETTINGS, OPTION_KEY_SCALEUP, OPTION_KEY_SCALEDN:
 		{
-			logger.Log(logger.DEBUG, "Option", OPTION_KEY_ZOOMOUT, "is", opt[1])
-			Editor.options.keyDecreaseFontSize = opt[1]
+			logger.Log(logger.DEBUG, "Option", opt[0], "is", opt[1])
+			proc.editor.options.keybinds.Set(keyOptionActions[opt[0]], opt[1])
 		}
 	default:
 		logger.Log(logger.WARN, "Invalid option", opt)
@@ -426,14 +1393,24 @@ func (proc *NvimProcess) Command(format string, args ...interface{}) bool {
 	return true
 }
 
-// Returns current mode
-func (proc *NvimProcess) Mode() string {
-	mode, err := proc.handle.Mode()
-	if err != nil {
-		logger.Log(logger.ERROR, "Failed to get current mode name:", err)
-		return ""
-	}
-	return mode.Mode
+// Tells neovim the window gained or lost focus, FocusGained and FocusLost
+// autocommands are triggered by neovim.
+func (proc *NvimProcess) SetFocus(gained bool) {
+	go func() {
+		if proc.apiLevel >= FOCUS_API_LEVEL {
+			err := proc.handle.Request("nvim_ui_set_focus", nil, gained)
+			if err != nil {
+				logger.Log(logger.ERROR, "Failed to set focus:", err)
+			}
+			return
+		}
+		// Older versions doesn't know the ui focus, trigger them ourselves
+		if gained {
+			proc.Command("doautocmd <nomodeline> FocusGained")
+		} else {
+			proc.Command("doautocmd <nomodeline> FocusLost")
+		}
+	}()
 }
 
 func (proc *NvimProcess) EchoError(format string, args ...interface{}) {
@@ -443,20 +1420,115 @@ func (proc *NvimProcess) EchoError(format string, args ...interface{}) {
 	logger.LogF(logger.ERROR, format, args...)
 }
 
+func (proc *NvimProcess) Echo(format string, args ...interface{}) {
+	formatted := fmt.Sprintf(format, args...)
+	proc.handle.WriteOut(formatted + "\n")
+	logger.LogF(logger.TRACE, format, args...)
+}
+
+// Call from main thread
 func (proc *NvimProcess) GetRegister(register string) string {
-	var content string
-	err := proc.handle.Call("getreg", &content, register)
+	content, err := waitCall(proc, "getreg", func() (content string, err error) {
+		err = proc.handle.Call("getreg", &content, register)
+		return
+	})
 	if err != nil {
 		logger.Log(logger.ERROR, "Api call getreg() failed:", err)
 	}
 	return content
 }
 
+// Returns the recently opened files, v:oldfiles. Call from another goroutine.
+func (proc *NvimProcess) OldFiles() []string {
+	files, err := timedCall("v:oldfiles", func() (files []string, err error) {
+		err = proc.handle.VVar("oldfiles", &files)
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to get v:oldfiles:", err)
+	}
+	return files
+}
+
+// Returns the digraphs of neovim as pairs of the digraph and the character,
+// including the ones defined by the user. Call from main thread.
+func (proc *NvimProcess) Digraphs() [][]string {
+	digraphs, err := waitCall(proc, "digraph_getlist", func() (digraphs [][]string, err error) {
+		err = proc.handle.Call("digraph_getlist", &digraphs, true)
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Api call digraph_getlist() failed:", err)
+	}
+	return digraphs
+}
+
+// Returns current working directory of neovim. Call from another goroutine.
+func (proc *NvimProcess) WorkingDirectory() string {
+	dir, err := timedCall("getcwd", func() (dir string, err error) {
+		err = proc.handle.Call("getcwd", &dir)
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Api call getcwd() failed:", err)
+	}
+	return dir
+}
+
+// Returns full path of the current buffer, empty if it has no name. Call from
+// another goroutine.
+func (proc *NvimProcess) CurrentBufferName() string {
+	name, err := timedCall("expand", func() (name string, err error) {
+		err = proc.handle.Call("expand", &name, "%:p")
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Api call expand() failed:", err)
+	}
+	return name
+}
+
+// Returns full paths of the listed buffers which have a name. Call from
+// another goroutine.
+func (proc *NvimProcess) ListedBuffers() []string {
+	names, err := timedCall("getbufinfo", func() (names []string, err error) {
+		err = proc.handle.Eval(`map(filter(getbufinfo({'buflisted': 1}), 'v:val.name != ""'), 'v:val.name')`, &names)
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to list buffers:", err)
+	}
+	return names
+}
+
+// Changes the directory, adds the buffers to the buffer list and edits the
+// current one
+func (proc *NvimProcess) RestoreBuffers(cwd, current string, buffers []string) {
+	logger.Log(logger.DEBUG, "Restoring buffers", buffers)
+	go func() {
+		if cwd != "" {
+			if escaped, ok := proc.EscapeFileName(cwd); ok {
+				proc.Command("cd %s", escaped)
+			}
+		}
+		for _, buffer := range buffers {
+			if escaped, ok := proc.EscapeFileName(buffer); ok {
+				proc.Command("badd %s", escaped)
+			}
+		}
+		if current != "" {
+			if escaped, ok := proc.EscapeFileName(current); ok {
+				proc.Command("edit %s", escaped)
+			}
+		}
+	}()
+}
+
 // This function cuts current selected text and returns the content.
 // Not updates clipboard on every system.
 func (proc *NvimProcess) Cut() string {
-	switch proc.Mode() {
-	case "v", "V":
+	switch proc.editor.cursor.mode.Name() {
+	case "visual", "visual_select":
 		proc.FeedKeys("\"*ygvd")
 		return proc.GetRegister("*")
 	default:
@@ -467,8 +1539,8 @@ func (proc *NvimProcess) Cut() string {
 // This function copies current selected text and returns the content.
 // Not updates clipboard on every system.
 func (proc *NvimProcess) Copy() string {
-	switch proc.Mode() {
-	case "v", "V":
+	switch proc.editor.cursor.mode.Name() {
+	case "visual", "visual_select":
 		proc.FeedKeys("\"*y")
 		return proc.GetRegister("*")
 	default:
@@ -476,24 +1548,171 @@ func (proc *NvimProcess) Copy() string {
 	}
 }
 
-// Pastes text at cursor.
+// Yanks the selection to a saved register and selects it again, the
+// registers and the autocommands are not affected.
+const selectedTextLua = `
+local mode = vim.api.nvim_get_mode().mode
+if not mode:match('^[vV\22sS\19]') then
+	return ''
+end
+local saved = vim.fn.getreginfo('z')
+local eventignore = vim.o.eventignore
+vim.o.eventignore = 'all'
+local keys = mode:match('^[sS\19]') and '<C-g>"zygv<C-g>' or '"zygv'
+keys = vim.api.nvim_replace_termcodes(keys, true, false, true)
+local ok = pcall(vim.api.nvim_feedkeys, keys, 'nx', false)
+vim.o.eventignore = eventignore
+local text = ok and vim.fn.getreg('z') or ''
+vim.fn.setreg('z', saved)
+return text
+`
+
+// Returns true if the screen cell is in the visual selection of the current
+// window. Lines out of the window are the rows before or after it.
+const selectionContainsLua = `
+local row, col = ...
+local mode = vim.api.nvim_get_mode().mode:sub(1, 1)
+if not mode:match('[vV\22sS\19]') then
+	return false
+end
+local winrow, wincol = unpack(vim.fn.win_screenpos(0))
+winrow, wincol = winrow - 1, wincol - 1
+if row < winrow or row >= winrow + vim.fn.winheight(0) or col < wincol or col >= wincol + vim.fn.winwidth(0) then
+	return false
+end
+local function screen(pos)
+	if pos[2] < vim.fn.line('w0') then
+		return -1, -1
+	elseif pos[2] > vim.fn.line('w$') then
+		return math.huge, math.huge
+	end
+	local p = vim.fn.screenpos(0, pos[2], pos[3])
+	return p.row - 1, p.col - 1
+end
+local first, last = vim.fn.getpos('v'), vim.fn.getpos('.')
+if first[2] > last[2] or (first[2] == last[2] and first[3] > last[3]) then
+	first, last = last, first
+end
+local srow, scol = screen(first)
+local erow, ecol = screen(last)
+if row < srow or row > erow then
+	return false
+elseif mode == 'V' or mode == 'S' then
+	return true
+elseif mode == '\22' or mode == '\19' then
+	return col >= math.min(scol, ecol) and col <= math.max(scol, ecol)
+end
+return (row > srow or col >= scol) and (row < erow or col <= ecol)
+`
+
+// Call from main thread. Returns true if the cell of the screen is selected,
+// rows and columns start from zero.
+func (proc *NvimProcess) SelectionContains(row, col int) bool {
+	contains, err := waitCall(proc, "selection", func() (contains bool, err error) {
+		err = proc.handle.ExecLua(selectionContainsLua, &contains, row, col)
+		return
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to check the selection:", err)
+	}
+	return contains
+}
+
+// Returns the text of the visual selection without changing the mode, empty
+// if the mode is not visual or select.
+func (proc *NvimProcess) SelectedText() string {
+	var text string
+	err := proc.handle.ExecLua(selectedTextLua, &text)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to get the selected text:", err)
+		return ""
+	}
+	return text
+}
+
+// Pastes text at cursor. The text is pasted literally, mappings and special
+// keys are not triggered. Large texts are sent in chunks and neovim shows the
+// progress, the user can cancel it with <Esc>.
 func (proc *NvimProcess) Paste(str string) {
 	go func() {
-		err := proc.handle.Call("nvim_paste", nil, str, true, -1)
+		chunks := splitPaste(str, PASTE_CHUNK_SIZE)
+		for i, chunk := range chunks {
+			phase := -1 // single call
+			if len(chunks) > 1 {
+				switch i {
+				case 0:
+					phase = 1 // starts
+				case len(chunks) - 1:
+					phase = 3 // ends
+				default:
+					phase = 2 // continues
+				}
+			}
+			ok, err := proc.handle.Paste(chunk, true, phase)
+			if err != nil {
+				logger.Log(logger.ERROR, "Api call nvim_paste() failed:", err)
+				return
+			}
+			if !ok {
+				logger.Log(logger.DEBUG, "Paste cancelled after", i+1, "of", len(chunks), "chunks")
+				return
+			}
+		}
+	}()
+}
+
+// Enters insert mode and pastes, keys are executed immediately so the paste
+// can't be run as commands of another mode.
+const pasteInsertLua = `
+local text = ...
+if vim.api.nvim_get_mode().mode:sub(1, 1) ~= 'i' then
+	local keys = vim.api.nvim_replace_termcodes('<C-\\><C-n>i', true, false, true)
+	vim.api.nvim_feedkeys(keys, 'nx!', false)
+end
+vim.paste(vim.split(text, '\n', { plain = true }), -1)
+`
+
+// Pastes literally in insert mode, the text is inserted even if it looks like
+// commands in normal mode. Not sent in chunks.
+func (proc *NvimProcess) PasteInsert(str string) {
+	go func() {
+		err := proc.handle.ExecLua(pasteInsertLua, nil, str)
 		if err != nil {
-			logger.Log(logger.ERROR, "Api call nvim_paste() failed:", err)
+			logger.Log(logger.ERROR, "Failed to paste in insert mode:", err)
 		}
 	}()
 }
 
+// Splits the text to chunks not larger than the size, without breaking
+// utf-8 sequences and crlf line endings.
+func splitPaste(str string, size int) []string {
+	chunks := make([]string, 0, len(str)/size+1)
+	for len(str) > size {
+		end := size
+		for end > 0 && !utf8.RuneStart(str[end]) {
+			end--
+		}
+		if end > 0 && str[end-1] == '\r' && str[end] == '\n' {
+			end--
+		}
+		if end == 0 {
+			// Can't happen with valid utf-8 and a reasonable size
+			end = size
+		}
+		chunks = append(chunks, str[:end])
+		str = str[end:]
+	}
+	return append(chunks, str)
+}
+
 // TODO: We need to check if this buffer is normal buffer.
 // Executing this function in non normal buffers may be dangerous.
 func (proc *NvimProcess) SelectAll() {
-	switch proc.Mode() {
-	case "i", "v":
+	switch proc.editor.cursor.mode.Name() {
+	case "insert", "visual", "visual_select":
 		proc.FeedKeys("<ESC>ggVG")
 		break
-	case "n":
+	case "normal":
 		proc.FeedKeys("ggVG")
 		break
 	}
@@ -504,24 +1723,102 @@ func (proc *NvimProcess) EditFile(file string) {
 	go proc.Command("edit %s", file)
 }
 
+// Sets the argument list to the files and opens them in tabs, vertical or
+// horizontal splits, or only the first one for buffers mode. Cursor stays at
+// the first file. Blocking.
+func (proc *NvimProcess) OpenFiles(files []string, mode string) {
+	logger.Log(logger.DEBUG, "Opening files", files, "as", mode)
+	escaped := make([]string, 0, len(files))
+	for _, file := range files {
+		name, ok := proc.EscapeFileName(file)
+		if !ok {
+			return
+		}
+		escaped = append(escaped, name)
+	}
+	if !proc.Command("args %s", strings.Join(escaped, " ")) {
+		return
+	}
+	switch mode {
+	case "tabs":
+		proc.Command("tab all | tabfirst")
+	case "vsplit":
+		proc.Command("vertical all | wincmd t")
+	case "hsplit":
+		proc.Command("all | wincmd t")
+	}
+}
+
+// Changes the working directory of neovim, or only the current window's if
+// local is true. Blocking.
+func (proc *NvimProcess) ChangeDir(dir string, local bool) bool {
+	logger.Log(logger.DEBUG, "Changing directory to", dir, "local:", local)
+	escaped, ok := proc.EscapeFileName(dir)
+	if !ok {
+		return false
+	}
+	if local {
+		return proc.Command("lcd %s", escaped)
+	}
+	return proc.Command("cd %s", escaped)
+}
+
 func (proc *NvimProcess) MoveCursor(line, col int) {
 	logger.Log(logger.DEBUG, "Moving cursor", line, col)
 	go proc.handle.Call("cursor", nil, line, col)
 }
 
+// Call from main thread
 func (proc *NvimProcess) FeedKeys(keys string) {
-	keycode, err := proc.handle.ReplaceTermcodes(keys, true, true, true)
+	keycode, err := waitCall(proc, "nvim_replace_termcodes", func() (string, error) {
+		return proc.handle.ReplaceTermcodes(keys, true, true, true)
+	})
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to replace termcodes:", err)
 		return
 	}
-	err = proc.handle.FeedKeys(keycode, "m", true)
+	_, err = waitCall(proc, "nvim_feedkeys", func() (interface{}, error) {
+		return nil, proc.handle.FeedKeys(keycode, "m", true)
+	})
 	if err != nil {
 		logger.Log(logger.ERROR, "Failed to feed keys:", err)
 	}
 }
 
+// Call this when neovim flushes
+func (proc *NvimProcess) Flushed() {
+	proc.inputTime = time.Time{}
+}
+
+// Returns how long neovim has not responded to the input, zero if it is not
+// busy. Not every input causes a flush, so neovim is only busy if it also
+// doesn't answer the request sent after input.
+func (proc *NvimProcess) BusyTime() time.Duration {
+	if proc.inputTime.IsZero() {
+		return 0
+	}
+	if atomic.LoadInt32(&proc.probing) == 0 {
+		proc.inputTime = time.Time{}
+		return 0
+	}
+	return time.Since(proc.inputTime)
+}
+
+func (proc *NvimProcess) markInput() {
+	if proc.inputTime.IsZero() {
+		proc.inputTime = time.Now()
+	}
+	if atomic.CompareAndSwapInt32(&proc.probing, 0, 1) {
+		go func() {
+			var result int
+			proc.handle.Eval("0", &result)
+			atomic.StoreInt32(&proc.probing, 0)
+		}()
+	}
+}
+
 func (proc *NvimProcess) Input(keycode string) {
+	proc.markInput()
 	written, err := proc.handle.Input(keycode)
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to send input keys:", err)
@@ -532,16 +1829,20 @@ func (proc *NvimProcess) Input(keycode string) {
 }
 
 func (proc *NvimProcess) InputMouse(button, action, modifier string, grid, row, column int) {
+	proc.markInput()
 	err := proc.handle.InputMouse(button, action, modifier, grid, row, column)
 	if err != nil {
 		logger.Log(logger.WARN, "Failed to send mouse input:", err)
 	}
 }
 
+// Does nothing if the size is same with the last requested size. Grid size
+// can't be compared because neovim may not give us the requested size.
 func (proc *NvimProcess) TryResizeUI(rows, cols int) {
-	if rows <= 0 || cols <= 0 {
+	if rows <= 0 || cols <= 0 || proc.uiSize == common.Vec2(cols, rows) {
 		return
 	}
+	proc.uiSize = common.Vec2(cols, rows)
 	go func() {
 		err := proc.handle.TryResizeUI(cols, rows)
 		if err != nil {
@@ -564,6 +1865,86 @@ func (proc *NvimProcess) TryResizeUIGrid(id, rows, cols int) {
 	}()
 }
 
+// Saves the windows of the tab to the session file given as the second
+// argument. Returns false if this is the last tab, fails if a window of the
+// tab has unsaved changes. Only the windows of the tab and their buffers are
+// saved with the current directory, other options of 'sessionoptions' are used
+// as they are.
+const tearOffTabLua = `
+local tab, file = ...
+if #vim.api.nvim_list_tabpages() <= 1 then
+	return false
+end
+for _, win in ipairs(vim.api.nvim_tabpage_list_wins(tab)) do
+	if vim.bo[vim.api.nvim_win_get_buf(win)].modified then
+		error('Tab has unsaved changes')
+	end
+end
+vim.api.nvim_set_current_tabpage(tab)
+local sessionoptions = vim.o.sessionoptions
+vim.opt.sessionoptions:remove({ 'tabpages', 'buffers', 'sesdir' })
+vim.opt.sessionoptions:append('curdir')
+local ok, err = pcall(vim.cmd, 'mksession! ' .. vim.fn.fnameescape(file))
+vim.o.sessionoptions = sessionoptions
+if not ok then
+	error(err)
+end
+return true
+`
+
+// Opens the windows of the tab in a new Neoray and closes the tab. The layout
+// is carried with a session file, the new Neoray sources and deletes it. Zero
+// is the current tab. Does nothing if this is the last tab or the tab has
+// unsaved changes.
+func (proc *NvimProcess) TearOffTab(tab nvim.Tabpage) {
+	go func() {
+		session, err := os.CreateTemp("", "neoray-tab-*.vim")
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to create session file:", err)
+			return
+		}
+		session.Close()
+		var ok bool
+		err = proc.handle.ExecLua(tearOffTabLua, &ok, tab, session.Name())
+		if err != nil || !ok {
+			os.Remove(session.Name())
+			if err != nil {
+				proc.EchoError("Failed to tear off the tab: %v", err)
+			}
+			return
+		}
+		remove := fmt.Sprintf("call delete('%s')", strings.ReplaceAll(session.Name(), "'", "''"))
+		err = OpenNewWindow("--session", session.Name(), "-c", remove)
+		if err != nil {
+			os.Remove(session.Name())
+			proc.EchoError("Failed to open new window: %v", err)
+			return
+		}
+		err = proc.handle.ExecLua("vim.cmd('tabclose ' .. vim.api.nvim_tabpage_get_number(...))", nil, tab)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to close the tab:", err)
+		}
+	}()
+}
+
+func (proc *NvimProcess) SetWindowWidth(win nvim.Window, width int) {
+	go func() {
+		err := proc.handle.SetWindowWidth(win, width)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to set window width:", err)
+		}
+	}()
+}
+
+func (proc *NvimProcess) SetWindowHeight(win nvim.Window, height int) {
+	go func() {
+		err := proc.handle.SetWindowHeight(win, height)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to set window height:", err)
+		}
+	}()
+}
+
 func (proc *NvimProcess) Close() {
 	// Sometimes Close function blocks forever
 	// I realized that when using a popular neovim configuration
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_splitPaste(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		size int
+		want []string
+	}{
+		{
+			name: "Small",
+			str:  "hello",
+			size: 8,
+			want: []string{"hello"},
+		},
+		{
+			name: "Exact",
+			str:  "abcdefgh",
+			size: 4,
+			want: []string{"abcd", "efgh"},
+		},
+		{
+			name: "Multibyte",
+			str:  "abcğdef",
+			size: 4,
+			want: []string{"abc", "ğde", "f"},
+		},
+		{
+			name: "Crlf",
+			str:  "abc\r\ndef",
+			size: 4,
+			want: []string{"abc", "\r\nde", "f"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitPaste(tt.str, tt.size)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitPaste() = %q, want %q", got, tt.want)
+			}
+			for _, chunk := range got {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("Chunk %q is not valid utf-8", chunk)
+				}
+			}
+		})
+	}
+}
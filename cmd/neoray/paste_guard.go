@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Number of the lines shown in the preview of the pasted text
+const PASTE_PREVIEW_LINES = 5
+
+// Choices of the paste guard
+const (
+	PASTE_CHOICE_PASTE   = "p"
+	PASTE_CHOICE_LITERAL = "l"
+	PASTE_CHOICE_CANCEL  = "c"
+)
+
+// PasteGuard asks the user before pasting a text longer than the
+// PasteProtection option or a text containing control characters, which are
+// usually copied by accident. The text can be pasted as always or literally
+// in insert mode, neovim doesn't run it as commands then.
+type PasteGuard struct {
+	pos        common.Vector2[int]
+	hidden     bool
+	rows, cols int
+	cells      [][]rune
+	buttons    []ConfirmButton
+	hlButton   int    // Highlighted button index, -1 if none
+	text       string // waiting for the answer
+	renderer   *GridRenderer
+}
+
+func NewPasteGuard() *PasteGuard {
+	guard := new(PasteGuard)
+	guard.hidden = true
+	guard.hlButton = -1
+	guard.rows = 1
+	guard.cols = 1
+	var err error
+	guard.renderer, err = NewGridRenderer(Editor, guard.rows, guard.cols, nil, DEFAULT_FONT_SIZE, guard.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create paste guard renderer")
+	}
+	return guard
+}
+
+// Pastes the clipboard, asks the user first if the text needs it
+func PasteClipboard() {
+	text := glfw.GetClipboardString()
+	Editor.clipboardHistory.Add(text)
+	PasteText(text)
+}
+
+// Pastes the text, asks the user first if the text needs it
+func PasteText(text string) {
+	if text == "" || Editor.pasteGuard.Show(text) {
+		return
+	}
+	Editor.nvim.Paste(text)
+}
+
+// Returns the number of the lines and whether the text contains control
+// characters other than the line endings and tabs.
+func inspectPaste(text string) (lines int, control bool) {
+	lines = strings.Count(strings.TrimRight(text, "\r\n"), "\n") + 1
+	for _, c := range text {
+		if (c < 0x20 && c != '\n' && c != '\r' && c != '\t') || (c >= 0x7F && c <= 0x9F) {
+			control = true
+			break
+		}
+	}
+	return lines, control
+}
+
+// Control characters are shown in caret notation, like ^[ for escape
+func previewPasteLine(line string, width int) string {
+	var builder strings.Builder
+	count := 0
+	for _, c := range strings.TrimRight(line, "\r") {
+		var text string
+		switch {
+		case c == '\t':
+			text = " "
+		case c < 0x20:
+			text = "^" + string(c+'@')
+		case c == 0x7F:
+			text = "^?"
+		case c >= 0x80 && c <= 0x9F:
+			text = fmt.Sprintf("<%x>", c)
+		default:
+			text = string(c)
+		}
+		count += len([]rune(text))
+		if count > width {
+			builder.WriteRune('…')
+			break
+		}
+		builder.WriteString(text)
+	}
+	return builder.String()
+}
+
+func (guard *PasteGuard) SetFontKit(kit *fontkit.FontKit) {
+	guard.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (guard *PasteGuard) SetFontSize(size float64) {
+	guard.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (guard *PasteGuard) IsVisible() bool {
+	return !guard.hidden
+}
+
+// Shows the guard if the text needs confirmation, returns false if it can be
+// pasted directly.
+func (guard *PasteGuard) Show(text string) bool {
+	maxLines := Editor.options.pasteProtection
+	if maxLines <= 0 {
+		return false
+	}
+	lines, control := inspectPaste(text)
+	if lines <= maxLines && !control {
+		return false
+	}
+	cellSize := guard.renderer.CellSize()
+	maxWidth := common.Max(Editor.ScreenSize().Width()/cellSize.Width()-4, 20)
+	message := []string{fmt.Sprintf("Pasting %d lines", lines)}
+	if lines == 1 {
+		message[0] = "Pasting 1 line"
+	}
+	if control {
+		message[0] += " with control characters"
+	}
+	message = append(message, "")
+	preview := strings.Split(text, "\n")
+	for i := 0; i < len(preview) && i < PASTE_PREVIEW_LINES; i++ {
+		message = append(message, "  "+previewPasteLine(preview[i], maxWidth-2))
+	}
+	if len(preview) > PASTE_PREVIEW_LINES {
+		message = append(message, fmt.Sprintf("  ... %d more lines", len(preview)-PASTE_PREVIEW_LINES))
+	}
+	buttons := []ConfirmButton{
+		{label: "[P]aste", key: PASTE_CHOICE_PASTE},
+		{label: "Paste [L]iterally in insert mode", key: PASTE_CHOICE_LITERAL},
+		{label: "[C]ancel", key: PASTE_CHOICE_CANCEL},
+	}
+	// Buttons are placed below the preview, wrapped if there is no space
+	buttonRow := len(message) + 2
+	col := 1
+	width := 0
+	for _, line := range message {
+		width = common.Max(width, len([]rune(line)))
+	}
+	for i := range buttons {
+		labelWidth := len([]rune(buttons[i].label))
+		if col > 1 && col+labelWidth > maxWidth+1 {
+			buttonRow++
+			col = 1
+		}
+		buttons[i].row = buttonRow
+		buttons[i].col = col
+		col += labelWidth + 2
+		width = common.Max(width, col-3)
+	}
+	// One cell padding around the guard for the border
+	guard.rows = buttonRow + 2
+	guard.cols = width + 2
+	guard.cells = make([][]rune, guard.rows)
+	for i := range guard.cells {
+		guard.cells[i] = make([]rune, guard.cols)
+	}
+	setText := func(row, col int, text string) {
+		for i, c := range []rune(text) {
+			if c == ' ' {
+				c = 0
+			}
+			guard.cells[row][col+i] = c
+		}
+	}
+	for i, line := range message {
+		setText(i+1, 1, line)
+	}
+	for _, button := range buttons {
+		setText(button.row, button.col, button.label)
+	}
+	guard.text = text
+	guard.buttons = buttons
+	guard.hlButton = -1
+	guard.hidden = false
+	guard.renderer.Resize(guard.rows, guard.cols)
+	guard.center()
+	Editor.MarkDraw()
+	logger.Log(logger.DEBUG, "Paste guard shown for", lines, "lines, control characters:", control)
+	return true
+}
+
+func (guard *PasteGuard) center() {
+	cellSize := guard.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	guard.pos = common.Vector2[int]{
+		X: common.Max((windowSize.Width()-guard.cols*cellSize.Width())/2, 0),
+		Y: common.Max((windowSize.Height()-guard.rows*cellSize.Height())/2, 0),
+	}
+	guard.renderer.SetPos(guard.pos)
+}
+
+func (guard *PasteGuard) Hide() {
+	if !guard.hidden {
+		guard.hidden = true
+		guard.text = ""
+		Editor.MarkRender()
+	}
+}
+
+// Runs the choice and hides the guard
+func (guard *PasteGuard) choose(choice string) {
+	text := guard.text
+	guard.Hide()
+	switch choice {
+	case PASTE_CHOICE_PASTE:
+		Editor.nvim.Paste(text)
+	case PASTE_CHOICE_LITERAL:
+		Editor.nvim.PasteInsert(text)
+	}
+}
+
+// Call this function instead of sending keys to neovim when it is visible.
+func (guard *PasteGuard) KeyInput(keycode string) {
+	switch strings.ToLower(keycode) {
+	case PASTE_CHOICE_PASTE:
+		guard.choose(PASTE_CHOICE_PASTE)
+	case PASTE_CHOICE_LITERAL:
+		guard.choose(PASTE_CHOICE_LITERAL)
+	case PASTE_CHOICE_CANCEL, "<esc>", "<c-c>":
+		guard.choose(PASTE_CHOICE_CANCEL)
+	case "<cr>", "<kenter>":
+		if guard.hlButton != -1 {
+			guard.choose(guard.buttons[guard.hlButton].key)
+		}
+	case "<tab>", "<right>":
+		guard.moveSelection(1)
+	case "<s-tab>", "<left>":
+		guard.moveSelection(-1)
+	}
+}
+
+func (guard *PasteGuard) moveSelection(v int) {
+	count := len(guard.buttons)
+	if guard.hlButton == -1 && v < 0 {
+		guard.hlButton = 0
+	}
+	guard.hlButton = (guard.hlButton + v + count) % count
+	Editor.MarkDraw()
+}
+
+func (guard *PasteGuard) Draw() {
+	if guard.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	// Window may be resized
+	guard.center()
+	normal := WidgetAttribute("Pmenu")
+	highlighted := WidgetAttribute("PmenuSel")
+	highlighted.bold = true
+	for row := 1; row < guard.rows-1; row++ {
+		for col := 1; col < guard.cols-1; col++ {
+			attrib := normal
+			if index := guard.buttonAt(row, col); index != -1 {
+				attrib.bold = true
+				if index == guard.hlButton {
+					attrib = highlighted
+				}
+			}
+			guard.renderer.DrawCell(row, col, guard.cells[row][col], attrib)
+		}
+	}
+	guard.renderer.DrawBorder(normal)
+	EndBenchmark("PasteGuard.Draw")
+}
+
+func (guard *PasteGuard) Render() {
+	if guard.hidden {
+		return
+	}
+	guard.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns index of the button at the cell, -1 if there is no button
+func (guard *PasteGuard) buttonAt(row, col int) int {
+	for i, button := range guard.buttons {
+		if row == button.row && col >= button.col && col < button.col+len([]rune(button.label)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Call this function when mouse moved.
+func (guard *PasteGuard) MouseMove(pos common.Vector2[int]) {
+	if guard.hidden {
+		return
+	}
+	index := -1
+	if row, col, ok := guard.renderer.CellAt(pos); ok {
+		index = guard.buttonAt(row, col)
+	}
+	if guard.hlButton != index {
+		guard.hlButton = index
+		Editor.MarkDraw()
+	}
+}
+
+// Call this function when mouse clicked. Returns true if the guard is
+// visible, it waits for the answer.
+func (guard *PasteGuard) MouseClick(pos common.Vector2[int]) bool {
+	if guard.hidden {
+		return false
+	}
+	if row, col, ok := guard.renderer.CellAt(pos); ok {
+		if index := guard.buttonAt(row, col); index != -1 {
+			guard.choose(guard.buttons[index].key)
+		}
+	}
+	return true
+}
+
+func (guard *PasteGuard) Destroy() {
+	guard.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Paste guard destroyed")
+}
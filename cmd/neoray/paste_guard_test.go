@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func Test_inspectPaste(t *testing.T) {
+	tests := []struct {
+		text    string
+		lines   int
+		control bool
+	}{
+		{"hello", 1, false},
+		{"a\nb\nc\n", 3, false},
+		{"a\r\nb\r\n", 2, false},
+		{"\tindented", 1, false},
+		{":!rm -rf ~\x1b", 1, true},
+		{"ok\u009bbad", 1, true},
+	}
+	for _, tt := range tests {
+		lines, control := inspectPaste(tt.text)
+		if lines != tt.lines || control != tt.control {
+			t.Errorf("inspectPaste(%q) = %d, %v, want %d, %v", tt.text, lines, control, tt.lines, tt.control)
+		}
+	}
+}
+
+func Test_previewPasteLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		want  string
+	}{
+		{"hello\r", 10, "hello"},
+		{"a\x1bb\x7f", 10, "a^[b^?"},
+		{"abcdefgh", 4, "abcd…"},
+	}
+	for _, tt := range tests {
+		if got := previewPasteLine(tt.line, tt.width); got != tt.want {
+			t.Errorf("previewPasteLine(%q, %d) = %q, want %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+const (
+	QUICK_OPEN_MAX_ITEMS = 12    // Maximum number of visible results
+	QUICK_OPEN_MAX_FILES = 20000 // Maximum number of files collected from working directory
+)
+
+var errQuickOpenLimit = errors.New("quick open file limit reached")
+
+// Directories of the version control systems, hidden ones are already skipped
+var quickOpenSkipDirs = map[string]bool{
+	"CVS":    true,
+	"_darcs": true,
+}
+
+type QuickOpenItem struct {
+	name string // displayed name, relative to working directory if possible
+	path string // absolute path
+}
+
+// A pattern of a .gitignore file, only matches the paths under base. Negated
+// patterns and ** in the middle of the patterns are not supported.
+type quickOpenIgnore struct {
+	base     string
+	pattern  string
+	dirOnly  bool
+	anchored bool // matched against the path relative to base, not the name
+}
+
+func parseQuickOpenIgnores(base, data string) []quickOpenIgnore {
+	ignores := []quickOpenIgnore{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		ignore := quickOpenIgnore{base: base}
+		if strings.HasSuffix(line, "/") {
+			ignore.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		line = strings.TrimPrefix(line, "**/")
+		if strings.Contains(line, "/") {
+			ignore.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		ignore.pattern = line
+		ignores = append(ignores, ignore)
+	}
+	return ignores
+}
+
+func (ignore quickOpenIgnore) matches(file string, isDir bool) bool {
+	if ignore.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(ignore.base, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !ignore.anchored {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(ignore.pattern, rel)
+	return ok
+}
+
+// Returns the recent files first and then the files in the working directory.
+// Hidden, version control and ignored directories are skipped.
+func collectQuickOpenFiles(cwd string, oldFiles []string) []QuickOpenItem {
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("QuickOpen.collectFiles")
+	items := []QuickOpenItem{}
+	added := make(map[string]bool)
+	add := func(path string) {
+		if added[path] {
+			return
+		}
+		added[path] = true
+		name := path
+		if cwd != "" {
+			rel, err := filepath.Rel(cwd, path)
+			if err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+		}
+		items = append(items, QuickOpenItem{name: name, path: path})
+	}
+	for _, file := range oldFiles {
+		info, err := os.Stat(file)
+		if err == nil && info.Mode().IsRegular() {
+			add(filepath.Clean(file))
+		}
+	}
+	if cwd == "" {
+		return items
+	}
+	// Ignores of the directories, including the ones of the parents
+	ignores := map[string][]quickOpenIgnore{}
+	ignored := func(path string, isDir bool) bool {
+		for _, ignore := range ignores[filepath.Dir(path)] {
+			if ignore.matches(path, isDir) {
+				return true
+			}
+		}
+		return false
+	}
+	count := 0
+	err := filepath.WalkDir(cwd, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable directories
+			return nil
+		}
+		if entry.IsDir() {
+			if path != cwd {
+				name := entry.Name()
+				if strings.HasPrefix(name, ".") || quickOpenSkipDirs[name] || ignored(path, true) {
+					return filepath.SkipDir
+				}
+			}
+			dirIgnores := ignores[filepath.Dir(path)]
+			if data, err := os.ReadFile(filepath.Join(path, ".gitignore")); err == nil {
+				dirIgnores = append(dirIgnores[:len(dirIgnores):len(dirIgnores)], parseQuickOpenIgnores(path, string(data))...)
+			}
+			ignores[path] = dirIgnores
+			return nil
+		}
+		if entry.Type().IsRegular() && !ignored(path, false) {
+			add(path)
+			count++
+			if count >= QUICK_OPEN_MAX_FILES {
+				return errQuickOpenLimit
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log(logger.WARN, "Quick open:", err)
+	}
+	return items
+}
+
+// QuickOpen is a fuzzy finder over recent files and the files in the working
+// directory of neovim. Input is captured while it is visible. Files are
+// collected in the background every time it is shown.
+type QuickOpen struct {
+	pos         common.Vector2[int]
+	hidden      bool
+	rows, cols  int
+	collecting  bool
+	generation  int // Results of the previous shows are dropped
+	items       []QuickOpenItem
+	matches     []QuickOpenItem
+	query       []rune
+	selected    int // index of the selected match
+	renderer    *GridRenderer
+	requestChan chan bool
+}
+
+func NewQuickOpen() *QuickOpen {
+	quickOpen := new(QuickOpen)
+	quickOpen.hidden = true
+	quickOpen.rows = QUICK_OPEN_MAX_ITEMS + 1
+	quickOpen.cols = 1
+	quickOpen.requestChan = make(chan bool, 1)
+	var err error
+	quickOpen.renderer, err = NewGridRenderer(Editor, quickOpen.rows, quickOpen.cols, nil, DEFAULT_FONT_SIZE, quickOpen.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create quick open renderer")
+	}
+	return quickOpen
+}
+
+// Returns the score of the path for the pattern, higher is better. Every
+// character of the pattern must be in the path in the same order. Consecutive
+// characters, start of the words and the file name scores more.
+func fuzzyScore(pattern, path string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	pattern = strings.ToLower(pattern)
+	path = strings.ToLower(path)
+	nameStart := strings.LastIndexAny(path, "/\\") + 1
+	score := 0
+	last := -2
+	i := 0
+	for _, c := range pattern {
+		index := strings.IndexRune(path[i:], c)
+		if index == -1 {
+			return 0, false
+		}
+		pos := i + index
+		score++
+		if pos == last+1 {
+			score += 3
+		}
+		if pos >= nameStart {
+			score += 2
+		}
+		if pos == 0 || strings.ContainsRune("/\\_-. ", rune(path[pos-1])) {
+			score += 2
+		}
+		last = pos
+		i = pos + utf8.RuneLen(c)
+	}
+	// Prefer shorter paths
+	score -= len(path) / 16
+	return score, true
+}
+
+func (quickOpen *QuickOpen) SetFontKit(kit *fontkit.FontKit) {
+	quickOpen.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (quickOpen *QuickOpen) SetFontSize(size float64) {
+	quickOpen.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (quickOpen *QuickOpen) IsVisible() bool {
+	return !quickOpen.hidden
+}
+
+// Can be called from any goroutine
+func (quickOpen *QuickOpen) Request() {
+	select {
+	case quickOpen.requestChan <- true:
+	default:
+	}
+}
+
+func (quickOpen *QuickOpen) Update() {
+	if len(quickOpen.requestChan) > 0 {
+		<-quickOpen.requestChan
+		quickOpen.Show()
+	}
+}
+
+// Neovim is asked for the working directory and the recent files in the
+// background too, the items are replaced when all are collected.
+func (quickOpen *QuickOpen) collectFiles() {
+	quickOpen.generation++
+	generation := quickOpen.generation
+	quickOpen.collecting = true
+	go func() {
+		items := collectQuickOpenFiles(Editor.nvim.WorkingDirectory(), Editor.nvim.OldFiles())
+		Editor.dispatch.Dispatch(func() {
+			if generation != quickOpen.generation {
+				return
+			}
+			quickOpen.collecting = false
+			quickOpen.items = items
+			if !quickOpen.hidden {
+				quickOpen.filter()
+			}
+		})
+	}()
+}
+
+func (quickOpen *QuickOpen) filter() {
+	pattern := string(quickOpen.query)
+	type scoredItem struct {
+		item  QuickOpenItem
+		score int
+		index int
+	}
+	scored := []scoredItem{}
+	for i, item := range quickOpen.items {
+		score, ok := fuzzyScore(pattern, item.name)
+		if ok {
+			scored = append(scored, scoredItem{item: item, score: score, index: i})
+		}
+	}
+	// Keep the order of the recent files when scores are equal
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+	quickOpen.matches = quickOpen.matches[:0]
+	for _, s := range scored {
+		quickOpen.matches = append(quickOpen.matches, s.item)
+	}
+	quickOpen.selected = 0
+	Editor.MarkDraw()
+}
+
+func (quickOpen *QuickOpen) Show() {
+	quickOpen.collectFiles()
+	quickOpen.query = quickOpen.query[:0]
+	quickOpen.hidden = false
+	// Width is the most of the window but not too wide
+	cellSize := quickOpen.renderer.CellSize()
+	windowCols := Editor.ScreenSize().Width() / cellSize.Width()
+	quickOpen.cols = common.Clamp(windowCols-4, common.Min(20, windowCols), 100)
+	quickOpen.renderer.Resize(quickOpen.rows, quickOpen.cols)
+	quickOpen.pos = common.Vector2[int]{
+		X: common.Max((Editor.ScreenSize().Width()-quickOpen.cols*cellSize.Width())/2, 0),
+		Y: Editor.ScreenSize().Height() / 8,
+	}
+	quickOpen.renderer.SetPos(quickOpen.pos)
+	quickOpen.filter()
+}
+
+func (quickOpen *QuickOpen) Hide() {
+	if !quickOpen.hidden {
+		quickOpen.hidden = true
+		Editor.MarkRender()
+	}
+}
+
+func (quickOpen *QuickOpen) open(index int) {
+	if index >= 0 && index < len(quickOpen.matches) {
+		Editor.nvim.EditFile(quickOpen.matches[index].path)
+	}
+	quickOpen.Hide()
+}
+
+func (quickOpen *QuickOpen) moveSelection(v int) {
+	count := common.Min(len(quickOpen.matches), QUICK_OPEN_MAX_ITEMS)
+	if count == 0 {
+		return
+	}
+	quickOpen.selected = (quickOpen.selected + v + count) % count
+	Editor.MarkDraw()
+}
+
+// Call this function instead of sending keys to neovim when it is visible.
+func (quickOpen *QuickOpen) KeyInput(keycode string) {
+	switch keycode {
+	case "<ESC>", "<C-c>":
+		quickOpen.Hide()
+	case "<CR>", "<kEnter>":
+		quickOpen.open(quickOpen.selected)
+	case "<BS>":
+		if len(quickOpen.query) > 0 {
+			quickOpen.query = quickOpen.query[:len(quickOpen.query)-1]
+			quickOpen.filter()
+		}
+	case "<C-u>":
+		quickOpen.query = quickOpen.query[:0]
+		quickOpen.filter()
+	case "<Up>", "<C-p>", "<S-Tab>":
+		quickOpen.moveSelection(-1)
+	case "<Down>", "<C-n>", "<Tab>":
+		quickOpen.moveSelection(1)
+	case "<Space>":
+		quickOpen.query = append(quickOpen.query, ' ')
+		quickOpen.filter()
+	default:
+		for char, special := range SpecialChars {
+			if keycode == "<"+special+">" {
+				quickOpen.query = append(quickOpen.query, char)
+				quickOpen.filter()
+				return
+			}
+		}
+		// Characters are sent without brackets
+		if utf8.RuneCountInString(keycode) == 1 {
+			char, _ := utf8.DecodeRuneInString(keycode)
+			quickOpen.query = append(quickOpen.query, char)
+			quickOpen.filter()
+		}
+	}
+}
+
+func (quickOpen *QuickOpen) Draw() {
+	if quickOpen.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	normal := WidgetAttribute("Pmenu")
+	selected := WidgetAttribute("PmenuSel")
+	selected.bold = true
+	// Fits the text to the width, cuts from the start because the end of
+	// the paths are more important
+	fit := func(text []rune, width int) []rune {
+		if len(text) > width {
+			return append([]rune{'…'}, text[len(text)-width+1:]...)
+		}
+		return text
+	}
+	// Prompt
+	prompt := append([]rune(" > "), fit(quickOpen.query, quickOpen.cols-4)...)
+	prompt = append(prompt, '▏')
+	promptAttrib := normal
+	promptAttrib.bold = true
+	quickOpen.renderer.DrawText(0, 0, prompt, promptAttrib)
+	// Matches
+	for i := 0; i < QUICK_OPEN_MAX_ITEMS; i++ {
+		var text []rune
+		attrib := normal
+		if i == len(quickOpen.matches) && quickOpen.collecting {
+			text = []rune("   Searching…")
+		} else if i < len(quickOpen.matches) {
+			text = append([]rune("   "), fit([]rune(quickOpen.matches[i].name), quickOpen.cols-4)...)
+			if i == quickOpen.selected {
+				attrib = selected
+			}
+		}
+		quickOpen.renderer.DrawText(i+1, 0, text, attrib)
+	}
+	EndBenchmark("QuickOpen.Draw")
+}
+
+func (quickOpen *QuickOpen) Render() {
+	if quickOpen.hidden {
+		return
+	}
+	quickOpen.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns true if the position is on the overlay and the index of the match
+// under the position, -1 if there is no match.
+func (quickOpen *QuickOpen) IsIntersecting(pos common.Vector2[int]) (bool, int) {
+	row, _, ok := quickOpen.renderer.CellAt(pos)
+	if !ok {
+		return false, -1
+	}
+	index := row - 1
+	if index < 0 || index >= len(quickOpen.matches) {
+		return true, -1
+	}
+	return true, index
+}
+
+// Call this function when mouse moved.
+func (quickOpen *QuickOpen) MouseMove(pos common.Vector2[int]) {
+	if quickOpen.hidden {
+		return
+	}
+	_, index := quickOpen.IsIntersecting(pos)
+	if index != -1 && index != quickOpen.selected {
+		quickOpen.selected = index
+		Editor.MarkDraw()
+	}
+}
+
+// Call this function when mouse clicked. Returns true if the click is
+// handled and shouldn't be sent to neovim.
+func (quickOpen *QuickOpen) MouseClick(pos common.Vector2[int]) bool {
+	if quickOpen.hidden {
+		return false
+	}
+	ok, index := quickOpen.IsIntersecting(pos)
+	if !ok {
+		quickOpen.Hide()
+	} else if index != -1 {
+		quickOpen.open(index)
+	}
+	return true
+}
+
+func (quickOpen *QuickOpen) Destroy() {
+	quickOpen.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Quick open destroyed")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_collectQuickOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":             "# comment\n*.log\n/build/\nnode_modules/\n",
+		"main.go":                "",
+		"debug.log":              "",
+		"build/out.bin":          "",
+		"cmd/build/keep.go":      "",
+		"cmd/.gitignore":         "gen_*.go\n",
+		"cmd/gen_table.go":       "",
+		"cmd/app.go":             "",
+		"web/node_modules/x.js":  "",
+		".git/config":            "",
+		"CVS/Entries":            "",
+		"docs/.hidden/secret.md": "",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := []string{}
+	for _, item := range collectQuickOpenFiles(dir, nil) {
+		names = append(names, filepath.ToSlash(item.name))
+	}
+	sort.Strings(names)
+	want := []string{".gitignore", "cmd/.gitignore", "cmd/app.go", "cmd/build/keep.go", "main.go"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("collectQuickOpenFiles = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+const (
+	RECORD_FPS        = 10
+	RECORD_MAX_FRAMES = RECORD_FPS * 120 // GIF frames are kept in memory until the end
+)
+
+// Start or stop request from neovim, the file is empty if the user didn't
+// give a name.
+type RecordRequest struct {
+	start bool
+	file  string
+	dir   string
+}
+
+// Recorder captures the frames from the screen at a fixed rate and encodes
+// them to a GIF, or to any format ffmpeg supports if it is installed.
+// Encoding is done in another goroutine while recording.
+type Recorder struct {
+	recording   bool
+	file        string
+	size        common.Vector2[int]
+	time        float32
+	needFrame   bool
+	frameChan   chan *image.RGBA
+	resultChan  chan error
+	requestChan chan RecordRequest
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		resultChan:  make(chan error, 1),
+		requestChan: make(chan RecordRequest, 4),
+	}
+}
+
+// Can be called from any goroutine
+func (recorder *Recorder) Request(request RecordRequest) {
+	recorder.requestChan <- request
+}
+
+func (recorder *Recorder) Update(delta float32) {
+	for len(recorder.requestChan) > 0 {
+		request := <-recorder.requestChan
+		if request.start {
+			recorder.Start(request.file, request.dir)
+		} else {
+			recorder.Stop()
+		}
+	}
+	select {
+	case err := <-recorder.resultChan:
+		if err != nil {
+			Editor.nvim.EchoError("Recording failed: %s", err)
+		} else {
+			Editor.nvim.Echo("Recording saved to %s", recorder.file)
+		}
+	default:
+	}
+	if recorder.recording {
+		recorder.time += delta
+		if recorder.time >= 1.0/RECORD_FPS {
+			recorder.time -= 1.0 / RECORD_FPS
+			// Frame will be captured after the render
+			recorder.needFrame = true
+			Editor.MarkRender()
+		}
+	}
+}
+
+func (recorder *Recorder) Start(file, dir string) {
+	if recorder.recording {
+		Editor.nvim.EchoError("Already recording to %s", recorder.file)
+		return
+	}
+	ffmpeg, ffmpegErr := exec.LookPath("ffmpeg")
+	if file == "" {
+		ext := ".gif"
+		if ffmpegErr == nil {
+			ext = ".mp4"
+		}
+		file = filepath.Join(dir, "neoray-"+time.Now().Format("20060102-150405")+ext)
+	}
+	useFFmpeg := strings.ToLower(filepath.Ext(file)) != ".gif"
+	if useFFmpeg && ffmpegErr != nil {
+		Editor.nvim.EchoError("ffmpeg not found, only .gif files can be recorded")
+		return
+	}
+	recorder.file = file
+	recorder.size = Editor.window.Size()
+	recorder.time = 0
+	recorder.needFrame = true
+	recorder.frameChan = make(chan *image.RGBA, 64)
+	recorder.recording = true
+	if useFFmpeg {
+		go func(frames chan *image.RGBA, size common.Vector2[int]) {
+			recorder.resultChan <- encodeFFmpeg(ffmpeg, file, size, frames)
+		}(recorder.frameChan, recorder.size)
+	} else {
+		go func(frames chan *image.RGBA) {
+			recorder.resultChan <- encodeGIF(file, frames)
+		}(recorder.frameChan)
+	}
+	logger.Log(logger.TRACE, "Recording started:", file)
+	Editor.MarkRender()
+}
+
+func (recorder *Recorder) Stop() {
+	if !recorder.recording {
+		return
+	}
+	recorder.recording = false
+	recorder.needFrame = false
+	close(recorder.frameChan)
+	logger.Log(logger.TRACE, "Recording stopped")
+}
+
+// Stops the recording and waits until the file is written, call when closing.
+func (recorder *Recorder) Close() {
+	if !recorder.recording {
+		return
+	}
+	recorder.Stop()
+	err := <-recorder.resultChan
+	if err != nil {
+		logger.Log(logger.ERROR, "Recording failed:", err)
+	} else {
+		logger.Log(logger.TRACE, "Recording saved to", recorder.file)
+	}
+}
+
+// Call this after rendering the screen.
+func (recorder *Recorder) Capture() {
+	if !recorder.recording || !recorder.needFrame {
+		return
+	}
+	recorder.needFrame = false
+	frame := Editor.window.Renderer().ReadPixels(Editor.window.Viewport())
+	// Size of the video can't be changed, window may be resized
+	img := image.NewRGBA(image.Rect(0, 0, recorder.size.Width(), recorder.size.Height()))
+	draw.Draw(img, img.Bounds(), frame, image.Point{}, draw.Src)
+	// Transparency is not supported
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	select {
+	case recorder.frameChan <- img:
+	default:
+		logger.Log(logger.WARN, "Recorder is slow, frame dropped")
+	}
+}
+
+func encodeGIF(file string, frames chan *image.RGBA) error {
+	anim := gif.GIF{}
+	for frame := range frames {
+		if len(anim.Image) >= RECORD_MAX_FRAMES {
+			continue
+		}
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.Draw(paletted, paletted.Bounds(), frame, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, 100/RECORD_FPS)
+	}
+	if len(anim.Image) >= RECORD_MAX_FRAMES {
+		logger.Log(logger.WARN, "Recording is too long, only first", RECORD_MAX_FRAMES, "frames are saved")
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = gif.EncodeAll(out, &anim)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func encodeFFmpeg(ffmpeg, file string, size common.Vector2[int], frames chan *image.RGBA) error {
+	cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", size.Width(), size.Height()),
+		"-r", fmt.Sprint(RECORD_FPS), "-i", "-",
+		// Most encoders need even dimensions
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2",
+		"-pix_fmt", "yuv420p", file)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	for frame := range frames {
+		if err == nil {
+			_, err = stdin.Write(frame.Pix)
+		}
+	}
+	stdin.Close()
+	if waitErr := cmd.Wait(); waitErr != nil {
+		return fmt.Errorf("%s %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Sessions are created by :mksession and Neoray appends the window state to
+// the end of the file as a NeorayRestoreWindow command. Sourcing the file
+// restores both neovim and the window.
+
+// Saving and restoring the window state must be done in the main thread.
+
+// Returns current window state as the arguments of NeorayRestoreWindow, in
+// form of "x y width height fontsize state"
+func windowSessionState() string {
+	dims := Editor.window.Dimensions()
+	state := "normal"
+	if Editor.window.IsFullscreen() {
+		state = "fullscreen"
+	} else if Editor.window.IsMaximized() {
+		state = "maximized"
+	}
+	return fmt.Sprintf("%d %d %d %d %s %s",
+		dims.X, dims.Y, dims.W, dims.H,
+		strconv.FormatFloat(Editor.gridManager.fontSize, 'f', -1, 64), state)
+}
+
+func restoreWindowSession(args []string) {
+	if len(args) != 6 {
+		logger.Log(logger.WARN, "NeorayRestoreWindow needs 6 arguments")
+		return
+	}
+	values := [4]int{}
+	for i := range values {
+		value, err := strconv.Atoi(args[i])
+		if err != nil {
+			logger.Log(logger.WARN, "NeorayRestoreWindow arguments aren't valid.")
+			return
+		}
+		values[i] = value
+	}
+	fontSize, err := strconv.ParseFloat(args[4], 64)
+	if err != nil || fontSize <= 0 {
+		logger.Log(logger.WARN, "NeorayRestoreWindow arguments aren't valid.")
+		return
+	}
+	logger.Log(logger.DEBUG, "Restoring window session:", args)
+	if Editor.window.IsFullscreen() {
+		Editor.window.ToggleFullscreen()
+	}
+	Editor.window.Move(common.Vec2(values[0], values[1]))
+	Editor.window.Resize(common.Vec2(values[2], values[3]))
+	SetFontSize(fontSize)
+	switch args[5] {
+	case "maximized":
+		Editor.window.Maximize()
+	case "fullscreen":
+		Editor.window.ToggleFullscreen()
+	}
+}
+
+// Sources the session file, used by the --session flag
+func (proc *NvimProcess) LoadSession(file string) {
+	logger.Log(logger.DEBUG, "Loading session", file)
+	go func() {
+		escaped, ok := proc.EscapeFileName(file)
+		if ok {
+			proc.Command("source %s", escaped)
+		}
+	}()
+}
+
+// Escapes the file name for using in commands, blocking
+func (proc *NvimProcess) EscapeFileName(file string) (string, bool) {
+	var escaped string
+	err := proc.handle.Call("fnameescape", &escaped, file)
+	if err != nil {
+		logger.Log(logger.ERROR, "Api call fnameescape() failed:", err)
+		return "", false
+	}
+	return escaped, true
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Font size is not an option, guifont sets it. But users want to change it
+// from settings too.
+const SETTINGS_FONT_SIZE = "FontSize"
+
+type SettingsEntry struct {
+	name           string // name of the option
+	toggle         bool   // toggles are true or false, others are sliders
+	min, max, step float64
+	value          func() float64 // current value, 0 or 1 for toggles
+}
+
+var SettingsEntries = []SettingsEntry{
+	{name: SETTINGS_FONT_SIZE, min: 6, max: 36, step: 0.5, value: func() float64 { return Editor.gridManager.fontSize }},
+	{name: OPTION_TRANSPARENCY, min: 0, max: 1, step: 0.05, value: func() float64 { return float64(Editor.options.transparency) }},
+	{name: OPTION_TARGET_TPS, min: 15, max: 240, step: 15, value: func() float64 { return float64(Editor.options.targetTPS) }},
+	{name: OPTION_CURSOR_ANIM, min: 0, max: 0.5, step: 0.02, value: func() float64 { return float64(Editor.options.cursorAnimTime) }},
+	{name: OPTION_FLOAT_ANIM, min: 0, max: 0.5, step: 0.02, value: func() float64 { return float64(Editor.options.floatAnimTime) }},
+	{name: OPTION_SWITCH_ANIM, min: 0, max: 0.5, step: 0.02, value: func() float64 { return float64(Editor.options.switchAnimTime) }},
+	{name: OPTION_MESSAGE_ANIM, min: 0, max: 0.5, step: 0.02, value: func() float64 { return float64(Editor.options.messageAnimTime) }},
+	{name: OPTION_MIN_CONTRAST, min: 1, max: 21, step: 0.5, value: func() float64 { return float64(Editor.options.minContrast) }},
+	{name: OPTION_BUSY_SPINNER, toggle: true, value: func() float64 { return boolToFloat(Editor.options.busySpinner) }},
+	{name: OPTION_CONTEXT_MENU, toggle: true, value: func() float64 { return boolToFloat(Editor.options.contextMenuEnabled) }},
+	{name: OPTION_BOX_DRAWING, toggle: true, value: func() float64 { return boolToFloat(Editor.options.boxDrawingEnabled) }},
+	{name: OPTION_IMAGE_VIEWER, toggle: true, value: func() float64 { return boolToFloat(Editor.options.imageViewerEnabled) }},
+	{name: OPTION_MINIMAP, toggle: true, value: func() float64 { return boolToFloat(Editor.options.minimapEnabled) }},
+	{name: OPTION_DIFF_GUTTER, toggle: true, value: func() float64 { return boolToFloat(Editor.options.diffGutter) }},
+	{name: OPTION_TERMINAL_IMAGES, toggle: true, value: func() float64 { return boolToFloat(Editor.options.terminalImages) }},
+	{name: OPTION_LOCK_GRID_SIZE, toggle: true, value: func() float64 { return boolToFloat(Editor.options.lockGridSize) }},
+	{name: OPTION_MOUSE_WARP, toggle: true, value: func() float64 { return boolToFloat(Editor.options.mouseWarp) }},
+	{name: OPTION_PASTE_PROTECTION, min: 0, max: 500, step: 10, value: func() float64 { return float64(Editor.options.pasteProtection) }},
+	{name: OPTION_DIGRAPH_HELPER, toggle: true, value: func() float64 { return boolToFloat(Editor.options.digraphHelper) }},
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (entry SettingsEntry) format(value float64) string {
+	if entry.toggle {
+		return strconv.FormatBool(value != 0)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Settings panel lists the options and lets the user change them with
+// keyboard or mouse. Changed settings are saved to the settings file in the
+// config directory and loaded after init.vim every time Neoray starts.
+type Settings struct {
+	pos         common.Vector2[int]
+	hidden      bool
+	rows, cols  int
+	selected    int
+	changed     map[string]string // options changed by the user
+	renderer    *GridRenderer
+	requestChan chan bool
+}
+
+func NewSettings() *Settings {
+	settings := new(Settings)
+	settings.hidden = true
+	settings.rows = len(SettingsEntries) + 3
+	settings.cols = 48
+	settings.changed = make(map[string]string)
+	settings.requestChan = make(chan bool, 1)
+	var err error
+	settings.renderer, err = NewGridRenderer(Editor, settings.rows, settings.cols, nil, DEFAULT_FONT_SIZE, settings.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create settings renderer")
+	}
+	return settings
+}
+
+func settingsFilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "neoray", "settings.vim"), nil
+}
+
+// Loads and applies the saved settings. The file contains NeoraySet commands.
+func (settings *Settings) Load() {
+	path, err := settingsFilePath()
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to find settings file:", err)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Log(logger.WARN, "Failed to read settings file:", err)
+		}
+		return
+	}
+	logger.Log(logger.DEBUG, "Loading settings from", path)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "NeoraySet" {
+			settings.apply(fields[1], fields[2])
+		}
+	}
+}
+
+func (settings *Settings) Save() {
+	if len(settings.changed) == 0 {
+		return
+	}
+	path, err := settingsFilePath()
+	if err != nil {
+		logger.Log(logger.WARN, "Failed to find settings file:", err)
+		return
+	}
+	// Keep the order of the entries
+	var builder strings.Builder
+	builder.WriteString("\" Generated by Neoray settings, do not edit while Neoray is running\n")
+	for _, entry := range SettingsEntries {
+		if value, ok := settings.changed[entry.name]; ok {
+			fmt.Fprintf(&builder, "NeoraySet %s %s\n", entry.name, value)
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(builder.String()), 0644)
+	}
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to save settings:", err)
+		return
+	}
+	logger.Log(logger.DEBUG, "Settings saved to", path)
+}
+
+func (settings *Settings) apply(name, value string) {
+	settings.changed[name] = value
+	if name == SETTINGS_FONT_SIZE {
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			logger.Log(logger.WARN, SETTINGS_FONT_SIZE, "value isn't valid.")
+			return
+		}
+		SetFontSize(size)
+		return
+	}
+	Editor.nvim.processOption([]string{name, value})
+}
+
+func (settings *Settings) SetFontKit(kit *fontkit.FontKit) {
+	settings.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (settings *Settings) SetFontSize(size float64) {
+	settings.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (settings *Settings) IsVisible() bool {
+	return !settings.hidden
+}
+
+// Can be called from any goroutine
+func (settings *Settings) Request() {
+	select {
+	case settings.requestChan <- true:
+	default:
+	}
+}
+
+func (settings *Settings) Update() {
+	if len(settings.requestChan) > 0 {
+		<-settings.requestChan
+		settings.Show()
+	}
+}
+
+func (settings *Settings) Show() {
+	settings.hidden = false
+	settings.center()
+	Editor.MarkDraw()
+}
+
+func (settings *Settings) center() {
+	cellSize := settings.renderer.CellSize()
+	windowSize := Editor.ScreenSize()
+	settings.pos = common.Vector2[int]{
+		X: common.Max((windowSize.Width()-settings.cols*cellSize.Width())/2, 0),
+		Y: common.Max((windowSize.Height()-settings.rows*cellSize.Height())/2, 0),
+	}
+	settings.renderer.SetPos(settings.pos)
+}
+
+func (settings *Settings) Hide() {
+	if !settings.hidden {
+		settings.hidden = true
+		settings.Save()
+		Editor.MarkRender()
+	}
+}
+
+// Moves the slider by steps or flips the toggle
+func (settings *Settings) change(index, steps int) {
+	entry := SettingsEntries[index]
+	value := entry.value()
+	if entry.toggle {
+		value = 1 - value
+	} else {
+		// Round to the step to prevent floating point errors
+		value = math.Round(value/entry.step+float64(steps)) * entry.step
+		value = common.Clamp(value, entry.min, entry.max)
+		value = math.Round(value*1000) / 1000
+	}
+	settings.apply(entry.name, entry.format(value))
+	Editor.MarkDraw()
+}
+
+func (settings *Settings) moveSelection(v int) {
+	count := len(SettingsEntries)
+	settings.selected = (settings.selected + v + count) % count
+	Editor.MarkDraw()
+}
+
+// Call this function instead of sending keys to neovim when it is visible.
+func (settings *Settings) KeyInput(keycode string) {
+	switch keycode {
+	case "<ESC>", "<C-c>", "q":
+		settings.Hide()
+	case "<Up>", "k", "<S-Tab>":
+		settings.moveSelection(-1)
+	case "<Down>", "j", "<Tab>":
+		settings.moveSelection(1)
+	case "<Left>", "h", "-":
+		settings.change(settings.selected, -1)
+	case "<Right>", "l", "+":
+		settings.change(settings.selected, 1)
+	case "<Space>", "<CR>":
+		if SettingsEntries[settings.selected].toggle {
+			settings.change(settings.selected, 1)
+		}
+	}
+}
+
+func (settings *Settings) Draw() {
+	if settings.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	settings.center()
+	normal := WidgetAttribute("Pmenu")
+	selected := WidgetAttribute("PmenuSel")
+	selected.bold = true
+	drawText := func(row int, text string, attrib HighlightAttribute) {
+		settings.renderer.DrawText(row, 0, []rune(text), attrib)
+	}
+	title := normal
+	title.bold = true
+	drawText(0, " Neoray Settings", title)
+	for i, entry := range SettingsEntries {
+		value := entry.value()
+		var control string
+		if entry.toggle {
+			control = "[ ]"
+			if value != 0 {
+				control = "[x]"
+			}
+		} else {
+			// Slider with 12 cells
+			filled := int(math.Round((value - entry.min) / (entry.max - entry.min) * 12))
+			filled = common.Clamp(filled, 0, 12)
+			control = strings.Repeat("█", filled) + strings.Repeat("░", 12-filled) + " " + entry.format(value)
+		}
+		attrib := normal
+		if i == settings.selected {
+			attrib = selected
+		}
+		drawText(i+1, fmt.Sprintf(" %-18s %s", entry.name, control), attrib)
+	}
+	drawText(settings.rows-2, "", normal)
+	drawText(settings.rows-1, " ←/→ change  space toggle  esc close", normal)
+	EndBenchmark("Settings.Draw")
+}
+
+func (settings *Settings) Render() {
+	if settings.hidden {
+		return
+	}
+	settings.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns true if the position is on the panel and the index of the entry
+// under the position, -1 if there is no entry.
+func (settings *Settings) IsIntersecting(pos common.Vector2[int]) (bool, int) {
+	row, _, ok := settings.renderer.CellAt(pos)
+	if !ok {
+		return false, -1
+	}
+	index := row - 1
+	if index < 0 || index >= len(SettingsEntries) {
+		return true, -1
+	}
+	return true, index
+}
+
+// Call this function when mouse clicked. Clicking to the left half of a
+// slider decreases and right half increases the value. Returns true if the
+// click shouldn't be sent to neovim.
+func (settings *Settings) MouseClick(pos common.Vector2[int]) bool {
+	if settings.hidden {
+		return false
+	}
+	ok, index := settings.IsIntersecting(pos)
+	if !ok {
+		settings.Hide()
+		return true
+	}
+	if index != -1 {
+		settings.selected = index
+		steps := 1
+		if pos.X-settings.pos.X < settings.cols*settings.renderer.CellSize().Width()/2 {
+			steps = -1
+		}
+		settings.change(index, steps)
+	}
+	return true
+}
+
+func (settings *Settings) Destroy() {
+	settings.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Settings destroyed")
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+func RegisterShell() error {
+	return errors.New("shell integration is only supported on Windows")
+}
+
+func UnregisterShell() error {
+	return errors.New("shell integration is only supported on Windows")
+}
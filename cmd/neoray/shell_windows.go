@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Extensions associated with Neoray, Neoray will be listed in "Open with"
+// menu of these files.
+var shellExtensions = []string{
+	".txt", ".md", ".log", ".ini", ".cfg", ".conf", ".toml", ".yaml", ".yml",
+	".json", ".xml", ".html", ".css", ".js", ".ts", ".go", ".c", ".h", ".cpp",
+	".hpp", ".cs", ".java", ".py", ".rs", ".lua", ".vim", ".sh", ".bat", ".ps1",
+}
+
+const (
+	SHELL_PROGID   = "Neoray.File"
+	SHELL_CLASSES  = `Software\Classes`
+	SHELL_APP_PATH = `Software\Classes\Applications\neoray.exe`
+)
+
+// Keys created by registration, every key has a default value and optional
+// named values. Keys are under HKEY_CURRENT_USER, no admin rights needed.
+func shellKeys(exe string) []struct {
+	path   string
+	values map[string]string
+} {
+	fileCmd := fmt.Sprintf(`"%s" --file "%%1"`, exe)
+	dirCmd := fmt.Sprintf(`"%s" "%%V"`, exe)
+	icon := fmt.Sprintf(`"%s",0`, exe)
+	return []struct {
+		path   string
+		values map[string]string
+	}{
+		// Context menu of the files
+		{SHELL_CLASSES + `\*\shell\Neoray`, map[string]string{"": "Open with Neoray", "Icon": icon}},
+		{SHELL_CLASSES + `\*\shell\Neoray\command`, map[string]string{"": fileCmd}},
+		// Context menu of the folders and folder backgrounds
+		{SHELL_CLASSES + `\Directory\shell\Neoray`, map[string]string{"": "Open with Neoray", "Icon": icon}},
+		{SHELL_CLASSES + `\Directory\shell\Neoray\command`, map[string]string{"": dirCmd}},
+		{SHELL_CLASSES + `\Directory\Background\shell\Neoray`, map[string]string{"": "Open with Neoray", "Icon": icon}},
+		{SHELL_CLASSES + `\Directory\Background\shell\Neoray\command`, map[string]string{"": dirCmd}},
+		// File type
+		{SHELL_CLASSES + `\` + SHELL_PROGID, map[string]string{"": "Neoray File"}},
+		{SHELL_CLASSES + `\` + SHELL_PROGID + `\DefaultIcon`, map[string]string{"": icon}},
+		{SHELL_CLASSES + `\` + SHELL_PROGID + `\shell\open\command`, map[string]string{"": fileCmd}},
+		// Application
+		{SHELL_APP_PATH, map[string]string{"FriendlyAppName": NAME}},
+		{SHELL_APP_PATH + `\DefaultIcon`, map[string]string{"": icon}},
+		{SHELL_APP_PATH + `\shell\open\command`, map[string]string{"": fileCmd}},
+	}
+}
+
+func RegisterShell() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	for _, key := range shellKeys(exe) {
+		k, _, err := registry.CreateKey(registry.CURRENT_USER, key.path, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("failed to create key %s: %w", key.path, err)
+		}
+		for name, value := range key.values {
+			err = k.SetStringValue(name, value)
+			if err != nil {
+				k.Close()
+				return fmt.Errorf("failed to set value of %s: %w", key.path, err)
+			}
+		}
+		k.Close()
+	}
+	// Supported types of the application and open with list of the extensions
+	types, _, err := registry.CreateKey(registry.CURRENT_USER, SHELL_APP_PATH+`\SupportedTypes`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer types.Close()
+	for _, ext := range shellExtensions {
+		types.SetStringValue(ext, "")
+		k, _, err := registry.CreateKey(registry.CURRENT_USER, SHELL_CLASSES+`\`+ext+`\OpenWithProgids`, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("failed to associate %s: %w", ext, err)
+		}
+		k.SetStringValue(SHELL_PROGID, "")
+		k.Close()
+	}
+	notifyAssocChanged()
+	return nil
+}
+
+func UnregisterShell() error {
+	roots := []string{
+		SHELL_CLASSES + `\*\shell\Neoray`,
+		SHELL_CLASSES + `\Directory\shell\Neoray`,
+		SHELL_CLASSES + `\Directory\Background\shell\Neoray`,
+		SHELL_CLASSES + `\` + SHELL_PROGID,
+		SHELL_APP_PATH,
+	}
+	for _, root := range roots {
+		err := deleteKeyTree(registry.CURRENT_USER, root)
+		if err != nil && err != registry.ErrNotExist {
+			return fmt.Errorf("failed to delete key %s: %w", root, err)
+		}
+	}
+	for _, ext := range shellExtensions {
+		k, err := registry.OpenKey(registry.CURRENT_USER, SHELL_CLASSES+`\`+ext+`\OpenWithProgids`, registry.SET_VALUE)
+		if err != nil {
+			continue
+		}
+		k.DeleteValue(SHELL_PROGID)
+		k.Close()
+	}
+	notifyAssocChanged()
+	return nil
+}
+
+// Registry doesn't let us delete keys which have subkeys
+func deleteKeyTree(root registry.Key, path string) error {
+	k, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return err
+	}
+	subkeys, err := k.ReadSubKeyNames(-1)
+	k.Close()
+	if err != nil {
+		return err
+	}
+	for _, subkey := range subkeys {
+		err = deleteKeyTree(root, path+`\`+subkey)
+		if err != nil {
+			return err
+		}
+	}
+	return registry.DeleteKey(root, path)
+}
+
+// Tells the explorer to reload the associations
+func notifyAssocChanged() {
+	const SHCNE_ASSOCCHANGED = 0x08000000
+	const SHCNF_IDLIST = 0
+	shell32 := windows.NewLazySystemDLL("shell32.dll")
+	shell32.NewProc("SHChangeNotify").Call(SHCNE_ASSOCCHANGED, SHCNF_IDLIST, 0, 0)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Stats counts ticks and rendered frames and publishes them with the memory
+// usage to g:neoray_stats once a second. Statusline plugins can show them.
+// Function averages are only available in debug builds.
+type Stats struct {
+	time    float32
+	ticks   int
+	frames  int
+	mutex   sync.Mutex // guards latest
+	latest  map[string]interface{}
+	sending bool
+	done    chan bool
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		latest: map[string]interface{}{},
+		done:   make(chan bool, 1),
+	}
+}
+
+// Call this after every render
+func (stats *Stats) FrameRendered() {
+	stats.frames++
+}
+
+func (stats *Stats) Update(delta float32) {
+	stats.ticks++
+	stats.time += delta
+	select {
+	case <-stats.done:
+		stats.sending = false
+	default:
+	}
+	if stats.time < 1 {
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	averages := map[string]interface{}{}
+	for name, average := range bench.Averages() {
+		averages[name] = average.Seconds() * 1000
+	}
+	current := map[string]interface{}{
+		"tps":        float64(stats.ticks) / float64(stats.time),
+		"fps":        float64(stats.frames) / float64(stats.time),
+		"memory":     mem.HeapAlloc,
+		"memory_sys": mem.Sys,
+		"gc_count":   mem.NumGC,
+		"goroutines": runtime.NumGoroutine(),
+		"averages":   averages, // milliseconds
+	}
+	stats.time = 0
+	stats.ticks = 0
+	stats.frames = 0
+	stats.mutex.Lock()
+	stats.latest = current
+	stats.mutex.Unlock()
+	// Skip if the last one is not sent yet, neovim may be busy
+	if Editor.state >= EditorWindowShown && !stats.sending {
+		stats.sending = true
+		go func() {
+			err := Editor.nvim.handle.SetVar("neoray_stats", current)
+			if err != nil {
+				logger.Log(logger.DEBUG, "Failed to publish stats:", err)
+			}
+			stats.done <- true
+		}()
+	}
+}
+
+// Returns the last calculated stats, can be called from any goroutine
+func (stats *Stats) Latest() map[string]interface{} {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return stats.latest
+}
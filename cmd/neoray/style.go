@@ -13,17 +13,19 @@ const DEFAULT_FONT_SIZE = 12
 
 // neovim ui options
 type UIOptions struct {
-	arabicshape   bool
-	ambiwidth     string
-	emoji         bool
-	guifont       string
-	guifontset    string
-	guifontwide   string // TODO
-	linespace     int    // TODO
-	pumblend      int    // TODO
-	showtabline   int
-	termguicolors bool
-	mousehide     bool // will be implemented soon, currently always true
+	arabicshape    bool
+	ambiwidth      string
+	emoji          bool
+	guifont        string
+	guifontKit     *fontkit.FontKit // nil if guifont is empty or not found
+	guifontset     string
+	guifontwide    string
+	guifontwideKit *fontkit.FontKit // nil if guifontwide is empty
+	linespace      int
+	pumblend       int
+	showtabline    int
+	termguicolors  bool
+	mousehide      bool // will be implemented soon, currently always true
 }
 
 func CreateUIOptions() UIOptions {
@@ -38,6 +40,7 @@ func (options *UIOptions) setGuiFont(guifont string) {
 		return
 	}
 	options.guifont = guifont
+	options.guifontKit = nil
 	var size float64 = DEFAULT_FONT_SIZE
 	// treat underlines like whitespaces
 	guifont = strings.ReplaceAll(guifont, "_", " ")
@@ -56,7 +59,7 @@ func (options *UIOptions) setGuiFont(guifont string) {
 	if name == "" {
 		// Set nil to disable font
 		Editor.gridManager.SetGridFontKit(1, nil)
-		Editor.contextMenu.SetFontKit(nil)
+		Editor.widgets.SetFontKit(nil)
 	} else {
 		// Create and set font
 		logger.Log(logger.TRACE, "Loading font", name)
@@ -78,13 +81,104 @@ func (options *UIOptions) setGuiFont(guifont string) {
 				logger.Log(logger.TRACE, "BoldItalic:", kit.BoldItalic().FilePath())
 			}
 			// Set fonts
+			options.guifontKit = kit
 			Editor.gridManager.SetGridFontKit(1, kit)
-			Editor.contextMenu.SetFontKit(kit)
+			Editor.widgets.SetFontKit(kit)
 		}
 	}
 	// Always set font size to default if user not set
+	SetFontSize(size)
+}
+
+// Font for double width characters, size is always same with the guifont
+func (options *UIOptions) setGuiFontWide(guifontwide string) {
+	if guifontwide == options.guifontwide {
+		return
+	}
+	options.guifontwide = guifontwide
+	options.guifontwideKit = nil
+	name := strings.Split(strings.ReplaceAll(guifontwide, "_", " "), ":")[0]
+	if name != "" {
+		logger.Log(logger.TRACE, "Loading wide font", name)
+		kit, err := fontkit.CreateKit(name)
+		if err != nil {
+			Editor.nvim.EchoError("Font %s not found", name)
+		} else {
+			options.guifontwideKit = kit
+		}
+	}
+	Editor.gridManager.SetWideFontKit(options.guifontwideKit)
+}
+
+// Line space is the number of pixels added to the height of the cells
+func (options *UIOptions) setLinespace(linespace int) {
+	if linespace == options.linespace {
+		return
+	}
+	options.linespace = linespace
+	Editor.gridManager.SetLineSpace(linespace)
+}
+
+// Neovim blends the popup menu itself and sends the blend attribute of the
+// highlights in multigrid, we only need to redraw.
+func (options *UIOptions) setPumblend(pumblend int) {
+	options.pumblend = pumblend
+	Editor.MarkForceDraw()
+}
+
+func (options *UIOptions) setShowtabline(showtabline int) {
+	options.showtabline = showtabline
+	Editor.MarkForceDraw()
+}
+
+// Width of the ambiguous characters are calculated by neovim and the cells
+// are sent again, redraw the old ones.
+func (options *UIOptions) setAmbiwidth(ambiwidth string) {
+	options.ambiwidth = ambiwidth
+	Editor.MarkForceDraw()
+}
+
+// We are always attached with rgb colors, but highlights may be changed.
+func (options *UIOptions) setTermguicolors(termguicolors bool) {
+	options.termguicolors = termguicolors
+	Editor.MarkForceDraw()
+}
+
+// Reloads the fonts with the same sizes, call when DPI or scale factor changes
+func ResetFontSize() {
+	reloadFontSizes()
+	Editor.gridManager.CheckDefaultGridSize()
+}
+
+// Reloads the fonts like ResetFontSize but resizes the window to keep the
+// number of rows and columns same. Used when the window moves to a monitor
+// with different DPI.
+func ResetFontSizeKeepCells() {
+	defaultGrid := Editor.gridManager.Grid(1)
+	if defaultGrid == nil || Editor.window.IsMaximized() || Editor.window.IsFullscreen() {
+		ResetFontSize()
+		return
+	}
+	rows, cols := defaultGrid.rows, defaultGrid.cols
+	reloadFontSizes()
+	ResizeWindowInCellFormat(rows, cols)
+	// Window manager may not accept the size
+	Editor.gridManager.CheckDefaultGridSize()
+}
+
+func reloadFontSizes() {
+	Editor.gridManager.ResetFontSize()
+	size := Editor.gridManager.fontSize
+	if size == 0 {
+		size = DEFAULT_FONT_SIZE
+	}
+	Editor.widgets.SetFontSize(size)
+}
+
+// Sets the font size of the grids and the widgets
+func SetFontSize(size float64) {
 	Editor.gridManager.SetGridFontSize(1, size)
-	Editor.contextMenu.SetFontSize(size)
+	Editor.widgets.SetFontSize(size)
 }
 
 type HighlightAttribute struct {
@@ -100,7 +194,7 @@ type HighlightAttribute struct {
 	undercurl bool
 	// underdot  bool
 	// underdash bool
-	// blend     int
+	blend int // 0 to 100, background transparency
 	// TODO: Implement commented attributes
 }
 
@@ -130,6 +224,13 @@ func (mode *Mode) Current() ModeInfo {
 	return ModeInfo{}
 }
 
+// Returns the name of the current mode sent by neovim, like normal, insert or
+// visual. This is always up to date with the last flush and doesn't need to
+// ask neovim.
+func (mode *Mode) Name() string {
+	return mode.current_mode_name
+}
+
 func (mode *Mode) Clear() {
 	mode.mode_infos = []ModeInfo{}
 }
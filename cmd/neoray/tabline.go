@@ -0,0 +1,453 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/neovim/go-client/nvim"
+)
+
+const (
+	TABLINE_MAX_LABEL  = 30   // Maximum width of a tab label in cells
+	TABLINE_SLIDE_TIME = 0.15 // Seconds of sliding a label to its new place
+)
+
+// Evaluates the labels and tooltips of the tabs like gvim does. Options are
+// evaluated like 'statusline' in the current window of the tab and v:lnum is
+// the number of the tab, defaults are used when they are empty or fail.
+const tablineLabelsLua = `
+local tabs = ...
+local labelfmt, tipfmt = vim.o.guitablabel, vim.o.guitabtooltip
+local lnum = vim.v.lnum
+local function eval(fmt, win, nr)
+	if fmt == '' then
+		return nil
+	end
+	vim.v.lnum = nr
+	local ok, result = pcall(vim.api.nvim_eval_statusline, fmt, { winid = win })
+	if ok then
+		return result.str
+	end
+end
+local result = {}
+for _, tab in ipairs(tabs) do
+	local item = { label = '', tooltip = '' }
+	if vim.api.nvim_tabpage_is_valid(tab) then
+		local nr = vim.api.nvim_tabpage_get_number(tab)
+		local win = vim.api.nvim_tabpage_get_win(tab)
+		local name = vim.api.nvim_buf_get_name(vim.api.nvim_win_get_buf(win))
+		local wins = vim.api.nvim_tabpage_list_wins(tab)
+		local modified = false
+		for _, w in ipairs(wins) do
+			if vim.bo[vim.api.nvim_win_get_buf(w)].modified then
+				modified = true
+			end
+		end
+		local default = name == '' and '[No Name]' or vim.fn.fnamemodify(name, ':t')
+		local prefix = (#wins > 1 and tostring(#wins) or '') .. (modified and '+' or '')
+		if prefix ~= '' then
+			default = prefix .. ' ' .. default
+		end
+		item.label = eval(labelfmt, win, nr) or default
+		item.tooltip = eval(tipfmt, win, nr) or (name == '' and '[No Name]' or name)
+	end
+	table.insert(result, item)
+end
+vim.v.lnum = lnum
+return result
+`
+
+// Moves the tab after the given number of tabs
+const tablineMoveLua = `
+local tab, nr = ...
+vim.api.nvim_set_current_tabpage(tab)
+vim.cmd('tabmove ' .. nr)
+`
+
+type TablineTab struct {
+	tab     nvim.Tabpage
+	name    string // Name of the buffer in the current window of the tab
+	label   string
+	tooltip string
+	begin   int    // First column of the label
+	end     int    // Column after the label
+	target  int    // Column the label slides to, -1 while dragging
+	slide   *Tween // X is the column the label is drawn at
+}
+
+type TablineLabel struct {
+	Label   string `msgpack:"label"`
+	Tooltip string `msgpack:"tooltip"`
+}
+
+type TablineLabels struct {
+	tabs   []nvim.Tabpage
+	labels []TablineLabel
+}
+
+// Tabline is drawn at the top of the window when the tabline is externalized.
+// Neovim sends the tabs with tabline_update, labels and tooltips are evaluated
+// in the background from 'guitablabel' and 'guitabtooltip'. Visibility
+// follows 'showtabline' and the grids are moved down by its height. Tabs can
+// be reordered by dragging them, the labels slide to their new places.
+type Tabline struct {
+	tabs       []TablineTab
+	current    nvim.Tabpage
+	dragging   bool
+	dragTab    nvim.Tabpage
+	dragOffset int // Pixels between the beginning of the dragged label and the mouse
+	mouseX     int
+	cols       int
+	height     int // Height when the visibility was checked last time
+	dirty      bool
+	evaluating bool
+	labelChan  chan TablineLabels
+	renderer   *GridRenderer
+}
+
+func NewTabline() *Tabline {
+	tabline := new(Tabline)
+	tabline.cols = 1
+	tabline.labelChan = make(chan TablineLabels, 1)
+	var err error
+	tabline.renderer, err = NewGridRenderer(Editor, 1, tabline.cols, nil, DEFAULT_FONT_SIZE, common.Vector2[int]{})
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create tabline renderer")
+	}
+	return tabline
+}
+
+func (tabline *Tabline) SetFontKit(kit *fontkit.FontKit) {
+	tabline.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (tabline *Tabline) SetFontSize(size float64) {
+	tabline.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+// Showtabline 0 is never, 1 is only if there are at least two tabs and 2 is
+// always.
+func (tabline *Tabline) IsVisible() bool {
+	if len(tabline.tabs) == 0 || !Editor.nvim.HasExt("tabline") {
+		return false
+	}
+	switch Editor.uiOptions.showtabline {
+	case 0:
+		return false
+	case 1:
+		return len(tabline.tabs) > 1
+	}
+	return true
+}
+
+// Returns the height of the tabline in pixels, zero if it is not visible. The
+// default grid must not use this height.
+func (tabline *Tabline) Height() int {
+	if !tabline.IsVisible() {
+		return 0
+	}
+	return tabline.renderer.CellSize().Height()
+}
+
+// Call this when neovim sends tabline_update
+func (tabline *Tabline) SetTabs(current nvim.Tabpage, tabs []TablineTab) {
+	// Keep the labels until the new ones are evaluated
+	for i := range tabs {
+		tabs[i].label = "[No Name]"
+		if tabs[i].name != "" {
+			tabs[i].label = filepath.Base(tabs[i].name)
+		}
+		for _, old := range tabline.tabs {
+			if old.tab == tabs[i].tab {
+				tabs[i].label = old.label
+				tabs[i].tooltip = old.tooltip
+				tabs[i].target = old.target
+				tabs[i].slide = old.slide
+			}
+		}
+	}
+	// Closed tabs don't slide anymore
+	for _, old := range tabline.tabs {
+		closed := true
+		for _, tab := range tabs {
+			if tab.tab == old.tab {
+				closed = false
+			}
+		}
+		if closed && old.slide != nil {
+			Editor.animator.Remove(old.slide)
+		}
+	}
+	tabline.current = current
+	tabline.tabs = tabs
+	tabline.dirty = true
+	Editor.MarkDraw()
+}
+
+func (tabline *Tabline) Update() {
+	select {
+	case result := <-tabline.labelChan:
+		tabline.evaluating = false
+		for i, tab := range result.tabs {
+			for j := range tabline.tabs {
+				if tabline.tabs[j].tab == tab && i < len(result.labels) {
+					tabline.tabs[j].label = result.labels[i].Label
+					tabline.tabs[j].tooltip = result.labels[i].Tooltip
+				}
+			}
+		}
+		Editor.MarkDraw()
+	default:
+	}
+	if tabline.dirty && !tabline.evaluating && tabline.IsVisible() {
+		tabline.dirty = false
+		tabline.evaluating = true
+		tabs := make([]nvim.Tabpage, len(tabline.tabs))
+		for i, tab := range tabline.tabs {
+			tabs[i] = tab.tab
+		}
+		go tabline.evaluate(tabs)
+	}
+	// Showtabline, number of the tabs or the font may have changed
+	if height := tabline.Height(); height != tabline.height {
+		tabline.height = height
+		Editor.gridManager.CheckDefaultGridSize()
+		Editor.MarkForceDraw()
+	}
+}
+
+// Always sends to the channel even if fails because this is the only way to
+// know evaluating is finished.
+func (tabline *Tabline) evaluate(tabs []nvim.Tabpage) {
+	result := TablineLabels{tabs: tabs}
+	defer func() {
+		tabline.labelChan <- result
+	}()
+	err := Editor.nvim.handle.ExecLua(tablineLabelsLua, &result.labels, tabs)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to evaluate tab labels:", err)
+	}
+}
+
+// Returns the label of the tab with the spaces around it
+func (tabline *Tabline) label(i int) []rune {
+	label := []rune(tabline.tabs[i].label)
+	if len(label) > TABLINE_MAX_LABEL {
+		label = append(label[:TABLINE_MAX_LABEL-1], '…')
+	}
+	return append(append([]rune{' '}, label...), ' ')
+}
+
+// Returns the index of the dragged tab, -1 if no tab is dragged
+func (tabline *Tabline) dragIndex() int {
+	if tabline.dragging {
+		for i, tab := range tabline.tabs {
+			if tab.tab == tabline.dragTab {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Returns the indices of the tabs in the order they are laid out and the
+// position the dragged tab is dropped, -1 if no tab is dragged. The dragged
+// tab is dropped before the first label whose middle is after its middle.
+func (tabline *Tabline) layout() ([]int, int) {
+	drag := tabline.dragIndex()
+	order := make([]int, 0, len(tabline.tabs))
+	for i := range tabline.tabs {
+		if i != drag {
+			order = append(order, i)
+		}
+	}
+	if drag < 0 {
+		return order, -1
+	}
+	cellWidth := tabline.renderer.CellSize().Width()
+	middle := (tabline.mouseX-tabline.dragOffset)/cellWidth + len(tabline.label(drag))/2
+	drop := len(order)
+	col := 0
+	for j, i := range order {
+		width := len(tabline.label(i))
+		if col+width/2 > middle {
+			drop = j
+			break
+		}
+		col += width
+	}
+	order = append(order[:drop], append([]int{drag}, order[drop:]...)...)
+	return order, drop
+}
+
+func (tabline *Tabline) Draw() {
+	if !tabline.IsVisible() {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	cellSize := tabline.renderer.CellSize()
+	cols := common.Max(Editor.ScreenSize().Width()/cellSize.Width(), 1)
+	if cols != tabline.cols {
+		tabline.cols = cols
+		tabline.renderer.Resize(1, tabline.cols)
+	}
+	// Above the default grid
+	tabline.renderer.SetPos(common.Vector2[int]{X: 0, Y: -cellSize.Height()})
+	tabline.renderer.DrawText(0, 0, nil, WidgetAttribute("TabLineFill"))
+	order, _ := tabline.layout()
+	drag := tabline.dragIndex()
+	col := 0
+	for _, i := range order {
+		tab := &tabline.tabs[i]
+		width := len(tabline.label(i))
+		tab.begin = col
+		tab.end = col + width
+		col += width
+		if tab.slide == nil {
+			tab.target = tab.begin
+			tab.slide = Editor.animator.NewTween(common.Vec2(float32(tab.begin), 0), Editor.MarkDraw)
+		}
+		if i == drag {
+			// The dragged label follows the mouse
+			tab.target = -1
+			begin := (tabline.mouseX - tabline.dragOffset) / cellSize.Width()
+			tab.slide.Set(common.Vec2(float32(common.Clamp(begin, 0, common.Max(cols-width, 0))), 0))
+		} else if tab.target != tab.begin {
+			tab.target = tab.begin
+			tab.slide.AnimateTo(common.Vec2(float32(tab.begin), 0), TABLINE_SLIDE_TIME, common.EaseOutCubic)
+		}
+	}
+	for i := range tabline.tabs {
+		if i != drag {
+			tabline.drawLabel(i)
+		}
+	}
+	// Dragged label is drawn over the others
+	if drag >= 0 {
+		tabline.drawLabel(drag)
+	}
+	EndBenchmark("Tabline.Draw")
+}
+
+func (tabline *Tabline) drawLabel(i int) {
+	tab := &tabline.tabs[i]
+	attrib := WidgetAttribute("TabLine")
+	if tab.tab == tabline.current {
+		attrib = WidgetAttribute("TabLineSel")
+	}
+	col := int(math.Round(float64(tab.slide.Value().X)))
+	for _, char := range tabline.label(i) {
+		if col >= 0 && col < tabline.cols {
+			if char == ' ' {
+				char = 0
+			}
+			tabline.renderer.DrawCell(0, col, char, attrib)
+		}
+		col++
+	}
+}
+
+func (tabline *Tabline) Render() {
+	if !tabline.IsVisible() {
+		return
+	}
+	tabline.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns the index of the tab at the position, -1 if there is none
+func (tabline *Tabline) TabAt(pos common.Vector2[int]) int {
+	if !tabline.IsVisible() || pos.Y >= 0 || pos.Y < -tabline.Height() {
+		return -1
+	}
+	col := pos.X / tabline.renderer.CellSize().Width()
+	for i, tab := range tabline.tabs {
+		if col >= tab.begin && col < tab.end {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the tooltip of the tab at the position, empty if there is none
+func (tabline *Tabline) TooltipAt(pos common.Vector2[int]) string {
+	if i := tabline.TabAt(pos); i >= 0 {
+		return tabline.tabs[i].tooltip
+	}
+	return ""
+}
+
+// Call this function when mouse clicked. Switches to the tab under the mouse,
+// starts dragging it and returns true if the position is on the tabline.
+func (tabline *Tabline) MouseClick(pos common.Vector2[int]) bool {
+	if !tabline.IsVisible() || pos.Y >= 0 {
+		return false
+	}
+	i := tabline.TabAt(pos)
+	// Tab is moved when dropped, opened in a new window when dragged out
+	inputCache.tabDrag = i >= 0
+	tabline.dragging = i >= 0
+	if i >= 0 {
+		tab := tabline.tabs[i].tab
+		tabline.dragTab = tab
+		tabline.dragOffset = pos.X - tabline.tabs[i].begin*tabline.renderer.CellSize().Width()
+		tabline.mouseX = pos.X
+		if tab != tabline.current {
+			go func() {
+				if err := Editor.nvim.handle.SetCurrentTabpage(tab); err != nil {
+					logger.Log(logger.ERROR, "Failed to switch tab:", err)
+				}
+			}()
+		}
+	}
+	return true
+}
+
+func (tabline *Tabline) MouseMove(pos common.Vector2[int]) {
+	if tabline.dragging && pos.X != tabline.mouseX {
+		tabline.mouseX = pos.X
+		Editor.MarkDraw()
+	}
+}
+
+// Call this when the mouse is released after clicking a tab. The dragged tab
+// is moved to where it is dropped with :tabmove, or opened in a new window if
+// it is dropped outside of the window.
+func (tabline *Tabline) MouseRelease(outside bool) {
+	drag := tabline.dragIndex()
+	if drag < 0 {
+		tabline.dragging = false
+		return
+	}
+	_, drop := tabline.layout()
+	tabline.dragging = false
+	tab := tabline.tabs[drag]
+	if outside {
+		Editor.nvim.TearOffTab(tab.tab)
+	} else if drop != drag {
+		// Moved here too, the labels don't jump back until neovim updates
+		tabs := append(tabline.tabs[:drag:drag], tabline.tabs[drag+1:]...)
+		tabline.tabs = append(tabs[:drop], append([]TablineTab{tab}, tabs[drop:]...)...)
+		go func() {
+			if err := Editor.nvim.handle.ExecLua(tablineMoveLua, nil, tab.tab, drop); err != nil {
+				logger.Log(logger.ERROR, "Failed to move tab:", err)
+			}
+		}()
+	}
+	Editor.MarkDraw()
+}
+
+func (tabline *Tabline) Destroy() {
+	for _, tab := range tabline.tabs {
+		if tab.slide != nil {
+			Editor.animator.Remove(tab.slide)
+		}
+	}
+	tabline.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Tabline destroyed")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/neovim/go-client/nvim"
+)
+
+// Escape sequences written by the programs in :terminal buffers. The terminal
+// emulator of neovim consumes them, neoray.vim sends the ones we handle with
+// the TermRequest autocommand, which needs neovim 0.10. Hyperlinks need the
+// cursor of the request, which is sent since neovim 0.11.
+
+// Larger OSC 52 payloads are ignored, this is the size of the decoded text
+const OSC52_MAX_SIZE = 1 << 20
+
+var errOSC52Query = errors.New("clipboard queries are not supported")
+
+// Returns the body of the OSC sequence without the introducer and the
+// terminator, like "52;c;aGVsbG8="
+func trimOSC(seq string) string {
+	seq = strings.TrimPrefix(seq, "\x1b]")
+	seq = strings.TrimPrefix(seq, "\u009d")
+	seq = strings.TrimSuffix(seq, "\x07")
+	seq = strings.TrimSuffix(seq, "\x1b\\")
+	seq = strings.TrimSuffix(seq, "\u009c")
+	return seq
+}
+
+// Parses "52;{selections};{base64 data}" sequences that programs like tmux and
+// vim over ssh use for setting the clipboard. Returns the decoded text.
+func parseOSC52(seq string) (string, error) {
+	seq = trimOSC(seq)
+	if !strings.HasPrefix(seq, "52;") {
+		return "", errors.New("not an OSC 52 sequence")
+	}
+	parts := strings.SplitN(seq[3:], ";", 2)
+	if len(parts) != 2 {
+		return "", errors.New("OSC 52 sequence has no data")
+	}
+	data := parts[1]
+	if data == "?" {
+		// Programs could read the clipboard with this
+		return "", errOSC52Query
+	}
+	if len(data) > base64.StdEncoding.EncodedLen(OSC52_MAX_SIZE) {
+		return "", fmt.Errorf("OSC 52 data is larger than %d bytes", OSC52_MAX_SIZE)
+	}
+	// Some programs don't pad
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+		if err != nil {
+			return "", fmt.Errorf("OSC 52 data is not valid base64: %w", err)
+		}
+	}
+	return string(decoded), nil
+}
+
+// Copies the payload of an OSC 52 sequence to the clipboard, unless the user
+// disabled it with the TerminalClipboard option.
+func HandleOSC52(seq string) {
+	if !Editor.options.terminalClipboard {
+		logger.Log(logger.DEBUG, "OSC 52 ignored, terminal clipboard is disabled")
+		return
+	}
+	text, err := parseOSC52(seq)
+	if err != nil {
+		logger.Log(logger.WARN, "Terminal clipboard:", err)
+		return
+	}
+	if text == "" {
+		return
+	}
+	logger.Log(logger.DEBUG, "Terminal set the clipboard,", len(text), "bytes")
+	SetClipboard(text)
+}
+
+// Schemes of the hyperlinks Neoray opens, others may run programs. Opening a
+// file may run it too, file links are shown in the file manager instead.
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"mailto": true,
+}
+
+// Opens the url with the default application of the system
+func OpenURL(link string) error {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(parsed.Scheme, "file") {
+		return RevealFile(parsed)
+	}
+	if !linkSchemes[strings.ToLower(parsed.Scheme)] {
+		return fmt.Errorf("unsupported link scheme %q", parsed.Scheme)
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	case "darwin":
+		cmd = exec.Command("open", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Shows the file of the file url in the file manager. The file is selected on
+// macOS, other systems open its directory. Files of other hosts can't be shown.
+func RevealFile(link *url.URL) error {
+	if host := link.Hostname(); host != "" && host != "localhost" {
+		if name, err := os.Hostname(); err != nil || !strings.EqualFold(host, name) {
+			return fmt.Errorf("file %q is on another host", link.Path)
+		}
+	}
+	path := filepath.FromSlash(link.Path)
+	if runtime.GOOS == "windows" {
+		// Paths start with a slash before the volume, like /C:/Users
+		path = strings.TrimPrefix(path, `\`)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir := path
+	if !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", dir)
+	case "darwin":
+		cmd = exec.Command("open", "-R", path)
+	default:
+		cmd = exec.Command("xdg-open", dir)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+type linkCell struct {
+	grid, row, col int
+}
+
+// TerminalLinks tracks the OSC 8 hyperlink under the mouse. Links are kept by
+// neoray.lua, it underlines the hovered one and Neoray shows its url in the
+// tooltip. Ctrl+click opens the link.
+type TerminalLinks struct {
+	url     string   // url of the hovered link, empty if none
+	cell    linkCell // cell of the url
+	waiting bool     // a request is running
+	pending *linkCell
+}
+
+// Call when the mouse moves to another cell. Only one request runs at a
+// time, the last cell is asked after it.
+func (links *TerminalLinks) MouseMove(grid, row, col int) {
+	cell := linkCell{grid: grid, row: row, col: col}
+	if links.waiting {
+		links.pending = &cell
+		return
+	}
+	if cell == links.cell || Editor.nvim.apiLevel < TERM_LINK_API_LEVEL {
+		return
+	}
+	win := nvim.Window(0)
+	if g := Editor.gridManager.Grid(grid); g != nil && grid != 1 {
+		win = g.window
+	}
+	links.waiting = true
+	go func() {
+		var link string
+		err := Editor.nvim.handle.ExecLua("return require('neoray').hover_link(...)", &link, win, row, col)
+		if err != nil {
+			logger.Log(logger.DEBUG, "Failed to get terminal link:", err)
+		}
+		Editor.dispatch.Dispatch(func() {
+			links.waiting = false
+			links.url = link
+			links.cell = cell
+			if links.pending != nil {
+				pending := *links.pending
+				links.pending = nil
+				links.MouseMove(pending.grid, pending.row, pending.col)
+			}
+		})
+	}()
+}
+
+// Returns the url of the link at the position, empty if there is none
+func (links *TerminalLinks) URLAt(pos common.Vector2[int]) string {
+	if links.url == "" || links.waiting {
+		return ""
+	}
+	grid, row, col := Editor.gridManager.CellAt(pos)
+	if (linkCell{grid: grid, row: row, col: col}) != links.cell {
+		return ""
+	}
+	return links.url
+}
+
+func (links *TerminalLinks) TooltipAt(pos common.Vector2[int]) string {
+	if link := links.URLAt(pos); link != "" {
+		return link + " (Ctrl+click to open)"
+	}
+	return ""
+}
+
+// Opens the link at the position, returns false if there is none
+func (links *TerminalLinks) Open(pos common.Vector2[int]) bool {
+	link := links.URLAt(pos)
+	if link == "" {
+		return false
+	}
+	logger.Log(logger.DEBUG, "Opening link:", link)
+	if err := OpenURL(link); err != nil {
+		Editor.nvim.EchoError("Failed to open %s: %v", link, err)
+	}
+	return true
+}
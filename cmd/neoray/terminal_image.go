@@ -0,0 +1,860 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/hismailbulut/Neoray/pkg/render"
+	"github.com/hismailbulut/Neoray/pkg/window"
+	"github.com/neovim/go-client/nvim"
+)
+
+// Images written by the programs in :terminal buffers with the kitty graphics
+// protocol (APC) or sixel (DCS). neoray.lua anchors them with an extmark at
+// the terminal cursor and sends them with the TermRequest autocommand, APC
+// sequences and the cursor are sent since neovim 0.11.
+
+// Images wider or taller than this are ignored, textures can't be larger than
+// 4096 on some drivers and the texture of the image has a transparent row and
+// column more, see termImage.upload
+const TERM_IMAGE_MAX_SIZE = 4095
+
+const TERM_IMAGE_MAX_PIXELS = TERM_IMAGE_MAX_SIZE * TERM_IMAGE_MAX_SIZE
+
+// Oldest images are deleted when there are more than this
+const TERM_IMAGES_MAX_COUNT = 64
+
+// Placements are fetched at most once in this duration
+const TERM_IMAGES_FETCH_INTERVAL = 100 * time.Millisecond
+
+// Returns the body of the DCS or APC sequence without the terminator
+func trimStringTerminator(seq string) string {
+	seq = strings.TrimSuffix(seq, "\x1b\\")
+	seq = strings.TrimSuffix(seq, "\u009c")
+	return seq
+}
+
+// Default colors of the VT340 in percents, programs usually define their own
+var sixelDefaultPalette = [16][3]int{
+	{0, 0, 0}, {20, 20, 80}, {80, 13, 13}, {20, 80, 20},
+	{80, 20, 80}, {20, 80, 80}, {80, 80, 20}, {53, 53, 53},
+	{26, 26, 26}, {33, 33, 60}, {60, 26, 26}, {33, 60, 33},
+	{60, 33, 60}, {33, 60, 60}, {60, 60, 33}, {80, 80, 80},
+}
+
+func percentColor(r, g, b int) color.NRGBA {
+	scale := func(v int) uint8 {
+		return uint8(common.Clamp(v, 0, 100) * 255 / 100)
+	}
+	return color.NRGBA{R: scale(r), G: scale(g), B: scale(b), A: 255}
+}
+
+// Hue of the sixel colors starts from blue, red is 120 and green is 240
+func hlsColor(h, l, s int) color.NRGBA {
+	hue := float64((h+240)%360) / 360
+	light := float64(common.Clamp(l, 0, 100)) / 100
+	sat := float64(common.Clamp(s, 0, 100)) / 100
+	if sat == 0 {
+		v := uint8(light * 255)
+		return color.NRGBA{R: v, G: v, B: v, A: 255}
+	}
+	q := light + sat - light*sat
+	if light < 0.5 {
+		q = light * (1 + sat)
+	}
+	p := 2*light - q
+	channel := func(t float64) uint8 {
+		t -= math.Floor(t)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return color.NRGBA{R: channel(hue + 1.0/3), G: channel(hue), B: channel(hue - 1.0/3), A: 255}
+}
+
+// Reads the numeric parameters separated with semicolons, empty ones are zero.
+// Returns the index after them.
+func sixelParams(data string, i int) ([]int, int) {
+	params := []int{}
+	value, has := 0, false
+	for ; i < len(data); i++ {
+		c := data[i]
+		if c >= '0' && c <= '9' {
+			value = common.Min(value*10+int(c-'0'), TERM_IMAGE_MAX_PIXELS)
+			has = true
+		} else if c == ';' {
+			params = append(params, value)
+			value, has = 0, false
+		} else {
+			break
+		}
+	}
+	if has || len(params) > 0 {
+		params = append(params, value)
+	}
+	return params, i
+}
+
+// Runs the sixel data, calls paint for every sixel with its column, the row
+// of its top pixel and its pixels as bits, top pixel is the lowest bit.
+// Returns the size given with the raster attributes and the size of the
+// painted area.
+func scanSixel(data string, paint func(x, y, count int, bits byte, c color.NRGBA)) (raster, extent common.Vector2[int], err error) {
+	palette := make([]color.NRGBA, 256)
+	for i, c := range sixelDefaultPalette {
+		palette[i] = percentColor(c[0], c[1], c[2])
+	}
+	current := 0
+	x, y := 0, 0
+	draw := func(count int, c byte) error {
+		bits := c - '?'
+		if bits != 0 {
+			extent.X = common.Max(extent.X, x+count)
+			extent.Y = common.Max(extent.Y, y+6)
+			if extent.X > TERM_IMAGE_MAX_SIZE || extent.Y > TERM_IMAGE_MAX_SIZE {
+				return fmt.Errorf("sixel image is larger than %dx%d", TERM_IMAGE_MAX_SIZE, TERM_IMAGE_MAX_SIZE)
+			}
+			if paint != nil {
+				paint(x, y, count, bits, palette[current])
+			}
+		}
+		x += count
+		return nil
+	}
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			var params []int
+			params, i = sixelParams(data, i+1)
+			if len(params) >= 4 {
+				raster = common.Vec2(params[2], params[3])
+			}
+		case c == '#':
+			var params []int
+			params, i = sixelParams(data, i+1)
+			if len(params) == 0 {
+				break
+			}
+			current = params[0] % len(palette)
+			if len(params) >= 5 {
+				switch params[1] {
+				case 1:
+					palette[current] = hlsColor(params[2], params[3], params[4])
+				case 2:
+					palette[current] = percentColor(params[2], params[3], params[4])
+				}
+			}
+		case c == '!':
+			var params []int
+			params, i = sixelParams(data, i+1)
+			if i < len(data) && data[i] >= '?' && data[i] <= '~' {
+				count := 1
+				if len(params) > 0 {
+					count = common.Max(params[0], 1)
+				}
+				if err := draw(count, data[i]); err != nil {
+					return raster, extent, err
+				}
+				i++
+			}
+		case c == '$':
+			x = 0
+			i++
+		case c == '-':
+			x = 0
+			y += 6
+			i++
+		case c >= '?' && c <= '~':
+			if err := draw(1, c); err != nil {
+				return raster, extent, err
+			}
+			i++
+		default:
+			// Line breaks and other characters are ignored
+			i++
+		}
+	}
+	return raster, extent, nil
+}
+
+// Decodes a sixel DCS sequence. Pixels without color are transparent, the
+// terminal background is shown behind them.
+func decodeSixel(seq string) (*image.NRGBA, error) {
+	seq = trimStringTerminator(strings.TrimPrefix(seq, "\x1bP"))
+	begin := strings.IndexByte(seq, 'q')
+	if begin < 0 || strings.Trim(seq[:begin], "0123456789;") != "" {
+		return nil, errors.New("not a sixel sequence")
+	}
+	data := seq[begin+1:]
+	raster, extent, err := scanSixel(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Raster attributes crop the image
+	size := extent
+	if raster.X > 0 && raster.Y > 0 && raster.X <= TERM_IMAGE_MAX_SIZE && raster.Y <= TERM_IMAGE_MAX_SIZE {
+		size = raster
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, errors.New("sixel image is empty")
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	scanSixel(data, func(x, y, count int, bits byte, c color.NRGBA) {
+		for bit := 0; bit < 6; bit++ {
+			if bits&(1<<bit) == 0 || y+bit >= size.Y {
+				continue
+			}
+			for col := x; col < x+count && col < size.X; col++ {
+				img.SetNRGBA(col, y+bit, c)
+			}
+		}
+	})
+	return img, nil
+}
+
+// A command of the kitty graphics protocol, keys that are not listed here,
+// like the source rectangle and the placement ids, are ignored.
+type kittyCommand struct {
+	action      byte // t transmit, T transmit and display, p display, d delete, q query
+	format      int  // 24 RGB, 32 RGBA, 100 PNG
+	medium      byte // only d, the data is in the payload
+	compression byte // z for zlib
+	width       int  // pixels of the RGB and RGBA data
+	height      int
+	id          int  // i, zero if the program didn't give
+	more        bool // more chunks follow
+	cols, rows  int  // cells of the displayed image, zero means its pixels
+	quiet       int  // 1 hides OK answers, 2 hides the errors too
+	delete      byte // what to delete, a for all images
+	payload     string
+}
+
+// Parses "\x1b_G{key=value,...};{payload}\x1b\\" sequences
+func parseKittyCommand(seq string) (kittyCommand, error) {
+	cmd := kittyCommand{action: 't', format: 32, medium: 'd', delete: 'a'}
+	if !strings.HasPrefix(seq, "\x1b_G") {
+		return cmd, errors.New("not a kitty graphics sequence")
+	}
+	seq = trimStringTerminator(seq[3:])
+	control := seq
+	if i := strings.IndexByte(seq, ';'); i >= 0 {
+		control, cmd.payload = seq[:i], seq[i+1:]
+	}
+	for _, pair := range strings.Split(control, ",") {
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || len(key) != 1 || value == "" {
+			return cmd, fmt.Errorf("invalid key %q", pair)
+		}
+		var number *int
+		switch key[0] {
+		case 'a':
+			cmd.action = value[0]
+		case 't':
+			cmd.medium = value[0]
+		case 'o':
+			cmd.compression = value[0]
+		case 'd':
+			cmd.delete = value[0]
+		case 'f':
+			number = &cmd.format
+		case 's':
+			number = &cmd.width
+		case 'v':
+			number = &cmd.height
+		case 'i':
+			number = &cmd.id
+		case 'c':
+			number = &cmd.cols
+		case 'r':
+			number = &cmd.rows
+		case 'q':
+			number = &cmd.quiet
+		case 'm':
+			cmd.more = value == "1"
+		}
+		if number != nil {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return cmd, fmt.Errorf("invalid value of %q", pair)
+			}
+			*number = n
+		}
+	}
+	return cmd, nil
+}
+
+// Decodes the image of a transmit command, payload is the joined payload of
+// all chunks. Files and shared memory are not supported, they could be used
+// for reading any file.
+func decodeKittyImage(cmd kittyCommand, payload string) (*image.NRGBA, error) {
+	if cmd.medium != 'd' {
+		return nil, fmt.Errorf("transmission medium %q is not supported", cmd.medium)
+	}
+	if len(payload) > base64.StdEncoding.EncodedLen(TERM_IMAGE_MAX_PIXELS*4) {
+		return nil, fmt.Errorf("image data is larger than %d pixels", TERM_IMAGE_MAX_PIXELS)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		if err != nil {
+			return nil, fmt.Errorf("image data is not valid base64: %w", err)
+		}
+	}
+	switch cmd.compression {
+	case 0:
+	case 'z':
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = io.ReadAll(io.LimitReader(reader, TERM_IMAGE_MAX_PIXELS*4+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > TERM_IMAGE_MAX_PIXELS*4 {
+			return nil, fmt.Errorf("image data is larger than %d pixels", TERM_IMAGE_MAX_PIXELS)
+		}
+	default:
+		return nil, fmt.Errorf("compression %q is not supported", cmd.compression)
+	}
+	switch cmd.format {
+	case 100:
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if config.Width > TERM_IMAGE_MAX_SIZE || config.Height > TERM_IMAGE_MAX_SIZE {
+			return nil, fmt.Errorf("image is larger than %dx%d", TERM_IMAGE_MAX_SIZE, TERM_IMAGE_MAX_SIZE)
+		}
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		bounds := decoded.Bounds()
+		img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(img, img.Bounds(), decoded, bounds.Min, draw.Src)
+		return img, nil
+	case 24, 32:
+		if cmd.width <= 0 || cmd.height <= 0 || cmd.width > TERM_IMAGE_MAX_SIZE || cmd.height > TERM_IMAGE_MAX_SIZE {
+			return nil, fmt.Errorf("invalid image size %dx%d", cmd.width, cmd.height)
+		}
+		bpp := cmd.format / 8
+		if len(data) != cmd.width*cmd.height*bpp {
+			return nil, fmt.Errorf("image data is %d bytes, expected %d", len(data), cmd.width*cmd.height*bpp)
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, cmd.width, cmd.height))
+		if bpp == 4 {
+			copy(img.Pix, data)
+		} else {
+			for i, j := 0, 0; i < len(data); i, j = i+3, j+4 {
+				copy(img.Pix[j:j+3], data[i:i+3])
+				img.Pix[j+3] = 255
+			}
+		}
+		return img, nil
+	default:
+		return nil, fmt.Errorf("image format %d is not supported", cmd.format)
+	}
+}
+
+// Answer of the kitty graphics protocol, programs ask with a=q whether the
+// terminal supports images. Commands without an id are not answered.
+func kittyResponse(cmd kittyCommand, err error) string {
+	if cmd.id == 0 || (err == nil && cmd.quiet >= 1) || cmd.quiet >= 2 {
+		return ""
+	}
+	message := "OK"
+	if err != nil {
+		message = "EINVAL:" + err.Error()
+	}
+	return fmt.Sprintf("\x1b_Gi=%d;%s\x1b\\", cmd.id, message)
+}
+
+type termImageKey struct {
+	buf nvim.Buffer
+	id  int // extmark of the image
+}
+
+type kittyImageKey struct {
+	buf nvim.Buffer
+	id  int // given by the program
+}
+
+type termImage struct {
+	pixels     *image.NRGBA // uploaded to the texture when drawn first
+	texture    render.Texture
+	texRect    common.Rectangle[float32] // area of the image in the texture
+	buffer     render.VertexBuffer
+	size       common.Vector2[int]
+	cols, rows int // zero means the size of the image
+	kittyID    int
+	count      int // placements drawn
+}
+
+// An image in a window, rows and columns are relative to the window
+type termImagePlacement struct {
+	key           termImageKey
+	win           nvim.Window
+	sRow, sCol    int // screen position of the window
+	height, width int
+	row, col      int
+}
+
+// A sequence sent by neoray.lua, seq is empty when the buffer is wiped out
+type termImageRequest struct {
+	key termImageKey
+	seq string
+}
+
+// A kitty image sent in chunks, only the first chunk has the keys
+type kittyTransfer struct {
+	key     termImageKey
+	cmd     kittyCommand
+	payload strings.Builder
+}
+
+// TerminalImages draws the images of the terminal buffers over their cells.
+// Sequences are decoded in the background in the order they are received,
+// positions of the images are fetched from neovim after every flush like the
+// diff gutter. Programs don't know the size of the image in cells, so the
+// text written after it is drawn below the image.
+type TerminalImages struct {
+	window     *window.Window
+	requests   chan termImageRequest
+	images     map[termImageKey]*termImage
+	order      []termImageKey // oldest first
+	placements []termImagePlacement
+	fetching   bool
+	dirty      bool
+	lastFetch  time.Time
+	// Used by the decoder goroutine only
+	transfers map[nvim.Buffer]*kittyTransfer
+	stored    map[kittyImageKey]*image.NRGBA // transmitted with an id, displayed with a=p
+	storedIDs []kittyImageKey
+}
+
+func NewTerminalImages(window *window.Window) *TerminalImages {
+	images := &TerminalImages{
+		window:    window,
+		requests:  make(chan termImageRequest, 64),
+		images:    make(map[termImageKey]*termImage),
+		transfers: make(map[nvim.Buffer]*kittyTransfer),
+		stored:    make(map[kittyImageKey]*image.NRGBA),
+	}
+	go images.decodeLoop()
+	return images
+}
+
+func (images *TerminalImages) IsEnabled() bool {
+	return Editor.options.terminalImages
+}
+
+// Call this when neovim sends an image sequence of a terminal buffer
+func (images *TerminalImages) Receive(buf nvim.Buffer, id int, seq string) {
+	images.requests <- termImageRequest{key: termImageKey{buf: buf, id: id}, seq: seq}
+}
+
+// Call this when a terminal buffer with images is wiped out
+func (images *TerminalImages) Wipe(buf nvim.Buffer) {
+	images.requests <- termImageRequest{key: termImageKey{buf: buf}}
+}
+
+func (images *TerminalImages) decodeLoop() {
+	for request := range images.requests {
+		if request.seq == "" {
+			buf := request.key.buf
+			images.wipeStored(buf)
+			Editor.dispatch.Dispatch(func() {
+				images.deleteWhere(func(key termImageKey, image *termImage) bool {
+					return key.buf == buf
+				})
+			})
+		} else if strings.HasPrefix(request.seq, "\x1bP") {
+			img, err := decodeSixel(request.seq)
+			images.finish(request.key, img, 0, 0, 0, err)
+		} else {
+			images.handleKitty(request.key, request.seq)
+		}
+	}
+}
+
+func (images *TerminalImages) handleKitty(key termImageKey, seq string) {
+	cmd, err := parseKittyCommand(seq)
+	if transfer := images.transfers[key.buf]; transfer != nil {
+		// Following chunks only have the m key
+		if len(transfer.payload.String())+len(cmd.payload) > base64.StdEncoding.EncodedLen(TERM_IMAGE_MAX_PIXELS*4) {
+			delete(images.transfers, key.buf)
+			images.finish(transfer.key, nil, 0, 0, 0, fmt.Errorf("image data is larger than %d pixels", TERM_IMAGE_MAX_PIXELS))
+			return
+		}
+		transfer.payload.WriteString(cmd.payload)
+		if err == nil && cmd.more {
+			return
+		}
+		delete(images.transfers, key.buf)
+		key, cmd = transfer.key, transfer.cmd
+		cmd.payload = transfer.payload.String()
+	} else if err == nil && cmd.more && (cmd.action == 't' || cmd.action == 'T' || cmd.action == 'q') {
+		transfer := &kittyTransfer{key: key, cmd: cmd}
+		transfer.payload.WriteString(cmd.payload)
+		images.transfers[key.buf] = transfer
+		return
+	}
+	if err != nil {
+		images.finish(key, nil, 0, 0, 0, err)
+		return
+	}
+	switch cmd.action {
+	case 't', 'T':
+		img, err := decodeKittyImage(cmd, cmd.payload)
+		if err == nil && cmd.id != 0 {
+			images.store(kittyImageKey{buf: key.buf, id: cmd.id}, img)
+		}
+		images.respond(key.buf, kittyResponse(cmd, err))
+		if cmd.action == 't' {
+			img = nil
+		}
+		images.finish(key, img, cmd.cols, cmd.rows, cmd.id, err)
+	case 'p':
+		img := images.stored[kittyImageKey{buf: key.buf, id: cmd.id}]
+		if img == nil {
+			err = fmt.Errorf("image %d is not found", cmd.id)
+		}
+		images.respond(key.buf, kittyResponse(cmd, err))
+		images.finish(key, img, cmd.cols, cmd.rows, cmd.id, err)
+	case 'q':
+		_, err := decodeKittyImage(cmd, cmd.payload)
+		images.respond(key.buf, kittyResponse(cmd, err))
+		images.finish(key, nil, 0, 0, 0, nil)
+	case 'd':
+		// Lowercase keeps the transmitted data, we always keep it
+		all := cmd.delete == 'a' || cmd.delete == 'A'
+		byID := cmd.delete == 'i' || cmd.delete == 'I'
+		images.finish(key, nil, 0, 0, 0, nil)
+		if all || byID {
+			Editor.dispatch.Dispatch(func() {
+				images.deleteWhere(func(k termImageKey, image *termImage) bool {
+					return k.buf == key.buf && (all || image.kittyID == cmd.id)
+				})
+			})
+		}
+	default:
+		images.finish(key, nil, 0, 0, 0, fmt.Errorf("action %q is not supported", cmd.action))
+	}
+}
+
+func (images *TerminalImages) store(key kittyImageKey, img *image.NRGBA) {
+	if _, ok := images.stored[key]; !ok {
+		images.storedIDs = append(images.storedIDs, key)
+	}
+	images.stored[key] = img
+	if len(images.storedIDs) > TERM_IMAGES_MAX_COUNT {
+		delete(images.stored, images.storedIDs[0])
+		images.storedIDs = images.storedIDs[1:]
+	}
+}
+
+func (images *TerminalImages) wipeStored(buf nvim.Buffer) {
+	delete(images.transfers, buf)
+	ids := images.storedIDs[:0]
+	for _, key := range images.storedIDs {
+		if key.buf == buf {
+			delete(images.stored, key)
+		} else {
+			ids = append(ids, key)
+		}
+	}
+	images.storedIDs = ids
+}
+
+func (images *TerminalImages) respond(buf nvim.Buffer, response string) {
+	if response == "" {
+		return
+	}
+	err := Editor.nvim.handle.ExecLua("require('neoray').term_respond(...)", nil, buf, response)
+	if err != nil {
+		logger.Log(logger.DEBUG, "Failed to answer the terminal image query:", err)
+	}
+}
+
+// Shows the image at the extmark, the mark is deleted if the image is nil
+func (images *TerminalImages) finish(key termImageKey, img *image.NRGBA, cols, rows, kittyID int, err error) {
+	if err != nil {
+		logger.Log(logger.WARN, "Terminal image:", err)
+	}
+	if img == nil {
+		deleteTermImageMarks(key.buf, []int{key.id})
+		return
+	}
+	Editor.dispatch.Dispatch(func() {
+		if !images.IsEnabled() {
+			deleteTermImageMarks(key.buf, []int{key.id})
+			return
+		}
+		images.add(key, &termImage{
+			pixels:  img,
+			size:    common.Vec2(img.Rect.Dx(), img.Rect.Dy()),
+			cols:    cols,
+			rows:    rows,
+			kittyID: kittyID,
+		})
+	})
+}
+
+func deleteTermImageMarks(buf nvim.Buffer, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+	go func() {
+		err := Editor.nvim.handle.ExecLua("require('neoray').delete_term_images(...)", nil, buf, ids)
+		if err != nil {
+			logger.Log(logger.DEBUG, "Failed to delete terminal image marks:", err)
+		}
+	}()
+}
+
+func (images *TerminalImages) add(key termImageKey, image *termImage) {
+	if old := images.images[key]; old != nil {
+		old.destroy()
+	} else {
+		images.order = append(images.order, key)
+	}
+	images.images[key] = image
+	if len(images.order) > TERM_IMAGES_MAX_COUNT {
+		oldest := images.order[0]
+		images.deleteWhere(func(key termImageKey, image *termImage) bool {
+			return key == oldest
+		})
+	}
+	images.MarkDirty()
+}
+
+// Deletes the images and their extmarks
+func (images *TerminalImages) deleteWhere(match func(key termImageKey, image *termImage) bool) {
+	marks := map[nvim.Buffer][]int{}
+	order := images.order[:0]
+	for _, key := range images.order {
+		image := images.images[key]
+		if match(key, image) {
+			image.destroy()
+			delete(images.images, key)
+			marks[key.buf] = append(marks[key.buf], key.id)
+		} else {
+			order = append(order, key)
+		}
+	}
+	images.order = order
+	for buf, ids := range marks {
+		deleteTermImageMarks(buf, ids)
+	}
+	if len(marks) > 0 {
+		Editor.MarkDraw()
+	}
+}
+
+// Call this after every flush, placements will be fetched in the next update
+func (images *TerminalImages) MarkDirty() {
+	if len(images.images) > 0 {
+		images.dirty = true
+	}
+}
+
+func (images *TerminalImages) Update() {
+	if Editor.state < EditorWindowShown {
+		return
+	}
+	if images.dirty && !images.fetching && time.Since(images.lastFetch) >= TERM_IMAGES_FETCH_INTERVAL {
+		images.dirty = false
+		images.fetching = true
+		images.lastFetch = time.Now()
+		go images.fetch()
+	}
+}
+
+func (images *TerminalImages) fetch() {
+	var result [][]int
+	err := Editor.nvim.handle.ExecLua("return require('neoray').term_images()", &result)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to get terminal images:", err)
+	}
+	placements := make([]termImagePlacement, 0, len(result))
+	for _, p := range result {
+		if len(p) != 9 {
+			continue
+		}
+		placements = append(placements, termImagePlacement{
+			win:    nvim.Window(p[0]),
+			sRow:   p[1],
+			sCol:   p[2],
+			height: p[3],
+			width:  p[4],
+			row:    p[5],
+			col:    p[6],
+			key:    termImageKey{buf: nvim.Buffer(p[7]), id: p[8]},
+		})
+	}
+	Editor.dispatch.Dispatch(func() {
+		images.fetching = false
+		if err == nil {
+			images.placements = placements
+			Editor.MarkDraw()
+		}
+	})
+}
+
+// Returns the rectangle of the image and the rectangle of its window
+func (images *TerminalImages) placementRects(p termImagePlacement, image *termImage) (common.Rectangle[int], common.Rectangle[int], bool) {
+	row, col := p.row, p.col
+	grid := windowGrid(p.win)
+	if grid == nil {
+		grid = Editor.gridManager.Grid(1)
+		if grid == nil {
+			return common.Rectangle[int]{}, common.Rectangle[int]{}, false
+		}
+		row += p.sRow
+		col += p.sCol
+	}
+	bounds := grid.CellsRect(row-p.row, col-p.col, p.height, p.width)
+	rect := grid.CellsRect(row, col, 1, 1)
+	rect.W, rect.H = image.size.Width(), image.size.Height()
+	cellSize := grid.CellSize()
+	switch {
+	case image.cols > 0 && image.rows > 0:
+		rect.W, rect.H = image.cols*cellSize.Width(), image.rows*cellSize.Height()
+	case image.cols > 0:
+		rect.W = image.cols * cellSize.Width()
+		rect.H = rect.W * image.size.Height() / image.size.Width()
+	case image.rows > 0:
+		rect.H = image.rows * cellSize.Height()
+		rect.W = rect.H * image.size.Width() / image.size.Height()
+	}
+	return rect, bounds, true
+}
+
+// Images are clipped to their windows
+func (images *TerminalImages) Draw() {
+	if len(images.images) == 0 {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("TerminalImages.Draw")
+	for _, image := range images.images {
+		image.count = 0
+	}
+	for _, p := range images.placements {
+		image := images.images[p.key]
+		if image == nil {
+			continue
+		}
+		rect, bounds, ok := images.placementRects(p, image)
+		if !ok {
+			continue
+		}
+		clip := rect.Intersect(bounds)
+		if clip.W <= 0 || clip.H <= 0 {
+			continue
+		}
+		if image.texture == nil {
+			image.upload(images.window)
+		}
+		full, visible := rect.ToF32(), clip.ToF32()
+		tex := common.Rectangle[float32]{
+			X: image.texRect.X + image.texRect.W*(visible.X-full.X)/full.W,
+			Y: image.texRect.Y + image.texRect.H*(visible.Y-full.Y)/full.H,
+			W: image.texRect.W * visible.W / full.W,
+			H: image.texRect.H * visible.H / full.H,
+		}
+		image.count++
+		image.buffer.Resize(image.count)
+		image.buffer.SetIndexPos(image.count-1, visible)
+		image.buffer.SetIndexTex1(image.count-1, tex, 0)
+	}
+}
+
+func (images *TerminalImages) Render() {
+	if len(images.images) == 0 {
+		return
+	}
+	renderer := images.window.Renderer()
+	renderer.SetBlending(true)
+	for _, image := range images.images {
+		if image.count == 0 {
+			continue
+		}
+		image.texture.Bind()
+		image.buffer.Bind()
+		image.buffer.Update()
+		image.buffer.SetProjection(Editor.ProjectionRect())
+		image.buffer.Render()
+	}
+	renderer.SetBlending(false)
+}
+
+// The texture holds straight alpha, the shader blends the texture color with
+// the background by its alpha. The shader also samples the second texture of
+// the vertex, which is the first pixel, so the image is drawn after a
+// transparent row and column.
+func (img *termImage) upload(window *window.Window) {
+	img.texture = window.Renderer().CreateTexture(img.size.Width()+1, img.size.Height()+1)
+	img.texture.Clear()
+	img.buffer = window.Renderer().CreateVertexBuffer(1)
+	img.texture.Bind()
+	dest := common.Rectangle[int]{X: 1, Y: 1, W: img.size.Width(), H: img.size.Height()}
+	pixels := &image.RGBA{Pix: img.pixels.Pix, Stride: img.pixels.Stride, Rect: img.pixels.Rect}
+	img.texture.Draw(pixels, dest, 0)
+	img.texRect = img.texture.Normalize(dest)
+	img.pixels = nil
+}
+
+func (img *termImage) destroy() {
+	if img.texture != nil {
+		img.texture.Delete()
+		img.buffer.Destroy()
+	}
+}
+
+// Call this when the option changed, images are deleted when disabled
+func (images *TerminalImages) SetEnabled(enabled bool) {
+	Editor.options.terminalImages = enabled
+	if !enabled {
+		images.deleteWhere(func(key termImageKey, image *termImage) bool {
+			return true
+		})
+		images.placements = nil
+	}
+}
+
+func (images *TerminalImages) Destroy() {
+	for _, image := range images.images {
+		image.destroy()
+	}
+	logger.Log(logger.DEBUG, "Terminal images destroyed")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func Test_decodeSixel(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	// Color 1 is red in RGB percents, two columns of six pixels
+	img, err := decodeSixel("\x1bPq#1;2;100;0;0~~\x1b\\")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(2, 6) {
+		t.Fatalf("size = %v, want 2x6", size)
+	}
+	if got := img.NRGBAAt(1, 5); got != red {
+		t.Errorf("pixel = %v, want %v", got, red)
+	}
+	// Repeat, carriage return and new line, raster crops the last band
+	img, err = decodeSixel("\x1bP0;1;0q\"1;1;3;8#1;2;100;0;0!3@$#2;2;0;0;100A-!3~\x1b\\")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(3, 8) {
+		t.Fatalf("size = %v, want 3x8", size)
+	}
+	if got := img.NRGBAAt(2, 0); got != red {
+		t.Errorf("first pixel = %v, want %v", got, red)
+	}
+	if got := img.NRGBAAt(0, 1); got.B != 255 {
+		t.Errorf("second pixel = %v, want blue", got)
+	}
+	if got := img.NRGBAAt(0, 2); got.A != 0 {
+		t.Errorf("empty pixel = %v, want transparent", got)
+	}
+	if got := img.NRGBAAt(0, 7); got.A != 255 {
+		t.Errorf("pixel of the second band = %v, want opaque", got)
+	}
+	// Hue of HLS starts from blue
+	img, err = decodeSixel("\x1bPq#1;1;120;50;100~\x1b\\")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.NRGBAAt(0, 0); got != red {
+		t.Errorf("HLS 120 = %v, want %v", got, red)
+	}
+	for _, seq := range []string{
+		"\x1bPq\x1b\\",
+		"\x1bP1$r\x1b\\",
+		"\x1bPq!99999~\x1b\\",
+	} {
+		if _, err := decodeSixel(seq); err == nil {
+			t.Errorf("decodeSixel(%q) didn't fail", seq)
+		}
+	}
+}
+
+func Test_parseKittyCommand(t *testing.T) {
+	cmd, err := parseKittyCommand("\x1b_Ga=T,f=24,s=2,v=1,i=7,m=1,c=10;AAAA\x1b\\")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := kittyCommand{action: 'T', format: 24, medium: 'd', width: 2, height: 1, id: 7, more: true, cols: 10, delete: 'a', payload: "AAAA"}
+	if cmd != want {
+		t.Errorf("parseKittyCommand = %+v, want %+v", cmd, want)
+	}
+	for _, seq := range []string{"\x1b]8;;a\x07", "\x1b_Ga=T,s=x;\x1b\\", "\x1b_Gab;\x1b\\"} {
+		if _, err := parseKittyCommand(seq); err == nil {
+			t.Errorf("parseKittyCommand(%q) didn't fail", seq)
+		}
+	}
+}
+
+func Test_decodeKittyImage(t *testing.T) {
+	rgb := []byte{255, 0, 0, 0, 0, 255}
+	img, err := decodeKittyImage(kittyCommand{medium: 'd', format: 24, width: 2, height: 1}, base64.StdEncoding.EncodeToString(rgb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.NRGBAAt(1, 0); got != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("RGB pixel = %v", got)
+	}
+	// Compressed PNG
+	var encoded, compressed bytes.Buffer
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	src.SetNRGBA(2, 1, color.NRGBA{G: 255, A: 128})
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatal(err)
+	}
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(encoded.Bytes())
+	writer.Close()
+	img, err = decodeKittyImage(kittyCommand{medium: 'd', format: 100, compression: 'z'}, base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.NRGBAAt(2, 1); got != (color.NRGBA{G: 255, A: 128}) {
+		t.Errorf("PNG pixel = %v", got)
+	}
+	tests := []struct {
+		name    string
+		cmd     kittyCommand
+		payload string
+	}{
+		{name: "File", cmd: kittyCommand{medium: 'f', format: 100}, payload: base64.StdEncoding.EncodeToString([]byte("/etc/passwd"))},
+		{name: "Wrong size", cmd: kittyCommand{medium: 'd', format: 32, width: 2, height: 1}, payload: base64.StdEncoding.EncodeToString(rgb)},
+		{name: "Too large", cmd: kittyCommand{medium: 'd', format: 24, width: TERM_IMAGE_MAX_SIZE + 1, height: 1}, payload: ""},
+		{name: "Invalid base64", cmd: kittyCommand{medium: 'd', format: 24, width: 2, height: 1}, payload: "!!!"},
+		{name: "Large payload", cmd: kittyCommand{medium: 'd', format: 100}, payload: strings.Repeat("A", base64.StdEncoding.EncodedLen(TERM_IMAGE_MAX_PIXELS*4)+4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeKittyImage(tt.cmd, tt.payload); err == nil {
+				t.Error("decodeKittyImage didn't fail")
+			}
+		})
+	}
+}
+
+func Test_kittyResponse(t *testing.T) {
+	if got := kittyResponse(kittyCommand{id: 31}, nil); got != "\x1b_Gi=31;OK\x1b\\" {
+		t.Errorf("OK response = %q", got)
+	}
+	if got := kittyResponse(kittyCommand{id: 31, quiet: 1}, nil); got != "" {
+		t.Errorf("quiet response = %q", got)
+	}
+	if got := kittyResponse(kittyCommand{}, nil); got != "" {
+		t.Errorf("response without id = %q", got)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_parseOSC52(t *testing.T) {
+	tests := []struct {
+		name    string
+		seq     string
+		want    string
+		wantErr bool
+	}{
+		{name: "Bell", seq: "\x1b]52;c;aGVsbG8=\x07", want: "hello"},
+		{name: "String terminator", seq: "\x1b]52;;aGVsbG8=\x1b\\", want: "hello"},
+		{name: "Without terminator", seq: "\x1b]52;c;aGVsbG8=", want: "hello"},
+		{name: "Without padding", seq: "\x1b]52;p;aGVsbG8", want: "hello"},
+		{name: "Query", seq: "\x1b]52;c;?\x07", wantErr: true},
+		{name: "Invalid", seq: "\x1b]52;c;!!!\x07", wantErr: true},
+		{name: "Other sequence", seq: "\x1b]8;;https://neovim.io\x07", wantErr: true},
+		{name: "Too large", seq: "\x1b]52;c;" + strings.Repeat("QUFB", OSC52_MAX_SIZE/3+2), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOSC52(tt.seq)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOSC52() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseOSC52() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenURLScheme(t *testing.T) {
+	for _, link := range []string{"javascript:alert(1)", "vscode://file/a", "no scheme", "", "file://example.invalid/etc", "file:///neoray-missing-file"} {
+		if err := OpenURL(link); err == nil {
+			t.Errorf("OpenURL(%q) opened the link", link)
+		}
+	}
+}
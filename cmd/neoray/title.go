@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Neovim is busy if it doesn't flush for this long after an input
+	BUSY_INDICATOR_DELAY = time.Second
+	// Seconds of a spinner frame
+	BUSY_SPINNER_STEP = 0.1
+)
+
+var busySpinner = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// Information about the current buffer sent by neoray.vim when g:neoray_title
+// is set
+type TitleInfo struct {
+	Template string `msgpack:"template"`
+	File     string `msgpack:"file"` // full path
+	Modified bool   `msgpack:"modified"`
+	Cwd      string `msgpack:"cwd"`
+}
+
+// Title of the window. The title set by neovim is used unless the user sets a
+// template with g:neoray_title. A spinner is shown in front of the title while
+// neovim is busy, so the user knows Neoray is not frozen.
+type Title struct {
+	nvimTitle string
+	info      TitleInfo
+	busy      bool
+	spinTime  float32
+	frame     int
+}
+
+func (title *Title) Update(delta float32) {
+	busy := Editor.nvim.BusyTime() > BUSY_INDICATOR_DELAY
+	if !busy {
+		if title.busy {
+			title.busy = false
+			title.apply()
+		}
+		return
+	}
+	if !title.busy {
+		title.busy = true
+		title.spinTime = 0
+		title.frame = 0
+		title.apply()
+		return
+	}
+	title.spinTime += delta
+	frame := int(title.spinTime/BUSY_SPINNER_STEP) % len(busySpinner)
+	if frame != title.frame {
+		title.frame = frame
+		title.apply()
+	}
+}
+
+// Call this when neovim sends set_title
+func (title *Title) SetNvimTitle(nvimTitle string) {
+	title.nvimTitle = nvimTitle
+	title.apply()
+}
+
+// Call this when neoray.vim sends the template or buffer changes
+func (title *Title) SetInfo(info TitleInfo) {
+	title.info = info
+	title.apply()
+}
+
+func (title *Title) apply() {
+	text := title.nvimTitle
+	if title.info.Template != "" {
+		text = ExpandTitle(title.info)
+	}
+	if title.busy {
+		text = string(busySpinner[title.frame]) + " " + text
+	}
+	Editor.window.SetTitle(text)
+}
+
+// Expands the title template. %f is the file name, %F is the full path, %m is
+// + when the buffer is modified, %{cwd} is the working directory and %% is %.
+func ExpandTitle(info TitleInfo) string {
+	name := filepath.Base(info.File)
+	if info.File == "" {
+		name = "[No Name]"
+	}
+	modified := ""
+	if info.Modified {
+		modified = "+"
+	}
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%f", name,
+		"%F", info.File,
+		"%m", modified,
+		"%{cwd}", info.Cwd,
+	)
+	return replacer.Replace(info.Template)
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestExpandTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		info TitleInfo
+		want string
+	}{
+		{
+			name: "File and cwd",
+			info: TitleInfo{Template: "%f — %{cwd} — Neoray", File: "/home/user/main.go", Cwd: "~/project"},
+			want: "main.go — ~/project — Neoray",
+		},
+		{
+			name: "Modified and full path",
+			info: TitleInfo{Template: "%F%m", File: "/home/user/main.go", Modified: true},
+			want: "/home/user/main.go+",
+		},
+		{
+			name: "No name",
+			info: TitleInfo{Template: "%f%m"},
+			want: "[No Name]",
+		},
+		{
+			name: "Escaped percent",
+			info: TitleInfo{Template: "100%% %%f", File: "/a.txt"},
+			want: "100% %f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandTitle(tt.info); got != tt.want {
+				t.Errorf("ExpandTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
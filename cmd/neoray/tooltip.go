@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+const (
+	TOOLTIP_DELAY    = 0.5 // Seconds the mouse must rest before showing
+	TOOLTIP_MAX_COLS = 80  // Maximum width of the tooltip in cells
+)
+
+// Returns the tooltip of the element under the position, empty if it has none
+func TooltipAt(pos common.Vector2[int]) string {
+	if text := Editor.tabline.TooltipAt(pos); text != "" {
+		return text
+	}
+	if text := Editor.terminalLinks.TooltipAt(pos); text != "" {
+		return text
+	}
+	return Editor.minimap.TooltipAt(pos)
+}
+
+// Tooltip shows the tooltip of the element under the mouse after the mouse
+// rests a while. It follows the mouse and changes immediately once shown, so
+// the minimap can show the lines while dragging.
+type Tooltip struct {
+	text     string
+	pos      common.Vector2[int] // Mouse position
+	time     float32             // Seconds the mouse rested
+	visible  bool
+	cols     int
+	renderer *GridRenderer
+}
+
+func NewTooltip() *Tooltip {
+	tooltip := new(Tooltip)
+	tooltip.cols = 1
+	var err error
+	tooltip.renderer, err = NewGridRenderer(Editor, 1, tooltip.cols, nil, DEFAULT_FONT_SIZE, tooltip.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create tooltip renderer")
+	}
+	return tooltip
+}
+
+func (tooltip *Tooltip) SetFontKit(kit *fontkit.FontKit) {
+	tooltip.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (tooltip *Tooltip) SetFontSize(size float64) {
+	tooltip.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (tooltip *Tooltip) Update(delta float32) {
+	pos := inputCache.mousePos
+	text := ""
+	if Editor.focused {
+		text = TooltipAt(pos)
+	}
+	if text == "" {
+		if tooltip.visible {
+			Editor.MarkRender()
+		}
+		tooltip.text = ""
+		tooltip.visible = false
+		return
+	}
+	if tooltip.visible {
+		if text != tooltip.text || pos != tooltip.pos {
+			tooltip.text = text
+			tooltip.pos = pos
+			Editor.MarkDraw()
+		}
+		return
+	}
+	if text != tooltip.text || pos != tooltip.pos {
+		tooltip.text = text
+		tooltip.pos = pos
+		tooltip.time = 0
+		return
+	}
+	tooltip.time += delta
+	if tooltip.time >= TOOLTIP_DELAY {
+		tooltip.visible = true
+		Editor.MarkDraw()
+	}
+}
+
+// Returns the text with one cell padding, the beginning is cut if it doesn't
+// fit because the end of the paths is more important
+func (tooltip *Tooltip) runes() []rune {
+	text := []rune(" " + tooltip.text + " ")
+	if len(text) > TOOLTIP_MAX_COLS {
+		text = append([]rune(" …"), text[len(text)-TOOLTIP_MAX_COLS+2:]...)
+	}
+	return text
+}
+
+func (tooltip *Tooltip) Draw() {
+	if !tooltip.visible {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	text := tooltip.runes()
+	if len(text) != tooltip.cols {
+		tooltip.cols = len(text)
+		tooltip.renderer.Resize(1, tooltip.cols)
+	}
+	// Below the mouse, above if there is no space
+	cellSize := tooltip.renderer.CellSize()
+	screenSize := Editor.ScreenSize()
+	top := -Editor.tabline.Height()
+	y := tooltip.pos.Y + cellSize.Height()
+	if y+cellSize.Height() > screenSize.Height() {
+		y = tooltip.pos.Y - cellSize.Height()
+	}
+	tooltip.renderer.SetPos(common.Vector2[int]{
+		X: common.Max(common.Min(tooltip.pos.X, screenSize.Width()-tooltip.cols*cellSize.Width()), 0),
+		Y: common.Max(y, top),
+	})
+	tooltip.renderer.DrawText(0, 0, text, WidgetAttribute("Pmenu"))
+	EndBenchmark("Tooltip.Draw")
+}
+
+func (tooltip *Tooltip) Render() {
+	if !tooltip.visible {
+		return
+	}
+	tooltip.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+func (tooltip *Tooltip) Destroy() {
+	tooltip.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Tooltip destroyed")
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hismailbulut/Neoray/pkg/bench"
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"golang.org/x/text/unicode/runenames"
+)
+
+const (
+	UNICODE_INPUT_MAX_ITEMS = 10 // Maximum number of visible results
+	UNICODE_INPUT_COLS      = 60
+	UNICODE_INPUT_MIN_QUERY = 2 // Names aren't searched for shorter queries
+)
+
+type UnicodeName struct {
+	char    rune
+	name    string
+	digraph string // only set for digraphs
+}
+
+// Names of all printable characters, created when the input is first shown
+var unicodeNames []UnicodeName
+
+func loadUnicodeNames() {
+	if unicodeNames != nil {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	defer EndBenchmark("loadUnicodeNames")
+	unicodeNames = make([]UnicodeName, 0, 1<<15)
+	for char := rune(0); char <= unicode.MaxRune; char++ {
+		if !unicode.IsPrint(char) || unicode.IsSpace(char) {
+			continue
+		}
+		name := runenames.Name(char)
+		if name == "" || name[0] == '<' {
+			continue
+		}
+		unicodeNames = append(unicodeNames, UnicodeName{char: char, name: name})
+	}
+}
+
+// Parses the query as a hexadecimal codepoint, U+ prefix is optional.
+func parseCodepoint(query string) (rune, bool) {
+	query = strings.TrimSpace(query)
+	if len(query) > 2 && (query[:2] == "U+" || query[:2] == "u+") {
+		query = query[2:]
+	}
+	if query == "" || len(query) > 6 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(query, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	char := rune(value)
+	if char > unicode.MaxRune || !utf8.ValidRune(char) || char < ' ' {
+		return 0, false
+	}
+	return char, true
+}
+
+// Every word of the query must be in the name
+func matchUnicodeName(words []string, name string) bool {
+	for _, word := range words {
+		if !strings.Contains(name, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the digraphs starting with the query, the exact one is the first.
+// Digraphs are also searched by the names of their characters.
+func filterDigraphs(digraphs []UnicodeName, query string, max int) []UnicodeName {
+	matches := []UnicodeName{}
+	added := make(map[int]bool)
+	add := func(match func(item UnicodeName) bool) {
+		for i, item := range digraphs {
+			if len(matches) >= max {
+				return
+			}
+			if !added[i] && match(item) {
+				added[i] = true
+				matches = append(matches, item)
+			}
+		}
+	}
+	add(func(item UnicodeName) bool { return item.digraph == query })
+	add(func(item UnicodeName) bool { return strings.HasPrefix(item.digraph, query) })
+	words := strings.Fields(strings.ToUpper(query))
+	if utf8.RuneCountInString(query) >= UNICODE_INPUT_MIN_QUERY && len(words) > 0 {
+		add(func(item UnicodeName) bool { return matchUnicodeName(words, item.name) })
+	}
+	return matches
+}
+
+// UnicodeInput is an overlay for inserting any character by its hexadecimal
+// codepoint or by searching its name, like "grinning face". Useful on the
+// platforms without an emoji picker. Input is captured while it is visible.
+// It also lists the digraphs of neovim when the digraph helper is enabled.
+type UnicodeInput struct {
+	pos         common.Vector2[int]
+	hidden      bool
+	rows, cols  int
+	query       []rune
+	matches     []UnicodeName
+	digraphs    []UnicodeName // not nil while showing digraphs
+	selected    int
+	renderer    *GridRenderer
+	requestChan chan bool
+}
+
+func NewUnicodeInput() *UnicodeInput {
+	unicodeInput := new(UnicodeInput)
+	unicodeInput.hidden = true
+	unicodeInput.rows = UNICODE_INPUT_MAX_ITEMS + 1
+	unicodeInput.cols = UNICODE_INPUT_COLS
+	unicodeInput.requestChan = make(chan bool, 1)
+	var err error
+	unicodeInput.renderer, err = NewGridRenderer(Editor, unicodeInput.rows, unicodeInput.cols, nil, DEFAULT_FONT_SIZE, unicodeInput.pos)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to create unicode input renderer")
+	}
+	return unicodeInput
+}
+
+func (unicodeInput *UnicodeInput) SetFontKit(kit *fontkit.FontKit) {
+	unicodeInput.renderer.SetFontKit(kit)
+	Editor.MarkForceDraw()
+}
+
+func (unicodeInput *UnicodeInput) SetFontSize(size float64) {
+	unicodeInput.renderer.SetFontSize(size, Editor.ScaledDPI())
+	Editor.MarkForceDraw()
+}
+
+func (unicodeInput *UnicodeInput) IsVisible() bool {
+	return !unicodeInput.hidden
+}
+
+// Can be called from any goroutine
+func (unicodeInput *UnicodeInput) Request() {
+	select {
+	case unicodeInput.requestChan <- true:
+	default:
+	}
+}
+
+func (unicodeInput *UnicodeInput) Update() {
+	if len(unicodeInput.requestChan) > 0 {
+		<-unicodeInput.requestChan
+		unicodeInput.Show()
+	}
+}
+
+func (unicodeInput *UnicodeInput) filter() {
+	query := string(unicodeInput.query)
+	unicodeInput.selected = 0
+	if unicodeInput.digraphs != nil {
+		unicodeInput.matches = filterDigraphs(unicodeInput.digraphs, query, UNICODE_INPUT_MAX_ITEMS)
+		Editor.MarkDraw()
+		return
+	}
+	unicodeInput.matches = unicodeInput.matches[:0]
+	if char, ok := parseCodepoint(query); ok {
+		unicodeInput.matches = append(unicodeInput.matches, UnicodeName{char: char, name: runenames.Name(char)})
+	}
+	words := strings.Fields(strings.ToUpper(query))
+	if utf8.RuneCountInString(query) >= UNICODE_INPUT_MIN_QUERY && len(words) > 0 {
+		for _, item := range unicodeNames {
+			if len(unicodeInput.matches) >= UNICODE_INPUT_MAX_ITEMS {
+				break
+			}
+			if matchUnicodeName(words, item.name) {
+				unicodeInput.matches = append(unicodeInput.matches, item)
+			}
+		}
+	}
+	Editor.MarkDraw()
+}
+
+func (unicodeInput *UnicodeInput) Show() {
+	loadUnicodeNames()
+	unicodeInput.digraphs = nil
+	unicodeInput.show()
+}
+
+// Shows the digraphs of neovim instead of all characters. Returns false if
+// neovim doesn't return any digraphs.
+func (unicodeInput *UnicodeInput) ShowDigraphs() bool {
+	list := Editor.nvim.Digraphs()
+	digraphs := make([]UnicodeName, 0, len(list))
+	for _, pair := range list {
+		if len(pair) != 2 || pair[1] == "" {
+			continue
+		}
+		char, _ := utf8.DecodeRuneInString(pair[1])
+		digraphs = append(digraphs, UnicodeName{char: char, name: runenames.Name(char), digraph: pair[0]})
+	}
+	if len(digraphs) == 0 {
+		return false
+	}
+	unicodeInput.digraphs = digraphs
+	unicodeInput.show()
+	return true
+}
+
+func (unicodeInput *UnicodeInput) show() {
+	unicodeInput.query = unicodeInput.query[:0]
+	unicodeInput.hidden = false
+	cellSize := unicodeInput.renderer.CellSize()
+	unicodeInput.pos = common.Vector2[int]{
+		X: common.Max((Editor.ScreenSize().Width()-unicodeInput.cols*cellSize.Width())/2, 0),
+		Y: Editor.ScreenSize().Height() / 8,
+	}
+	unicodeInput.renderer.SetPos(unicodeInput.pos)
+	unicodeInput.filter()
+}
+
+func (unicodeInput *UnicodeInput) Hide() {
+	if !unicodeInput.hidden {
+		unicodeInput.hidden = true
+		Editor.MarkRender()
+	}
+}
+
+func (unicodeInput *UnicodeInput) insert(index int) {
+	unicodeInput.Hide()
+	if index < 0 || index >= len(unicodeInput.matches) {
+		return
+	}
+	text := string(unicodeInput.matches[index].char)
+	if text == "<" {
+		text = "<lt>"
+	}
+	Editor.nvim.Input(text)
+}
+
+func (unicodeInput *UnicodeInput) moveSelection(v int) {
+	count := len(unicodeInput.matches)
+	if count == 0 {
+		return
+	}
+	unicodeInput.selected = (unicodeInput.selected + v + count) % count
+	Editor.MarkDraw()
+}
+
+// Call this function instead of sending keys to neovim when it is visible.
+func (unicodeInput *UnicodeInput) KeyInput(keycode string) {
+	switch keycode {
+	case "<ESC>", "<C-c>":
+		unicodeInput.Hide()
+	case "<CR>", "<kEnter>":
+		unicodeInput.insert(unicodeInput.selected)
+	case "<BS>":
+		if len(unicodeInput.query) > 0 {
+			unicodeInput.query = unicodeInput.query[:len(unicodeInput.query)-1]
+			unicodeInput.filter()
+		}
+	case "<C-u>":
+		unicodeInput.query = unicodeInput.query[:0]
+		unicodeInput.filter()
+	case "<Up>", "<C-p>", "<S-Tab>":
+		unicodeInput.moveSelection(-1)
+	case "<Down>", "<C-n>", "<Tab>":
+		unicodeInput.moveSelection(1)
+	case "<Space>":
+		unicodeInput.query = append(unicodeInput.query, ' ')
+		unicodeInput.filter()
+	default:
+		for char, special := range SpecialChars {
+			if keycode == "<"+special+">" {
+				unicodeInput.query = append(unicodeInput.query, char)
+				unicodeInput.filter()
+				return
+			}
+		}
+		if utf8.RuneCountInString(keycode) == 1 {
+			char, _ := utf8.DecodeRuneInString(keycode)
+			unicodeInput.query = append(unicodeInput.query, char)
+			unicodeInput.filter()
+		}
+	}
+}
+
+func (unicodeInput *UnicodeInput) Draw() {
+	if unicodeInput.hidden {
+		return
+	}
+	EndBenchmark := bench.Begin()
+	normal := WidgetAttribute("Pmenu")
+	selected := WidgetAttribute("PmenuSel")
+	selected.bold = true
+	// Prompt
+	query := unicodeInput.query
+	if len(query) > unicodeInput.cols-4 {
+		query = query[len(query)-unicodeInput.cols+4:]
+	}
+	prompt := append([]rune(" > "), query...)
+	prompt = append(prompt, '▏')
+	promptAttrib := normal
+	promptAttrib.bold = true
+	unicodeInput.renderer.DrawText(0, 0, prompt, promptAttrib)
+	// Matches, wide characters also cover the cell after them
+	for i := 0; i < UNICODE_INPUT_MAX_ITEMS; i++ {
+		var text []rune
+		attrib := normal
+		if i < len(unicodeInput.matches) {
+			match := unicodeInput.matches[i]
+			text = []rune(fmt.Sprintf("  %c  ", match.char))
+			if unicodeInput.digraphs != nil {
+				text = append(text, []rune(fmt.Sprintf("%-2s  ", match.digraph))...)
+			}
+			text = append(text, []rune(fmt.Sprintf("U+%04X %s", match.char, strings.ToLower(match.name)))...)
+			if i == unicodeInput.selected {
+				attrib = selected
+			}
+		}
+		unicodeInput.renderer.DrawText(i+1, 0, text, attrib)
+	}
+	EndBenchmark("UnicodeInput.Draw")
+}
+
+func (unicodeInput *UnicodeInput) Render() {
+	if unicodeInput.hidden {
+		return
+	}
+	unicodeInput.renderer.Render(1, 1, common.Vector2[float32]{})
+}
+
+// Returns true if the position is on the overlay and the index of the match
+// under the position, -1 if there is no match.
+func (unicodeInput *UnicodeInput) IsIntersecting(pos common.Vector2[int]) (bool, int) {
+	row, _, ok := unicodeInput.renderer.CellAt(pos)
+	if !ok {
+		return false, -1
+	}
+	index := row - 1
+	if index < 0 || index >= len(unicodeInput.matches) {
+		return true, -1
+	}
+	return true, index
+}
+
+// Call this function when mouse moved.
+func (unicodeInput *UnicodeInput) MouseMove(pos common.Vector2[int]) {
+	if unicodeInput.hidden {
+		return
+	}
+	_, index := unicodeInput.IsIntersecting(pos)
+	if index != -1 && index != unicodeInput.selected {
+		unicodeInput.selected = index
+		Editor.MarkDraw()
+	}
+}
+
+// Call this function when mouse clicked. Returns true if the click is
+// handled and shouldn't be sent to neovim.
+func (unicodeInput *UnicodeInput) MouseClick(pos common.Vector2[int]) bool {
+	if unicodeInput.hidden {
+		return false
+	}
+	ok, index := unicodeInput.IsIntersecting(pos)
+	if !ok {
+		unicodeInput.Hide()
+	} else if index != -1 {
+		unicodeInput.insert(index)
+	}
+	return true
+}
+
+func (unicodeInput *UnicodeInput) Destroy() {
+	unicodeInput.renderer.Destroy()
+	logger.Log(logger.DEBUG, "Unicode input destroyed")
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func Test_parseCodepoint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  rune
+		ok    bool
+	}{
+		{"1F600", '😀', true},
+		{"U+00E9", 'é', true},
+		{"u+3c", '<', true},
+		{" 41 ", 'A', true},
+		{"", 0, false},
+		{"U+", 0, false},
+		{"D800", 0, false},     // surrogate
+		{"110000", 0, false},   // out of range
+		{"1B", 0, false},       // control character
+		{"smile", 0, false},    // not hexadecimal
+		{"0001F600", 0, false}, // too long
+	}
+	for _, tt := range tests {
+		got, ok := parseCodepoint(tt.query)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseCodepoint(%q) = %q, %v, want %q, %v", tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func Test_matchUnicodeName(t *testing.T) {
+	words := []string{"GRIN", "FACE"}
+	if !matchUnicodeName(words, "GRINNING FACE") {
+		t.Error("GRINNING FACE must match")
+	}
+	if matchUnicodeName(words, "GRINNING CAT") {
+		t.Error("GRINNING CAT must not match")
+	}
+}
+
+func Test_filterDigraphs(t *testing.T) {
+	digraphs := []UnicodeName{
+		{char: 'é', name: "LATIN SMALL LETTER E WITH ACUTE", digraph: "e'"},
+		{char: 'ê', name: "LATIN SMALL LETTER E WITH CIRCUMFLEX", digraph: "e>"},
+		{char: 'ε', name: "GREEK SMALL LETTER EPSILON", digraph: "e*"},
+		{char: '€', name: "EURO SIGN", digraph: "Eu"},
+	}
+	matches := filterDigraphs(digraphs, "e*", 10)
+	if len(matches) != 1 || matches[0].char != 'ε' {
+		t.Errorf("Exact digraph must be the only match, got %v", matches)
+	}
+	matches = filterDigraphs(digraphs, "e", 10)
+	if len(matches) != 3 {
+		t.Errorf("Prefix must match 3 digraphs, got %v", matches)
+	}
+	matches = filterDigraphs(digraphs, "euro", 10)
+	if len(matches) != 1 || matches[0].digraph != "Eu" {
+		t.Errorf("Name search must find the euro sign, got %v", matches)
+	}
+	matches = filterDigraphs(digraphs, "", 2)
+	if len(matches) != 2 {
+		t.Errorf("Matches must be limited, got %v", matches)
+	}
+}
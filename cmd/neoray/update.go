@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/sqweek/dialog"
+)
+
+const (
+	UPDATE_RELEASES_URL   = "https://api.github.com/repos/hismailbulut/Neoray/releases/latest"
+	UPDATE_CHECKSUMS_NAME = "checksums.txt"
+)
+
+type GithubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Returns download url of the asset, empty string if not found
+func (release GithubRelease) assetURL(name string) string {
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return asset.URL
+		}
+	}
+	return ""
+}
+
+// Updater checks the latest release from github and replaces the executable
+// with the new one if the user wants. Checking is opt-in and done once.
+type Updater struct {
+	once        sync.Once
+	client      *http.Client
+	releaseChan chan GithubRelease
+	resultChan  chan error
+}
+
+func NewUpdater() *Updater {
+	updater := &Updater{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		releaseChan: make(chan GithubRelease, 1),
+		resultChan:  make(chan error, 1),
+	}
+	// Remove the executable left from the last update
+	exe, err := executablePath()
+	if err == nil {
+		os.Remove(exe + ".old")
+	}
+	return updater
+}
+
+// Name of the release asset for this platform, like neoray-linux-amd64
+func updateAssetName() string {
+	name := fmt.Sprintf("neoray-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Starts checking in the background, can be called multiple times.
+func (updater *Updater) Check() {
+	updater.once.Do(func() {
+		go func() {
+			release, err := updater.latestRelease()
+			if err != nil {
+				logger.Log(logger.WARN, "Update check failed:", err)
+				return
+			}
+			current := logger.Version{Major: VERSION_MAJOR, Minor: VERSION_MINOR, Patch: VERSION_PATCH}
+			latest, err := logger.ParseVersion(release.TagName)
+			if err != nil {
+				logger.Log(logger.WARN, "Update check failed:", err)
+				return
+			}
+			if current.Less(latest) {
+				logger.Log(logger.TRACE, "New version available:", latest)
+				updater.releaseChan <- release
+			} else {
+				logger.Log(logger.DEBUG, "Neoray is up to date")
+			}
+		}()
+	})
+}
+
+func (updater *Updater) download(url string) ([]byte, error) {
+	response, err := updater.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+func (updater *Updater) latestRelease() (GithubRelease, error) {
+	data, err := updater.download(UPDATE_RELEASES_URL)
+	if err != nil {
+		return GithubRelease{}, err
+	}
+	var release GithubRelease
+	err = json.Unmarshal(data, &release)
+	return release, err
+}
+
+// Finds the checksum of the file in sha256sum output
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksum of %s not found", name)
+}
+
+// Downloads the new executable, verifies it's checksum and swaps it with the
+// current one. The running executable is renamed because Windows doesn't let
+// us remove it.
+func (updater *Updater) selfUpdate(release GithubRelease) error {
+	name := updateAssetName()
+	assetURL := release.assetURL(name)
+	checksumsURL := release.assetURL(UPDATE_CHECKSUMS_NAME)
+	if assetURL == "" || checksumsURL == "" {
+		return fmt.Errorf("release %s has no %s or %s", release.TagName, name, UPDATE_CHECKSUMS_NAME)
+	}
+	checksums, err := updater.download(checksumsURL)
+	if err != nil {
+		return err
+	}
+	expected, err := findChecksum(checksums, name)
+	if err != nil {
+		return err
+	}
+	data, err := updater.download(assetURL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != expected {
+		return errors.New("checksum mismatch, downloaded file is corrupted")
+	}
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(exe+".new", data, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	os.Remove(exe + ".old")
+	err = os.Rename(exe, exe+".old")
+	if err != nil {
+		os.Remove(exe + ".new")
+		return err
+	}
+	err = os.Rename(exe+".new", exe)
+	if err != nil {
+		// Restore the old one
+		os.Rename(exe+".old", exe)
+		os.Remove(exe + ".new")
+		return err
+	}
+	return nil
+}
+
+// Asks the user when a new version found and reports the result of the update.
+// Dialogs must be shown in the main thread.
+func (updater *Updater) Update() {
+	select {
+	case release := <-updater.releaseChan:
+		msg := fmt.Sprintf("Neoray %s is available, you are using %s.\nDo you want to update now?",
+			release.TagName, logger.Version{Major: VERSION_MAJOR, Minor: VERSION_MINOR, Patch: VERSION_PATCH})
+		if dialog.Message(msg).Title("Update").YesNo() {
+			go func() {
+				updater.resultChan <- updater.selfUpdate(release)
+			}()
+		}
+		Editor.window.Raise()
+	case err := <-updater.resultChan:
+		if err != nil {
+			logger.Log(logger.ERROR, "Update failed:", err)
+			dialog.Message("Update failed: %s", err).Title("Update").Error()
+		} else {
+			logger.Log(logger.TRACE, "Neoray updated")
+			dialog.Message("Neoray is updated, the new version will be used after restart.").Title("Update").Info()
+		}
+		Editor.window.Raise()
+	default:
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+)
+
+// Widgets are the overlays Neoray draws over the grids, like the dialogs, the
+// tabline and the tooltips. Every widget draws its cells to its own grid
+// renderer and updates itself, the layer only orders them.
+type Widget interface {
+	SetFontKit(kit *fontkit.FontKit)
+	SetFontSize(size float64)
+	Draw()
+	Render()
+	Destroy()
+}
+
+// Widgets taking the mouse clicks implement this. Returning true captures the
+// click, it isn't sent to the widgets below and neovim.
+type WidgetClickHandler interface {
+	MouseClick(pos common.Vector2[int]) bool
+}
+
+// Widgets following the mouse implement this, every widget gets the moves.
+type WidgetMoveHandler interface {
+	MouseMove(pos common.Vector2[int])
+}
+
+// WidgetLayer holds the widgets in z-order. They are drawn and rendered from
+// the bottom to the top and the top one gets the mouse first.
+type WidgetLayer struct {
+	widgets []Widget
+}
+
+// Widgets must be added from the bottom to the top
+func (layer *WidgetLayer) Add(widgets ...Widget) {
+	layer.widgets = append(layer.widgets, widgets...)
+}
+
+func (layer *WidgetLayer) SetFontKit(kit *fontkit.FontKit) {
+	for _, widget := range layer.widgets {
+		widget.SetFontKit(kit)
+	}
+}
+
+func (layer *WidgetLayer) SetFontSize(size float64) {
+	for _, widget := range layer.widgets {
+		widget.SetFontSize(size)
+	}
+}
+
+func (layer *WidgetLayer) Draw() {
+	for _, widget := range layer.widgets {
+		widget.Draw()
+	}
+}
+
+func (layer *WidgetLayer) Render() {
+	for _, widget := range layer.widgets {
+		widget.Render()
+	}
+}
+
+// Returns true if a widget captured the click
+func (layer *WidgetLayer) MouseClick(pos common.Vector2[int]) bool {
+	for i := len(layer.widgets) - 1; i >= 0; i-- {
+		if handler, ok := layer.widgets[i].(WidgetClickHandler); ok && handler.MouseClick(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+func (layer *WidgetLayer) MouseMove(pos common.Vector2[int]) {
+	for _, widget := range layer.widgets {
+		if handler, ok := widget.(WidgetMoveHandler); ok {
+			handler.MouseMove(pos)
+		}
+	}
+}
+
+func (layer *WidgetLayer) Destroy() {
+	for _, widget := range layer.widgets {
+		widget.Destroy()
+	}
+	layer.widgets = nil
+	logger.Log(logger.DEBUG, "Widgets destroyed")
+}
+
+// Selected groups use the default colors in bold until neovim sends them, the
+// others use the default colors swapped.
+var widgetSelectedGroups = map[string]bool{
+	"PmenuSel":   true,
+	"TabLineSel": true,
+}
+
+// Returns the attribute of the builtin highlight group for drawing widgets,
+// so they follow the colorscheme. Neovim sends the groups with hl_group_set.
+func WidgetAttribute(group string) HighlightAttribute {
+	fg := Editor.gridManager.foreground
+	bg := Editor.gridManager.background
+	attrib, ok := Editor.gridManager.GroupAttribute(group)
+	if !ok {
+		if widgetSelectedGroups[group] {
+			return HighlightAttribute{foreground: fg, background: bg, bold: true}
+		}
+		return HighlightAttribute{foreground: bg, background: fg}
+	}
+	// Zero alpha means color is not set and we use default color
+	if attrib.foreground.A <= 0 {
+		attrib.foreground = fg
+	}
+	if attrib.background.A <= 0 {
+		attrib.background = bg
+	}
+	if attrib.reverse {
+		attrib.foreground, attrib.background = attrib.background, attrib.foreground
+		attrib.reverse = false
+	}
+	// Widgets are always opaque
+	attrib.background.A = 1
+	attrib.blend = 0
+	return attrib
+}
+
+// Drawing helpers of the widgets
+
+// Returns the rectangle of the renderer in the screen
+func (renderer *GridRenderer) Rect() common.Rectangle[int] {
+	cellSize := renderer.CellSize()
+	return common.Rectangle[int]{
+		X: renderer.position.X,
+		Y: renderer.position.Y,
+		W: renderer.cols * cellSize.Width(),
+		H: renderer.rows * cellSize.Height(),
+	}
+}
+
+// Returns the cell at the position in the screen, ok is false if the position
+// is not on the renderer
+func (renderer *GridRenderer) CellAt(pos common.Vector2[int]) (row, col int, ok bool) {
+	if !pos.IsInRect(renderer.Rect()) {
+		return -1, -1, false
+	}
+	cellSize := renderer.CellSize()
+	row = (pos.Y - renderer.position.Y) / cellSize.Height()
+	col = (pos.X - renderer.position.X) / cellSize.Width()
+	return row, col, true
+}
+
+// Returns the center of the cell in the screen
+func (renderer *GridRenderer) CellCenter(row, col int) common.Vector2[int] {
+	cellSize := renderer.CellSize()
+	return common.Vector2[int]{
+		X: renderer.position.X + col*cellSize.Width() + cellSize.Width()/2,
+		Y: renderer.position.Y + row*cellSize.Height() + cellSize.Height()/2,
+	}
+}
+
+// Draws the text to the row starting from the column and clears the rest of
+// the row. Every character takes one cell and spaces are empty cells.
+func (renderer *GridRenderer) DrawText(row, col int, text []rune, attrib HighlightAttribute) {
+	for i := 0; col+i < renderer.cols; i++ {
+		var char rune
+		if i < len(text) && text[i] != ' ' {
+			char = text[i]
+		}
+		renderer.DrawCell(row, col+i, char, attrib)
+	}
+}
+
+// Draws a box to the edge cells of the renderer
+func (renderer *GridRenderer) DrawBorder(attrib HighlightAttribute) {
+	last := renderer.rows - 1
+	right := renderer.cols - 1
+	for col := 1; col < right; col++ {
+		renderer.DrawCell(0, col, '─', attrib)
+		renderer.DrawCell(last, col, '─', attrib)
+	}
+	for row := 1; row < last; row++ {
+		renderer.DrawCell(row, 0, '│', attrib)
+		renderer.DrawCell(row, right, '│', attrib)
+	}
+	renderer.DrawCell(0, 0, '╭', attrib)
+	renderer.DrawCell(0, right, '╮', attrib)
+	renderer.DrawCell(last, 0, '╰', attrib)
+	renderer.DrawCell(last, right, '╯', attrib)
+}
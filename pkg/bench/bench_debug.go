@@ -7,7 +7,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -44,18 +43,12 @@ func Begin() func(name ...string) {
 	before := time.Now()
 	return func(name ...string) {
 		elapsed := time.Since(before)
+		benchName := measureName(name)
+		if isTracing() {
+			addTraceEvent(benchName, before, elapsed)
+		}
 		mutex.Lock()
 		defer mutex.Unlock()
-		benchName := "unknown"
-		if len(name) > 0 {
-			benchName = name[0]
-		} else {
-			// get caller function name
-			pc, _, _, ok := runtime.Caller(1)
-			if ok {
-				benchName = runtime.FuncForPC(pc).Name()
-			}
-		}
 		val, ok := averages[benchName]
 		if ok {
 			val.calls++
@@ -74,6 +67,17 @@ func Begin() func(name ...string) {
 	}
 }
 
+// Returns the average execution times of the measured functions
+func Averages() map[string]time.Duration {
+	mutex.Lock()
+	defer mutex.Unlock()
+	result := make(map[string]time.Duration, len(averages))
+	for name, val := range averages {
+		result[name] = val.totalTime / time.Duration(val.calls)
+	}
+	return result
+}
+
 // This prints a table which has the measurement information of all functions.
 func PrintResults(out io.Writer) {
 	mutex.Lock()
@@ -0,0 +1,121 @@
+package bench
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Events after this are dropped, a long session would use too much memory
+const MAX_TRACE_EVENTS = 1 << 20
+
+// Complete event of the chrome tracing format, times are in microseconds
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"ph"`
+	Time  int64  `json:"ts"`
+	Dur   int64  `json:"dur"`
+	Pid   int    `json:"pid"`
+	Tid   int    `json:"tid"`
+}
+
+var (
+	tracing    int32 // atomic, 1 if tracing
+	traceMutex sync.Mutex
+	traceFile  string
+	traceBegin time.Time
+	traceList  []traceEvent
+	profile    *os.File
+)
+
+// Starts recording every measured function to a chrome://tracing compatible
+// file. Works in both debug and release builds.
+func StartTrace(file string) {
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	traceFile = file
+	traceBegin = time.Now()
+	traceList = make([]traceEvent, 0, 4096)
+	atomic.StoreInt32(&tracing, 1)
+}
+
+// Stops tracing and writes the events to the file
+func StopTrace() error {
+	if atomic.SwapInt32(&tracing, 0) == 0 {
+		return nil
+	}
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	data, err := json.Marshal(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{traceList, "ms"})
+	traceList = nil
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(traceFile, data, 0644)
+}
+
+func isTracing() bool {
+	return atomic.LoadInt32(&tracing) == 1
+}
+
+func addTraceEvent(name string, begin time.Time, elapsed time.Duration) {
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	if len(traceList) >= MAX_TRACE_EVENTS {
+		return
+	}
+	traceList = append(traceList, traceEvent{
+		Name:  name,
+		Phase: "X",
+		Time:  begin.Sub(traceBegin).Microseconds(),
+		Dur:   elapsed.Microseconds(),
+		Pid:   1,
+		Tid:   1,
+	})
+}
+
+// Returns the name given to the function returned from Begin, or the name of
+// the function calling it. Must be called directly from there.
+func measureName(name []string) string {
+	if len(name) > 0 {
+		return name[0]
+	}
+	pc, _, _, ok := runtime.Caller(2)
+	if ok {
+		return runtime.FuncForPC(pc).Name()
+	}
+	return "unknown"
+}
+
+// Starts pprof cpu profiling to the file
+func StartCPUProfile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = pprof.StartCPUProfile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	profile = f
+	return nil
+}
+
+func StopCPUProfile() error {
+	if profile == nil {
+		return nil
+	}
+	pprof.StopCPUProfile()
+	err := profile.Close()
+	profile = nil
+	return err
+}
@@ -42,22 +42,51 @@ func Abs[T Numbers](v T) T {
 	return v
 }
 
+// Easing functions take the progress of the animation between 0 and 1 and
+// return the progress of the value
+type Easing func(t float32) float32
+
+func EaseLinear(t float32) float32 {
+	return t
+}
+
+// Starts fast and slows down
+func EaseOutCubic(t float32) float32 {
+	t = 1 - t
+	return 1 - t*t*t
+}
+
+// Starts and ends slowly
+func EaseInOutCubic(t float32) float32 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	t = -2*t + 2
+	return 1 - t*t*t/2
+}
+
 // Animation used for calculating positions of animated objects (points)
 type Animation struct {
 	from     Vector2[float32]
 	to       Vector2[float32]
 	time     float32
 	lifeTime float32
+	easing   Easing
 }
 
 // Lifetime is the life of the animation. Animation speed is depends of the
 // delta time and lifetime. For lifeTime parameter, 1.0 value is 1 seconds
 func NewAnimation(from, to Vector2[float32], lifeTime float32) Animation {
+	return NewEasedAnimation(from, to, lifeTime, EaseLinear)
+}
+
+func NewEasedAnimation(from, to Vector2[float32], lifeTime float32, easing Easing) Animation {
 	return Animation{
 		from:     from,
 		to:       to,
 		time:     0,
 		lifeTime: lifeTime,
+		easing:   easing,
 	}
 }
 
@@ -67,7 +96,18 @@ func (anim *Animation) Step(delta float32) Vector2[float32] {
 		return anim.to
 	}
 	anim.time += delta
-	return anim.from.Add(anim.to.Sub(anim.from).DivS(anim.lifeTime).MulS(Min(anim.time, anim.lifeTime)))
+	t := Min(anim.time, anim.lifeTime) / anim.lifeTime
+	if anim.easing != nil {
+		t = anim.easing(t)
+	}
+	return anim.from.Add(anim.to.Sub(anim.from).MulS(t))
+}
+
+// Returns the position of animation after delta without advancing it. Used for
+// interpolating between steps.
+func (anim *Animation) Peek(delta float32) Vector2[float32] {
+	next := *anim
+	return next.Step(delta)
 }
 
 func (anim *Animation) IsFinished() bool {
@@ -45,3 +45,35 @@ func (rect Rectangle[T]) ToF32() Rectangle[float32] {
 func (rect Rectangle[T]) Area() float32 {
 	return float32(rect.W * rect.H)
 }
+
+// Returns the common area of the rectangles, empty rectangle if they don't
+// overlap.
+func (rect Rectangle[T]) Intersect(other Rectangle[T]) Rectangle[T] {
+	x := Max(rect.X, other.X)
+	y := Max(rect.Y, other.Y)
+	right := Min(rect.X+rect.W, other.X+other.W)
+	bottom := Min(rect.Y+rect.H, other.Y+other.H)
+	if right <= x || bottom <= y {
+		return Rectangle[T]{}
+	}
+	return Rectangle[T]{X: x, Y: y, W: right - x, H: bottom - y}
+}
+
+// Returns the smallest rectangle containing both rectangles, empty rectangles
+// are ignored.
+func (rect Rectangle[T]) Union(other Rectangle[T]) Rectangle[T] {
+	if other.W <= 0 || other.H <= 0 {
+		return rect
+	}
+	if rect.W <= 0 || rect.H <= 0 {
+		return other
+	}
+	x := Min(rect.X, other.X)
+	y := Min(rect.Y, other.Y)
+	return Rectangle[T]{
+		X: x,
+		Y: y,
+		W: Max(rect.X+rect.W, other.X+other.W) - x,
+		H: Max(rect.Y+rect.H, other.Y+other.H) - y,
+	}
+}
@@ -10,11 +10,22 @@ import (
 	"github.com/adrg/sysfont"
 )
 
+// FontFile is a font file and the index of the font in it. Index is only
+// used for font collections (.ttc, .otc) and zero for others.
+type FontFile struct {
+	Path  string
+	Index int
+}
+
+func (file FontFile) IsEmpty() bool {
+	return file.Path == ""
+}
+
 type FontPathInfo struct {
-	Regular    string
-	BoldItalic string
-	Italic     string
-	Bold       string
+	Regular    FontFile
+	BoldItalic FontFile
+	Italic     FontFile
+	Bold       FontFile
 }
 
 type fontSearchInfo struct {
@@ -67,11 +78,23 @@ func List() []*sysfont.Font {
 }
 
 func Find(name string) FontPathInfo {
+	// Try the platform's font matching first, it knows the real family and
+	// style names and doesn't need to wait for the system font list.
+	if info, ok := findSystem(name); ok {
+		return info
+	}
 	systemFontListGuard.Lock()
 	defer systemFontListGuard.Unlock()
 	return find(name)
 }
 
+// Returns the fonts the system chooses for the character when the user font
+// doesn't have it, best first. The system may return a font without the glyph, the caller
+// must check it.
+func FallbacksFor(char rune) []FontFile {
+	return systemFallbacksFor(char)
+}
+
 func find(name string) FontPathInfo {
 
 	fonts := []fontSearchInfo{}
@@ -105,20 +128,20 @@ func find(name string) FontPathInfo {
 	for _, f := range fonts {
 		// Order is important here.
 		if f.hasItalic && f.hasBold {
-			info.BoldItalic = f.handle.Filename
+			info.BoldItalic = FontFile{Path: f.handle.Filename}
 		} else if f.hasItalic {
-			info.Italic = f.handle.Filename
+			info.Italic = FontFile{Path: f.handle.Filename}
 		} else if f.hasBold {
-			info.Bold = f.handle.Filename
+			info.Bold = FontFile{Path: f.handle.Filename}
 		} else if f.hasRegular {
-			info.Regular = f.handle.Filename
+			info.Regular = FontFile{Path: f.handle.Filename}
 			// If a font has 'Regular' string, it is the regular.
 			// No look for others. If no font has 'Regular' or 'Normal'
 			// then the font has smallest filename length and has no
 			// italic or bold will be the regular.
 			regularFounded = true
 		} else if !regularFounded {
-			info.Regular = f.handle.Filename
+			info.Regular = FontFile{Path: f.handle.Filename}
 		}
 	}
 
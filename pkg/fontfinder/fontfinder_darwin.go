@@ -0,0 +1,212 @@
+package fontfinder
+
+/*
+#cgo LDFLAGS: -framework CoreText -framework CoreFoundation
+#include <stdlib.h>
+#include <CoreText/CoreText.h>
+
+// Copies the string to a new c string, caller must free it.
+static char* copyCString(CFStringRef str) {
+	if (str == NULL) {
+		return NULL;
+	}
+	CFIndex size = CFStringGetMaximumSizeForEncoding(CFStringGetLength(str), kCFStringEncodingUTF8) + 1;
+	char* buf = malloc(size);
+	if (!CFStringGetCString(str, buf, size, kCFStringEncodingUTF8)) {
+		free(buf);
+		return NULL;
+	}
+	return buf;
+}
+
+// Returns the file path and the postscript name of the font descriptor.
+static int descriptorInfo(CTFontDescriptorRef desc, char** path, char** psname) {
+	*path = NULL;
+	*psname = NULL;
+	CFURLRef url = CTFontDescriptorCopyAttribute(desc, kCTFontURLAttribute);
+	if (url == NULL) {
+		return 0;
+	}
+	CFStringRef pathStr = CFURLCopyFileSystemPath(url, kCFURLPOSIXPathStyle);
+	CFRelease(url);
+	*path = copyCString(pathStr);
+	if (pathStr != NULL) {
+		CFRelease(pathStr);
+	}
+	CFStringRef nameStr = CTFontDescriptorCopyAttribute(desc, kCTFontNameAttribute);
+	*psname = copyCString(nameStr);
+	if (nameStr != NULL) {
+		CFRelease(nameStr);
+	}
+	return *path != NULL;
+}
+
+// Finds the font in the family which matches best with the traits. Returns 0
+// if there is no family with this name.
+static int matchFont(const char* family, int bold, int italic, char** path, char** psname) {
+	CFStringRef familyStr = CFStringCreateWithCString(NULL, family, kCFStringEncodingUTF8);
+	if (familyStr == NULL) {
+		return 0;
+	}
+	CTFontSymbolicTraits symbolic = 0;
+	if (bold) symbolic |= kCTFontBoldTrait;
+	if (italic) symbolic |= kCTFontItalicTrait;
+	CFNumberRef symbolicNum = CFNumberCreate(NULL, kCFNumberSInt32Type, &symbolic);
+	CFTypeRef traitKeys[] = { kCTFontSymbolicTrait };
+	CFTypeRef traitValues[] = { symbolicNum };
+	CFDictionaryRef traits = CFDictionaryCreate(NULL, traitKeys, traitValues, 1, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFTypeRef keys[] = { kCTFontFamilyNameAttribute, kCTFontTraitsAttribute };
+	CFTypeRef values[] = { familyStr, traits };
+	CFDictionaryRef attributes = CFDictionaryCreate(NULL, keys, values, 2, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CTFontDescriptorRef desc = CTFontDescriptorCreateWithAttributes(attributes);
+	// Family must match, otherwise Core Text returns any font
+	CFTypeRef mandatoryKeys[] = { kCTFontFamilyNameAttribute };
+	CFSetRef mandatory = CFSetCreate(NULL, mandatoryKeys, 1, &kCFTypeSetCallBacks);
+	CTFontDescriptorRef matched = CTFontDescriptorCreateMatchingFontDescriptor(desc, mandatory);
+	int ok = 0;
+	if (matched != NULL) {
+		ok = descriptorInfo(matched, path, psname);
+		CFRelease(matched);
+	}
+	CFRelease(mandatory);
+	CFRelease(desc);
+	CFRelease(attributes);
+	CFRelease(traits);
+	CFRelease(symbolicNum);
+	CFRelease(familyStr);
+	return ok;
+}
+
+// Returns the font Core Text chooses for the characters when the fixed pitch
+// system font doesn't have them, the system font itself if none has them.
+static int fallbackFont(const UniChar* chars, CFIndex length, char** path, char** psname) {
+	*path = NULL;
+	*psname = NULL;
+	CTFontRef base = CTFontCreateUIFontForLanguage(kCTFontUIFontUserFixedPitch, 0, NULL);
+	if (base == NULL) {
+		return 0;
+	}
+	CFStringRef str = CFStringCreateWithCharacters(NULL, chars, length);
+	if (str == NULL) {
+		CFRelease(base);
+		return 0;
+	}
+	CTFontRef font = CTFontCreateForString(base, str, CFRangeMake(0, length));
+	int ok = 0;
+	if (font != NULL) {
+		CTFontDescriptorRef desc = CTFontCopyFontDescriptor(font);
+		ok = descriptorInfo(desc, path, psname);
+		CFRelease(desc);
+		CFRelease(font);
+	}
+	CFRelease(str);
+	CFRelease(base);
+	return ok;
+}
+*/
+import "C"
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// Uses Core Text to find the font files. Core Text knows the real family
+// names of the fonts (like "SF Mono") and the fonts in collections. Returns
+// false if there is no family with this name.
+func findSystem(name string) (FontPathInfo, bool) {
+	info := FontPathInfo{}
+	info.Regular = ctMatch(name, false, false)
+	if info.Regular.IsEmpty() {
+		return FontPathInfo{}, false
+	}
+	// If the family doesn't have a style, Core Text returns the closest
+	// one. We don't need the same file twice, fontkit already uses regular
+	// when a style is missing.
+	unique := func(file FontFile) FontFile {
+		if file == info.Regular {
+			return FontFile{}
+		}
+		return file
+	}
+	info.Bold = unique(ctMatch(name, true, false))
+	info.Italic = unique(ctMatch(name, false, true))
+	info.BoldItalic = unique(ctMatch(name, true, true))
+	return info, true
+}
+
+func ctMatch(family string, bold, italic bool) FontFile {
+	cfamily := C.CString(family)
+	defer C.free(unsafe.Pointer(cfamily))
+	var cpath, cpsname *C.char
+	ok := C.matchFont(cfamily, boolToCInt(bold), boolToCInt(italic), &cpath, &cpsname)
+	defer C.free(unsafe.Pointer(cpath))
+	defer C.free(unsafe.Pointer(cpsname))
+	if ok == 0 {
+		return FontFile{}
+	}
+	return fontFile(C.GoString(cpath), C.GoString(cpsname))
+}
+
+// Asks Core Text which font it uses for the character, the same one the other
+// applications use.
+func systemFallbacksFor(char rune) []FontFile {
+	chars := utf16.Encode([]rune{char})
+	var cpath, cpsname *C.char
+	ok := C.fallbackFont((*C.UniChar)(unsafe.Pointer(&chars[0])), C.CFIndex(len(chars)), &cpath, &cpsname)
+	defer C.free(unsafe.Pointer(cpath))
+	defer C.free(unsafe.Pointer(cpsname))
+	if ok == 0 {
+		return nil
+	}
+	file := fontFile(C.GoString(cpath), C.GoString(cpsname))
+	if file.IsEmpty() {
+		return nil
+	}
+	return []FontFile{file}
+}
+
+// Core Text doesn't give the index of the font in a collection, we are
+// finding it by comparing the postscript names.
+func fontFile(path, psname string) FontFile {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ttf", ".otf":
+		return FontFile{Path: path}
+	case ".ttc", ".otc":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return FontFile{}
+		}
+		collection, err := sfnt.ParseCollection(data)
+		if err != nil {
+			return FontFile{}
+		}
+		var buffer sfnt.Buffer
+		for i := 0; i < collection.NumFonts(); i++ {
+			font, err := collection.Font(i)
+			if err != nil {
+				continue
+			}
+			name, err := font.Name(&buffer, sfnt.NameIDPostScript)
+			if err == nil && name == psname {
+				return FontFile{Path: path, Index: i}
+			}
+		}
+		return FontFile{}
+	default:
+		// We can't load others
+		return FontFile{}
+	}
+}
+
+func boolToCInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+package fontfinder
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fonts checked for a missing glyph at most, others are rarely needed and
+// loading them costs memory
+const FALLBACK_CANDIDATES = 3
+
+// A font in the fallback order of fontconfig and the characters it has
+type fcFallback struct {
+	file   FontFile
+	ranges [][2]rune // nil if the charset couldn't be parsed
+}
+
+func (fallback fcFallback) covers(char rune) bool {
+	if fallback.ranges == nil {
+		return true
+	}
+	for _, r := range fallback.ranges {
+		if char >= r[0] && char <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	fcFallbacks     []fcFallback
+	fcFallbacksOnce sync.Once
+)
+
+// Uses fontconfig to find the font files. This is more reliable than
+// matching the names of the files because fontconfig knows the real family
+// and style names of the fonts. Returns false if fontconfig is not
+// available or it couldn't find the family.
+func findSystem(name string) (FontPathInfo, bool) {
+	if _, err := exec.LookPath("fc-match"); err != nil {
+		return FontPathInfo{}, false
+	}
+	info := FontPathInfo{}
+	info.Regular = fcMatch(name, "regular", "roman")
+	if info.Regular.IsEmpty() {
+		// There is no family with this name, let the caller try other ways
+		return FontPathInfo{}, false
+	}
+	// If the family doesn't have a style, fontconfig returns the closest
+	// one. We don't need the same file twice, fontkit already uses regular
+	// when a style is missing.
+	unique := func(file FontFile) FontFile {
+		if file == info.Regular {
+			return FontFile{}
+		}
+		return file
+	}
+	info.Bold = unique(fcMatch(name, "bold", "roman"))
+	info.Italic = unique(fcMatch(name, "regular", "italic"))
+	info.BoldItalic = unique(fcMatch(name, "bold", "italic"))
+	return info, true
+}
+
+// Fontconfig sorts all fonts by how well they match with the monospace
+// family, this is the order it uses for the missing glyphs too. Charsets are
+// asked in the same call, so fc-match runs only once instead of for every
+// missing glyph.
+func systemFallbacksFor(char rune) []FontFile {
+	fcFallbacksOnce.Do(func() {
+		out, err := exec.Command("fc-match", "--sort", "--format=%{file}\t%{index}\t%{charset}\n", "monospace").Output()
+		if err != nil {
+			return
+		}
+		fcFallbacks = parseFcFallbacks(string(out))
+	})
+	files := []FontFile{}
+	for _, fallback := range fcFallbacks {
+		if fallback.covers(char) {
+			files = append(files, fallback.file)
+			if len(files) == FALLBACK_CANDIDATES {
+				break
+			}
+		}
+	}
+	return files
+}
+
+// Parses the lines of file, index and charset
+func parseFcFallbacks(out string) []fcFallback {
+	fallbacks := []fcFallback{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		index, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		file := loadableFile(strings.TrimSpace(fields[0]), index)
+		if file.IsEmpty() {
+			continue
+		}
+		fallbacks = append(fallbacks, fcFallback{
+			file:   file,
+			ranges: parseFcCharset(fields[2]),
+		})
+	}
+	return fallbacks
+}
+
+// Charsets are space separated hexadecimal ranges, like "20-7e a0 100-17f".
+// Returns nil if the charset is not in this format.
+func parseFcCharset(charset string) [][2]rune {
+	ranges := [][2]rune{}
+	for _, field := range strings.Fields(charset) {
+		bounds := strings.SplitN(field, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 16, 32)
+		if err != nil {
+			return nil
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 16, 32)
+			if err != nil || last < first {
+				return nil
+			}
+		}
+		ranges = append(ranges, [2]rune{rune(first), rune(last)})
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	return ranges
+}
+
+// Returns the file of the best matching font, or empty file if the matched
+// font is not in the requested family.
+func fcMatch(family, weight, slant string) FontFile {
+	pattern := fcEscape(family) + ":weight=" + weight + ":slant=" + slant
+	out, err := exec.Command("fc-match", "--format=%{family}\n%{index}\n%{file}", pattern).Output()
+	if err != nil {
+		return FontFile{}
+	}
+	lines := strings.SplitN(string(out), "\n", 3)
+	if len(lines) != 3 {
+		return FontFile{}
+	}
+	families, file := lines[0], strings.TrimSpace(lines[2])
+	index, err := strconv.Atoi(lines[1])
+	if err != nil {
+		return FontFile{}
+	}
+	// fontconfig always returns a font, even if the family is not installed
+	// so we must check the family of the result
+	matched := false
+	for _, f := range strings.Split(families, ",") {
+		if strings.EqualFold(strings.TrimSpace(f), family) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return FontFile{}
+	}
+	return loadableFile(file, index)
+}
+
+// Returns empty file if we can't load the file, like bitmap fonts
+func loadableFile(path string, index int) FontFile {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ttf", ".otf", ".ttc", ".otc":
+		return FontFile{Path: path, Index: index}
+	default:
+		return FontFile{}
+	}
+}
+
+// Escapes the characters which have special meaning in fontconfig patterns.
+func fcEscape(str string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `-`, `\-`, `:`, `\:`, `,`, `\,`)
+	return replacer.Replace(str)
+}
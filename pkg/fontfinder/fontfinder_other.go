@@ -0,0 +1,13 @@
+//go:build !linux && !windows && !darwin
+// +build !linux,!windows,!darwin
+
+package fontfinder
+
+// There is no system specific way to find fonts for this platform.
+func findSystem(name string) (FontPathInfo, bool) {
+	return FontPathInfo{}, false
+}
+
+func systemFallbacksFor(char rune) []FontFile {
+	return nil
+}
@@ -0,0 +1,358 @@
+package fontfinder
+
+import (
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// DirectWrite is a COM api, we are calling its methods by their index in the
+// virtual method table. Indices are taken from dwrite.h
+const (
+	// IUnknown
+	iUnknownQueryInterface = 0
+	iUnknownRelease        = 2
+	// IDWriteFactory
+	iDWriteFactoryGetSystemFontCollection = 3
+	// IDWriteFactory2
+	iDWriteFactory2GetSystemFontFallback = 26
+	// IDWriteFontFallback
+	iDWriteFontFallbackMapCharacters = 3
+	// IDWriteFontCollection
+	iDWriteFontCollectionGetFontFamily  = 4
+	iDWriteFontCollectionFindFamilyName = 5
+	// IDWriteFontFamily
+	iDWriteFontFamilyGetFirstMatchingFont = 7
+	// IDWriteFont
+	iDWriteFontCreateFontFace = 13
+	// IDWriteFontFace
+	iDWriteFontFaceGetFiles = 4
+	iDWriteFontFaceGetIndex = 5
+	// IDWriteFontFile
+	iDWriteFontFileGetReferenceKey = 3
+	iDWriteFontFileGetLoader       = 4
+	// IDWriteLocalFontFileLoader
+	iDWriteLocalFontFileLoaderGetFilePathLengthFromKey = 4
+	iDWriteLocalFontFileLoaderGetFilePathFromKey       = 5
+)
+
+const (
+	E_NOINTERFACE              = 0x80004002
+	LOCALE_NAME_MAX_LENGTH     = 85
+	DWRITE_FACTORY_TYPE_SHARED = 0
+	DWRITE_FONT_WEIGHT_NORMAL  = 400
+	DWRITE_FONT_WEIGHT_BOLD    = 700
+	DWRITE_FONT_STRETCH_NORMAL = 5
+	DWRITE_FONT_STYLE_NORMAL   = 0
+	DWRITE_FONT_STYLE_ITALIC   = 2
+)
+
+var (
+	dwrite                       = syscall.NewLazyDLL("dwrite.dll")
+	procDWriteCreateFactory      = dwrite.NewProc("DWriteCreateFactory")
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGetUserDefaultLocaleName = kernel32.NewProc("GetUserDefaultLocaleName")
+
+	IID_IDWriteFactory             = syscall.GUID{Data1: 0xb859ee5a, Data2: 0xd838, Data3: 0x4b5b, Data4: [8]byte{0xa2, 0xe8, 0x1a, 0xdc, 0x7d, 0x93, 0xdb, 0x48}}
+	IID_IDWriteFactory2            = syscall.GUID{Data1: 0x0439fc60, Data2: 0xca44, Data3: 0x4994, Data4: [8]byte{0x8d, 0xee, 0x3a, 0x9a, 0xf7, 0xb7, 0x32, 0xec}}
+	IID_IDWriteLocalFontFileLoader = syscall.GUID{Data1: 0xb2d9f3ec, Data2: 0xc9fe, Data3: 0x4a11, Data4: [8]byte{0xa2, 0xec, 0xd8, 0x62, 0x08, 0xf7, 0xc0, 0xa2}}
+)
+
+type comObject struct {
+	vtbl *[32]uintptr
+}
+
+func (obj *comObject) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(obj.vtbl[method], append([]uintptr{uintptr(unsafe.Pointer(obj))}, args...)...)
+	return ret
+}
+
+func (obj *comObject) release() {
+	obj.call(iUnknownRelease)
+}
+
+func failed(hr uintptr) bool {
+	return int32(hr) < 0
+}
+
+type dwriteFontCollection struct {
+	factory    *comObject
+	collection *comObject
+}
+
+func newDWriteFontCollection() (*dwriteFontCollection, bool) {
+	if procDWriteCreateFactory.Find() != nil {
+		return nil, false
+	}
+	dw := new(dwriteFontCollection)
+	hr, _, _ := procDWriteCreateFactory.Call(
+		DWRITE_FACTORY_TYPE_SHARED,
+		uintptr(unsafe.Pointer(&IID_IDWriteFactory)),
+		uintptr(unsafe.Pointer(&dw.factory)),
+	)
+	if failed(hr) || dw.factory == nil {
+		return nil, false
+	}
+	hr = dw.factory.call(iDWriteFactoryGetSystemFontCollection, uintptr(unsafe.Pointer(&dw.collection)), 0)
+	if failed(hr) || dw.collection == nil {
+		dw.factory.release()
+		return nil, false
+	}
+	return dw, true
+}
+
+func (dw *dwriteFontCollection) release() {
+	dw.collection.release()
+	dw.factory.release()
+}
+
+// Returns the font family with the given name. DirectWrite also matches the
+// localized names of the families.
+func (dw *dwriteFontCollection) family(name string) *comObject {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil
+	}
+	var index uint32
+	var exists int32
+	hr := dw.collection.call(iDWriteFontCollectionFindFamilyName,
+		uintptr(unsafe.Pointer(namePtr)),
+		uintptr(unsafe.Pointer(&index)),
+		uintptr(unsafe.Pointer(&exists)),
+	)
+	if failed(hr) || exists == 0 {
+		return nil
+	}
+	var family *comObject
+	hr = dw.collection.call(iDWriteFontCollectionGetFontFamily, uintptr(index), uintptr(unsafe.Pointer(&family)))
+	if failed(hr) {
+		return nil
+	}
+	return family
+}
+
+// Returns the file of the font in the family which matches best with the
+// given weight and style. If the family doesn't have this style, DirectWrite
+// returns the closest one.
+func matchingFontFile(family *comObject, weight, style uintptr) FontFile {
+	var font *comObject
+	hr := family.call(iDWriteFontFamilyGetFirstMatchingFont, weight, DWRITE_FONT_STRETCH_NORMAL, style, uintptr(unsafe.Pointer(&font)))
+	if failed(hr) || font == nil {
+		return FontFile{}
+	}
+	defer font.release()
+	return fontFileOf(font)
+}
+
+// Returns the file of the IDWriteFont
+func fontFileOf(font *comObject) FontFile {
+	var face *comObject
+	hr := font.call(iDWriteFontCreateFontFace, uintptr(unsafe.Pointer(&face)))
+	if failed(hr) || face == nil {
+		return FontFile{}
+	}
+	defer face.release()
+	// Index of the font in the collection file
+	index := int(uint32(face.call(iDWriteFontFaceGetIndex)))
+	// Local fonts have only one file
+	var numFiles uint32 = 1
+	var file *comObject
+	hr = face.call(iDWriteFontFaceGetFiles, uintptr(unsafe.Pointer(&numFiles)), uintptr(unsafe.Pointer(&file)))
+	if failed(hr) || file == nil {
+		return FontFile{}
+	}
+	defer file.release()
+	path := localFilePath(file)
+	if path == "" {
+		return FontFile{}
+	}
+	return FontFile{Path: path, Index: index}
+}
+
+// Returns the path of the font file if it is a local file, otherwise
+// returns empty string
+func localFilePath(file *comObject) string {
+	var key uintptr
+	var keySize uint32
+	hr := file.call(iDWriteFontFileGetReferenceKey, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(&keySize)))
+	if failed(hr) {
+		return ""
+	}
+	var loader *comObject
+	hr = file.call(iDWriteFontFileGetLoader, uintptr(unsafe.Pointer(&loader)))
+	if failed(hr) || loader == nil {
+		return ""
+	}
+	defer loader.release()
+	var localLoader *comObject
+	hr = loader.call(iUnknownQueryInterface, uintptr(unsafe.Pointer(&IID_IDWriteLocalFontFileLoader)), uintptr(unsafe.Pointer(&localLoader)))
+	if failed(hr) || localLoader == nil {
+		// This is not a local font
+		return ""
+	}
+	defer localLoader.release()
+	var length uint32
+	hr = localLoader.call(iDWriteLocalFontFileLoaderGetFilePathLengthFromKey, key, uintptr(keySize), uintptr(unsafe.Pointer(&length)))
+	if failed(hr) {
+		return ""
+	}
+	buf := make([]uint16, length+1)
+	hr = localLoader.call(iDWriteLocalFontFileLoaderGetFilePathFromKey, key, uintptr(keySize), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if failed(hr) {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
+
+// Uses DirectWrite to find the font files. DirectWrite knows the localized
+// family names and the fonts in collections. Returns false if the family
+// couldn't be found.
+func findSystem(name string) (FontPathInfo, bool) {
+	dw, ok := newDWriteFontCollection()
+	if !ok {
+		return FontPathInfo{}, false
+	}
+	defer dw.release()
+	family := dw.family(name)
+	if family == nil {
+		return FontPathInfo{}, false
+	}
+	defer family.release()
+	info := FontPathInfo{}
+	info.Regular = matchingFontFile(family, DWRITE_FONT_WEIGHT_NORMAL, DWRITE_FONT_STYLE_NORMAL)
+	if info.Regular.IsEmpty() {
+		return FontPathInfo{}, false
+	}
+	// DirectWrite simulates missing styles using the regular font. We don't
+	// need the same file twice, fontkit already uses regular when a style is
+	// missing.
+	unique := func(file FontFile) FontFile {
+		if file == info.Regular {
+			return FontFile{}
+		}
+		return file
+	}
+	info.Bold = unique(matchingFontFile(family, DWRITE_FONT_WEIGHT_BOLD, DWRITE_FONT_STYLE_NORMAL))
+	info.Italic = unique(matchingFontFile(family, DWRITE_FONT_WEIGHT_NORMAL, DWRITE_FONT_STYLE_ITALIC))
+	info.BoldItalic = unique(matchingFontFile(family, DWRITE_FONT_WEIGHT_BOLD, DWRITE_FONT_STYLE_ITALIC))
+	return info, true
+}
+
+// DirectWrite asks the text to IDWriteTextAnalysisSource, which we implement
+// for a single character. The vtable is created once because callbacks are
+// limited, and only one character is mapped at a time.
+var (
+	fallbackGuard  sync.Mutex
+	fallbackOnce   sync.Once
+	fontFallback   *comObject // IDWriteFontFallback, nil if not supported
+	fallbackText   []uint16   // character being mapped
+	fallbackLocale []uint16   // locale of the user, changes the CJK fonts
+	textSource     struct {
+		vtbl *[8]uintptr
+	}
+	textSourceVtbl [8]uintptr
+)
+
+func initFontFallback() {
+	textSourceVtbl = [8]uintptr{
+		// QueryInterface, AddRef and Release, the object is static
+		syscall.NewCallback(func(this, iid uintptr, object *uintptr) uintptr {
+			*object = 0
+			return E_NOINTERFACE
+		}),
+		syscall.NewCallback(func(this uintptr) uintptr { return 1 }),
+		syscall.NewCallback(func(this uintptr) uintptr { return 1 }),
+		// GetTextAtPosition
+		syscall.NewCallback(func(this, position uintptr, text **uint16, length *uint32) uintptr {
+			*text, *length = nil, 0
+			if int(position) < len(fallbackText) {
+				*text = &fallbackText[position]
+				*length = uint32(len(fallbackText) - int(position))
+			}
+			return 0
+		}),
+		// GetTextBeforePosition
+		syscall.NewCallback(func(this, position uintptr, text **uint16, length *uint32) uintptr {
+			*text, *length = nil, 0
+			if position > 0 && int(position) <= len(fallbackText) {
+				*text = &fallbackText[0]
+				*length = uint32(position)
+			}
+			return 0
+		}),
+		// GetParagraphReadingDirection, left to right
+		syscall.NewCallback(func(this uintptr) uintptr { return 0 }),
+		// GetLocaleName
+		syscall.NewCallback(func(this, position uintptr, length *uint32, locale **uint16) uintptr {
+			*length = uint32(len(fallbackText))
+			*locale = &fallbackLocale[0]
+			return 0
+		}),
+		// GetNumberSubstitution
+		syscall.NewCallback(func(this, position uintptr, length *uint32, substitution *uintptr) uintptr {
+			*length = uint32(len(fallbackText))
+			*substitution = 0
+			return 0
+		}),
+	}
+	textSource.vtbl = &textSourceVtbl
+	fallbackLocale = make([]uint16, LOCALE_NAME_MAX_LENGTH)
+	if procGetUserDefaultLocaleName.Find() == nil {
+		procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&fallbackLocale[0])), uintptr(len(fallbackLocale)))
+	}
+	// IDWriteFactory2 needs Windows 8.1, factory is not released because the
+	// fallback belongs to it
+	dw, ok := newDWriteFontCollection()
+	if !ok {
+		return
+	}
+	var factory2 *comObject
+	hr := dw.factory.call(iUnknownQueryInterface, uintptr(unsafe.Pointer(&IID_IDWriteFactory2)), uintptr(unsafe.Pointer(&factory2)))
+	dw.release()
+	if failed(hr) || factory2 == nil {
+		return
+	}
+	hr = factory2.call(iDWriteFactory2GetSystemFontFallback, uintptr(unsafe.Pointer(&fontFallback)))
+	if failed(hr) {
+		fontFallback = nil
+		factory2.release()
+	}
+}
+
+// Asks the system font fallback of DirectWrite, the same one the other
+// applications use, which font has the character.
+func systemFallbacksFor(char rune) []FontFile {
+	fallbackGuard.Lock()
+	defer fallbackGuard.Unlock()
+	fallbackOnce.Do(initFontFallback)
+	if fontFallback == nil {
+		return nil
+	}
+	fallbackText = utf16.Encode([]rune{char})
+	var mappedLength uint32
+	var mappedFont *comObject
+	var scale float32
+	hr := fontFallback.call(iDWriteFontFallbackMapCharacters,
+		uintptr(unsafe.Pointer(&textSource)),
+		0,
+		uintptr(len(fallbackText)),
+		0, // system font collection
+		0, // no base family, only the fallbacks
+		DWRITE_FONT_WEIGHT_NORMAL,
+		DWRITE_FONT_STYLE_NORMAL,
+		DWRITE_FONT_STRETCH_NORMAL,
+		uintptr(unsafe.Pointer(&mappedLength)),
+		uintptr(unsafe.Pointer(&mappedFont)),
+		uintptr(unsafe.Pointer(&scale)),
+	)
+	if failed(hr) || mappedFont == nil {
+		return nil
+	}
+	defer mappedFont.release()
+	file := fontFileOf(mappedFont)
+	if file.IsEmpty() {
+		return nil
+	}
+	return []FontFile{file}
+}
@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/draw"
 	"math"
+	"sync"
 
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"golang.org/x/image/font"
@@ -13,9 +14,24 @@ import (
 	"golang.org/x/image/vector"
 )
 
+// Rendered glyphs are kept until the font is freed, so switching between font
+// sizes doesn't render the glyphs again. Glyphs more than this aren't cached.
+const MAX_CACHED_GLYPHS = 4096
+
+type glyphKey struct {
+	char                     rune
+	underline, strikethrough bool
+	size                     common.Vector2[int]
+}
+
 type FaceParams struct {
 	Size, DPI                      float64
 	UseBoxDrawing, UseBlockDrawing bool
+	// In pixels, negative values means use the values from the font
+	UnderlineThickness float64
+	UnderlineOffset    float64 // Distance from baseline to center of the underline
+	// Extra pixels added to the cell height, shared between top and bottom
+	LineSpace int
 }
 
 type Face struct {
@@ -29,9 +45,13 @@ type Face struct {
 	descent int
 	height  int
 	// calculated
-	thickness float32
+	thickness          float32
+	underlineThickness float32
+	underlineOffset    float32
 	// cache
-	imgCache map[common.Vector2[int]]*image.RGBA
+	imgCache   map[common.Vector2[int]]*image.RGBA
+	glyphCache map[glyphKey]*image.RGBA
+	glyphMutex *sync.Mutex // guards glyphCache, warm up fills it in background
 }
 
 // This funtion may return a face previously created and used because it caches
@@ -44,36 +64,135 @@ func (f *Font) CreateFace(params FaceParams) (*Face, error) {
 	if ok {
 		return face, nil
 	} else {
-		face = new(Face)
-		face.useBoxDrawing = params.UseBoxDrawing
-		face.useBlockDrawing = params.UseBlockDrawing
-		var err error
-		face.handle, err = opentype.NewFace(f.handle, &opentype.FaceOptions{
-			Size:    params.Size,
-			DPI:     params.DPI,
-			Hinting: font.HintingFull,
-		})
+		face, err := f.newFace(params)
 		if err != nil {
 			return nil, err
 		}
+		face.glyphCache = make(map[glyphKey]*image.RGBA)
+		face.glyphMutex = new(sync.Mutex)
+		f.faceCache[params] = face
+		return face, nil
+	}
+}
+
+// Creates a face without caching it
+func (f *Font) newFace(params FaceParams) (*Face, error) {
+	face := new(Face)
+	face.useBoxDrawing = params.UseBoxDrawing
+	face.useBlockDrawing = params.UseBlockDrawing
+	var err error
+	face.handle, err = opentype.NewFace(f.handle, &opentype.FaceOptions{
+		Size:    params.Size,
+		DPI:     params.DPI,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		advance, ok := face.handle.GlyphAdvance('m')
-		if !ok {
-			return nil, errors.New("Failed to get font advance!")
+	advance, ok := face.handle.GlyphAdvance('m')
+	if !ok {
+		return nil, errors.New("Failed to get font advance!")
+	}
+	face.advance = advance.Floor()
+
+	face.calcMetrics(params.LineSpace)
+
+	face.thickness = common.Max(float32(math.Ceil(4*(float64(face.height)/12))/4), 1)
+	face.calcUnderline(f, params)
+	face.imgCache = make(map[common.Vector2[int]]*image.RGBA)
+	return face, nil
+}
+
+// Renders the glyphs of the text in background and caches them in the face
+// created with the params, so they are ready when they are first drawn. Uses
+// its own face because faces can't be used from multiple goroutines. Must be
+// called from the goroutine creating the faces.
+func (f *Font) WarmUp(params FaceParams, text string, imgSize common.Vector2[int]) {
+	face, err := f.CreateFace(params)
+	if err != nil {
+		return
+	}
+	worker, err := f.newFace(params)
+	if err != nil {
+		return
+	}
+	go func() {
+		for _, char := range text {
+			key := glyphKey{char: char, size: imgSize}
+			if _, ok := face.cachedGlyph(key); ok {
+				continue
+			}
+			img := worker.renderChar(char, false, false, imgSize)
+			if img != nil && !face.cacheGlyph(key, img) {
+				// Cache is full
+				return
+			}
 		}
-		face.advance = advance.Floor()
+	}()
+}
 
-		metrics := face.handle.Metrics()
-		face.ascent = metrics.Ascent.Ceil()
-		face.descent = metrics.Descent.Floor()
-		face.height = metrics.Height.Floor()
+func (face *Face) cachedGlyph(key glyphKey) (*image.RGBA, bool) {
+	face.glyphMutex.Lock()
+	defer face.glyphMutex.Unlock()
+	img, ok := face.glyphCache[key]
+	return img, ok
+}
 
-		face.thickness = common.Max(float32(math.Ceil(4*(float64(face.height)/12))/4), 1)
-		face.imgCache = make(map[common.Vector2[int]]*image.RGBA)
+// Caches a copy of the image, returns false if the cache is full
+func (face *Face) cacheGlyph(key glyphKey, img *image.RGBA) bool {
+	face.glyphMutex.Lock()
+	defer face.glyphMutex.Unlock()
+	if len(face.glyphCache) >= MAX_CACHED_GLYPHS {
+		return false
+	}
+	if _, ok := face.glyphCache[key]; !ok {
+		cached := image.NewRGBA(img.Rect)
+		copy(cached.Pix, img.Pix)
+		face.glyphCache[key] = cached
+	}
+	return true
+}
 
-		f.faceCache[params] = face
-		return face, nil
+// Calculates cell height and the baseline from ascent, descent and line gap
+// of the font. Ascent and descent are rounded up to not clip the glyphs and
+// the line gap is shared between top and bottom of the cell, this keeps the
+// text vertically centered. Line space is added the same way. After this,
+// descent is the distance between baseline and the bottom of the cell.
+func (face *Face) calcMetrics(lineSpace int) {
+	metrics := face.handle.Metrics()
+	ascent := metrics.Ascent.Ceil()
+	descent := metrics.Descent.Ceil()
+	lineGap := common.Max((metrics.Height - metrics.Ascent - metrics.Descent).Round(), 0)
+	lineGap += common.Max(lineSpace, 0)
+	face.ascent = ascent + (lineGap - lineGap/2)
+	face.descent = descent + lineGap/2
+	face.height = face.ascent + face.descent
+}
+
+// Calculates underline thickness and offset from the post table of the font.
+// Fonts without post table uses the old values, which are same thickness
+// with the other lines and one pixel below the baseline.
+func (face *Face) calcUnderline(f *Font, params FaceParams) {
+	face.underlineThickness = face.thickness
+	face.underlineOffset = 1
+	post := f.handle.PostTable()
+	if post != nil && post.UnderlineThickness > 0 {
+		// Font units to pixels
+		scale := params.Size * params.DPI / 72 / float64(f.handle.UnitsPerEm())
+		face.underlineThickness = common.Max(float32(math.Round(float64(post.UnderlineThickness)*scale)), 1)
+		// Position is the top of the underline and negative values are below the baseline
+		face.underlineOffset = float32(-float64(post.UnderlinePosition)*scale) + face.underlineThickness/2
+	}
+	if params.UnderlineThickness >= 0 {
+		face.underlineThickness = common.Max(float32(params.UnderlineThickness), 1)
 	}
+	if params.UnderlineOffset >= 0 {
+		face.underlineOffset = float32(params.UnderlineOffset)
+	}
+	// Underline must be in the cell
+	maxOffset := float32(face.descent) - face.underlineThickness/2
+	face.underlineOffset = common.Clamp(face.underlineOffset, 0, common.Max(maxOffset, 0))
 }
 
 func (face *Face) ImageSize() common.Vector2[int] {
@@ -85,14 +204,17 @@ func (face *Face) ImageSize() common.Vector2[int] {
 func (face *Face) RenderUndercurl(imgSize common.Vector2[int]) *image.RGBA {
 	w := float32(imgSize.Width())
 	h := float32(imgSize.Height())
-	y := h - float32(face.descent)/2
+	// Curve goes h/16 above and below the y, place top of it to the underline
+	amplitude := h / 16
+	baseline := h - float32(face.descent)
+	y := common.Min(baseline+face.underlineOffset+amplitude, h-amplitude-face.underlineThickness/2)
 	r := vector.NewRasterizer(imgSize.Width(), imgSize.Height())
-	rastCurve(r, face.thickness,
+	rastCurve(r, face.underlineThickness,
 		common.Vec2(0, y),
 		common.Vec2(w/2, y),
 		common.Vec2(w/4, y+h/8),
 	)
-	rastCurve(r, face.thickness,
+	rastCurve(r, face.underlineThickness,
 		common.Vec2(w/2, y),
 		common.Vec2(w, y),
 		common.Vec2(w/4*3, y-h/8),
@@ -142,8 +264,22 @@ func (face *Face) RenderGlyph(char rune, imgSize common.Vector2[int]) *image.RGB
 }
 
 // Renders given char to an RGBA image and returns.
-// Also renders underline and strikethrough if specified.
+// Also renders underline and strikethrough if specified. Returned image must
+// not be modified.
 func (face *Face) RenderChar(char rune, underline, strikethrough bool, imgSize common.Vector2[int]) *image.RGBA {
+	key := glyphKey{char: char, underline: underline, strikethrough: strikethrough, size: imgSize}
+	if img, ok := face.cachedGlyph(key); ok {
+		return img
+	}
+	// Rendered image is reused by the next render, a copy of it is cached
+	img := face.renderChar(char, underline, strikethrough, imgSize)
+	if img != nil && face.cacheGlyph(key, img) {
+		img, _ = face.cachedGlyph(key)
+	}
+	return img
+}
+
+func (face *Face) renderChar(char rune, underline, strikethrough bool, imgSize common.Vector2[int]) *image.RGBA {
 	if face.useBoxDrawing && char >= 0x2500 && char <= 0x257F {
 		// Unicode box drawing characters
 		// https://www.compart.com/en/unicode/block/U+2500
@@ -167,8 +303,8 @@ func (face *Face) RenderChar(char rune, underline, strikethrough bool, imgSize c
 		w := float32(img.Rect.Dx())
 		r := vector.NewRasterizer(img.Rect.Dx(), img.Rect.Dy())
 		if underline {
-			y := float32(imgSize.Height()-face.descent) + 1
-			rastLine(r, common.Vec2(0, y), common.Vec2(w, y), face.thickness)
+			y := float32(imgSize.Height()-face.descent) + face.underlineOffset
+			rastLine(r, common.Vec2(0, y), common.Vec2(w, y), face.underlineThickness)
 		}
 		if strikethrough {
 			y := float32(imgSize.Height()) / 2
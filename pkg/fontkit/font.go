@@ -3,6 +3,8 @@ package fontkit
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/font/sfnt"
@@ -15,12 +17,20 @@ type Font struct {
 	faceCache map[FaceParams]*Face
 }
 
-func CreateFontFromFile(pathToFile string) (*Font, error) {
+// Index is the index of the font in the collection and only used when the
+// file is a font collection (.ttc, .otc)
+func CreateFontFromFile(pathToFile string, index int) (*Font, error) {
 	fileData, err := os.ReadFile(pathToFile)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read file: %s\n", err)
 	}
-	font, err := CreateFontFromMem(fileData)
+	var font *Font
+	switch strings.ToLower(filepath.Ext(pathToFile)) {
+	case ".ttc", ".otc":
+		font, err = CreateFontFromCollection(fileData, index)
+	default:
+		font, err = CreateFontFromMem(fileData)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +38,23 @@ func CreateFontFromFile(pathToFile string) (*Font, error) {
 	return font, nil
 }
 
+func CreateFontFromCollection(data []byte, index int) (*Font, error) {
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse font collection: %s\n", err)
+	}
+	if index < 0 || index >= collection.NumFonts() {
+		return nil, fmt.Errorf("Font index %d out of range, collection has %d fonts\n", index, collection.NumFonts())
+	}
+	font := new(Font)
+	font.handle, err = collection.Font(index)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse font data: %s\n", err)
+	}
+	font.faceCache = make(map[FaceParams]*Face)
+	return font, nil
+}
+
 func CreateFontFromMem(data []byte) (*Font, error) {
 	font := new(Font)
 	var err error
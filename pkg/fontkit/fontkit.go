@@ -2,6 +2,7 @@ package fontkit
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/hismailbulut/Neoray/pkg/fontfinder"
 )
@@ -9,6 +10,9 @@ import (
 var (
 	// Private
 	defaultFontKit *FontKit
+	// Fonts chosen by the system for the characters, nil if failed to load
+	fallbackCache      = make(map[fontfinder.FontFile]*Font)
+	fallbackCacheGuard sync.Mutex
 )
 
 // FontKit is a struct that holds different styles of same font family
@@ -22,33 +26,33 @@ type FontKit struct {
 
 func CreateKit(fontname string) (*FontKit, error) {
 	info := fontfinder.Find(fontname)
-	if info.Regular == "" && info.Bold == "" && info.Italic == "" && info.BoldItalic == "" {
+	if info.Regular.IsEmpty() && info.Bold.IsEmpty() && info.Italic.IsEmpty() && info.BoldItalic.IsEmpty() {
 		// This means we could not find any font file with this name
 		return nil, fmt.Errorf("Couldn't find font %s", fontname)
 	}
 	fontkit := new(FontKit)
 	// Load fonts
 	var err error
-	if info.Regular != "" {
-		fontkit.regular, err = CreateFontFromFile(info.Regular)
+	if !info.Regular.IsEmpty() {
+		fontkit.regular, err = CreateFontFromFile(info.Regular.Path, info.Regular.Index)
 		if err != nil {
 			return nil, err
 		}
 	}
-	if info.Bold != "" {
-		fontkit.bold, err = CreateFontFromFile(info.Bold)
+	if !info.Bold.IsEmpty() {
+		fontkit.bold, err = CreateFontFromFile(info.Bold.Path, info.Bold.Index)
 		if err != nil {
 			return nil, err
 		}
 	}
-	if info.Italic != "" {
-		fontkit.italic, err = CreateFontFromFile(info.Italic)
+	if !info.Italic.IsEmpty() {
+		fontkit.italic, err = CreateFontFromFile(info.Italic.Path, info.Italic.Index)
 		if err != nil {
 			return nil, err
 		}
 	}
-	if info.BoldItalic != "" {
-		fontkit.boldItalic, err = CreateFontFromFile(info.BoldItalic)
+	if !info.BoldItalic.IsEmpty() {
+		fontkit.boldItalic, err = CreateFontFromFile(info.BoldItalic.Path, info.BoldItalic.Index)
 		if err != nil {
 			return nil, err
 		}
@@ -77,6 +81,28 @@ func Default() *FontKit {
 	return defaultFontKit
 }
 
+// Returns the font the system chooses for the character, nil if the system
+// doesn't have a font with this glyph. Fonts are loaded once.
+func FallbackFor(char rune) *Font {
+	for _, file := range fontfinder.FallbacksFor(char) {
+		fallbackCacheGuard.Lock()
+		font, ok := fallbackCache[file]
+		if !ok {
+			var err error
+			font, err = CreateFontFromFile(file.Path, file.Index)
+			if err != nil {
+				font = nil
+			}
+			fallbackCache[file] = font
+		}
+		fallbackCacheGuard.Unlock()
+		if font != nil && font.ContainsGlyph(char) {
+			return font
+		}
+	}
+	return nil
+}
+
 func (fontkit *FontKit) Regular() *Font {
 	return fontkit.regular
 }
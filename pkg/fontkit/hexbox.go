@@ -0,0 +1,90 @@
+package fontkit
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+)
+
+// 3x5 bitmaps of the hexadecimal digits, every row is 3 bits
+var hexDigitBitmaps = [16][5]uint8{
+	{7, 5, 5, 5, 7}, // 0
+	{2, 6, 2, 2, 7}, // 1
+	{7, 1, 7, 4, 7}, // 2
+	{7, 1, 7, 1, 7}, // 3
+	{5, 5, 7, 1, 1}, // 4
+	{7, 4, 7, 1, 7}, // 5
+	{7, 4, 7, 5, 7}, // 6
+	{7, 1, 1, 1, 1}, // 7
+	{7, 5, 7, 5, 7}, // 8
+	{7, 5, 7, 1, 7}, // 9
+	{7, 5, 7, 5, 5}, // A
+	{6, 5, 6, 5, 6}, // B
+	{7, 4, 4, 4, 7}, // C
+	{6, 5, 5, 5, 6}, // D
+	{7, 4, 7, 4, 7}, // E
+	{7, 4, 7, 4, 4}, // F
+}
+
+// Renders a box with the codepoint of the char written in hexadecimal inside
+// it, like terminals do for the glyphs that no font has. Codepoints in the
+// basic multilingual plane uses 2 rows of 2 digits, others 2 rows of 3 digits.
+func (face *Face) RenderHexBox(char rune, imgSize common.Vector2[int]) *image.RGBA {
+	img := face.cachedImage(imgSize)
+	w := imgSize.Width()
+	h := imgSize.Height()
+	digits := fmt.Sprintf("%04X", char)
+	cols := 2
+	if len(digits) > 4 {
+		digits = fmt.Sprintf("%06X", char)
+		cols = 3
+	}
+	// Every digit is 3x5 and there is one pixel space between them
+	// 2 pixels for the border and 1 pixel space between border and digits
+	scale := common.Max(common.Min((w-6)/(cols*4-1), (h-6)/11), 1)
+	textW := (cols*4 - 1) * scale
+	textH := 11 * scale
+	// Center the box in the cell
+	boxW := common.Min(textW+6, w)
+	boxH := common.Min(textH+6, h)
+	boxX := (w - boxW) / 2
+	boxY := (h - boxH) / 2
+	white := color.RGBA{255, 255, 255, 255}
+	for x := boxX; x < boxX+boxW; x++ {
+		img.SetRGBA(x, boxY, white)
+		img.SetRGBA(x, boxY+boxH-1, white)
+	}
+	for y := boxY; y < boxY+boxH; y++ {
+		img.SetRGBA(boxX, y, white)
+		img.SetRGBA(boxX+boxW-1, y, white)
+	}
+	// Draw digits
+	textX := boxX + (boxW-textW)/2
+	textY := boxY + (boxH-textH)/2
+	for i, digit := range digits {
+		var value int
+		if digit >= 'A' {
+			value = int(digit-'A') + 10
+		} else {
+			value = int(digit - '0')
+		}
+		bitmap := hexDigitBitmaps[value]
+		originX := textX + (i%cols)*4*scale
+		originY := textY + (i/cols)*6*scale
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if bitmap[row]&(4>>col) == 0 {
+					continue
+				}
+				for py := 0; py < scale; py++ {
+					for px := 0; px < scale; px++ {
+						img.SetRGBA(originX+col*scale+px, originY+row*scale+py, white)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,223 @@
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Linear sRGB to XYZ matrix, chromatically adapted to D50 (Bradford) because
+// ICC profile connection space is always D50.
+var srgbToXYZ = Matrix{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+type Matrix [3][3]float64
+
+func (m Matrix) Mul(o Matrix) Matrix {
+	var r Matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i][j] += m[i][k] * o[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Returns false if the matrix is not invertible
+func (m Matrix) Inverse() (Matrix, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-9 {
+		return Matrix{}, false
+	}
+	inv := Matrix{
+		{m[1][1]*m[2][2] - m[1][2]*m[2][1], m[0][2]*m[2][1] - m[0][1]*m[2][2], m[0][1]*m[1][2] - m[0][2]*m[1][1]},
+		{m[1][2]*m[2][0] - m[1][0]*m[2][2], m[0][0]*m[2][2] - m[0][2]*m[2][0], m[0][2]*m[1][0] - m[0][0]*m[1][2]},
+		{m[1][0]*m[2][1] - m[1][1]*m[2][0], m[0][1]*m[2][0] - m[0][0]*m[2][1], m[0][0]*m[1][1] - m[0][1]*m[1][0]},
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			inv[i][j] /= det
+		}
+	}
+	return inv, true
+}
+
+// Matrix/TRC based RGB display profile. Lookup table based profiles are not
+// supported, most of the display profiles have the matrix tags anyway.
+type Profile struct {
+	// Columns are the XYZ values of the red, green and blue primaries
+	ToXYZ Matrix
+	// Tone response curves of the channels approximated as gamma
+	Gamma [3]float64
+}
+
+func Load(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("not an icc profile")
+	}
+	if string(data[16:20]) != "RGB " {
+		return nil, fmt.Errorf("unsupported color space %q", data[16:20])
+	}
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:132]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, errors.New("tag table is truncated")
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, errors.New("tag is out of bounds")
+		}
+		tags[string(data[entry:entry+4])] = data[offset : offset+size]
+	}
+	profile := new(Profile)
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseXYZ(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sig, err)
+		}
+		for j := 0; j < 3; j++ {
+			profile.ToXYZ[j][i] = xyz[j]
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseCurve(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sig, err)
+		}
+		profile.Gamma[i] = fitGamma(curve)
+	}
+	return profile, nil
+}
+
+// Returns the matrix converts linear sRGB colors to the linear colors of the
+// display.
+func (profile *Profile) FromSRGB() (Matrix, bool) {
+	inv, ok := profile.ToXYZ.Inverse()
+	if !ok {
+		return Matrix{}, false
+	}
+	return inv.Mul(srgbToXYZ), true
+}
+
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+func parseXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, errors.New("invalid XYZ tag")
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+// Returns the tone response curve as a function
+func parseCurve(tag []byte) (func(x float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("invalid curve tag")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+count*2 {
+			return nil, errors.New("curve is truncated")
+		}
+		switch count {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(count-1)
+			i := int(pos)
+			if i >= count-1 {
+				return table[count-1]
+			}
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+	case "para":
+		// Parameter counts of the function types
+		counts := []int{1, 3, 4, 5, 7}
+		typ := int(binary.BigEndian.Uint16(tag[8:]))
+		if typ >= len(counts) || len(tag) < 12+counts[typ]*4 {
+			return nil, errors.New("invalid parametric curve")
+		}
+		var p [7]float64
+		for i := 0; i < counts[typ]; i++ {
+			p[i] = s15Fixed16(tag[12+i*4:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		return func(x float64) float64 {
+			switch typ {
+			case 0:
+				return math.Pow(x, g)
+			case 1:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g)
+				}
+				return 0
+			case 2:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g) + c
+				}
+				return c
+			case 3:
+				if x >= d {
+					return math.Pow(a*x+b, g)
+				}
+				return c * x
+			default:
+				if x >= d {
+					return math.Pow(a*x+b, g) + e
+				}
+				return c*x + f
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported curve type %q", tag[:4])
+}
+
+// Finds the gamma value closest to the curve, shader uses a simple power
+// function instead of the curve itself.
+func fitGamma(curve func(x float64) float64) float64 {
+	sum := 0.0
+	samples := 0
+	for i := 1; i < 16; i++ {
+		x := float64(i) / 16
+		y := curve(x)
+		if y <= 0 || y >= 1 {
+			continue
+		}
+		sum += math.Log(y) / math.Log(x)
+		samples++
+	}
+	if samples == 0 {
+		return 1
+	}
+	return sum / float64(samples)
+}
@@ -1,6 +1,10 @@
 package logger
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type BuildType uint8
 
@@ -29,6 +33,34 @@ func (version Version) String() string {
 	return fmt.Sprintf("v%d.%d.%d", version.Major, version.Minor, version.Patch)
 }
 
+// Parses versions like v0.2.5 or 0.2.5
+func ParseVersion(str string) (Version, error) {
+	parts := strings.Split(strings.TrimPrefix(str, "v"), ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %s", str)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %s", str)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// Returns true if the version is older than other
+func (version Version) Less(other Version) bool {
+	if version.Major != other.Major {
+		return version.Major < other.Major
+	}
+	if version.Minor != other.Minor {
+		return version.Minor < other.Minor
+	}
+	return version.Patch < other.Patch
+}
+
 type AnsiTermColor string
 
 const (
@@ -9,37 +9,14 @@ import (
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/logger"
 	"github.com/hismailbulut/Neoray/pkg/opengl/gl"
+	"github.com/hismailbulut/Neoray/pkg/render"
 )
 
 var boundVertexArrayId uint32 // vao id
 
-type Vertex struct {
-	// position of this vertex
-	Pos common.Rectangle[float32] // layout 0
-	// texture position
-	Tex1 common.Rectangle[float32] // layout 1
-	// second texture position used for multiwidth characters
-	Tex2 common.Rectangle[float32] // layout 2
-	// foreground color
-	Fg common.Color // layout 3
-	// background color
-	Bg common.Color // layout 4
-	// special color
-	Sp common.Color // layout 5
-}
-
-func (vertex Vertex) String() string {
-	return fmt.Sprintf("Vertex(pos: %v, tex1: %v, tex2: %v, fg: %v, bg: %v, sp: %v)",
-		vertex.Pos,
-		vertex.Tex1,
-		vertex.Tex2,
-		vertex.Fg,
-		vertex.Bg,
-		vertex.Sp,
-	)
-}
+type Vertex = render.Vertex
 
-const sizeof_Vertex = int32(unsafe.Sizeof(Vertex{})) // 96 bytes
+const sizeof_Vertex = int32(unsafe.Sizeof(Vertex{})) // 104 bytes
 
 type VertexBuffer struct {
 	shader      *ShaderProgram
@@ -47,6 +24,9 @@ type VertexBuffer struct {
 	vboid       uint32
 	updatedSize int      // Last buffer size updated to GPU
 	data        []Vertex // Current buffer in memory (len(data) gives capacity)
+	// Only the changed rows are uploaded to GPU, a row is rowSize vertices
+	rowSize int
+	dirty   []bool
 }
 
 func (buffer *VertexBuffer) String() string {
@@ -58,7 +38,7 @@ func (buffer *VertexBuffer) String() string {
 	)
 }
 
-func (context *Context) CreateVertexBuffer(size int) *VertexBuffer {
+func (context *Context) CreateVertexBuffer(size int) render.VertexBuffer {
 	if size <= 0 {
 		panic("vertex buffer size must bigger then zero")
 	}
@@ -88,6 +68,7 @@ func (context *Context) CreateVertexBuffer(size int) *VertexBuffer {
 	}
 	// Create buffer in memory
 	buffer.data = make([]Vertex, size)
+	buffer.SetRowSize(size)
 	logger.Log(logger.DEBUG, "Buffer created:", buffer)
 	return buffer
 }
@@ -114,6 +95,25 @@ func (buffer *VertexBuffer) Resize(size int) {
 		remaining := size - len(buffer.data)
 		buffer.data = append(buffer.data, make([]Vertex, remaining)...)
 	}
+	buffer.SetRowSize(buffer.rowSize)
+}
+
+// Sets the number of vertices in a row, whole buffer is marked as dirty
+func (buffer *VertexBuffer) SetRowSize(rowSize int) {
+	buffer.rowSize = common.Clamp(rowSize, 1, len(buffer.data))
+	rows := (len(buffer.data) + buffer.rowSize - 1) / buffer.rowSize
+	if cap(buffer.dirty) >= rows {
+		buffer.dirty = buffer.dirty[:rows]
+	} else {
+		buffer.dirty = make([]bool, rows)
+	}
+	for i := range buffer.dirty {
+		buffer.dirty[i] = true
+	}
+}
+
+func (buffer *VertexBuffer) markDirty(index int) {
+	buffer.dirty[index/buffer.rowSize] = true
 }
 
 // OpenGL Specific functions
@@ -142,9 +142,26 @@ func (buffer *VertexBuffer) Update() {
 		gl.BufferData(gl.ARRAY_BUFFER, len(buffer.data)*int(sizeof_Vertex), unsafe.Pointer(&buffer.data[0]), gl.DYNAMIC_DRAW)
 		checkGLError()
 		buffer.updatedSize = len(buffer.data)
-	} else {
-		gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(buffer.data)*int(sizeof_Vertex), unsafe.Pointer(&buffer.data[0]))
+		for i := range buffer.dirty {
+			buffer.dirty[i] = false
+		}
+		return
+	}
+	// Consecutive dirty rows are uploaded together
+	for row := 0; row < len(buffer.dirty); row++ {
+		if !buffer.dirty[row] {
+			continue
+		}
+		end := row
+		for end < len(buffer.dirty) && buffer.dirty[end] {
+			buffer.dirty[end] = false
+			end++
+		}
+		begin := row * buffer.rowSize
+		size := common.Min(end*buffer.rowSize, len(buffer.data)) - begin
+		gl.BufferSubData(gl.ARRAY_BUFFER, begin*int(sizeof_Vertex), size*int(sizeof_Vertex), unsafe.Pointer(&buffer.data[begin]))
 		checkGLError()
+		row = end
 	}
 }
 
@@ -175,14 +192,41 @@ func orthoProjection(top, left, right, bottom, near, far float32) [16]float32 {
 }
 
 func (buffer *VertexBuffer) SetProjection(rect common.Rectangle[float32]) {
-	projection := orthoProjection(rect.X, rect.Y, rect.W, rect.H, -1, 1)
+	projection := orthoProjection(rect.Y, rect.X, rect.X+rect.W, rect.Y+rect.H, -1, 1)
 	loc := buffer.shader.UniformLocation("projection")
 	gl.UniformMatrix4fv(loc, 1, true, &projection[0])
 }
 
-func (buffer *VertexBuffer) SetUndercurlRect(rect common.Rectangle[float32]) {
+func (buffer *VertexBuffer) SetUndercurlRect(rect common.Rectangle[float32], layer int) {
 	loc := buffer.shader.UniformLocation("undercurlRect")
 	gl.Uniform4f(loc, rect.X, rect.Y, rect.W, rect.H)
+	loc = buffer.shader.UniformLocation("undercurlLayer")
+	gl.Uniform1f(loc, float32(layer))
+}
+
+// Foreground colors are adjusted in the shader to keep the contrast between
+// foreground and background at least ratio. 1 disables it.
+func (buffer *VertexBuffer) SetMinContrast(ratio float32) {
+	loc := buffer.shader.UniformLocation("minContrast")
+	gl.Uniform1f(loc, ratio)
+}
+
+// Backgrounds with negative alpha values will be drawn with this alpha
+func (buffer *VertexBuffer) SetBackgroundAlpha(alpha float32) {
+	loc := buffer.shader.UniformLocation("backgroundAlpha")
+	gl.Uniform1f(loc, alpha)
+}
+
+// Final alpha of every pixel is multiplied with opacity
+func (buffer *VertexBuffer) SetOpacity(opacity float32) {
+	loc := buffer.shader.UniformLocation("opacity")
+	gl.Uniform1f(loc, opacity)
+}
+
+// Moves every vertex by offset pixels
+func (buffer *VertexBuffer) SetOffset(offset common.Vector2[float32]) {
+	loc := buffer.shader.UniformLocation("offset")
+	gl.Uniform2f(loc, offset.X, offset.Y)
 }
 
 func (buffer *VertexBuffer) Destroy() {
@@ -198,26 +242,34 @@ func (buffer *VertexBuffer) Destroy() {
 
 func (buffer *VertexBuffer) SetIndexPos(index int, pos common.Rectangle[float32]) {
 	buffer.data[index].Pos = pos
+	buffer.markDirty(index)
 }
 
-func (buffer *VertexBuffer) SetIndexTex1(index int, tex1 common.Rectangle[float32]) {
+func (buffer *VertexBuffer) SetIndexTex1(index int, tex1 common.Rectangle[float32], layer int) {
 	buffer.data[index].Tex1 = tex1
+	buffer.data[index].Layers.X = float32(layer)
+	buffer.markDirty(index)
 }
 
-func (buffer *VertexBuffer) SetIndexTex2(index int, tex2 common.Rectangle[float32]) {
+func (buffer *VertexBuffer) SetIndexTex2(index int, tex2 common.Rectangle[float32], layer int) {
 	buffer.data[index].Tex2 = tex2
+	buffer.data[index].Layers.Y = float32(layer)
+	buffer.markDirty(index)
 }
 
 func (buffer *VertexBuffer) SetIndexFg(index int, fg common.Color) {
 	buffer.data[index].Fg = fg
+	buffer.markDirty(index)
 }
 
 func (buffer *VertexBuffer) SetIndexBg(index int, bg common.Color) {
 	buffer.data[index].Bg = bg
+	buffer.markDirty(index)
 }
 
 func (buffer *VertexBuffer) SetIndexSp(index int, sp common.Color) {
 	buffer.data[index].Sp = sp
+	buffer.markDirty(index)
 }
 
 func (buffer *VertexBuffer) CopyButPos(dst, src int) {
@@ -226,6 +278,8 @@ func (buffer *VertexBuffer) CopyButPos(dst, src int) {
 	buffer.data[dst].Fg = buffer.data[src].Fg
 	buffer.data[dst].Bg = buffer.data[src].Bg
 	buffer.data[dst].Sp = buffer.data[src].Sp
+	buffer.data[dst].Layers = buffer.data[src].Layers
+	buffer.markDirty(dst)
 }
 
 func (buffer *VertexBuffer) VertexAt(index int) Vertex {
@@ -3,25 +3,22 @@ package opengl
 import (
 	_ "embed"
 	"fmt"
+	"image"
 	"unsafe"
 
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/opengl/gl"
+	"github.com/hismailbulut/Neoray/pkg/render"
 )
 
-type ContextInfo struct {
-	Version                string
-	Vendor                 string
-	Renderer               string
-	ShadingLanguageVersion string
-	MaxTextureSize         int32
-}
-
+// Context is the OpenGL 3.3 implementation of the renderer
 type Context struct {
 	shader      *ShaderProgram // default shader for monospaced font rendering
 	framebuffer uint32         // only for clearing textures
 }
 
+var _ render.Renderer = (*Context)(nil)
+
 // Call per window
 func New(getProcAddress func(name string) unsafe.Pointer) (*Context, error) {
 	// Initialize opengl
@@ -43,6 +40,9 @@ func New(getProcAddress func(name string) unsafe.Pointer) (*Context, error) {
 	frag.Delete()
 	// TODO: When we start using multiple shaders this line will be deleted
 	context.shader.Use()
+	// Grids are fully opaque unless they are animating
+	gl.Uniform1f(context.shader.UniformLocation("opacity"), 1)
+	checkGLError()
 
 	// Create framebuffer object
 	// We dont need to bind framebuffer because we need it only when clearing texture
@@ -52,14 +52,15 @@ func New(getProcAddress func(name string) unsafe.Pointer) (*Context, error) {
 	return context, nil
 }
 
-func (context *Context) Info() ContextInfo {
-	info := ContextInfo{
+func (context *Context) Info() render.Info {
+	info := render.Info{
 		Version:                gl.GoStr(gl.GetString(gl.VERSION)),
 		Vendor:                 gl.GoStr(gl.GetString(gl.VENDOR)),
 		Renderer:               gl.GoStr(gl.GetString(gl.RENDERER)),
 		ShadingLanguageVersion: gl.GoStr(gl.GetString(gl.SHADING_LANGUAGE_VERSION)),
 	}
 	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &info.MaxTextureSize)
+	gl.GetIntegerv(gl.MAX_ARRAY_TEXTURE_LAYERS, &info.MaxArrayTextureLayers)
 	return info
 }
 
@@ -68,6 +69,41 @@ func (context *Context) SetViewport(rect common.Rectangle[int]) {
 	checkGLError()
 }
 
+// Colors are converted from sRGB to the colors of the display in the shader.
+// Matrix converts linear colors and gamma is the tone response of the display.
+func (context *Context) SetColorTransform(matrix [3][3]float32, gamma [3]float32) {
+	transform := [16]float32{
+		matrix[0][0], matrix[0][1], matrix[0][2], 0,
+		matrix[1][0], matrix[1][1], matrix[1][2], 0,
+		matrix[2][0], matrix[2][1], matrix[2][2], 0,
+		0, 0, 0, 1,
+	}
+	context.shader.Use()
+	gl.UniformMatrix4fv(context.shader.UniformLocation("colorTransform"), 1, true, &transform[0])
+	// Last component enables the transform
+	gl.Uniform4f(context.shader.UniformLocation("displayGamma"), gamma[0], gamma[1], gamma[2], 1)
+	checkGLError()
+}
+
+func (context *Context) DisableColorTransform() {
+	context.shader.Use()
+	gl.Uniform4f(context.shader.UniformLocation("displayGamma"), 1, 1, 1, 0)
+	checkGLError()
+}
+
+// Limits clearing and rendering to the rectangle. Rectangle is in opengl
+// coordinates, starts from bottom left corner.
+func (context *Context) SetScissor(rect common.Rectangle[int]) {
+	gl.Enable(gl.SCISSOR_TEST)
+	gl.Scissor(int32(rect.X), int32(rect.Y), int32(rect.W), int32(rect.H))
+	checkGLError()
+}
+
+func (context *Context) DisableScissor() {
+	gl.Disable(gl.SCISSOR_TEST)
+	checkGLError()
+}
+
 func (context *Context) ClearScreen(c common.Color) {
 	gl.ClearColor(c.R, c.G, c.B, c.A)
 	checkGLError()
@@ -75,8 +111,41 @@ func (context *Context) ClearScreen(c common.Color) {
 	checkGLError()
 }
 
+// Blending is only enabled when rendering translucent grids, otherwise every
+// grid replaces the pixels behind it.
+func (context *Context) SetBlending(enable bool) {
+	if enable {
+		gl.Enable(gl.BLEND)
+		gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ONE, gl.ONE_MINUS_SRC_ALPHA)
+	} else {
+		gl.Disable(gl.BLEND)
+	}
+	checkGLError()
+}
+
+// Reads the pixels of the rectangle from the screen. The image is flipped
+// vertically because opengl starts from the bottom left corner.
+func (context *Context) ReadPixels(rect common.Rectangle[int]) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, rect.W, rect.H))
+	if rect.W <= 0 || rect.H <= 0 {
+		return img
+	}
+	gl.ReadPixels(int32(rect.X), int32(rect.Y), int32(rect.W), int32(rect.H), gl.RGBA, gl.UNSIGNED_BYTE, unsafe.Pointer(&img.Pix[0]))
+	checkGLError()
+	// Flip
+	row := make([]byte, img.Stride)
+	for y := 0; y < rect.H/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(rect.H-y-1)*img.Stride : (rect.H-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+	return img
+}
+
 func (context *Context) Flush() {
-	// Since we are not using doublebuffering, we don't need to swap buffers, but we need to flush.
+	// Single buffered windows don't swap buffers, but we need to flush.
 	gl.Flush()
 	checkGLError()
 }
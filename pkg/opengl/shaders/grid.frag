@@ -2,21 +2,76 @@
 layout(location = 0) out vec4 outFragColor;
 
 in GS_OUT {
-	vec2 tex1pos;
-	vec2 tex2pos;
-	vec2 ucPos;
+	vec3 tex1pos;
+	vec3 tex2pos;
+	vec3 ucPos;
 	vec4 fgColor;
 	vec4 bgColor;
 	vec4 spColor;
 } fs_in;
 
-uniform sampler2D atlas;
+uniform sampler2DArray atlas;
+uniform float minContrast; // 1 means disabled
+uniform float backgroundAlpha; // used for default backgrounds
+uniform float opacity; // used for animations
+uniform mat4 colorTransform; // linear sRGB to linear display colors
+uniform vec4 displayGamma; // w is zero when color management is disabled
+
+// Converts sRGB color to linear
+vec3 linear(vec3 c) {
+	return mix(c / 12.92, pow((c + 0.055) / 1.055, vec3(2.4)), step(0.04045, c));
+}
+
+// Relative luminance of the color
+float luminance(vec3 c) {
+	return dot(linear(c), vec3(0.2126, 0.7152, 0.0722));
+}
+
+float contrast(vec3 a, vec3 b) {
+	float la = luminance(a);
+	float lb = luminance(b);
+	return (max(la, lb) + 0.05) / (min(la, lb) + 0.05);
+}
+
+// Moves the foreground color to black or white until the contrast between
+// foreground and background is greater than minContrast
+vec3 ensureContrast(vec3 fg, vec3 bg) {
+	if (contrast(fg, bg) >= minContrast) {
+		return fg;
+	}
+	// Choose the direction which has more contrast
+	vec3 target = contrast(vec3(1), bg) > contrast(vec3(0), bg) ? vec3(1) : vec3(0);
+	float lo = 0;
+	float hi = 1;
+	for (int i = 0; i < 8; i++) {
+		float t = (lo + hi) / 2;
+		if (contrast(mix(fg, target, t), bg) >= minContrast) {
+			hi = t;
+		} else {
+			lo = t;
+		}
+	}
+	return mix(fg, target, hi);
+}
 
 void main() {
+	vec4 fgColor = fs_in.fgColor;
+	vec4 bgColor = fs_in.bgColor;
+	if (bgColor.a < 0) {
+		bgColor.a = backgroundAlpha;
+	}
+	if (minContrast > 1 && fgColor.a > 0) {
+		fgColor.rgb = ensureContrast(fgColor.rgb, bgColor.rgb);
+	}
 	vec4 tex1    = texture(atlas, fs_in.tex1pos);
-	vec4 fg      = mix(tex1, fs_in.fgColor, fs_in.fgColor.a);           // Use texture color if fg.A < 1
+	vec4 fg      = mix(tex1, fgColor, fgColor.a);                       // Use texture color if fg.A < 1
 	float texA   = max(tex1.a, texture(atlas, fs_in.tex2pos).a);        // Use both of textures
 	float ucA    = min(texture(atlas, fs_in.ucPos).a, fs_in.spColor.a); // If sp.A == 0 we don't draw undercurl
-	vec4 result  = mix(fs_in.bgColor, fg, texA);                        // Draw foreground over background
+	vec4 result  = mix(bgColor, fg, texA);                              // Draw foreground over background
 	outFragColor = mix(result, fs_in.spColor, ucA);                     // Draw special over result color
+	outFragColor.a *= opacity;
+	if (displayGamma.w > 0) {
+		vec3 display = (colorTransform * vec4(linear(outFragColor.rgb), 0)).rgb;
+		outFragColor.rgb = pow(clamp(display, 0, 1), 1 / displayGamma.rgb);
+	}
 }
@@ -5,14 +5,18 @@ layout(location = 2) in vec4 tex2;
 layout(location = 3) in vec4 fg;
 layout(location = 4) in vec4 bg;
 layout(location = 5) in vec4 sp;
+layout(location = 6) in vec2 layers;
 
 uniform mat4 projection;
 uniform vec4 undercurlRect;
+uniform float undercurlLayer;
+uniform vec2 offset;
 
 out VS_OUT {
 	vec4 tex1pos;
 	vec4 tex2pos;
 	vec4 ucPos;
+	vec3 layers;
 	mat4 projection;
 	vec4 fgColor;
 	vec4 bgColor;
@@ -20,10 +24,11 @@ out VS_OUT {
 } vs_out;
 
 void main() {
-	gl_Position       = pos;
+	gl_Position       = vec4(pos.xy + offset, pos.zw);
 	vs_out.tex1pos    = tex1;
 	vs_out.tex2pos    = tex2;
 	vs_out.ucPos      = undercurlRect;
+	vs_out.layers     = vec3(layers, undercurlLayer);
 	vs_out.projection = projection;
 	vs_out.fgColor    = fg;
 	vs_out.bgColor    = bg;
@@ -8,65 +8,125 @@ import (
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/logger"
 	"github.com/hismailbulut/Neoray/pkg/opengl/gl"
+	"github.com/hismailbulut/Neoray/pkg/render"
 )
 
 var boundTextureId uint32
 
+// All textures are 2d array textures. A texture with a single layer behaves
+// like a normal 2d texture and the atlas uses multiple layers as pages.
 type Texture struct {
 	id     uint32
 	width  int
 	height int
+	layers int
 	fbo    uint32 // this is like pointer to the framebuffer because framebuffer is in gpu memory
 }
 
-func (texture Texture) String() string {
-	return fmt.Sprintf("Texture(ID: %d, Width: %d, Height: %d)", texture.id, texture.width, texture.height)
+func (texture *Texture) String() string {
+	return fmt.Sprintf("Texture(ID: %d, Width: %d, Height: %d, Layers: %d)", texture.id, texture.width, texture.height, texture.layers)
 }
 
-func (context *Context) CreateTexture(width, height int) Texture {
-	texture := Texture{
-		fbo: context.framebuffer,
+func (context *Context) CreateTexture(width, height int) render.Texture {
+	texture := &Texture{
+		layers: 1,
+		fbo:    context.framebuffer,
 	}
+	texture.id = genTexture()
+	texture.Resize(width, height)
+	logger.Log(logger.DEBUG, "Texture created:", texture)
+	return texture
+}
+
+// Generates and binds a new texture
+func genTexture() uint32 {
+	var id uint32
 	// NOTE: There can be multiple textures but only one can bind at a time
-	gl.GenTextures(1, &texture.id)
+	gl.GenTextures(1, &id)
 	checkGLError()
-	gl.BindTexture(gl.TEXTURE_2D, texture.id)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, id)
 	checkGLError()
-	boundTextureId = texture.id
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	boundTextureId = id
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	checkGLError()
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	checkGLError()
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
 	checkGLError()
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 	checkGLError()
-	texture.Resize(width, height)
-	logger.Log(logger.DEBUG, "Texture created:", texture)
-	return texture
+	return id
 }
 
 func (texture *Texture) Size() common.Vector2[int] {
 	return common.Vec2(texture.width, texture.height)
 }
 
+func (texture *Texture) Layers() int {
+	return texture.layers
+}
+
 // Texture must bound before resizing
+// Resizing keeps the layer count but clears the content of all layers
 func (texture *Texture) Resize(width, height int) {
 	if boundTextureId != texture.id {
 		panic("texture must be bound before resize")
 	}
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, int32(width), int32(height), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, gl.RGBA8, int32(width), int32(height), int32(texture.layers), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
 	checkGLError()
 	texture.width = width
 	texture.height = height
 }
 
+// Adds count layers to the texture. Unlike Resize, the content of the
+// existing layers are preserved and new layers are cleared. Texture id changes
+// after this call and the texture will be bound.
+func (texture *Texture) AddLayers(count int) {
+	if count <= 0 {
+		return
+	}
+	oldId := texture.id
+	oldLayers := texture.layers
+	texture.id = genTexture()
+	texture.layers += count
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, gl.RGBA8, int32(texture.width), int32(texture.height), int32(texture.layers), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	checkGLError()
+	// Copy old layers to the new texture
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, texture.fbo)
+	checkGLError()
+	for layer := 0; layer < oldLayers; layer++ {
+		gl.FramebufferTextureLayer(gl.READ_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, oldId, 0, int32(layer))
+		checkGLError()
+		fbo_status := gl.CheckFramebufferStatus(gl.READ_FRAMEBUFFER)
+		if fbo_status != gl.FRAMEBUFFER_COMPLETE {
+			panic(fmt.Errorf("Framebuffer is not complete: %d", fbo_status))
+		}
+		gl.CopyTexSubImage3D(gl.TEXTURE_2D_ARRAY, 0, 0, 0, int32(layer), 0, 0, int32(texture.width), int32(texture.height))
+		checkGLError()
+	}
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	checkGLError()
+	// Clear new layers
+	for layer := oldLayers; layer < texture.layers; layer++ {
+		texture.clearLayer(layer)
+	}
+	gl.DeleteTextures(1, &oldId)
+	checkGLError()
+	logger.Log(logger.DEBUG, "Texture layers added:", texture)
+}
+
 func (texture *Texture) Clear() {
+	for layer := 0; layer < texture.layers; layer++ {
+		texture.clearLayer(layer)
+	}
+}
+
+func (texture *Texture) clearLayer(layer int) {
 	// Bind framebuffer
 	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, texture.fbo)
 	checkGLError()
-	// Init framebuffer with texture
-	gl.FramebufferTexture2D(gl.DRAW_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, texture.id, 0)
+	// Init framebuffer with texture layer
+	gl.FramebufferTextureLayer(gl.DRAW_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, texture.id, 0, int32(layer))
 	checkGLError()
 	// Check if the framebuffer is complete and ready for draw
 	fbo_status := gl.CheckFramebufferStatus(gl.DRAW_FRAMEBUFFER)
@@ -88,17 +148,20 @@ func (texture *Texture) Bind() {
 	if boundTextureId == texture.id {
 		return
 	}
-	gl.BindTexture(gl.TEXTURE_2D, texture.id)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, texture.id)
 	checkGLError()
 	boundTextureId = texture.id
 }
 
 // Texture must bound before drawing
-func (texture *Texture) Draw(image *image.RGBA, dest common.Rectangle[int]) {
+func (texture *Texture) Draw(image *image.RGBA, dest common.Rectangle[int], layer int) {
 	if boundTextureId != texture.id {
-		panic("texture must be bound before resize")
+		panic("texture must be bound before draw")
+	}
+	if layer < 0 || layer >= texture.layers {
+		panic(fmt.Errorf("texture layer %d out of range", layer))
 	}
-	gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(dest.X), int32(dest.Y), int32(dest.W), int32(dest.H), gl.RGBA, gl.UNSIGNED_BYTE, unsafe.Pointer(&image.Pix[0]))
+	gl.TexSubImage3D(gl.TEXTURE_2D_ARRAY, 0, int32(dest.X), int32(dest.Y), int32(layer), int32(dest.W), int32(dest.H), 1, gl.RGBA, gl.UNSIGNED_BYTE, unsafe.Pointer(&image.Pix[0]))
 	checkGLError()
 }
 
@@ -117,6 +180,7 @@ func (texture *Texture) Delete() {
 	texture.id = 0
 	texture.width = 0
 	texture.height = 0
+	texture.layers = 0
 	texture.fbo = 0
 	logger.Log(logger.DEBUG, "Texture deleted:", texture)
 }
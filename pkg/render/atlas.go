@@ -0,0 +1,367 @@
+package render
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+	"github.com/hismailbulut/Neoray/pkg/fontkit"
+	"github.com/hismailbulut/Neoray/pkg/logger"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	UNDERCURL_GLYPH_ID = 0xfffffffffffffffe // "Undercurl"
+)
+
+// Position of an image in the atlas. Layer is the page of the atlas texture
+// the image drawn to.
+type AtlasPos struct {
+	common.Rectangle[int]
+	Layer int
+}
+
+func (pos AtlasPos) String() string {
+	return fmt.Sprintf("AtlasPos(%v, Layer: %d)", pos.Rectangle, pos.Layer)
+}
+
+type Atlas struct {
+	kit             *fontkit.FontKit
+	wideKit         *fontkit.FontKit // used for double width characters if not nil
+	fontSize, dpi   float64
+	useBoxDrawing   bool
+	useBlockDrawing bool
+	// Negative values means calculate from font
+	underlineThickness float64
+	underlineOffset    float64
+	lineSpace          int
+	warmUp             string // glyphs rendered in background after every reset
+	texture            Texture
+	maxLayers          int
+	cache              map[uint64]AtlasPos
+	pen                common.Vector2[int]
+	layer              int // current page
+}
+
+func (atlas *Atlas) String() string {
+	return fmt.Sprintf("Atlas(Texture: %v, Font Size: %f, Pen: %v, Layer: %d)",
+		atlas.texture,
+		atlas.fontSize,
+		atlas.pen,
+		atlas.layer,
+	)
+}
+
+func NewAtlas(renderer Renderer, kit *fontkit.FontKit, size, dpi float64, useBoxDrawing, useBlockDrawing bool) *Atlas {
+	atlas := new(Atlas)
+	atlas.kit = kit
+	atlas.fontSize = size
+	atlas.dpi = dpi
+	atlas.useBoxDrawing = useBoxDrawing
+	atlas.useBlockDrawing = useBlockDrawing
+	atlas.underlineThickness = -1
+	atlas.underlineOffset = -1
+	// Every page of the atlas is a layer of an array texture
+	// 1024 * 1024 * RGBA8 = 4mib per page
+	// When a page is full we continue drawing to the next page and add
+	// layers to the texture if needed. Adding layers doesn't change the
+	// positions of the glyphs, so the cache stays valid.
+	info := renderer.Info()
+	pageSize := common.Min(1024, int(info.MaxTextureSize))
+	atlas.maxLayers = int(info.MaxArrayTextureLayers)
+	atlas.texture = renderer.CreateTexture(pageSize, pageSize)
+	atlas.cache = make(map[uint64]AtlasPos)
+	atlas.issueHack()
+	return atlas
+}
+
+func (atlas *Atlas) issueHack() {
+	// HACK
+	// I dont know why but if the renderer first draws a character
+	// between 0x2588 and 0x258F (unicode block characters) strange things
+	// happens. This is not happening before Neoray version 0.2
+	// To prevent this we just drawing 'a' first
+	// But this is not a real fix. TODO: We should address this
+	// We are doing this every time atlas recreated
+	// Try change 'a' to one of characters in range [0x2588, 0x258F] and see the result
+	atlas.GetCharPos('a', false, false, false, false, atlas.ImageSize())
+}
+
+func (atlas *Atlas) FontKit() *fontkit.FontKit {
+	if atlas.kit != nil {
+		return atlas.kit
+	}
+	return fontkit.Default()
+}
+
+func (atlas *Atlas) SetFontKit(kit *fontkit.FontKit) {
+	atlas.kit = kit
+	atlas.Reset()
+}
+
+// Sets the font kit used for double width characters, nil means use the
+// same font kit with other characters
+func (atlas *Atlas) SetWideFontKit(kit *fontkit.FontKit) {
+	if kit == atlas.wideKit {
+		return
+	}
+	atlas.wideKit = kit
+	atlas.Reset()
+}
+
+func (atlas *Atlas) FontSize() float64 {
+	return atlas.fontSize
+}
+
+func (atlas *Atlas) SetFontSize(fontSize, dpi float64) {
+	atlas.fontSize = fontSize
+	atlas.dpi = dpi
+	atlas.Reset()
+}
+
+func (atlas *Atlas) SetBoxDrawing(useBoxDrawing, useBlockDrawing bool) {
+	atlas.useBoxDrawing = useBoxDrawing
+	atlas.useBlockDrawing = useBlockDrawing
+	atlas.Reset()
+}
+
+// Thickness and offset are in pixels, negative values means use the values
+// from the font
+func (atlas *Atlas) SetUnderline(thickness, offset float64) {
+	if thickness == atlas.underlineThickness && offset == atlas.underlineOffset {
+		return
+	}
+	atlas.underlineThickness = thickness
+	atlas.underlineOffset = offset
+	atlas.Reset()
+}
+
+// Line space is the extra pixels added to the height of the cells
+func (atlas *Atlas) SetLineSpace(lineSpace int) {
+	if lineSpace == atlas.lineSpace {
+		return
+	}
+	atlas.lineSpace = lineSpace
+	atlas.Reset()
+}
+
+func (atlas *Atlas) faceParams() fontkit.FaceParams {
+	return fontkit.FaceParams{
+		Size:               atlas.fontSize,
+		DPI:                atlas.dpi,
+		UseBoxDrawing:      atlas.useBoxDrawing,
+		UseBlockDrawing:    atlas.useBlockDrawing,
+		UnderlineThickness: atlas.underlineThickness,
+		UnderlineOffset:    atlas.underlineOffset,
+		LineSpace:          atlas.lineSpace,
+	}
+}
+
+func (atlas *Atlas) Reset() {
+	atlas.texture.Clear()
+	atlas.cache = make(map[uint64]AtlasPos)
+	atlas.pen = common.Vector2[int]{}
+	atlas.layer = 0
+	atlas.issueHack()
+	atlas.startWarmUp()
+}
+
+// Sets the glyphs rendered in background when the font changes, so the first
+// screen doesn't stutter while rendering them. Empty text disables it.
+func (atlas *Atlas) SetWarmUp(text string) {
+	if text == atlas.warmUp {
+		return
+	}
+	atlas.warmUp = text
+	atlas.startWarmUp()
+}
+
+func (atlas *Atlas) startWarmUp() {
+	if atlas.warmUp == "" {
+		return
+	}
+	kit := atlas.FontKit()
+	params := atlas.faceParams()
+	imgSize := atlas.ImageSize()
+	started := make(map[*fontkit.Font]bool)
+	for _, style := range [][2]bool{{false, false}, {true, false}, {false, true}, {true, true}} {
+		font := kit.SuitableFont(style[0], style[1])
+		if font != nil && !started[font] {
+			started[font] = true
+			font.WarmUp(params, atlas.warmUp, imgSize)
+		}
+	}
+}
+
+func (atlas *Atlas) ImageSize() common.Vector2[int] {
+	face, err := atlas.FontKit().DefaultFont().CreateFace(atlas.faceParams())
+	if err != nil {
+		panic(err)
+	}
+	return face.ImageSize()
+}
+
+func getCharID(char rune, italic, bold, underline, strikethrough bool) uint64 {
+	id := uint64(char)
+	if italic {
+		id = id | uint64(1)<<32
+	}
+	if bold {
+		id = id | uint64(1)<<40
+	}
+	if underline {
+		id = id | uint64(1)<<48
+	}
+	if strikethrough {
+		id = id | uint64(1)<<56
+	}
+	return id
+}
+
+// Draws img to texture and returns position
+func (atlas *Atlas) drawImage(img *image.RGBA) AtlasPos {
+	textureSize := atlas.texture.Size()
+	// The image must fit to a page, this only happens with very big font sizes
+	if img.Rect.Dx() > textureSize.Width() || img.Rect.Dy() > textureSize.Height() {
+		// We must grow the texture
+		atlas.texture.Bind()
+		atlas.texture.Resize(textureSize.Width()*2, textureSize.Height()*2)
+		logger.Log(logger.DEBUG, "Atlas texture resized:", atlas.texture)
+		// Resizing texture also clears it, so we should also clear the cache
+		atlas.cache = make(map[uint64]AtlasPos)
+		atlas.pen = common.Vector2[int]{}
+		atlas.layer = 0
+		atlas.issueHack()
+		return atlas.drawImage(img)
+	}
+	// Check X
+	if atlas.pen.X+img.Rect.Dx() > textureSize.Width() {
+		atlas.pen.X = 0
+		atlas.pen.Y += img.Rect.Dy()
+	}
+	// Check Y
+	if atlas.pen.Y+img.Rect.Dy() > textureSize.Height() {
+		// This page is full, continue with the next one
+		atlas.pen = common.Vector2[int]{}
+		atlas.layer++
+		if atlas.layer >= atlas.texture.Layers() {
+			if atlas.texture.Layers() >= atlas.maxLayers {
+				// We can't add more pages, start over
+				logger.Log(logger.WARN, "Atlas reached maximum layer count", atlas.maxLayers, atlas.texture)
+				atlas.Reset()
+				return atlas.drawImage(img)
+			}
+			atlas.texture.AddLayers(1)
+			logger.Log(logger.DEBUG, "Atlas has", atlas.texture.Layers(), "pages:", atlas.texture)
+		}
+	}
+	// draw image to current pen
+	dest := AtlasPos{
+		Rectangle: common.Rect(atlas.pen.X, atlas.pen.Y, img.Rect.Dx(), img.Rect.Dy()),
+		Layer:     atlas.layer,
+	}
+	// We should bind texture before drawing to it
+	atlas.texture.Bind()
+	atlas.texture.Draw(img, dest.Rectangle, dest.Layer)
+	// increment pen
+	atlas.pen.X += img.Rect.Dx()
+	return dest
+}
+
+func (atlas *Atlas) drawChar(face *fontkit.Face, id uint64, char rune, underline, strikethrough bool, imgSize common.Vector2[int]) AtlasPos {
+	img := face.RenderChar(char, underline, strikethrough, imgSize)
+	if img == nil {
+		// Font says it has the glyph but couldn't render it
+		return atlas.unsupported(face, id, char, imgSize)
+	}
+	pos := atlas.drawImage(img)
+	atlas.cache[id] = pos
+	return pos
+}
+
+func (atlas *Atlas) suitableFont(char rune, bold, italic bool) (*fontkit.Font, bool) {
+	if atlas.wideKit != nil && runewidth.RuneWidth(char) == 2 {
+		if atlas.wideKit.SuitableFont(bold, italic).ContainsGlyph(char) {
+			return atlas.wideKit.SuitableFont(bold, italic), true
+		}
+	}
+	if atlas.FontKit().SuitableFont(bold, italic).ContainsGlyph(char) {
+		return atlas.FontKit().SuitableFont(bold, italic), true
+	}
+	if atlas.FontKit().DefaultFont().ContainsGlyph(char) {
+		return atlas.FontKit().DefaultFont(), true
+	}
+	if fontkit.Default().SuitableFont(bold, italic).ContainsGlyph(char) {
+		return fontkit.Default().SuitableFont(bold, italic), true
+	}
+	if fontkit.Default().DefaultFont().ContainsGlyph(char) {
+		return fontkit.Default().DefaultFont(), true
+	}
+	if font := fontkit.FallbackFor(char); font != nil {
+		return font, true
+	}
+	// Neither of the fonts supports this glyph
+	return atlas.FontKit().SuitableFont(bold, italic), false
+}
+
+// For the first time draws and caches undercurl image, returns image pos and true representing first time
+// After that uses cached image and returns false
+func (atlas *Atlas) Undercurl(imgSize common.Vector2[int]) (AtlasPos, bool) {
+	pos, ok := atlas.cache[UNDERCURL_GLYPH_ID]
+	if ok {
+		return pos, false
+	}
+	// Draw and cache
+	face, err := atlas.FontKit().DefaultFont().CreateFace(atlas.faceParams())
+	if err != nil {
+		panic(fmt.Errorf("face creation failed: %s", err))
+	}
+	img := face.RenderUndercurl(imgSize)
+	pos = atlas.drawImage(img)
+	atlas.cache[UNDERCURL_GLYPH_ID] = pos
+	return pos, true
+}
+
+// Draws a box with the codepoint of the char in it, so the user can notice
+// which characters are missing
+func (atlas *Atlas) unsupported(face *fontkit.Face, id uint64, char rune, imgSize common.Vector2[int]) AtlasPos {
+	img := face.RenderHexBox(char, imgSize)
+	pos := atlas.drawImage(img)
+	atlas.cache[id] = pos
+	return pos
+}
+
+func (atlas *Atlas) GetCharPos(char rune, bold, italic, underline, strikethrough bool, imgSize common.Vector2[int]) AtlasPos {
+	id := getCharID(char, italic, bold, underline, strikethrough)
+	pos, ok := atlas.cache[id]
+	if ok {
+		return pos
+	}
+	font, contains := atlas.suitableFont(char, bold, italic)
+	face, err := font.CreateFace(atlas.faceParams())
+	if err != nil {
+		panic(fmt.Errorf("face creation failed: %s", err))
+	}
+	if contains {
+		// Draw and cache
+		pos = atlas.drawChar(face, id, char, underline, strikethrough, imgSize)
+		return pos
+	} else {
+		// unsupported
+		return atlas.unsupported(face, id, char, imgSize)
+	}
+}
+
+// Normalization required when updating texture position to the gpu
+// Layer of the position doesn't need normalization
+func (atlas *Atlas) Normalize(pos AtlasPos) common.Rectangle[float32] {
+	return atlas.texture.Normalize(pos.Rectangle)
+}
+
+func (atlas *Atlas) BindTexture() {
+	atlas.texture.Bind()
+}
+
+func (atlas *Atlas) Destroy() {
+	atlas.texture.Delete()
+}
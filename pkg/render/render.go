@@ -0,0 +1,100 @@
+// Package render defines the interface between the editor and the rendering
+// backends. Editor only talks to these interfaces, so a backend can be
+// replaced without touching it, like a software renderer or a mock for the
+// tests. The font atlas is shared by every backend because it only draws to a
+// texture. The opengl package is the OpenGL 3.3 implementation.
+package render
+
+import (
+	"image"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+)
+
+type Info struct {
+	Version                string
+	Vendor                 string
+	Renderer               string
+	ShadingLanguageVersion string
+	MaxTextureSize         int32
+	MaxArrayTextureLayers  int32
+}
+
+// Renderer is created per window and renders to the window. Rectangles given
+// to the viewport, scissor and reading pixels starts from bottom left corner.
+type Renderer interface {
+	Info() Info
+	SetViewport(rect common.Rectangle[int])
+	// Colors are converted from sRGB to the colors of the display. Matrix
+	// converts linear colors and gamma is the tone response of the display.
+	SetColorTransform(matrix [3][3]float32, gamma [3]float32)
+	DisableColorTransform()
+	// Limits clearing and rendering to the rectangle
+	SetScissor(rect common.Rectangle[int])
+	DisableScissor()
+	ClearScreen(c common.Color)
+	// Blending is only enabled when rendering translucent grids, otherwise
+	// every grid replaces the pixels behind it.
+	SetBlending(enable bool)
+	// Returns the pixels of the rectangle from the top left corner
+	ReadPixels(rect common.Rectangle[int]) *image.RGBA
+	Flush()
+	CreateTexture(width, height int) Texture
+	CreateVertexBuffer(size int) VertexBuffer
+	Destroy()
+}
+
+// All textures are 2d array textures. A texture with a single layer behaves
+// like a normal 2d texture and the atlas uses multiple layers as pages.
+type Texture interface {
+	Size() common.Vector2[int]
+	Layers() int
+	// Texture must bound before resizing. Resizing keeps the layer count but
+	// clears the content of all layers.
+	Resize(width, height int)
+	// Adds count layers to the texture, the content of the existing layers
+	// are preserved and the new layers are cleared. Texture will be bound.
+	AddLayers(count int)
+	Clear()
+	Bind()
+	// Texture must bound before drawing
+	Draw(image *image.RGBA, dest common.Rectangle[int], layer int)
+	// Converts the rectangle to texture coordinates, 0 to 1
+	Normalize(pos common.Rectangle[int]) common.Rectangle[float32]
+	Delete()
+}
+
+// VertexBuffer holds a vertex for every cell. Vertices are kept in memory and
+// only the changed rows are uploaded when updating. Uniform setters apply to
+// every buffer until they are changed again.
+type VertexBuffer interface {
+	// Resizing clears the buffer
+	Resize(size int)
+	// Sets the number of vertices in a row, whole buffer is marked as dirty
+	SetRowSize(rowSize int)
+	Bind()
+	// Uploads the changed vertices, caller is responsible to bind the buffer
+	Update()
+	// Caller is responsible to bind the buffer and flush
+	Render()
+	SetProjection(rect common.Rectangle[float32])
+	SetUndercurlRect(rect common.Rectangle[float32], layer int)
+	// Foreground colors are adjusted to keep the contrast between foreground
+	// and background at least ratio. 1 disables it.
+	SetMinContrast(ratio float32)
+	// Backgrounds with negative alpha values will be drawn with this alpha
+	SetBackgroundAlpha(alpha float32)
+	// Final alpha of every pixel is multiplied with opacity
+	SetOpacity(opacity float32)
+	// Moves every vertex by offset pixels
+	SetOffset(offset common.Vector2[float32])
+	Destroy()
+	SetIndexPos(index int, pos common.Rectangle[float32])
+	SetIndexTex1(index int, tex1 common.Rectangle[float32], layer int)
+	SetIndexTex2(index int, tex2 common.Rectangle[float32], layer int)
+	SetIndexFg(index int, fg common.Color)
+	SetIndexBg(index int, bg common.Color)
+	SetIndexSp(index int, sp common.Color)
+	CopyButPos(dst, src int)
+	VertexAt(index int) Vertex
+}
@@ -0,0 +1,38 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/hismailbulut/Neoray/pkg/common"
+)
+
+// Vertex is a cell. Every field is float32, backends may upload the vertices
+// directly in this layout.
+type Vertex struct {
+	// position of this vertex
+	Pos common.Rectangle[float32] // layout 0
+	// texture position
+	Tex1 common.Rectangle[float32] // layout 1
+	// second texture position used for multiwidth characters
+	Tex2 common.Rectangle[float32] // layout 2
+	// foreground color
+	Fg common.Color // layout 3
+	// background color
+	Bg common.Color // layout 4
+	// special color
+	Sp common.Color // layout 5
+	// atlas layers of the first and second textures
+	Layers common.Vector2[float32] // layout 6
+}
+
+func (vertex Vertex) String() string {
+	return fmt.Sprintf("Vertex(pos: %v, tex1: %v, tex2: %v, fg: %v, bg: %v, sp: %v, layers: %v)",
+		vertex.Pos,
+		vertex.Tex1,
+		vertex.Tex2,
+		vertex.Fg,
+		vertex.Bg,
+		vertex.Sp,
+		vertex.Layers,
+	)
+}
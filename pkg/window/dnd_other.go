@@ -0,0 +1,21 @@
+//go:build !windows || !(amd64 || arm64)
+// +build !windows !amd64,!arm64
+
+package window
+
+// GLFW only accepts dropped files. Text drag and drop needs XDND on X11 and
+// NSDraggingSource on macOS, both are handled in the event loop of GLFW. OLE
+// callbacks take POINTL by value, it fits in one argument only on 64 bit
+// Windows.
+
+func (window *Window) initDragDrop() {}
+
+func (window *Window) destroyDragDrop() {}
+
+func (window *Window) TextDragSupported() bool {
+	return false
+}
+
+func (window *Window) StartTextDrag(text string) bool {
+	return false
+}
@@ -0,0 +1,370 @@
+//go:build windows && (amd64 || arm64)
+// +build windows
+// +build amd64 arm64
+
+package window
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// GLFW accepts dropped files with DragAcceptFiles, which can't receive text
+// and can't start a drag. We register our own OLE drop target instead, it
+// replaces the one of GLFW, and implement a data object for dragging text out.
+// COM methods are called by their index in the virtual method table, indices
+// are taken from oleidl.h and objidl.h
+
+const (
+	// IDataObject
+	iDataObjectGetData      = 3
+	iDataObjectQueryGetData = 5
+)
+
+const (
+	S_OK                         = 0
+	E_NOINTERFACE                = 0x80004002
+	E_NOTIMPL                    = 0x80004001
+	E_OUTOFMEMORY                = 0x8007000E
+	DV_E_FORMATETC               = 0x80040064
+	OLE_E_ADVISENOTSUPPORTED     = 0x80040003
+	DRAGDROP_S_DROP              = 0x00040100
+	DRAGDROP_S_CANCEL            = 0x00040101
+	DRAGDROP_S_USEDEFAULTCURSORS = 0x00040102
+	DROPEFFECT_NONE              = 0
+	DROPEFFECT_COPY              = 1
+	MK_LBUTTON                   = 0x1
+	CF_UNICODETEXT               = 13
+	CF_HDROP                     = 15
+	DVASPECT_CONTENT             = 1
+	TYMED_HGLOBAL                = 1
+	DATADIR_GET                  = 1
+	GMEM_MOVEABLE                = 0x2
+	DRAGQUERYFILE_COUNT          = 0xFFFFFFFF
+	dragDropVtblSize             = 12
+)
+
+var (
+	ole32                     = windows.NewLazySystemDLL("ole32.dll")
+	procOleInitialize         = ole32.NewProc("OleInitialize")
+	procRegisterDragDrop      = ole32.NewProc("RegisterDragDrop")
+	procRevokeDragDrop        = ole32.NewProc("RevokeDragDrop")
+	procDoDragDrop            = ole32.NewProc("DoDragDrop")
+	procReleaseStgMedium      = ole32.NewProc("ReleaseStgMedium")
+	shell32                   = windows.NewLazySystemDLL("shell32.dll")
+	procDragQueryFileW        = shell32.NewProc("DragQueryFileW")
+	procSHCreateStdEnumFmtEtc = shell32.NewProc("SHCreateStdEnumFmtEtc")
+	procScreenToClient        = user32.NewProc("ScreenToClient")
+	kernel32                  = windows.NewLazySystemDLL("kernel32.dll")
+	procGlobalAlloc           = kernel32.NewProc("GlobalAlloc")
+	procGlobalLock            = kernel32.NewProc("GlobalLock")
+	procGlobalUnlock          = kernel32.NewProc("GlobalUnlock")
+
+	IID_IUnknown    = windows.GUID{Data1: 0x00000000, Data4: [8]byte{0xc0, 0, 0, 0, 0, 0, 0, 0x46}}
+	IID_IDataObject = windows.GUID{Data1: 0x0000010e, Data4: [8]byte{0xc0, 0, 0, 0, 0, 0, 0, 0x46}}
+	IID_IDropSource = windows.GUID{Data1: 0x00000121, Data4: [8]byte{0xc0, 0, 0, 0, 0, 0, 0, 0x46}}
+	IID_IDropTarget = windows.GUID{Data1: 0x00000122, Data4: [8]byte{0xc0, 0, 0, 0, 0, 0, 0, 0x46}}
+)
+
+type formatEtc struct {
+	cfFormat uint16
+	ptd      uintptr
+	dwAspect uint32
+	lindex   int32
+	tymed    uint32
+}
+
+type point struct {
+	x, y int32
+}
+
+type stgMedium struct {
+	tymed          uint32
+	hGlobal        uintptr
+	pUnkForRelease uintptr
+}
+
+type comObject struct {
+	vtbl *[dragDropVtblSize]uintptr
+}
+
+func (obj *comObject) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(obj.vtbl[method], append([]uintptr{uintptr(unsafe.Pointer(obj))}, args...)...)
+	return ret
+}
+
+func failed(hr uintptr) bool {
+	return int32(hr) < 0
+}
+
+func textFormat(format uint16) formatEtc {
+	return formatEtc{cfFormat: format, dwAspect: DVASPECT_CONTENT, lindex: -1, tymed: TYMED_HGLOBAL}
+}
+
+// Objects are static and there is only one window, so the reference counts
+// are ignored. Vtables are created once because callbacks are limited.
+var (
+	dragDropOnce   sync.Once
+	dragDropWindow *Window
+	dropAccepted   bool     // the object dragged over us has text or files
+	dragText       []uint16 // null terminated text we are dragging out
+	dropTarget     comObject
+	dropSource     comObject
+	dataObject     comObject
+	dropTargetVtbl [dragDropVtblSize]uintptr
+	dropSourceVtbl [dragDropVtblSize]uintptr
+	dataObjectVtbl [dragDropVtblSize]uintptr
+)
+
+func queryInterface(this uintptr, iid *windows.GUID, object *uintptr, own *windows.GUID) uintptr {
+	if *iid == IID_IUnknown || *iid == *own {
+		*object = this
+		return S_OK
+	}
+	*object = 0
+	return E_NOINTERFACE
+}
+
+func addRefRelease(this uintptr) uintptr {
+	return 1
+}
+
+func initDragDropObjects() {
+	// POINTL is passed by value, it fits in a single register on amd64
+	dropTargetVtbl = [dragDropVtblSize]uintptr{
+		syscall.NewCallback(func(this uintptr, iid *windows.GUID, object *uintptr) uintptr {
+			return queryInterface(this, iid, object, &IID_IDropTarget)
+		}),
+		syscall.NewCallback(addRefRelease),
+		syscall.NewCallback(addRefRelease),
+		// DragEnter
+		syscall.NewCallback(func(this uintptr, data *comObject, keyState, pt uintptr, effect *uint32) uintptr {
+			dropAccepted = hasFormat(data, CF_HDROP) || hasFormat(data, CF_UNICODETEXT)
+			*effect = dropEffect()
+			return S_OK
+		}),
+		// DragOver
+		syscall.NewCallback(func(this, keyState, pt uintptr, effect *uint32) uintptr {
+			*effect = dropEffect()
+			return S_OK
+		}),
+		// DragLeave
+		syscall.NewCallback(func(this uintptr) uintptr {
+			dropAccepted = false
+			return S_OK
+		}),
+		// Drop
+		syscall.NewCallback(func(this uintptr, data *comObject, keyState, pt uintptr, effect *uint32) uintptr {
+			*effect = dropEffect()
+			dropAccepted = false
+			handleDrop(data, int32(pt), int32(pt>>32))
+			return S_OK
+		}),
+	}
+	dropSourceVtbl = [dragDropVtblSize]uintptr{
+		syscall.NewCallback(func(this uintptr, iid *windows.GUID, object *uintptr) uintptr {
+			return queryInterface(this, iid, object, &IID_IDropSource)
+		}),
+		syscall.NewCallback(addRefRelease),
+		syscall.NewCallback(addRefRelease),
+		// QueryContinueDrag
+		syscall.NewCallback(func(this, escapePressed, keyState uintptr) uintptr {
+			if uint32(escapePressed) != 0 {
+				return DRAGDROP_S_CANCEL
+			}
+			if keyState&MK_LBUTTON == 0 {
+				return DRAGDROP_S_DROP
+			}
+			return S_OK
+		}),
+		// GiveFeedback
+		syscall.NewCallback(func(this, effect uintptr) uintptr {
+			return DRAGDROP_S_USEDEFAULTCURSORS
+		}),
+	}
+	dataObjectVtbl = [dragDropVtblSize]uintptr{
+		syscall.NewCallback(func(this uintptr, iid *windows.GUID, object *uintptr) uintptr {
+			return queryInterface(this, iid, object, &IID_IDataObject)
+		}),
+		syscall.NewCallback(addRefRelease),
+		syscall.NewCallback(addRefRelease),
+		// GetData, the receiver frees the memory
+		syscall.NewCallback(func(this uintptr, format *formatEtc, medium *stgMedium) uintptr {
+			if !isDragTextFormat(format) {
+				return DV_E_FORMATETC
+			}
+			size := uintptr(len(dragText) * 2)
+			hGlobal, _, _ := procGlobalAlloc.Call(GMEM_MOVEABLE, size)
+			if hGlobal == 0 {
+				return E_OUTOFMEMORY
+			}
+			ptr, _, _ := procGlobalLock.Call(hGlobal)
+			copy(unsafe.Slice((*uint16)(unsafe.Pointer(ptr)), len(dragText)), dragText)
+			procGlobalUnlock.Call(hGlobal)
+			*medium = stgMedium{tymed: TYMED_HGLOBAL, hGlobal: hGlobal}
+			return S_OK
+		}),
+		// GetDataHere
+		syscall.NewCallback(func(this, format, medium uintptr) uintptr {
+			return E_NOTIMPL
+		}),
+		// QueryGetData
+		syscall.NewCallback(func(this uintptr, format *formatEtc) uintptr {
+			if !isDragTextFormat(format) {
+				return DV_E_FORMATETC
+			}
+			return S_OK
+		}),
+		// GetCanonicalFormatEtc
+		syscall.NewCallback(func(this, format, formatOut uintptr) uintptr {
+			return E_NOTIMPL
+		}),
+		// SetData
+		syscall.NewCallback(func(this, format, medium, release uintptr) uintptr {
+			return E_NOTIMPL
+		}),
+		// EnumFormatEtc, shell has an enumerator for static formats
+		syscall.NewCallback(func(this, direction uintptr, enum *uintptr) uintptr {
+			*enum = 0
+			if direction != DATADIR_GET {
+				return E_NOTIMPL
+			}
+			format := textFormat(CF_UNICODETEXT)
+			hr, _, _ := procSHCreateStdEnumFmtEtc.Call(1, uintptr(unsafe.Pointer(&format)), uintptr(unsafe.Pointer(enum)))
+			return hr
+		}),
+		// DAdvise, DUnadvise and EnumDAdvise
+		syscall.NewCallback(func(this, format, flags, sink, connection uintptr) uintptr {
+			return OLE_E_ADVISENOTSUPPORTED
+		}),
+		syscall.NewCallback(func(this, connection uintptr) uintptr {
+			return OLE_E_ADVISENOTSUPPORTED
+		}),
+		syscall.NewCallback(func(this, enum uintptr) uintptr {
+			return OLE_E_ADVISENOTSUPPORTED
+		}),
+	}
+	dropTarget.vtbl = &dropTargetVtbl
+	dropSource.vtbl = &dropSourceVtbl
+	dataObject.vtbl = &dataObjectVtbl
+}
+
+func dropEffect() uint32 {
+	if dropAccepted {
+		return DROPEFFECT_COPY
+	}
+	return DROPEFFECT_NONE
+}
+
+func isDragTextFormat(format *formatEtc) bool {
+	return format.cfFormat == CF_UNICODETEXT && format.dwAspect == DVASPECT_CONTENT && format.tymed&TYMED_HGLOBAL != 0
+}
+
+func hasFormat(data *comObject, format uint16) bool {
+	etc := textFormat(format)
+	return data.call(iDataObjectQueryGetData, uintptr(unsafe.Pointer(&etc))) == S_OK
+}
+
+// Calls the function with the locked global memory of the format
+func withData(data *comObject, format uint16, f func(hGlobal, ptr uintptr)) bool {
+	etc := textFormat(format)
+	var medium stgMedium
+	if failed(data.call(iDataObjectGetData, uintptr(unsafe.Pointer(&etc)), uintptr(unsafe.Pointer(&medium)))) {
+		return false
+	}
+	defer procReleaseStgMedium.Call(uintptr(unsafe.Pointer(&medium)))
+	ptr, _, _ := procGlobalLock.Call(medium.hGlobal)
+	if ptr == 0 {
+		return false
+	}
+	defer procGlobalUnlock.Call(medium.hGlobal)
+	f(medium.hGlobal, ptr)
+	return true
+}
+
+// Files are preferred, explorer gives both the files and their names as text
+func handleDrop(data *comObject, x, y int32) {
+	window := dragDropWindow
+	if window == nil {
+		return
+	}
+	ok := withData(data, CF_HDROP, func(hGlobal, ptr uintptr) {
+		count, _, _ := procDragQueryFileW.Call(ptr, DRAGQUERYFILE_COUNT, 0, 0)
+		names := make([]string, 0, count)
+		for i := uintptr(0); i < count; i++ {
+			length, _, _ := procDragQueryFileW.Call(ptr, i, 0, 0)
+			buf := make([]uint16, length+1)
+			procDragQueryFileW.Call(ptr, i, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+			names = append(names, windows.UTF16ToString(buf))
+		}
+		window.events.Push(WindowEventDrop, names)
+	})
+	if ok {
+		return
+	}
+	withData(data, CF_UNICODETEXT, func(hGlobal, ptr uintptr) {
+		text := windows.UTF16PtrToString((*uint16)(unsafe.Pointer(ptr)))
+		pos := point{x: x, y: y}
+		hwnd := uintptr(unsafe.Pointer(window.handle.GetWin32Window()))
+		procScreenToClient.Call(hwnd, uintptr(unsafe.Pointer(&pos)))
+		window.events.Push(WindowEventTextDrop, text, float64(pos.x), float64(pos.y))
+	})
+}
+
+// Registers the window as a drop target, called once after the window created
+func (window *Window) initDragDrop() {
+	if ole32.Load() != nil || shell32.Load() != nil {
+		return
+	}
+	dragDropOnce.Do(initDragDropObjects)
+	// S_FALSE is returned if it is already initialized for the thread
+	if hr, _, _ := procOleInitialize.Call(0); failed(hr) {
+		return
+	}
+	hwnd := uintptr(unsafe.Pointer(window.handle.GetWin32Window()))
+	if hr, _, _ := procRegisterDragDrop.Call(hwnd, uintptr(unsafe.Pointer(&dropTarget))); failed(hr) {
+		return
+	}
+	dragDropWindow = window
+}
+
+func (window *Window) destroyDragDrop() {
+	if dragDropWindow == window {
+		hwnd := uintptr(unsafe.Pointer(window.handle.GetWin32Window()))
+		procRevokeDragDrop.Call(hwnd)
+		dragDropWindow = nil
+	}
+}
+
+// Returns true if the text can be dragged out of the window
+func (window *Window) TextDragSupported() bool {
+	return dragDropWindow == window
+}
+
+// Starts dragging the text to other applications, blocks until the text is
+// dropped or the drag is cancelled. The left mouse button must be held.
+// Returns true if the text is dropped somewhere, false if the drag is
+// cancelled or the platform is not supported.
+func (window *Window) StartTextDrag(text string) bool {
+	if dragDropWindow != window || text == "" {
+		return false
+	}
+	var err error
+	dragText, err = windows.UTF16FromString(text)
+	if err != nil {
+		// Text has a null character
+		return false
+	}
+	defer func() { dragText = nil }()
+	var effect uint32
+	hr, _, _ := procDoDragDrop.Call(
+		uintptr(unsafe.Pointer(&dataObject)),
+		uintptr(unsafe.Pointer(&dropSource)),
+		DROPEFFECT_COPY,
+		uintptr(unsafe.Pointer(&effect)),
+	)
+	return hr == DRAGDROP_S_DROP && effect != DROPEFFECT_NONE
+}
@@ -13,7 +13,10 @@ const (
 	WindowEventMouseMove
 	WindowEventScroll
 	WindowEventDrop
+	WindowEventTextDrop // Params: text, x and y position in the window
 	WindowEventScaleChanged
+	WindowEventMinimize // Params: true if minimized, false if restored
+	WindowEventFocus    // Params: true if focused, false if lost
 	WindowEventClose
 )
 
@@ -35,6 +38,14 @@ func (Type WindowEventType) String() string {
 		return "WindowEventScroll"
 	case WindowEventDrop:
 		return "WindowEventDrop"
+	case WindowEventTextDrop:
+		return "WindowEventTextDrop"
+	case WindowEventScaleChanged:
+		return "WindowEventScaleChanged"
+	case WindowEventMinimize:
+		return "WindowEventMinimize"
+	case WindowEventFocus:
+		return "WindowEventFocus"
 	case WindowEventClose:
 		return "WindowEventClose"
 	default:
@@ -0,0 +1,11 @@
+//go:build !((linux || freebsd || netbsd || openbsd) && !wayland)
+// +build !linux,!freebsd,!netbsd,!openbsd wayland
+
+package window
+
+// Windows and macOS have no Hyper modifier, keyboard tools send it as all the
+// other modifiers together. Wayland doesn't expose the keymap through GLFW.
+
+func (window *Window) IsHyperKey(scancode int) bool {
+	return false
+}
@@ -0,0 +1,31 @@
+//go:build (linux || freebsd || netbsd || openbsd) && !wayland
+// +build linux freebsd netbsd openbsd
+// +build !wayland
+
+package window
+
+// #cgo LDFLAGS: -lX11
+// #include <X11/XKBlib.h>
+// #include <X11/keysym.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Returns true if the key of the scancode is Hyper. GLFW reports Hyper as an
+// unknown key and its modifier as Super on most layouts, scancodes are the X11
+// keycodes and the keysym tells it.
+func (window *Window) IsHyperKey(scancode int) bool {
+	if scancode < 8 || scancode > 255 {
+		return false
+	}
+	display := (*C.Display)(unsafe.Pointer(glfw.GetX11Display()))
+	if display == nil {
+		return false
+	}
+	sym := C.XkbKeycodeToKeysym(display, C.KeyCode(scancode), 0, 0)
+	return sym == C.XK_Hyper_L || sym == C.XK_Hyper_R
+}
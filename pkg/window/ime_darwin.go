@@ -0,0 +1,62 @@
+package window
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+
+// Input source restored when the input method is opened
+static TISInputSourceRef savedSource = NULL;
+
+// Returns 1 if the current input source is not ASCII capable, like the input
+// methods of CJK languages, and saves it to restore later.
+static int currentSourceOpen(void) {
+	TISInputSourceRef source = TISCopyCurrentKeyboardInputSource();
+	if (source == NULL) {
+		return 0;
+	}
+	CFBooleanRef ascii = TISGetInputSourceProperty(source, kTISPropertyInputSourceIsASCIICapable);
+	if (ascii != NULL && CFBooleanGetValue(ascii)) {
+		CFRelease(source);
+		return 0;
+	}
+	if (savedSource != NULL) {
+		CFRelease(savedSource);
+	}
+	savedSource = source;
+	return 1;
+}
+
+// Selects the saved input source or an ASCII capable one, returns 0 if fails.
+static int selectSource(int open) {
+	if (open) {
+		return savedSource == NULL || TISSelectInputSource(savedSource) == noErr;
+	}
+	TISInputSourceRef source = TISCopyCurrentASCIICapableKeyboardInputSource();
+	if (source == NULL) {
+		return 0;
+	}
+	OSStatus err = TISSelectInputSource(source);
+	CFRelease(source);
+	return err == noErr;
+}
+*/
+import "C"
+
+// macOS has no open state, the input method is open when the input source is
+// not ASCII capable. Closing it selects an ASCII capable source, like the
+// keyboard layout, and opening it selects the last open source again.
+
+// Returns true if the input method of the window is open
+func (window *Window) IMEOpen() bool {
+	return C.currentSourceOpen() != 0
+}
+
+// Opens or closes the input method of the window. Returns false if the input
+// source can't be selected.
+func (window *Window) SetIMEOpen(open bool) bool {
+	var value C.int
+	if open {
+		value = 1
+	}
+	return C.selectSource(value) != 0
+}
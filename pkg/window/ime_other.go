@@ -0,0 +1,15 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package window
+
+// GLFW 3.3 has no input method api, and there is no common one on Linux. Input
+// methods like IBus and Fcitx can only be switched with their own interfaces.
+
+func (window *Window) IMEOpen() bool {
+	return false
+}
+
+func (window *Window) SetIMEOpen(open bool) bool {
+	return false
+}
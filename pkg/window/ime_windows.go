@@ -0,0 +1,52 @@
+package window
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	imm32                 = windows.NewLazySystemDLL("imm32.dll")
+	procImmGetContext     = imm32.NewProc("ImmGetContext")
+	procImmReleaseContext = imm32.NewProc("ImmReleaseContext")
+	procImmGetOpenStatus  = imm32.NewProc("ImmGetOpenStatus")
+	procImmSetOpenStatus  = imm32.NewProc("ImmSetOpenStatus")
+)
+
+// Calls the function with the input context of the window
+func (window *Window) withIMEContext(f func(himc uintptr)) bool {
+	if imm32.Load() != nil {
+		return false
+	}
+	hwnd := uintptr(unsafe.Pointer(window.handle.GetWin32Window()))
+	himc, _, _ := procImmGetContext.Call(hwnd)
+	if himc == 0 {
+		return false
+	}
+	defer procImmReleaseContext.Call(hwnd, himc)
+	f(himc)
+	return true
+}
+
+// Returns true if the input method of the window is open
+func (window *Window) IMEOpen() bool {
+	open := false
+	window.withIMEContext(func(himc uintptr) {
+		ret, _, _ := procImmGetOpenStatus.Call(himc)
+		open = ret != 0
+	})
+	return open
+}
+
+// Opens or closes the input method of the window. Returns false if the
+// platform is not supported.
+func (window *Window) SetIMEOpen(open bool) bool {
+	return window.withIMEContext(func(himc uintptr) {
+		var value uintptr
+		if open {
+			value = 1
+		}
+		procImmSetOpenStatus.Call(himc, value)
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package window
+
+// GLFW 3.3 doesn't give the color profile of the monitor. On Linux it is
+// stored in the _ICC_PROFILE property of the X root window or managed by
+// colord, users can give the profile file instead.
+
+func (window *Window) ColorProfilePath() string {
+	return ""
+}
@@ -0,0 +1,37 @@
+package window
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32             = windows.NewLazySystemDLL("user32.dll")
+	procGetDC          = user32.NewProc("GetDC")
+	procReleaseDC      = user32.NewProc("ReleaseDC")
+	gdi32              = windows.NewLazySystemDLL("gdi32.dll")
+	procGetICMProfileW = gdi32.NewProc("GetICMProfileW")
+)
+
+// Returns the path of the color profile of the monitor where the window is.
+// Returns empty string if the platform is not supported or monitor has no
+// profile.
+func (window *Window) ColorProfilePath() string {
+	if user32.Load() != nil || gdi32.Load() != nil {
+		return ""
+	}
+	hwnd := uintptr(unsafe.Pointer(window.handle.GetWin32Window()))
+	hdc, _, _ := procGetDC.Call(hwnd)
+	if hdc == 0 {
+		return ""
+	}
+	defer procReleaseDC.Call(hwnd, hdc)
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procGetICMProfileW.Call(hdc, uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&buf[0])))
+	if ret == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
@@ -8,26 +8,43 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/hismailbulut/Neoray/pkg/common"
 	"github.com/hismailbulut/Neoray/pkg/opengl"
+	"github.com/hismailbulut/Neoray/pkg/render"
+)
+
+type MouseShape int32
+
+const (
+	MouseShapeArrow   MouseShape = iota // Default shape
+	MouseShapeIBeam                     // Text
+	MouseShapeHResize                   // Vertical separators
+	MouseShapeVResize                   // Horizontal separators
 )
 
 type Window struct {
 	handle  *glfw.Window
 	context *opengl.Context
+	// Standard cursors are created when first used
+	cursors    map[MouseShape]*glfw.Cursor
+	mouseShape MouseShape
 	// info and cache
 	dims         common.Rectangle[int]   // window dimensions used for restoring window from fullscreen
+	doubleBuffer bool                    // frames are presented by swapping buffers
 	events       WindowEventStack        // Cached event stack
 	eventHandler func(event WindowEvent) // Event handler function will be called for every event at PollEvents call
 }
 
 // New creates a window and initializes an opengl context for it
-// Im order to use context just call GL function of window
+// In order to use context just call Renderer function of window
 // You must call the Show function to show the window
-func New(title string, width, height int, debugContext bool) (*Window, error) {
+// Window is single buffered unless doubleBuffer is true
+func New(title string, width, height int, debugContext, doubleBuffer bool) (*Window, error) {
 	if width <= 0 || height <= 0 {
 		return nil, errors.New("Window dimensions must bigger than zero")
 	}
 
 	window := new(Window)
+	window.cursors = make(map[MouseShape]*glfw.Cursor)
+	window.doubleBuffer = doubleBuffer
 
 	// Set opengl library version
 	// TODO: make it 2.1 (needs some research)
@@ -43,8 +60,13 @@ func New(title string, width, height int, debugContext bool) (*Window, error) {
 
 	// We are initializing window as hidden, and then we show it when mainloop begins
 	glfw.WindowHint(glfw.Visible, glfw.False)
-	// Framebuffer transparency not working on fullscreen when doublebuffer is on.
-	glfw.WindowHint(glfw.DoubleBuffer, glfw.False)
+	// Framebuffer transparency not working on fullscreen when doublebuffer is
+	// on. But single buffering flickers on some drivers, user can choose.
+	if doubleBuffer {
+		glfw.WindowHint(glfw.DoubleBuffer, glfw.True)
+	} else {
+		glfw.WindowHint(glfw.DoubleBuffer, glfw.False)
+	}
 	glfw.WindowHint(glfw.TransparentFramebuffer, glfw.True)
 	// Scales window width and height to monitor
 	glfw.WindowHint(glfw.ScaleToMonitor, glfw.True)
@@ -105,13 +127,39 @@ func New(title string, width, height int, debugContext bool) (*Window, error) {
 		window.events.Push(WindowEventScaleChanged)
 	})
 
+	window.handle.SetIconifyCallback(func(w *glfw.Window, iconified bool) {
+		window.events.Push(WindowEventMinimize, iconified)
+	})
+
+	window.handle.SetFocusCallback(func(w *glfw.Window, focused bool) {
+		window.events.Push(WindowEventFocus, focused)
+	})
+
+	// Text drops are pushed as WindowEventTextDrop where supported
+	window.initDragDrop()
+
 	return window, nil
 }
 
-func (window *Window) GL() *opengl.Context {
+// Returns the renderer of the window, which is opengl for now
+func (window *Window) Renderer() render.Renderer {
 	return window.context
 }
 
+func (window *Window) IsDoubleBuffered() bool {
+	return window.doubleBuffer
+}
+
+// Makes the rendered frame visible. Buffers are swapped when double buffered,
+// otherwise commands are flushed to the front buffer.
+func (window *Window) Present() {
+	if window.doubleBuffer {
+		window.handle.SwapBuffers()
+	} else {
+		window.context.Flush()
+	}
+}
+
 // You can use this if window closed by user but you don't want to close
 // Immediately call after WindowEventClose received
 func (window *Window) KeepAlive() {
@@ -163,9 +211,9 @@ func (window *Window) Viewport() common.Rectangle[int] {
 	return common.Rectangle[int]{X: 0, Y: 0, W: window.Size().Width(), H: window.Size().Height()}
 }
 
-func (window *Window) SetIcon(icons [3]image.Image) {
+func (window *Window) SetIcon(icons []image.Image) {
 	// Set icons, images must png
-	window.handle.SetIcon(icons[:])
+	window.handle.SetIcon(icons)
 }
 
 // Not working on win11
@@ -176,6 +224,11 @@ func (window *Window) Raise() {
 	window.handle.Focus()
 }
 
+// Flashes the taskbar entry or bounces the dock icon, depends on the platform
+func (window *Window) RequestAttention() {
+	window.handle.RequestAttention()
+}
+
 func (window *Window) Minimize() {
 	window.handle.Iconify()
 }
@@ -228,12 +281,46 @@ func (window *Window) HideMouseCursor() {
 	window.handle.SetInputMode(glfw.CursorMode, glfw.CursorHidden)
 }
 
+// Moves the mouse pointer to the position in the window
+func (window *Window) SetMousePos(pos common.Vector2[int]) {
+	window.handle.SetCursorPos(float64(pos.X), float64(pos.Y))
+}
+
+// Changes the shape of the mouse pointer when it is over the window
+func (window *Window) SetMouseShape(shape MouseShape) {
+	if shape == window.mouseShape {
+		return
+	}
+	window.mouseShape = shape
+	cursor, ok := window.cursors[shape]
+	if !ok {
+		switch shape {
+		case MouseShapeIBeam:
+			cursor = glfw.CreateStandardCursor(glfw.IBeamCursor)
+		case MouseShapeHResize:
+			cursor = glfw.CreateStandardCursor(glfw.HResizeCursor)
+		case MouseShapeVResize:
+			cursor = glfw.CreateStandardCursor(glfw.VResizeCursor)
+		default:
+			// nil is the default arrow
+		}
+		window.cursors[shape] = cursor
+	}
+	window.handle.SetCursor(cursor)
+}
+
 func (window *Window) DPI() float64 {
 	_, y := window.handle.GetContentScale()
 	return float64(96 * y)
 }
 
 func (window *Window) Destroy() {
+	for _, cursor := range window.cursors {
+		if cursor != nil {
+			cursor.Destroy()
+		}
+	}
+	window.destroyDragDrop()
 	window.context.Destroy()
 	window.handle.Destroy()
 }